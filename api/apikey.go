@@ -0,0 +1,131 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// Validate checks if the JSON request is valid.
+func (r *CreateAPIKeyRequest) Validate() error {
+	var v validator
+	v.required(r.Name, "name")
+	v.check(len(r.Scopes) > 0, "scopes", "are required")
+	for _, scope := range r.Scopes {
+		v.check(auth.IsValidScope(scope), "scopes", fmt.Sprintf("contain the invalid scope %q", scope))
+	}
+	return v.err()
+}
+
+// apiKey is a representation of an API key but as an API response.
+type apiKey struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenantId"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newAPIKeyResponse(key *domain.APIKey) apiKey {
+	return apiKey{
+		ID:        key.ID,
+		TenantID:  key.TenantID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+}
+
+// CreateAPIKeyResponse is the response when creating an API key.
+// It is the only time the plaintext key is revealed.
+type CreateAPIKeyResponse struct {
+	apiKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKey creates a new API key for the tenant of the caller.
+func (s *Server) CreateAPIKey(response http.ResponseWriter, request *http.Request) {
+	// parse and validate request JSON
+	requestJSON, ok := parseRequestJSON[CreateAPIKeyRequest](response, request)
+	if !ok {
+		return
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	key, plaintext, err := domain.NewAPIKey(tenant.ID, requestJSON.Name, requestJSON.Scopes)
+	if err != nil {
+		WriteErrorResponse(response, http.StatusInternalServerError, []string{
+			"Unable to create api key",
+		})
+		return
+	}
+
+	err = s.apiKeyStore.Add(request.Context(), key)
+	if err != nil {
+		writeError(response, err, "Unable to save api key")
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, CreateAPIKeyResponse{
+		apiKey: newAPIKeyResponse(key),
+		Key:    plaintext,
+	})
+}
+
+// ListAPIKeys lists all API keys of the tenant of the caller.
+func (s *Server) ListAPIKeys(response http.ResponseWriter, request *http.Request) {
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	keys, err := s.apiKeyStore.List(request.Context(), tenant.ID)
+	if err != nil {
+		writeError(response, err, "Unable to list api keys")
+		return
+	}
+
+	result := make([]apiKey, len(keys))
+	for i, key := range keys {
+		result[i] = newAPIKeyResponse(key)
+	}
+
+	WriteAPIResponse(response, http.StatusOK, result)
+}
+
+// DeleteAPIKey revokes an API key of the tenant of the caller.
+func (s *Server) DeleteAPIKey(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if strings.TrimSpace(id) == "" {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"id is required",
+		})
+		return
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	err := s.apiKeyStore.Delete(request.Context(), tenant.ID, id)
+	if err != nil {
+		writeError(response, err, "Could not delete api key")
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
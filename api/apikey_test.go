@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+// helper to create a test Server with API key authentication and a bootstrap admin key
+func newAuthTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	srv := newTestServer(t)
+	keys := persistence.NewInMemoryAPIKeyStore()
+	admin, plaintext, err := domain.NewAPIKey(domain.DefaultTenantID, "admin", []string{auth.ScopeAdmin})
+	if err != nil {
+		t.Fatalf("NewAPIKey error: %v", err)
+	}
+	if err := keys.Add(context.Background(), admin); err != nil {
+		t.Fatalf("add key: %v", err)
+	}
+	srv.apiKeyStore = keys
+	srv.authenticator = auth.NewAPIKeyAuthenticator(keys)
+	return srv, plaintext
+}
+
+// helper to send a request through the full routing of the server
+func doHandlerReq(t *testing.T, srv *Server, method, target string, headers map[string]string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPIKeys_RequireAuthentication(t *testing.T) {
+	srv, adminKey := newAuthTestServer(t)
+
+	rr := doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device", nil, nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without key, got %d", rr.Code)
+	}
+	if rr.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected WWW-Authenticate header")
+	}
+	var erresp ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &erresp); err != nil || len(erresp.Errors) == 0 {
+		t.Fatalf("expected ErrorResponse, got %s", rr.Body.String())
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device", map[string]string{auth.APIKeyHeader: "ssk_invalid"}, nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with invalid key, got %d", rr.Code)
+	}
+
+	// the admin key lacks devices:read
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device", map[string]string{auth.APIKeyHeader: adminKey}, nil)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without scope, got %d", rr.Code)
+	}
+
+	// health stays public
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/health", nil, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for health, got %d", rr.Code)
+	}
+}
+
+func TestAPIKeys_ManageAndUse(t *testing.T) {
+	srv, adminKey := newAuthTestServer(t)
+	admin := map[string]string{auth.APIKeyHeader: adminKey}
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/api-keys", admin, CreateAPIKeyRequest{Name: "x", Scopes: []string{"unknown"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown scope, got %d", rr.Code)
+	}
+
+	create := CreateAPIKeyRequest{Name: "pos", Scopes: []string{auth.ScopeDevicesWrite, auth.ScopeSign}}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/api-keys", admin, create)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created struct {
+		Data struct {
+			ID  string `json:"id"`
+			Key string `json:"key"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	pos := map[string]string{auth.APIKeyHeader: created.Data.Key}
+
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", pos, CreateSignatureDeviceRequest{Algorithm: crypto.ECC, Label: "pos"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device", pos, nil)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without devices:read, got %d", rr.Code)
+	}
+
+	// an authenticated caller can not act for another tenant
+	pos[TenantHeader] = "acme"
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", pos, CreateSignatureDeviceRequest{Algorithm: crypto.ECC, Label: "pos"})
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for foreign tenant, got %d", rr.Code)
+	}
+	delete(pos, TenantHeader)
+
+	// listing never reveals keys
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/api-keys", admin, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if bytes.Contains(rr.Body.Bytes(), []byte(created.Data.Key)) {
+		t.Fatalf("listing must not reveal the plaintext key")
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodDelete, "/api/v0/api-keys/"+created.Data.ID, admin, nil)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", pos, CreateSignatureDeviceRequest{Algorithm: crypto.ECC, Label: "pos"})
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with revoked key, got %d", rr.Code)
+	}
+}
+
+// failingAuthenticator fails like an authenticator whose key store or JWKS endpoint is unreachable
+type failingAuthenticator struct{}
+
+func (failingAuthenticator) Authenticate(*http.Request) (auth.Identity, error) {
+	return auth.Identity{}, errors.New("dial tcp 10.0.0.7:6379: connection refused")
+}
+
+func TestAPIKeys_AuthenticatorFailure(t *testing.T) {
+	srv := newTestServer(t)
+	srv.authenticator = failingAuthenticator{}
+
+	rr := doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device", nil, nil)
+	assertProblem(t, rr, http.StatusInternalServerError, ProblemInternal)
+	if strings.Contains(rr.Body.String(), "10.0.0.7") {
+		t.Fatalf("authenticator error leaked into the response: %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ksrichard/signing-service-challenge/auth"
+)
+
+// requireScope wraps a handler so it is only served to callers authenticated with the given scope.
+// The identity of the caller is stored in the request context.
+// If the server has no authenticator, authentication is disabled and every request is served.
+func (s *Server) requireScope(scope auth.Scope, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if s.authenticator == nil {
+			next(response, request)
+			return
+		}
+
+		identity, err := s.authenticator.Authenticate(request)
+		if writeContextError(response, err) {
+			return
+		}
+		if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+			if challenger, ok := s.authenticator.(auth.Challenger); ok {
+				response.Header().Set("WWW-Authenticate", challenger.Challenge())
+			}
+			WriteErrorResponse(response, http.StatusUnauthorized, []string{
+				fmt.Sprintf("Authentication failed: %s", err.Error()),
+			})
+			return
+		}
+		if err != nil {
+			writeError(response, err, "Unable to authenticate request")
+			return
+		}
+
+		if !identity.HasScope(scope) {
+			WriteErrorResponse(response, http.StatusForbidden, []string{
+				fmt.Sprintf("Missing required scope: %s", scope),
+			})
+			return
+		}
+
+		next(response, request.WithContext(auth.WithIdentity(request.Context(), identity)))
+	})
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+// GetConfig returns the effective configuration of the service, without secrets.
+// It covers every tenant, so only the admins of the default tenant, which operates the service, may read it.
+func (s *Server) GetConfig(response http.ResponseWriter, request *http.Request) {
+	if identity, ok := auth.IdentityFromContext(request.Context()); ok && identity.TenantID != domain.DefaultTenantID {
+		WriteErrorResponse(response, http.StatusForbidden, []string{
+			"The configuration of the service is only available to admins of the default tenant",
+		})
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, s.config)
+}
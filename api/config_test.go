@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/config"
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+func TestGetConfig_AdminOnly(t *testing.T) {
+	srv, adminKey := newAuthTestServer(t)
+	cfg := config.Default()
+	cfg.Store = config.StoreConfig{Backend: config.StoreRedis, DSN: "redis://:secret@localhost:6379/0"}
+	srv.config = cfg.Redacted()
+
+	rr := doHandlerReq(t, srv, http.MethodGet, "/api/v0/admin/config", nil, nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without key, got %d", rr.Code)
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/admin/config", map[string]string{auth.APIKeyHeader: adminKey}, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"listen_address": ":8080"`) || strings.Contains(rr.Body.String(), "secret") {
+		t.Fatalf("unexpected config response: %s", rr.Body.String())
+	}
+
+	// admins of other tenants must not see the settings of every tenant
+	tenantAdmin, plaintext, err := domain.NewAPIKey("acme", "admin", []string{auth.ScopeAdmin})
+	if err != nil {
+		t.Fatalf("NewAPIKey error: %v", err)
+	}
+	if err := srv.apiKeyStore.Add(context.Background(), tenantAdmin); err != nil {
+		t.Fatalf("add key: %v", err)
+	}
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v1/admin/config", map[string]string{auth.APIKeyHeader: plaintext}, nil)
+	assertProblem(t, rr, http.StatusForbidden, ProblemForbidden)
+	if strings.Contains(rr.Body.String(), "listen_address") {
+		t.Fatalf("config leaked to a tenant admin: %s", rr.Body.String())
+	}
+}
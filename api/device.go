@@ -1,14 +1,13 @@
 package api
 
 import (
-	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 
 	"github.com/ksrichard/signing-service-challenge/crypto"
 	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
 )
 
 type CreateSignatureDeviceRequest struct {
@@ -18,13 +17,9 @@ type CreateSignatureDeviceRequest struct {
 
 // Validate checks if the JSON request is valid.
 func (r *CreateSignatureDeviceRequest) Validate() error {
-	// validate algorithm
-	switch r.Algorithm {
-	case crypto.RSA, crypto.ECC:
-		return nil
-	}
-
-	return errors.New("invalid algorithm")
+	var v validator
+	v.check(r.Algorithm == crypto.RSA || r.Algorithm == crypto.ECC, "algorithm", fmt.Sprintf("must be %s or %s", crypto.RSA, crypto.ECC))
+	return v.err()
 }
 
 // CreateSignatureDeviceResponse is the response when creating a signature device.
@@ -39,67 +34,90 @@ func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *ht
 	if !ok {
 		return
 	}
-	if err := requestJSON.Validate(); err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			fmt.Sprintf("Request validation failed: %s", err.Error()),
-		})
+
+	device, ok := s.createSignatureDevice(response, request, requestJSON)
+	if !ok {
 		return
 	}
 
+	WriteAPIResponse(response, http.StatusOK, CreateSignatureDeviceResponse{
+		ID: device.GetIDStr(),
+	})
+}
+
+// createSignatureDevice creates and saves a new signature device of the request tenant, shared by the API versions.
+// If the second return value is false, the handler must return because there was an error.
+func (s *Server) createSignatureDevice(response http.ResponseWriter, request *http.Request, requestJSON *CreateSignatureDeviceRequest) (*domain.SignatureDevice, bool) {
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return nil, false
+	}
+
 	// create new signature device
-	device, err := domain.NewSignatureDevice(s.keyGeneratorStore, s.signerStore, requestJSON.Algorithm, requestJSON.Label)
+	device, err := domain.NewSignatureDevice(request.Context(), s.keyGeneratorStore, s.signerStore, tenant.ID, requestJSON.Algorithm, requestJSON.Label)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			"Unable to create signature device",
-		})
-		return
+		writeError(response, err, "Unable to create signature device")
+		return nil, false
 	}
 
-	err = s.deviceStore.Add(device)
+	err = s.deviceStore.Add(request.Context(), device, tenant.MaxDevices)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			"Unable to save signature device",
-		})
-		return
+		writeError(response, err, "Unable to save signature device")
+		return nil, false
 	}
 
-	log.Printf("New signature device (%s) saved: %q\n", requestJSON.Algorithm, device.GetIDStr())
-
-	WriteAPIResponse(response, http.StatusOK, CreateSignatureDeviceResponse{
-		ID: device.GetIDStr(),
-	})
+	logDeviceID(request.Context(), device.GetIDStr())
+	s.requestLogger(request.Context()).Info("signature device created",
+		"tenant_id", tenant.ID, "device_id", device.GetIDStr(), "algorithm", requestJSON.Algorithm)
+	s.publish(domain.EventDeviceCreated, tenant.ID, device.GetIDStr(), newSignatureDevice(device))
+	return device, true
 }
 
 // signatureDevice is a representation of a signature device but as an API response.
 type signatureDevice struct {
 	ID               string                    `json:"id"`
+	TenantID         string                    `json:"tenantId"`
 	Algorithm        crypto.SignatureAlgorithm `json:"algorithm"`
 	PublicKey        []byte                    `json:"publicKey"`
 	Label            string                    `json:"label"`
+	State            domain.DeviceState        `json:"state"`
 	SignatureCounter uint64                    `json:"signatureCounter"`
+	KeyVersion       uint64                    `json:"keyVersion"`
+	PublicKeys       []domain.PublicKeyVersion `json:"publicKeys"`
+}
+
+func newSignatureDevice(device *domain.SignatureDevice) signatureDevice {
+	return signatureDevice{
+		ID:               device.GetIDStr(),
+		TenantID:         device.TenantID,
+		Algorithm:        device.Algorithm,
+		PublicKey:        device.PublicKey,
+		Label:            device.Label,
+		State:            device.State,
+		SignatureCounter: device.GetSignatureCounter(),
+		KeyVersion:       device.KeyVersion(),
+		PublicKeys:       device.PublicKeys(),
+	}
 }
 
 // ListSignatureDevices lists all signature devices.
 func (s *Server) ListSignatureDevices(response http.ResponseWriter, request *http.Request) {
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
 	// list devices
-	devices, err := s.deviceStore.List()
+	devices, err := s.deviceStore.List(request.Context(), tenant.ID)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			fmt.Sprintf("Unable to list signature devices: %s", err.Error()),
-		})
+		writeError(response, err, "Unable to list signature devices")
 		return
 	}
 
 	// convert to API response
 	result := make([]signatureDevice, len(devices))
 	for i, device := range devices {
-		result[i] = signatureDevice{
-			ID:               device.GetIDStr(),
-			Algorithm:        device.Algorithm,
-			PublicKey:        device.PublicKey,
-			Label:            device.Label,
-			SignatureCounter: device.GetSignatureCounter(),
-		}
+		result[i] = newSignatureDevice(device)
 	}
 
 	WriteAPIResponse(response, http.StatusOK, result)
@@ -108,6 +126,7 @@ func (s *Server) ListSignatureDevices(response http.ResponseWriter, request *htt
 // GetSignatureDevice returns a single signature device.
 func (s *Server) GetSignatureDevice(response http.ResponseWriter, request *http.Request) {
 	id := request.PathValue("id")
+	logDeviceID(request.Context(), id)
 	if strings.TrimSpace(id) == "" {
 		WriteErrorResponse(response, http.StatusBadRequest, []string{
 			"id is required",
@@ -115,19 +134,117 @@ func (s *Server) GetSignatureDevice(response http.ResponseWriter, request *http.
 		return
 	}
 
-	device, err := s.deviceStore.Get(id)
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	device, err := s.deviceStore.Get(request.Context(), tenant.ID, id)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusNotFound, []string{
-			fmt.Sprintf("Could not retrieve signature device: %s", err.Error()),
-		})
+		writeError(response, err, "Could not retrieve signature device")
 		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, signatureDevice{
-		ID:               device.GetIDStr(),
-		Algorithm:        device.Algorithm,
-		PublicKey:        device.PublicKey,
-		Label:            device.Label,
-		SignatureCounter: device.GetSignatureCounter(),
+	WriteAPIResponse(response, http.StatusOK, newSignatureDevice(device))
+}
+
+type UpdateSignatureDeviceRequest struct {
+	State domain.DeviceState `json:"state"`
+}
+
+// Validate checks if the JSON request is valid.
+func (r *UpdateSignatureDeviceRequest) Validate() error {
+	var v validator
+	v.check(r.State.Valid(), "state", fmt.Sprintf("must be %q or %q", domain.StateActive, domain.StateSuspended))
+	return v.err()
+}
+
+// UpdateSignatureDevice changes the state of a signature device, e.g. suspends it.
+func (s *Server) UpdateSignatureDevice(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	logDeviceID(request.Context(), id)
+
+	// parse and validate request JSON
+	requestJSON, ok := parseRequestJSON[UpdateSignatureDeviceRequest](response, request)
+	if !ok {
+		return
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	device, err := s.deviceStore.Get(request.Context(), tenant.ID, id)
+	if err != nil {
+		writeError(response, err, "Could not retrieve signature device")
+		return
+	}
+	if device.State == requestJSON.State {
+		WriteAPIResponse(response, http.StatusOK, newSignatureDevice(device))
+		return
+	}
+
+	updated, err := s.deviceStore.SetState(request.Context(), tenant.ID, id, requestJSON.State)
+	if err != nil {
+		writeError(response, err, "Could not update signature device")
+		return
+	}
+
+	s.requestLogger(request.Context()).Info("signature device state changed",
+		"tenant_id", tenant.ID, "device_id", id, "state", updated.State, "previous_state", device.State)
+	s.publish(domain.EventDeviceStateChanged, tenant.ID, id, stateChangedEvent{
+		State:         updated.State,
+		PreviousState: device.State,
 	})
+
+	WriteAPIResponse(response, http.StatusOK, newSignatureDevice(updated))
+}
+
+// RotateSignatureDeviceKey replaces the key pair of a signature device. The signature chain continues
+// with the new key, signatures created before keep verifying with the previous public keys.
+func (s *Server) RotateSignatureDeviceKey(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	logDeviceID(request.Context(), id)
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	device, err := s.deviceStore.Get(request.Context(), tenant.ID, id)
+	if err != nil {
+		writeError(response, err, "Could not retrieve signature device")
+		return
+	}
+
+	// the key pair is generated once, concurrent signatures only move the point it takes over at
+	generator, err := s.keyGeneratorStore.Get(device.Algorithm)
+	if err != nil {
+		writeError(response, err, "Unable to rotate key")
+		return
+	}
+	public, private, err := generator.GenerateKeyPair(request.Context())
+	if err != nil {
+		writeError(response, err, "Unable to generate key pair")
+		return
+	}
+
+	rotated, err := persistence.RotateKey(request.Context(), s.deviceStore, s.signerStore, tenant.ID, id, public, private)
+	if err != nil {
+		writeError(response, err, "Unable to rotate key")
+		return
+	}
+
+	keys := rotated.PublicKeys()
+	current := keys[len(keys)-1]
+	s.requestLogger(request.Context()).Info("signature device key rotated",
+		"tenant_id", tenant.ID, "device_id", id, "key_version", current.Version, "first_counter", current.FirstCounter)
+	s.publish(domain.EventDeviceKeyRotated, tenant.ID, id, keyRotatedEvent{
+		KeyVersion:   current.Version,
+		PublicKey:    current.PublicKey,
+		FirstCounter: current.FirstCounter,
+	})
+
+	WriteAPIResponse(response, http.StatusOK, newSignatureDevice(rotated))
 }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,7 +18,7 @@ import (
 
 type failingGenerator struct{}
 
-func (f *failingGenerator) GenerateKeyPair() ([]byte, []byte, error) {
+func (f *failingGenerator) GenerateKeyPair(ctx context.Context) ([]byte, []byte, error) {
 	return nil, nil, assertErr("genfail")
 }
 
@@ -29,7 +30,9 @@ type failingStore struct {
 	persistence.InMemorySignatureDeviceStore
 }
 
-func (f *failingStore) Add(device *domain.SignatureDevice) error { return assertErr("addfail") }
+func (f *failingStore) Add(ctx context.Context, device *domain.SignatureDevice, maxDevices int) error {
+	return assertErr("addfail")
+}
 
 // helper to create a test Server with configurable stores
 func newTestServer(t *testing.T) *Server {
@@ -43,12 +46,14 @@ func newTestServer(t *testing.T) *Server {
 		crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
 	})
 	store := persistence.NewInMemorySignatureDeviceStore()
-	return NewServer(ServerParams{
+	srv := NewServer(ServerParams{
 		ListenAddress:     "",
 		SignerStore:       ss,
 		KeyGeneratorStore: kg,
 		DeviceStore:       store,
 	})
+	t.Cleanup(func() { srv.webhooks.Close() })
+	return srv
 }
 
 func doJSONReq(t *testing.T, handler http.HandlerFunc, method, target string, url *string, body any) *httptest.ResponseRecorder {
@@ -135,8 +140,8 @@ func TestCreateSignatureDevice_KeyGenFailure(t *testing.T) {
 	})
 	body := CreateSignatureDeviceRequest{Algorithm: crypto.RSA, Label: "x"}
 	rr := doJSONReq(t, srv.CreateSignatureDevice, http.MethodPost, "/api/v0/signature-device", nil, body)
-	if rr.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400, got %d", rr.Code)
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
 	}
 }
 
@@ -151,8 +156,8 @@ func TestCreateSignatureDevice_DeviceStoreAddFailure(t *testing.T) {
 	srv := NewServer(ServerParams{KeyGeneratorStore: kg, SignerStore: ss, DeviceStore: fs})
 	body := CreateSignatureDeviceRequest{Algorithm: crypto.RSA, Label: "x"}
 	rr := doJSONReq(t, srv.CreateSignatureDevice, http.MethodPost, "/api/v0/signature-device", nil, body)
-	if rr.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400, got %d", rr.Code)
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
 	}
 	var erresp ErrorResponse
 	_ = json.Unmarshal(rr.Body.Bytes(), &erresp)
@@ -165,11 +170,11 @@ func TestListSignatureDevices_Success(t *testing.T) {
 	srv := newTestServer(t)
 	// Pre-populate two devices
 	for _, alg := range []crypto.SignatureAlgorithm{crypto.RSA, crypto.ECC} {
-		dev, err := domain.NewSignatureDevice(srv.keyGeneratorStore, srv.signerStore, alg, string(alg)+"-label")
+		dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, alg, string(alg)+"-label")
 		if err != nil {
 			t.Fatalf("prep device: %v", err)
 		}
-		if err := srv.deviceStore.Add(dev); err != nil {
+		if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
 			t.Fatalf("add: %v", err)
 		}
 	}
@@ -199,11 +204,11 @@ func TestListSignatureDevices_Success(t *testing.T) {
 
 func TestGetSignatureDevice_Success(t *testing.T) {
 	srv := newTestServer(t)
-	dev, err := domain.NewSignatureDevice(srv.keyGeneratorStore, srv.signerStore, crypto.RSA, "lbl")
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.RSA, "lbl")
 	if err != nil {
 		t.Fatalf("create device: %v", err)
 	}
-	if err := srv.deviceStore.Add(dev); err != nil {
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
 		t.Fatalf("add: %v", err)
 	}
 	url := "/api/v0/signature-device/" + dev.GetIDStr()
@@ -234,3 +239,88 @@ func TestGetSignatureDevice_NotFound(t *testing.T) {
 		t.Fatalf("expected 404, got %d", rr.Code)
 	}
 }
+
+func TestUpdateSignatureDevice_Suspend(t *testing.T) {
+	srv := newTestServer(t)
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.ECC, "lbl")
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	target := "/api/v0/signature-device/" + dev.GetIDStr()
+
+	rr := doHandlerReq(t, srv, http.MethodPatch, target, nil, map[string]any{"state": "broken"})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown state, got %d", rr.Code)
+	}
+	rr = doHandlerReq(t, srv, http.MethodPatch, "/api/v0/signature-device/unknown", nil, UpdateSignatureDeviceRequest{State: domain.StateSuspended})
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	rr = doHandlerReq(t, srv, http.MethodPatch, target, nil, UpdateSignatureDeviceRequest{State: domain.StateSuspended})
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"state": "suspended"`) {
+		t.Fatalf("expected the suspended device, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: dev.GetIDStr(), Data: "data"})
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a suspended device, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = doHandlerReq(t, srv, http.MethodPatch, target, nil, UpdateSignatureDeviceRequest{State: domain.StateActive})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: dev.GetIDStr(), Data: "data"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 once active again, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRotateSignatureDeviceKey(t *testing.T) {
+	srv := newTestServer(t)
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.RSA, "lbl")
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	sign := func() SignTxResponse {
+		t.Helper()
+		rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: dev.GetIDStr(), Data: "data"})
+		var signed struct {
+			Data SignTxResponse `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &signed); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("sign: %d %s", rr.Code, rr.Body.String())
+		}
+		return signed.Data
+	}
+	before := sign()
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device/unknown/rotate-key", nil, nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device/"+dev.GetIDStr()+"/rotate-key", nil, nil)
+	var rotated struct {
+		Data signatureDevice `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &rotated); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("rotate: %d %s", rr.Code, rr.Body.String())
+	}
+	if rotated.Data.KeyVersion != 2 || len(rotated.Data.PublicKeys) != 2 || rotated.Data.PublicKeys[1].FirstCounter != 1 {
+		t.Fatalf("unexpected rotated device: %+v", rotated.Data)
+	}
+	after := sign()
+
+	// signatures of both key versions keep verifying
+	for _, signed := range []SignTxResponse{before, after} {
+		valid, err := srv.verifySignature(context.Background(), domain.DefaultTenantID, dev.GetIDStr(), signed.SignedData, signed.Signature)
+		if err != nil || !valid {
+			t.Fatalf("expected %q to verify, got %v, %v", signed.SignedData, valid, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+// stateChangedEvent is the data of a device.state_changed event.
+type stateChangedEvent struct {
+	State         domain.DeviceState `json:"state"`
+	PreviousState domain.DeviceState `json:"previousState"`
+}
+
+// keyRotatedEvent is the data of a device.key_rotated event.
+type keyRotatedEvent struct {
+	KeyVersion   uint64 `json:"keyVersion"`
+	PublicKey    []byte `json:"publicKey"`
+	FirstCounter uint64 `json:"firstCounter"`
+}
+
+// signatureCreatedEvent is the data of a signature.created event.
+type signatureCreatedEvent struct {
+	Counter    uint64 `json:"counter"`
+	Signature  string `json:"signature"`
+	SignedData string `json:"signedData"`
+	KeyVersion uint64 `json:"keyVersion"`
+}
+
+// legacySignatureCreatedEvent is the data of a signature.created event of the v0 event stream,
+// which repeats the signed data under its former name for existing subscribers.
+type legacySignatureCreatedEvent struct {
+	signatureCreatedEvent
+	LegacySignedData string `json:"signed_data"`
+}
+
+// Sequence numbers the signatures of a device by their counter, event streams resume from it.
+func (e signatureCreatedEvent) Sequence() uint64 {
+	return e.Counter
+}
+
+// publish notifies the subscribers (e.g. the webhook endpoints) of an event of a device, without blocking.
+func (s *Server) publish(eventType domain.EventType, tenantID string, deviceID string, data any) {
+	s.events.Publish(domain.NewEvent(eventType, tenantID, deviceID, data))
+}
+
+// newSignatureCreatedEvent returns the data of the signature.created event of a committed signature.
+func newSignatureCreatedEvent(result domain.SignDataResult) signatureCreatedEvent {
+	return signatureCreatedEvent{
+		Counter:    result.Counter,
+		Signature:  result.Signature,
+		SignedData: result.SignedData,
+		KeyVersion: result.KeyVersion,
+	}
+}
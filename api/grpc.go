@@ -0,0 +1,370 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ksrichard/signing-service-challenge/api/signingpb"
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcScopes are the scopes required by the gRPC methods, the same as by their REST counterparts.
+var grpcScopes = map[string]auth.Scope{
+	signingpb.SignatureDeviceService_CreateSignatureDevice_FullMethodName: auth.ScopeDevicesWrite,
+	signingpb.SignatureDeviceService_GetSignatureDevice_FullMethodName:    auth.ScopeDevicesRead,
+	signingpb.SignatureDeviceService_ListSignatureDevices_FullMethodName:  auth.ScopeDevicesRead,
+	signingpb.SignatureDeviceService_SignTransaction_FullMethodName:       auth.ScopeSign,
+	signingpb.SignatureDeviceService_VerifySignature_FullMethodName:       auth.ScopeDevicesRead,
+}
+
+// GRPCServer returns the gRPC server of the API. It shares the stores, authentication
+// and rate limits with the REST API, so both transports act on the same signature chains.
+func (s *Server) GRPCServer() *grpc.Server {
+	options := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(s.observeCalls, s.authenticateCall, s.limitClientCall),
+	}
+	if s.tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	signingpb.RegisterSignatureDeviceServiceServer(server, &grpcService{server: s})
+	return server
+}
+
+// observeCalls is the gRPC counterpart of observeRequests: it assigns each call a request ID,
+// returns it in the response header, logs the completed call and records it in the metrics.
+func (s *Server) observeCalls(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+
+	requestID := incomingMetadata(ctx, RequestIDHeader)
+	if !validRequestID.MatchString(requestID) {
+		requestID = uuid.NewString()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(RequestIDHeader), requestID))
+
+	entry := &requestLog{requestID: requestID}
+	response, err := handler(context.WithValue(ctx, requestLogKey{}, entry), req)
+
+	code := status.Code(err)
+	latency := time.Since(start)
+	s.metrics.ObserveCall(info.FullMethod, code.String(), latency)
+
+	attrs := []slog.Attr{
+		slog.String("request_id", requestID),
+		slog.String("method", info.FullMethod),
+		slog.String("code", code.String()),
+		slog.Duration("latency", latency),
+	}
+	span := trace.SpanFromContext(ctx)
+	if entry.deviceID != "" {
+		attrs = append(attrs, slog.String("device_id", entry.deviceID))
+		span.SetAttributes(attribute.String("device.id", entry.deviceID))
+	}
+	var internal *internalCallError
+	if errors.As(err, &internal) {
+		attrs = append(attrs, slog.String("error", internal.cause.Error()))
+	}
+	if spanContext := span.SpanContext(); spanContext.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	}
+	s.logger.LogAttrs(ctx, level, "request completed", attrs...)
+	return response, err
+}
+
+// authenticateCall is the gRPC counterpart of requireScope. The credentials are read from the
+// metadata (e.g. x-api-key or authorization) and the client certificate of the connection.
+func (s *Server) authenticateCall(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.authenticator == nil {
+		return handler(ctx, req)
+	}
+	scope, ok := grpcScopes[info.FullMethod]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "No scope grants access to %s", info.FullMethod)
+	}
+
+	identity, err := s.authenticator.Authenticate(authenticationRequest(ctx, info.FullMethod))
+	if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+		return nil, status.Errorf(codes.Unauthenticated, "Authentication failed: %s", err.Error())
+	}
+	if err != nil {
+		return nil, grpcError(err, "Unable to authenticate request")
+	}
+
+	if !identity.HasScope(scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "Missing required scope: %s", scope)
+	}
+
+	return handler(auth.WithIdentity(ctx, identity), req)
+}
+
+// limitClientCall is the gRPC counterpart of limitClient, calls count against the same buckets as requests.
+func (s *Server) limitClientCall(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	tenantID := strings.TrimSpace(incomingMetadata(ctx, TenantHeader))
+	client := "addr:"
+	if p, ok := peer.FromContext(ctx); ok {
+		client += hostOf(p.Addr.String())
+	}
+	if identity, ok := auth.IdentityFromContext(ctx); ok {
+		tenantID = identity.TenantID
+		client = "sub:" + identity.Subject
+	}
+	if tenantID == "" {
+		tenantID = domain.DefaultTenantID
+	}
+
+	if _, result := s.allowClientCall(tenantID, client); !result.Allowed {
+		return nil, resourceExhausted(ctx, result.RetryAfter, "Rate limit of the client exceeded")
+	}
+	return handler(ctx, req)
+}
+
+// authenticationRequest presents the metadata and the connection of a call as an HTTP request,
+// so the authenticators of the REST API can be used for gRPC calls as well.
+func authenticationRequest(ctx context.Context, fullMethod string) *http.Request {
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, fullMethod, nil)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		// pseudo headers like :authority are not credentials
+		if strings.HasPrefix(key, ":") {
+			continue
+		}
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		request.RemoteAddr = p.Addr.String()
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state := tlsInfo.State
+			request.TLS = &state
+		}
+	}
+	return request
+}
+
+// incomingMetadata returns the first value of the metadata key of the call, header names are accepted in any case.
+func incomingMetadata(ctx context.Context, key string) string {
+	values := metadata.ValueFromIncomingContext(ctx, strings.ToLower(key))
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// resourceExhausted returns the error of a rate limited call, telling the client when to retry in the retry-after header.
+func resourceExhausted(ctx context.Context, retryAfter time.Duration, message string) error {
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(max(1, ceilSeconds(retryAfter)))))
+	return status.Errorf(codes.ResourceExhausted, "%s, retry in %s", message, retryAfter.Round(time.Millisecond))
+}
+
+// grpcError converts an error of the shared service layer to a gRPC status, mirroring the status codes of the REST API.
+func grpcError(err error, message string) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "Request was cancelled")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "Request timed out")
+	case errors.Is(err, persistence.ErrDeviceNotFound):
+		code = codes.NotFound
+	case errors.Is(err, domain.ErrTenantQuotaExceeded):
+		code = codes.PermissionDenied
+	case errors.Is(err, domain.ErrDeviceNotActive):
+		code = codes.FailedPrecondition
+	case errors.Is(err, domain.ErrChainConflict):
+		code = codes.Aborted
+	case errors.Is(err, errSignatureEncoding), errors.Is(err, crypto.ErrUnsupportedAlgorithm), errors.Is(err, domain.ErrInvalidState):
+		code = codes.InvalidArgument
+	}
+	if code == codes.Internal {
+		// the error of a backend may reveal its internals, it is only logged with the call
+		return &internalCallError{status: status.New(codes.Internal, message), cause: err}
+	}
+	return status.Errorf(code, "%s: %s", message, err.Error())
+}
+
+// internalCallError is an internal error of a call: the client receives its status, observeCalls logs its cause.
+type internalCallError struct {
+	status *status.Status
+	cause  error
+}
+
+func (e *internalCallError) Error() string {
+	return e.status.Err().Error()
+}
+
+// GRPCStatus returns the status sent to the client.
+func (e *internalCallError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+// grpcService implements the gRPC API on top of the Server.
+type grpcService struct {
+	signingpb.UnimplementedSignatureDeviceServiceServer
+	server *Server
+}
+
+// callTenant resolves the tenant the call acts for, requested by the x-tenant-id metadata.
+func (g *grpcService) callTenant(ctx context.Context) (domain.Tenant, error) {
+	tenant, err := g.server.resolveTenant(ctx, incomingMetadata(ctx, TenantHeader))
+	switch {
+	case errors.Is(err, errForeignTenant):
+		return domain.Tenant{}, status.Errorf(codes.PermissionDenied, "Not allowed to act for tenant: %q", tenant.ID)
+	case errors.Is(err, persistence.ErrTenantNotFound):
+		return domain.Tenant{}, status.Errorf(codes.PermissionDenied, "Unknown tenant: %q", tenant.ID)
+	case err != nil:
+		return domain.Tenant{}, grpcError(err, "Unable to resolve tenant")
+	}
+	return tenant, nil
+}
+
+func (g *grpcService) CreateSignatureDevice(ctx context.Context, req *signingpb.CreateSignatureDeviceRequest) (*signingpb.CreateSignatureDeviceResponse, error) {
+	request := CreateSignatureDeviceRequest{Algorithm: crypto.SignatureAlgorithm(req.GetAlgorithm()), Label: req.GetLabel()}
+	if err := request.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Request validation failed: %s", err.Error())
+	}
+
+	tenant, err := g.callTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := domain.NewSignatureDevice(ctx, g.server.keyGeneratorStore, g.server.signerStore, tenant.ID, request.Algorithm, request.Label)
+	if err != nil {
+		return nil, grpcError(err, "Unable to create signature device")
+	}
+	if err := g.server.deviceStore.Add(ctx, device, tenant.MaxDevices); err != nil {
+		return nil, grpcError(err, "Unable to save signature device")
+	}
+
+	logDeviceID(ctx, device.GetIDStr())
+	g.server.requestLogger(ctx).Info("signature device created",
+		"tenant_id", tenant.ID, "device_id", device.GetIDStr(), "algorithm", request.Algorithm)
+	g.server.publish(domain.EventDeviceCreated, tenant.ID, device.GetIDStr(), newSignatureDevice(device))
+
+	return &signingpb.CreateSignatureDeviceResponse{Id: device.GetIDStr()}, nil
+}
+
+func (g *grpcService) GetSignatureDevice(ctx context.Context, req *signingpb.GetSignatureDeviceRequest) (*signingpb.SignatureDevice, error) {
+	logDeviceID(ctx, req.GetId())
+	if strings.TrimSpace(req.GetId()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	tenant, err := g.callTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := g.server.deviceStore.Get(ctx, tenant.ID, req.GetId())
+	if err != nil {
+		return nil, grpcError(err, "Could not retrieve signature device")
+	}
+	return newProtoSignatureDevice(device), nil
+}
+
+func (g *grpcService) ListSignatureDevices(ctx context.Context, req *signingpb.ListSignatureDevicesRequest) (*signingpb.ListSignatureDevicesResponse, error) {
+	tenant, err := g.callTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := g.server.deviceStore.List(ctx, tenant.ID)
+	if err != nil {
+		return nil, grpcError(err, "Unable to list signature devices")
+	}
+
+	result := make([]*signingpb.SignatureDevice, len(devices))
+	for i, device := range devices {
+		result[i] = newProtoSignatureDevice(device)
+	}
+	return &signingpb.ListSignatureDevicesResponse{Devices: result}, nil
+}
+
+func (g *grpcService) SignTransaction(ctx context.Context, req *signingpb.SignTransactionRequest) (*signingpb.SignTransactionResponse, error) {
+	request := SignTxRequest{DeviceID: req.GetDeviceId(), Data: req.GetData()}
+	if err := request.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Request validation failed: %s", err.Error())
+	}
+
+	tenant, err := g.callTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logDeviceID(ctx, request.DeviceID)
+	_, allowed, err := g.server.allowDeviceCall(ctx, tenant.ID, request.DeviceID, 1)
+	if err != nil {
+		return nil, grpcError(err, "Failed to sign data")
+	}
+	if !allowed.Allowed {
+		return nil, resourceExhausted(ctx, allowed.RetryAfter, "Rate limit of the signature device exceeded")
+	}
+
+	// sign data with the device and commit the new chain head, exactly like the REST API
+	result, err := persistence.SignData(ctx, g.server.deviceStore, tenant.ID, request.DeviceID, request.Data)
+	if err != nil {
+		return nil, grpcError(err, "Failed to sign data")
+	}
+	g.server.publish(domain.EventSignatureCreated, tenant.ID, request.DeviceID, newSignatureCreatedEvent(result))
+
+	return &signingpb.SignTransactionResponse{
+		Signature:  result.Signature,
+		SignedData: result.SignedData,
+		Counter:    result.Counter,
+	}, nil
+}
+
+func (g *grpcService) VerifySignature(ctx context.Context, req *signingpb.VerifySignatureRequest) (*signingpb.VerifySignatureResponse, error) {
+	request := VerifyTxRequest{DeviceID: req.GetDeviceId(), SignedData: req.GetSignedData(), Signature: req.GetSignature()}
+	if err := request.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Request validation failed: %s", err.Error())
+	}
+
+	tenant, err := g.callTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logDeviceID(ctx, request.DeviceID)
+
+	valid, err := g.server.verifySignature(ctx, tenant.ID, request.DeviceID, request.SignedData, request.Signature)
+	if err != nil {
+		return nil, grpcError(err, "Failed to verify signature")
+	}
+	return &signingpb.VerifySignatureResponse{Valid: valid}, nil
+}
+
+func newProtoSignatureDevice(device *domain.SignatureDevice) *signingpb.SignatureDevice {
+	return &signingpb.SignatureDevice{
+		Id:               device.GetIDStr(),
+		TenantId:         device.TenantID,
+		Algorithm:        string(device.Algorithm),
+		PublicKey:        device.PublicKey,
+		Label:            device.Label,
+		State:            string(device.State),
+		SignatureCounter: device.GetSignatureCounter(),
+	}
+}
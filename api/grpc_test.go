@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/api/signingpb"
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/logging"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// helper to serve the gRPC API of the server in memory and connect a client to it
+func newGRPCClient(t *testing.T, srv *Server) signingpb.SignatureDeviceServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := srv.GRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return signingpb.NewSignatureDeviceServiceClient(conn)
+}
+
+func TestGRPC_SharesSignatureChainWithREST(t *testing.T) {
+	srv := newTestServer(t)
+	client := newGRPCClient(t, srv)
+	ctx := context.Background()
+
+	created, err := client.CreateSignatureDevice(ctx, &signingpb.CreateSignatureDeviceRequest{Algorithm: "ECC", Label: "grpc"})
+	if err != nil {
+		t.Fatalf("CreateSignatureDevice error: %v", err)
+	}
+
+	// alternate between the transports, the counter advances across both
+	for counter := uint64(0); counter < 4; counter++ {
+		var signedData, signature string
+		if counter%2 == 0 {
+			signed, err := client.SignTransaction(ctx, &signingpb.SignTransactionRequest{DeviceId: created.GetId(), Data: "data"})
+			if err != nil {
+				t.Fatalf("SignTransaction error: %v", err)
+			}
+			if signed.GetCounter() != counter {
+				t.Fatalf("expected counter %d, got %d", counter, signed.GetCounter())
+			}
+			signedData, signature = signed.GetSignedData(), signed.GetSignature()
+		} else {
+			rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: created.GetId(), Data: "data"})
+			var signed struct {
+				Data SignTxResponse `json:"data"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &signed); err != nil {
+				t.Fatalf("unmarshal: %v (%s)", err, rr.Body.String())
+			}
+			signedData, signature = signed.Data.SignedData, signed.Data.Signature
+		}
+		if !strings.HasPrefix(signedData, fmt.Sprintf("%d_data_", counter)) {
+			t.Fatalf("expected signed data at counter %d, got %q", counter, signedData)
+		}
+
+		verified, err := client.VerifySignature(ctx, &signingpb.VerifySignatureRequest{DeviceId: created.GetId(), SignedData: signedData, Signature: signature})
+		if err != nil || !verified.GetValid() {
+			t.Fatalf("expected valid signature, got %v, %v", verified, err)
+		}
+	}
+
+	device, err := client.GetSignatureDevice(ctx, &signingpb.GetSignatureDeviceRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatalf("GetSignatureDevice error: %v", err)
+	}
+	if device.GetSignatureCounter() != 4 || device.GetState() != string(domain.StateActive) || len(device.GetPublicKey()) == 0 {
+		t.Fatalf("unexpected device: %v", device)
+	}
+	listed, err := client.ListSignatureDevices(ctx, &signingpb.ListSignatureDevicesRequest{})
+	if err != nil || len(listed.GetDevices()) != 1 {
+		t.Fatalf("expected one device, got %v, %v", listed, err)
+	}
+}
+
+func TestGRPC_Errors(t *testing.T) {
+	client := newGRPCClient(t, newTestServer(t))
+	ctx := context.Background()
+
+	_, err := client.CreateSignatureDevice(ctx, &signingpb.CreateSignatureDeviceRequest{Algorithm: "DSA"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	_, err = client.GetSignatureDevice(ctx, &signingpb.GetSignatureDeviceRequest{Id: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+	_, err = client.SignTransaction(ctx, &signingpb.SignTransactionRequest{DeviceId: "unknown", Data: "data"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+	_, err = client.VerifySignature(ctx, &signingpb.VerifySignatureRequest{DeviceId: "unknown", SignedData: "0_a_b", Signature: "%%%"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	unknownTenant := metadata.AppendToOutgoingContext(ctx, "x-tenant-id", "unknown")
+	_, err = client.ListSignatureDevices(unknownTenant, &signingpb.ListSignatureDevicesRequest{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestGRPC_Authentication(t *testing.T) {
+	srv, adminKey := newAuthTestServer(t)
+	client := newGRPCClient(t, srv)
+	ctx := context.Background()
+
+	_, err := client.ListSignatureDevices(ctx, &signingpb.ListSignatureDevicesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated without credentials, got %v", err)
+	}
+
+	// the admin key lacks the devices:read scope
+	adminCtx := metadata.AppendToOutgoingContext(ctx, strings.ToLower(auth.APIKeyHeader), adminKey)
+	_, err = client.ListSignatureDevices(adminCtx, &signingpb.ListSignatureDevicesRequest{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied without scope, got %v", err)
+	}
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/api-keys", map[string]string{auth.APIKeyHeader: adminKey},
+		map[string]any{"name": "reader", "scopes": []string{auth.ScopeDevicesRead}})
+	var created struct {
+		Data struct {
+			Key string `json:"key"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || created.Data.Key == "" {
+		t.Fatalf("create key: %v (%s)", err, rr.Body.String())
+	}
+	readerCtx := metadata.AppendToOutgoingContext(ctx, strings.ToLower(auth.APIKeyHeader), created.Data.Key)
+	if _, err := client.ListSignatureDevices(readerCtx, &signingpb.ListSignatureDevicesRequest{}); err != nil {
+		t.Fatalf("expected the reader key to list devices, got %v", err)
+	}
+	// authenticated callers can not act for other tenants
+	foreignCtx := metadata.AppendToOutgoingContext(readerCtx, "x-tenant-id", "acme")
+	if _, err := client.ListSignatureDevices(foreignCtx, &signingpb.ListSignatureDevicesRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for a foreign tenant, got %v", err)
+	}
+}
+
+func TestServerRun_ServesGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := newTestServer(t)
+	srv.listener, srv.grpcListener = listener, grpcListener
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx) }()
+
+	conn, err := grpc.NewClient(grpcListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc client: %v", err)
+	}
+	defer conn.Close()
+	client := signingpb.NewSignatureDeviceServiceClient(conn)
+	if _, err := client.ListSignatureDevices(ctx, &signingpb.ListSignatureDevicesRequest{}); err != nil {
+		t.Fatalf("ListSignatureDevices error: %v", err)
+	}
+
+	cancel()
+	if err := <-runErr; err != nil {
+		t.Fatalf("expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestGRPC_InternalErrors(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Level: "info", Format: logging.FormatJSON})
+	if err != nil {
+		t.Fatalf("logging.New error: %v", err)
+	}
+	srv := newTestServer(t)
+	srv.deviceStore = &failingStore{}
+	srv.logger = logger
+	client := newGRPCClient(t, srv)
+
+	// the cause of an internal error is logged with the call, but not returned to the client
+	_, err = client.CreateSignatureDevice(context.Background(), &signingpb.CreateSignatureDeviceRequest{Algorithm: "ECC"})
+	if status.Code(err) != codes.Internal || status.Convert(err).Message() != "Unable to save signature device" {
+		t.Fatalf("expected Internal without its cause, got %v", err)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("unmarshal log entry: %v (%s)", err, buf.String())
+	}
+	if entry["level"] != "ERROR" || entry["error"] != "addfail" {
+		t.Fatalf("expected the internal error in the log entry, got %v", entry)
+	}
+}
+
+func TestGRPC_ErrorCodes(t *testing.T) {
+	// typed errors map to the gRPC counterparts of their REST statuses
+	tests := map[error]codes.Code{
+		fmt.Errorf("commit: %w", domain.ErrChainConflict): codes.Aborted,
+		domain.ErrInvalidState:                            codes.InvalidArgument,
+		domain.ErrDeviceNotActive:                         codes.FailedPrecondition,
+		persistence.ErrDeviceNotFound:                     codes.NotFound,
+	}
+	for err, expected := range tests {
+		if got := status.Code(grpcError(err, "Failed")); got != expected {
+			t.Errorf("%v: expected %s, got %s", err, expected, got)
+		}
+	}
+}
@@ -1,18 +1,217 @@
 package api
 
-import "net/http"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"time"
 
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/version"
+)
+
+// Health check statuses, see https://datatracker.ietf.org/doc/html/draft-inadarei-api-health-check
+const (
+	HealthPass = "pass"
+	HealthWarn = "warn"
+	HealthFail = "fail"
+
+	HealthContentType = "application/health+json"
+
+	healthServiceID = "signing-service"
+	// readinessTimeout bounds all the checks of a readiness probe.
+	readinessTimeout = 5 * time.Second
+)
+
+// HealthResponse is the health of the service in the format of the IETF health check draft.
 type HealthResponse struct {
-	Status  string `json:"status"`
-	Version string `json:"version"`
+	Status      string                   `json:"status"`
+	Version     string                   `json:"version,omitempty"`
+	ReleaseID   string                   `json:"releaseId,omitempty"`
+	ServiceID   string                   `json:"serviceId,omitempty"`
+	Description string                   `json:"description,omitempty"`
+	Checks      map[string][]HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the result of checking a single component, the checks are keyed by "component:measurement".
+type HealthCheck struct {
+	ComponentID   string    `json:"componentId,omitempty"`
+	ComponentType string    `json:"componentType,omitempty"`
+	ObservedValue any       `json:"observedValue,omitempty"`
+	ObservedUnit  string    `json:"observedUnit,omitempty"`
+	Status        string    `json:"status"`
+	Time          time.Time `json:"time"`
+	Output        string    `json:"output,omitempty"`
+}
+
+// selfTestKey is the key pair an algorithm is self-tested with, generated on the first readiness probe.
+type selfTestKey struct {
+	public  []byte
+	private []byte
+}
+
+// Liveness reports whether the process is able to serve requests at all, without checking its dependencies.
+func (s *Server) Liveness(response http.ResponseWriter, request *http.Request) {
+	health := s.newHealthResponse("liveness of the signing service")
+	health.Checks = map[string][]HealthCheck{
+		"uptime": {{
+			ComponentType: "system",
+			ObservedValue: time.Since(s.startedAt).Seconds(),
+			ObservedUnit:  "s",
+			Status:        HealthPass,
+			Time:          time.Now().UTC(),
+		}},
+	}
+	writeHealthResponse(response, health)
+}
+
+// Readiness reports whether the service is able to sign: the device store has to be reachable,
+// every registered algorithm has to pass a sign/verify self-test and its key custody has to be available.
+// The details of failed checks are logged, the response only names the failing components.
+func (s *Server) Readiness(response http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), readinessTimeout)
+	defer cancel()
+
+	health := s.newHealthResponse("readiness of the signing service")
+	health.Checks = map[string][]HealthCheck{}
+	fail := func(check HealthCheck, output string, err error) HealthCheck {
+		s.requestLogger(request.Context()).Warn("health check failed", "component", check.ComponentType,
+			"component_id", check.ComponentID, "error", err)
+		check.Status = HealthFail
+		check.Output = output
+		return check
+	}
+
+	start := time.Now()
+	err := s.deviceStore.Ping(ctx)
+	check := HealthCheck{
+		ComponentType: "datastore",
+		ObservedValue: float64(time.Since(start).Microseconds()) / 1000,
+		ObservedUnit:  "ms",
+		Status:        HealthPass,
+		Time:          time.Now().UTC(),
+	}
+	if err != nil {
+		check = fail(check, "device store is unreachable", err)
+	}
+	health.Checks["store:responseTime"] = []HealthCheck{check}
+
+	for _, algorithm := range s.keyGeneratorStore.Algorithms() {
+		check := HealthCheck{
+			ComponentID:   string(algorithm),
+			ComponentType: "component",
+			Status:        HealthPass,
+		}
+
+		custody := check
+		if err := s.checkCustody(ctx, algorithm); err != nil {
+			custody = fail(custody, "key custody is unavailable", err)
+		}
+		custody.Time = time.Now().UTC()
+		health.Checks["keyCustody:status"] = append(health.Checks["keyCustody:status"], custody)
+
+		selfTest := check
+		if err := s.selfTest(ctx, algorithm); err != nil {
+			selfTest = fail(selfTest, "sign/verify self-test failed", err)
+		}
+		selfTest.Time = time.Now().UTC()
+		health.Checks["signer:selfTest"] = append(health.Checks["signer:selfTest"], selfTest)
+	}
+
+	for _, checks := range health.Checks {
+		for _, check := range checks {
+			if check.Status == HealthFail {
+				health.Status = HealthFail
+			}
+		}
+	}
+	writeHealthResponse(response, health)
+}
+
+// newHealthResponse returns a passing health response with the build information of the service.
+func (s *Server) newHealthResponse(description string) HealthResponse {
+	build := version.Get()
+	return HealthResponse{
+		Status:      HealthPass,
+		Version:     build.Version,
+		ReleaseID:   build.Commit,
+		ServiceID:   healthServiceID,
+		Description: description,
+	}
+}
+
+// checkCustody checks that the key custody of the algorithm's key generator is available.
+func (s *Server) checkCustody(ctx context.Context, algorithm crypto.SignatureAlgorithm) error {
+	generator, err := s.keyGeneratorStore.Get(algorithm)
+	if err != nil {
+		return err
+	}
+	return crypto.CheckCustody(ctx, generator)
 }
 
-// Health evaluates the health of the service and writes a standardized response.
-func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
-	health := HealthResponse{
-		Status:  "pass",
-		Version: "v0",
+// selfTest signs a random challenge with the algorithm and verifies the signature with its public key.
+func (s *Server) selfTest(ctx context.Context, algorithm crypto.SignatureAlgorithm) error {
+	key, err := s.selfTestKey(ctx, algorithm)
+	if err != nil {
+		return err
+	}
+	signer, err := s.signerStore.Get(algorithm, key.private)
+	if err != nil {
+		return err
+	}
+	verifier, err := s.verifierStore.Get(algorithm, key.public)
+	if err != nil {
+		return err
+	}
+
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return err
+	}
+	signature, err := signer.Sign(ctx, challenge)
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(challenge, signature)
+}
+
+// selfTestKey returns the self-test key pair of the algorithm, generating it on first use.
+func (s *Server) selfTestKey(ctx context.Context, algorithm crypto.SignatureAlgorithm) (selfTestKey, error) {
+	s.selfTestMutex.Lock()
+	defer s.selfTestMutex.Unlock()
+	if key, ok := s.selfTestKeys[algorithm]; ok {
+		return key, nil
+	}
+
+	generator, err := s.keyGeneratorStore.Get(algorithm)
+	if err != nil {
+		return selfTestKey{}, err
+	}
+	public, private, err := generator.GenerateKeyPair(ctx)
+	if err != nil {
+		return selfTestKey{}, err
+	}
+	key := selfTestKey{public: public, private: private}
+	s.selfTestKeys[algorithm] = key
+	return key, nil
+}
+
+// writeHealthResponse writes the health response, failing health is reported as 503 Service Unavailable.
+func writeHealthResponse(w http.ResponseWriter, health HealthResponse) {
+	code := http.StatusOK
+	if health.Status == HealthFail {
+		code = http.StatusServiceUnavailable
+	}
+
+	bytes, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		WriteInternalError(w)
+		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, health)
+	w.Header().Set("Content-Type", HealthContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(bytes)
 }
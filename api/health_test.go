@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+// unreachableStore fails every ping, like a store behind a broken network.
+type unreachableStore struct {
+	*persistence.InMemorySignatureDeviceStore
+}
+
+func (s *unreachableStore) Ping(ctx context.Context) error {
+	return assertErr("dial tcp 10.0.0.5:6379: connection refused")
+}
+
+// custodyGenerator is a key generator backed by an unavailable remote key custody.
+type custodyGenerator struct {
+	crypto.ECCGenerator
+}
+
+func (g *custodyGenerator) CheckCustody(ctx context.Context) error {
+	return assertErr("kms unavailable")
+}
+
+// brokenSigner produces signatures which never verify.
+type brokenSigner struct{}
+
+func (brokenSigner) Sign(ctx context.Context, dataToBeSigned []byte) ([]byte, error) {
+	return []byte("not a signature"), nil
+}
+
+func decodeHealth(t *testing.T, body []byte) HealthResponse {
+	t.Helper()
+	var health HealthResponse
+	if err := json.Unmarshal(body, &health); err != nil {
+		t.Fatalf("decode health: %v (%s)", err, body)
+	}
+	return health
+}
+
+// checkStatuses returns the status of every check by its key and component ID.
+func checkStatuses(health HealthResponse) map[string]string {
+	statuses := make(map[string]string)
+	for key, checks := range health.Checks {
+		for _, check := range checks {
+			statuses[key+"/"+check.ComponentID] = check.Status
+		}
+	}
+	return statuses
+}
+
+func TestLiveness(t *testing.T) {
+	srv := newTestServer(t)
+	for _, target := range []string{"/api/v0/health", "/api/v0/health/live"} {
+		rr := doHandlerReq(t, srv, http.MethodGet, target, nil, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", target, rr.Code)
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != HealthContentType {
+			t.Fatalf("%s: expected %s, got %q", target, HealthContentType, contentType)
+		}
+		health := decodeHealth(t, rr.Body.Bytes())
+		if health.Status != HealthPass || health.Version == "" || health.ServiceID == "" {
+			t.Fatalf("%s: unexpected health %+v", target, health)
+		}
+		if len(health.Checks["uptime"]) != 1 {
+			t.Fatalf("%s: expected an uptime check, got %+v", target, health.Checks)
+		}
+	}
+}
+
+func TestReadiness_Pass(t *testing.T) {
+	srv := newTestServer(t)
+	rr := doHandlerReq(t, srv, http.MethodGet, "/api/v0/health/ready", nil, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	health := decodeHealth(t, rr.Body.Bytes())
+	if health.Status != HealthPass {
+		t.Fatalf("expected pass, got %+v", health)
+	}
+	want := map[string]string{
+		"store:responseTime/":   HealthPass,
+		"keyCustody:status/ECC": HealthPass,
+		"keyCustody:status/RSA": HealthPass,
+		"signer:selfTest/ECC":   HealthPass,
+		"signer:selfTest/RSA":   HealthPass,
+	}
+	if got := checkStatuses(health); len(got) != len(want) {
+		t.Fatalf("expected checks %v, got %v", want, got)
+	} else {
+		for key, status := range want {
+			if got[key] != status {
+				t.Fatalf("expected %s to be %s, got %v", key, status, got)
+			}
+		}
+	}
+
+	// the self-test keys are generated once
+	keys := len(srv.selfTestKeys)
+	doHandlerReq(t, srv, http.MethodGet, "/api/v0/health/ready", nil, nil)
+	if keys != 2 || len(srv.selfTestKeys) != keys {
+		t.Fatalf("expected the 2 self-test keys to be reused, got %d then %d", keys, len(srv.selfTestKeys))
+	}
+}
+
+func TestReadiness_Fail(t *testing.T) {
+	srv := NewServer(ServerParams{
+		KeyGeneratorStore: crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{
+			crypto.RSA: &crypto.RSAGenerator{},
+			crypto.ECC: &custodyGenerator{},
+		}),
+		SignerStore: crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+			crypto.RSA: func(privateKey []byte) (crypto.Signer, error) { return brokenSigner{}, nil },
+			crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+		}),
+		DeviceStore: &unreachableStore{InMemorySignatureDeviceStore: persistence.NewInMemorySignatureDeviceStore()},
+	})
+
+	rr := doHandlerReq(t, srv, http.MethodGet, "/api/v0/health/ready", nil, nil)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rr.Code)
+	}
+	health := decodeHealth(t, rr.Body.Bytes())
+	if health.Status != HealthFail {
+		t.Fatalf("expected fail, got %+v", health)
+	}
+	got := checkStatuses(health)
+	want := map[string]string{
+		"store:responseTime/":   HealthFail,
+		"keyCustody:status/ECC": HealthFail,
+		"keyCustody:status/RSA": HealthPass,
+		"signer:selfTest/ECC":   HealthPass,
+		"signer:selfTest/RSA":   HealthFail,
+	}
+	for key, status := range want {
+		if got[key] != status {
+			t.Fatalf("expected %s to be %s, got %v", key, status, got)
+		}
+	}
+	// internal details are only logged
+	if body := rr.Body.String(); strings.Contains(body, "10.0.0.5") || strings.Contains(body, "kms") {
+		t.Fatalf("expected no internal error details in the response, got %s", body)
+	}
+
+	// liveness does not depend on the dependencies
+	if rr := doHandlerReq(t, srv, http.MethodGet, "/api/v0/health/live", nil, nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected liveness to pass, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// RequestIDHeader carries the ID correlating a request with its log entries.
+	RequestIDHeader = "X-Request-ID"
+)
+
+// validRequestID restricts the request IDs accepted from clients, so they can not inject into the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type requestLogKey struct{}
+
+// requestLog collects the details of a request which are only known to the handler.
+type requestLog struct {
+	requestID string
+	deviceID  string
+}
+
+// statusRecorder remembers the status code and the internal error written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	err    error
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer (e.g. for flushing).
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// observeRequests assigns each request an ID, taken from the X-Request-ID header if valid,
+// returns it to the client, logs the completed request and records it in the metrics.
+func (s *Server) observeRequests(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+
+		requestID := request.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		response.Header().Set(RequestIDHeader, requestID)
+
+		_, route := mux.Handler(request)
+		ctx, span := startServerSpan(request, route)
+		defer span.End()
+
+		entry := &requestLog{requestID: requestID}
+		request = request.WithContext(context.WithValue(ctx, requestLogKey{}, entry))
+		recorder := &statusRecorder{ResponseWriter: response}
+
+		mux.ServeHTTP(recorder, request)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		latency := time.Since(start)
+		s.metrics.ObserveRequest(request.Method, route, recorder.status, latency)
+		endServerSpan(span, recorder.status, entry.deviceID)
+
+		attrs := []slog.Attr{
+			slog.String("request_id", requestID),
+			slog.String("method", request.Method),
+			slog.String("route", route),
+			slog.Int("status", recorder.status),
+			slog.Duration("latency", latency),
+		}
+		if entry.deviceID != "" {
+			attrs = append(attrs, slog.String("device_id", entry.deviceID))
+		}
+		if recorder.err != nil {
+			attrs = append(attrs, slog.String("error", recorder.err.Error()))
+		}
+		if spanContext := span.SpanContext(); spanContext.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+		}
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		s.logger.LogAttrs(request.Context(), level, "request completed", attrs...)
+	})
+}
+
+// recordError adds the internal error of a response to the log entry of its request.
+func recordError(w http.ResponseWriter, err error) {
+	for {
+		switch writer := w.(type) {
+		case *statusRecorder:
+			writer.err = err
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+// logDeviceID adds the device a request acts on to its log entry.
+func logDeviceID(ctx context.Context, deviceID string) {
+	if entry, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		entry.deviceID = deviceID
+	}
+}
+
+// requestLogger returns the server logger annotated with the ID of the request.
+func (s *Server) requestLogger(ctx context.Context) *slog.Logger {
+	if entry, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		return s.logger.With("request_id", entry.requestID)
+	}
+	return s.logger
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/logging"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+func TestRequestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Level: "debug", Format: logging.FormatJSON})
+	if err != nil {
+		t.Fatalf("logging.New error: %v", err)
+	}
+	srv := newTestServer(t)
+	srv.logger = logger
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", nil,
+		CreateSignatureDeviceRequest{Algorithm: crypto.ECC, Label: "logged"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var created struct {
+		Data CreateSignatureDeviceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unmarshal create response: %v", err)
+	}
+	generatedID := rr.Header().Get(RequestIDHeader)
+	if generatedID == "" {
+		t.Fatalf("expected a generated request id")
+	}
+
+	buf.Reset()
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", map[string]string{RequestIDHeader: "client-req-1"},
+		SignTxRequest{DeviceID: created.Data.ID, Data: "very secret payload"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get(RequestIDHeader); got != "client-req-1" {
+		t.Fatalf("expected propagated request id, got %q", got)
+	}
+	if strings.Contains(buf.String(), "very secret payload") {
+		t.Fatalf("payload reached the log: %s", buf.String())
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("unmarshal log entry: %v (%s)", err, buf.String())
+	}
+	expected := map[string]any{
+		"request_id": "client-req-1",
+		"method":     http.MethodPost,
+		"route":      "POST /api/v0/sign-tx",
+		"status":     float64(http.StatusOK),
+		"device_id":  created.Data.ID,
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Fatalf("expected %s=%v in log entry, got %v", key, value, entry)
+		}
+	}
+	if _, ok := entry["latency"]; !ok {
+		t.Fatalf("expected latency in log entry, got %v", entry)
+	}
+
+	// request IDs which could inject into the logs are replaced
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/health", map[string]string{RequestIDHeader: "bad id\nlevel=ERROR"}, nil)
+	if got := rr.Header().Get(RequestIDHeader); got == "" || strings.ContainsAny(got, " \n") {
+		t.Fatalf("expected invalid request id to be replaced, got %q", got)
+	}
+}
+
+func TestRequestLogging_InternalError(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Level: "info", Format: logging.FormatJSON})
+	if err != nil {
+		t.Fatalf("logging.New error: %v", err)
+	}
+	kg := crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{crypto.ECC: &crypto.ECCGenerator{}})
+	ss := crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+		crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+	})
+	store := &failingCommitStore{InMemorySignatureDeviceStore: persistence.NewInMemorySignatureDeviceStore()}
+	srv := NewServer(ServerParams{KeyGeneratorStore: kg, SignerStore: ss, DeviceStore: store, Logger: logger})
+	t.Cleanup(func() { srv.webhooks.Close() })
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.ECC, "lbl")
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	// the cause of an internal error is logged with the request, but not returned to the client
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device/"+dev.GetIDStr()+"/sign-batch", nil,
+		SignBatchRequest{Data: []string{"a"}})
+	assertProblem(t, rr, http.StatusInternalServerError, ProblemInternal)
+	if strings.Contains(rr.Body.String(), "connection reset by peer") {
+		t.Fatalf("internal error leaked into the response: %s", rr.Body.String())
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("unmarshal log entry: %v (%s)", err, buf.String())
+	}
+	if entry["level"] != "ERROR" || !strings.Contains(entry["error"].(string), "connection reset by peer") ||
+		entry["request_id"] != rr.Header().Get(RequestIDHeader) {
+		t.Fatalf("expected the internal error in the log entry, got %v", entry)
+	}
+}
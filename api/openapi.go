@@ -0,0 +1,21 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPIContentType is the content type of the OpenAPI document.
+const OpenAPIContentType = "application/json"
+
+// openAPISpec is the OpenAPI 3.1 document of the HTTP API.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// ServeOpenAPI serves the OpenAPI document describing every HTTP route.
+func ServeOpenAPI(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", OpenAPIContentType)
+	response.WriteHeader(http.StatusOK)
+	response.Write(openAPISpec)
+}
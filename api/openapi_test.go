@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// routeRecorder records the patterns of the registered routes.
+type routeRecorder struct {
+	patterns []string
+}
+
+func (r *routeRecorder) Handle(pattern string, _ http.Handler) {
+	r.patterns = append(r.patterns, pattern)
+}
+
+// openAPIDocument is the part of the OpenAPI document the tests look at.
+type openAPIDocument struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			AllOf      []json.RawMessage          `json:"allOf"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenAPIDocument(t *testing.T) openAPIDocument {
+	t.Helper()
+	var document openAPIDocument
+	if err := json.Unmarshal(openAPISpec, &document); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+	return document
+}
+
+func TestOpenAPI_CoversEveryRoute(t *testing.T) {
+	srv := newTestServer(t)
+	document := loadOpenAPIDocument(t)
+
+	routes := &routeRecorder{}
+	srv.registerRoutes(routes)
+	registered := map[string]bool{}
+	for _, pattern := range routes.patterns {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			t.Fatalf("route %q has no method", pattern)
+		}
+		registered[strings.ToLower(method)+" "+path] = true
+		if _, ok := document.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("route %q is missing from the OpenAPI document", pattern)
+		}
+	}
+
+	// the document does not describe routes which do not exist
+	for path, operations := range document.Paths {
+		for method := range operations {
+			if !registered[method+" "+path] {
+				t.Errorf("OpenAPI operation %s %s is not a registered route", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPI_ReferencesResolve(t *testing.T) {
+	var document map[string]any
+	if err := json.Unmarshal(openAPISpec, &document); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+	components := document["components"].(map[string]any)
+	for _, match := range regexp.MustCompile(`"\$ref": "#/components/(\w+)/(\w+)"`).FindAllStringSubmatch(string(openAPISpec), -1) {
+		section, _ := components[match[1]].(map[string]any)
+		if _, ok := section[match[2]]; !ok {
+			t.Errorf("unresolved reference #/components/%s/%s", match[1], match[2])
+		}
+	}
+}
+
+// jsonFields returns the JSON field names of a struct, including those of embedded structs.
+func jsonFields(typ reflect.Type) []string {
+	var fields []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+func TestOpenAPI_SchemasMatchTypes(t *testing.T) {
+	document := loadOpenAPIDocument(t)
+
+	schemas := map[string]any{
+		"CreateSignatureDeviceRequest":  CreateSignatureDeviceRequest{},
+		"CreateSignatureDeviceResponse": CreateSignatureDeviceResponse{},
+		"SignatureDevice":               signatureDevice{},
+		"UpdateSignatureDeviceRequest":  UpdateSignatureDeviceRequest{},
+		"CreateSignatureRequest":        CreateSignatureRequest{},
+		"CreateSignatureBatchRequest":   CreateSignatureBatchRequest{},
+		"Signature":                     Signature{},
+		"VerifySignatureRequest":        VerifySignatureRequest{},
+		"SignTxRequest":                 SignTxRequest{},
+		"SignTxResponse":                SignTxResponse{},
+		"SignBatchRequest":              SignBatchRequest{},
+		"SignBatchItem":                 SignBatchItem{},
+		"VerifyTxRequest":               VerifyTxRequest{},
+		"VerifyTxResponse":              VerifyTxResponse{},
+		"CreateAPIKeyRequest":           CreateAPIKeyRequest{},
+		"APIKey":                        apiKey{},
+		"CreateWebhookRequest":          CreateWebhookRequest{},
+		"Webhook":                       webhookEndpoint{},
+		"DeadLetter":                    deadLetter{},
+		"Health":                        HealthResponse{},
+		"HealthCheck":                   HealthCheck{},
+		"InvalidParam":                  InvalidParam{},
+		"Problem":                       Problem{},
+	}
+	for name, value := range schemas {
+		schema, ok := document.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s is missing", name)
+			continue
+		}
+		var properties []string
+		for property := range schema.Properties {
+			properties = append(properties, property)
+		}
+		fields := jsonFields(reflect.TypeOf(value))
+		sort.Strings(properties)
+		sort.Strings(fields)
+		if !reflect.DeepEqual(properties, fields) {
+			t.Errorf("schema %s has the properties %v, the type has the fields %v", name, properties, fields)
+		}
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doHandlerReq(t, srv, http.MethodGet, "/api/openapi.json", nil, nil)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != OpenAPIContentType {
+		t.Fatalf("unexpected response: %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var document openAPIDocument
+	if err := json.Unmarshal(rr.Body.Bytes(), &document); err != nil || document.OpenAPI != "3.1.0" {
+		t.Fatalf("unexpected document: %v", err)
+	}
+}
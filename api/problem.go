@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+	"github.com/ksrichard/signing-service-challenge/webhook"
+)
+
+const (
+	// ProblemContentType is the content type of the error responses (RFC 7807).
+	ProblemContentType = "application/problem+json"
+	// ProblemTypePrefix prefixes the code of a problem to form its type URI.
+	ProblemTypePrefix = "urn:signing-service:problem:"
+)
+
+// ProblemCode identifies the kind of an error response, clients can rely on it not to change.
+type ProblemCode string
+
+// generic problems, identified by their HTTP status
+const (
+	ProblemBadRequest       ProblemCode = "bad_request"
+	ProblemUnauthenticated  ProblemCode = "unauthenticated"
+	ProblemForbidden        ProblemCode = "forbidden"
+	ProblemNotFound         ProblemCode = "not_found"
+	ProblemConflict         ProblemCode = "conflict"
+	ProblemRateLimited      ProblemCode = "rate_limited"
+	ProblemPayloadTooLarge  ProblemCode = "payload_too_large"
+	ProblemUnsupportedMedia ProblemCode = "unsupported_media_type"
+	ProblemRequestCancelled ProblemCode = "request_cancelled"
+	ProblemInternal         ProblemCode = "internal_error"
+	ProblemUnavailable      ProblemCode = "unavailable"
+	ProblemTimeout          ProblemCode = "timeout"
+)
+
+// problems of typed errors
+const (
+	ProblemValidationFailed     ProblemCode = "validation_failed"
+	ProblemInvalidJSON          ProblemCode = "invalid_json"
+	ProblemDeviceNotFound       ProblemCode = "device_not_found"
+	ProblemUnsupportedAlgorithm ProblemCode = "unsupported_algorithm"
+	ProblemDeviceNotActive      ProblemCode = "device_not_active"
+	ProblemChainConflict        ProblemCode = "chain_conflict"
+	ProblemInvalidState         ProblemCode = "invalid_state"
+	ProblemTenantQuotaExceeded  ProblemCode = "tenant_quota_exceeded"
+	ProblemForeignTenant        ProblemCode = "foreign_tenant"
+	ProblemUnknownTenant        ProblemCode = "unknown_tenant"
+	ProblemInvalidSignature     ProblemCode = "invalid_signature_encoding"
+	ProblemAPIKeyNotFound       ProblemCode = "api_key_not_found"
+	ProblemWebhookNotFound      ProblemCode = "webhook_not_found"
+	ProblemDeadLetterNotFound   ProblemCode = "dead_letter_not_found"
+	ProblemWebhooksUnavailable  ProblemCode = "webhooks_unavailable"
+	ProblemIdempotencyKeyReused ProblemCode = "idempotency_key_reused"
+	ProblemBatchExceedsLimit    ProblemCode = "batch_exceeds_rate_limit"
+)
+
+// internalErrorDetail follows the message of internal errors, their cause is only logged with the request.
+const internalErrorDetail = "internal error, the request ID identifies it in the logs"
+
+// Problem is the error API response container (RFC 7807).
+type Problem struct {
+	Type   string      `json:"type"`
+	Title  string      `json:"title"`
+	Status int         `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+	Code   ProblemCode `json:"code"`
+	// InvalidParams lists the invalid fields of a request which failed validation.
+	InvalidParams []InvalidParam `json:"invalidParams,omitempty"`
+	// Errors keeps the messages of the former ErrorResponse for existing clients.
+	Errors []string `json:"errors"`
+}
+
+// problemError is the problem reported for a typed error.
+type problemError struct {
+	err    error
+	status int
+	code   ProblemCode
+	title  string
+}
+
+// problemErrors lists the typed errors with a problem of their own, the first match wins.
+var problemErrors = []problemError{
+	{errInvalidJSON, http.StatusBadRequest, ProblemInvalidJSON, "Invalid JSON request body"},
+	{errBodyTooLarge, http.StatusRequestEntityTooLarge, ProblemPayloadTooLarge, "Request body too large"},
+	{errUnsupportedMedia, http.StatusUnsupportedMediaType, ProblemUnsupportedMedia, "Unsupported request content type"},
+	{persistence.ErrDeviceNotFound, http.StatusNotFound, ProblemDeviceNotFound, "Signature device not found"},
+	{crypto.ErrUnsupportedAlgorithm, http.StatusBadRequest, ProblemUnsupportedAlgorithm, "Unsupported signature algorithm"},
+	{domain.ErrDeviceNotActive, http.StatusConflict, ProblemDeviceNotActive, "Signature device is not active"},
+	{domain.ErrChainConflict, http.StatusConflict, ProblemChainConflict, "Signature chain was advanced concurrently"},
+	{domain.ErrIdempotencyKeyReused, http.StatusConflict, ProblemIdempotencyKeyReused, "Idempotency key was used for a different request"},
+	{errBatchExceedsLimit, http.StatusUnprocessableEntity, ProblemBatchExceedsLimit, "Batch exceeds the rate limit of the signature device"},
+	{domain.ErrInvalidState, http.StatusBadRequest, ProblemInvalidState, "Invalid signature device state"},
+	{domain.ErrTenantQuotaExceeded, http.StatusForbidden, ProblemTenantQuotaExceeded, "Signature device quota exceeded"},
+	{errForeignTenant, http.StatusForbidden, ProblemForeignTenant, "Not allowed to act for tenant"},
+	{persistence.ErrTenantNotFound, http.StatusForbidden, ProblemUnknownTenant, "Unknown tenant"},
+	{errSignatureEncoding, http.StatusBadRequest, ProblemInvalidSignature, "Invalid signature encoding"},
+	{persistence.ErrAPIKeyNotFound, http.StatusNotFound, ProblemAPIKeyNotFound, "API key not found"},
+	{persistence.ErrWebhookNotFound, http.StatusNotFound, ProblemWebhookNotFound, "Webhook not found"},
+	{persistence.ErrDeadLetterNotFound, http.StatusNotFound, ProblemDeadLetterNotFound, "Dead letter not found"},
+	{webhook.ErrQueueFull, http.StatusServiceUnavailable, ProblemWebhooksUnavailable, "Webhook deliveries unavailable"},
+	{webhook.ErrDispatcherClosed, http.StatusServiceUnavailable, ProblemWebhooksUnavailable, "Webhook deliveries unavailable"},
+}
+
+// statusProblems are the codes of the error responses without a typed error.
+var statusProblems = map[int]ProblemCode{
+	http.StatusBadRequest:            ProblemBadRequest,
+	http.StatusUnauthorized:          ProblemUnauthenticated,
+	http.StatusForbidden:             ProblemForbidden,
+	http.StatusNotFound:              ProblemNotFound,
+	http.StatusConflict:              ProblemConflict,
+	http.StatusRequestEntityTooLarge: ProblemPayloadTooLarge,
+	http.StatusUnsupportedMediaType:  ProblemUnsupportedMedia,
+	http.StatusTooManyRequests:       ProblemRateLimited,
+	StatusClientClosedRequest:        ProblemRequestCancelled,
+	http.StatusInternalServerError:   ProblemInternal,
+	http.StatusServiceUnavailable:    ProblemUnavailable,
+	http.StatusGatewayTimeout:        ProblemTimeout,
+}
+
+// statusProblem returns the generic problem of an HTTP status.
+func statusProblem(status int) (ProblemCode, string) {
+	code, ok := statusProblems[status]
+	if !ok {
+		code = ProblemBadRequest
+		if status >= http.StatusInternalServerError {
+			code = ProblemInternal
+		}
+	}
+	title := http.StatusText(status)
+	if status == StatusClientClosedRequest {
+		title = "Client Closed Request"
+	}
+	return code, title
+}
+
+// writeError writes the problem of err as an error response, its detail is the message followed by err
+// (by a generic text for internal errors).
+func writeError(w http.ResponseWriter, err error, message string) {
+	writeErrorDetail(w, err, message, fmt.Sprintf("%s: %s", message, err.Error()))
+}
+
+// writeErrorDetail writes the problem of err as an error response with the given detail.
+// Context errors are reported like writeContextError does, validation errors list the invalid fields,
+// typed errors (see problemErrors) are reported with their own status and code and anything else is an internal error
+// whose detail is the message followed by a generic text, its error is only logged with the request.
+func writeErrorDetail(w http.ResponseWriter, err error, message string, detail string) {
+	if writeContextError(w, err) {
+		return
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		writeProblem(w, Problem{
+			Status:        http.StatusBadRequest,
+			Code:          ProblemValidationFailed,
+			Title:         "Request validation failed",
+			Detail:        detail,
+			InvalidParams: validationErr.Params,
+		})
+		return
+	}
+	for _, problem := range problemErrors {
+		if errors.Is(err, problem.err) {
+			writeProblem(w, Problem{Status: problem.status, Code: problem.code, Title: problem.title, Detail: detail})
+			return
+		}
+	}
+	// the error of a backend may reveal its internals, it is only logged with the request
+	recordError(w, err)
+	code, title := statusProblem(http.StatusInternalServerError)
+	writeProblem(w, Problem{Status: http.StatusInternalServerError, Code: code, Title: title, Detail: message + ": " + internalErrorDetail})
+}
+
+// writeProblem completes a problem with its type and writes it as an error response.
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	problem.Type = ProblemTypePrefix + string(problem.Code)
+	if problem.Errors == nil && problem.Detail != "" {
+		problem.Errors = []string{problem.Detail}
+	}
+
+	bytes, err := json.Marshal(problem)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(bytes)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+// helper to decode a problem response and check its status and code
+func assertProblem(t *testing.T, rr *httptest.ResponseRecorder, status int, code ProblemCode) Problem {
+	t.Helper()
+	if rr.Code != status {
+		t.Fatalf("expected %d, got %d: %s", status, rr.Code, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != ProblemContentType {
+		t.Fatalf("expected %s, got %s", ProblemContentType, contentType)
+	}
+	var problem Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("unmarshal: %v (%s)", err, rr.Body.String())
+	}
+	if problem.Status != status || problem.Code != code || problem.Type != ProblemTypePrefix+string(code) ||
+		problem.Title == "" || problem.Detail == "" || len(problem.Errors) == 0 {
+		t.Fatalf("unexpected problem: %+v", problem)
+	}
+	return problem
+}
+
+func TestProblems_TypedErrors(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: "unknown", Data: "data"})
+	assertProblem(t, rr, http.StatusNotFound, ProblemDeviceNotFound)
+
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", nil, CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+	var device struct {
+		Data CreateSignatureDeviceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &device); err != nil {
+		t.Fatalf("create device: %d %s", rr.Code, rr.Body.String())
+	}
+	doHandlerReq(t, srv, http.MethodPatch, "/api/v0/signature-device/"+device.Data.ID, nil, UpdateSignatureDeviceRequest{State: domain.StateSuspended})
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: device.Data.ID, Data: "data"})
+	assertProblem(t, rr, http.StatusConflict, ProblemDeviceNotActive)
+
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/verify-tx", nil, VerifyTxRequest{DeviceID: device.Data.ID, SignedData: "0_data_x", Signature: "%%%"})
+	assertProblem(t, rr, http.StatusBadRequest, ProblemInvalidSignature)
+
+	// ECC is a known algorithm, but not enabled on this server
+	rsaOnly := NewServer(ServerParams{
+		KeyGeneratorStore: crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{crypto.RSA: &crypto.RSAGenerator{}}),
+		DeviceStore:       persistence.NewInMemorySignatureDeviceStore(),
+	})
+	t.Cleanup(func() { rsaOnly.webhooks.Close() })
+	rr = doHandlerReq(t, rsaOnly, http.MethodPost, "/api/v0/signature-device", nil, CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+	assertProblem(t, rr, http.StatusBadRequest, ProblemUnsupportedAlgorithm)
+
+	rr = httptest.NewRecorder()
+	writeError(rr, fmt.Errorf("commit: %w", domain.ErrChainConflict), "Failed to sign data")
+	problem := assertProblem(t, rr, http.StatusConflict, ProblemChainConflict)
+	if problem.Detail != "Failed to sign data: commit: "+domain.ErrChainConflict.Error() {
+		t.Fatalf("unexpected detail: %q", problem.Detail)
+	}
+
+	// internal errors do not reveal their cause
+	rr = httptest.NewRecorder()
+	writeError(rr, errors.New("dial tcp 10.0.0.7:6379: connection refused"), "Unable to list signature devices")
+	problem = assertProblem(t, rr, http.StatusInternalServerError, ProblemInternal)
+	if problem.Detail != "Unable to list signature devices: "+internalErrorDetail || strings.Contains(rr.Body.String(), "10.0.0.7") {
+		t.Fatalf("internal error leaked into the response: %s", rr.Body.String())
+	}
+}
+
+func TestProblems_Validation(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{Data: "data"})
+	problem := assertProblem(t, rr, http.StatusBadRequest, ProblemValidationFailed)
+	if len(problem.InvalidParams) != 1 || problem.InvalidParams[0].Name != "deviceId" || problem.InvalidParams[0].Reason != "is required" {
+		t.Fatalf("unexpected invalid params: %+v", problem.InvalidParams)
+	}
+	// the former error messages are kept
+	if problem.Errors[0] != "Request validation failed: deviceId is required" {
+		t.Fatalf("unexpected errors: %v", problem.Errors)
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", nil, map[string]string{"algorithm": "DSA"})
+	problem = assertProblem(t, rr, http.StatusBadRequest, ProblemValidationFailed)
+	if len(problem.InvalidParams) != 1 || problem.InvalidParams[0].Name != "algorithm" {
+		t.Fatalf("unexpected invalid params: %+v", problem.InvalidParams)
+	}
+}
+
+func TestProblems_GenericStatus(t *testing.T) {
+	rr := httptest.NewRecorder()
+	WriteErrorResponse(rr, http.StatusTooManyRequests, []string{"Rate limit exceeded"})
+	problem := assertProblem(t, rr, http.StatusTooManyRequests, ProblemRateLimited)
+	if problem.Title != "Too Many Requests" || problem.Detail != "Rate limit exceeded" {
+		t.Fatalf("unexpected problem: %+v", problem)
+	}
+
+	rr = httptest.NewRecorder()
+	WriteErrorResponse(rr, StatusClientClosedRequest, []string{"Request was cancelled"})
+	assertProblem(t, rr, StatusClientClosedRequest, ProblemRequestCancelled)
+}
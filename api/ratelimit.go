@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/ratelimit"
+)
+
+const (
+	clientRateLimitHeaderPrefix = "X-RateLimit"
+	deviceRateLimitHeaderPrefix = "X-Device-RateLimit"
+)
+
+var (
+	errBatchExceedsLimit = errors.New("batch exceeds the rate limit of the signature device")
+)
+
+// RateLimitPolicy configures the token bucket limits of requests.
+// Zero limits are unlimited.
+type RateLimitPolicy struct {
+	// Client limits the requests of a single API client (authenticated identity or remote address).
+	Client ratelimit.Limit
+	// Device limits the signature requests for a single signature device.
+	Device ratelimit.Limit
+}
+
+// RateLimitParams configures the rate limits of the Server.
+type RateLimitParams struct {
+	RateLimitPolicy
+	// TenantOverrides replaces the default policy for the given tenants.
+	TenantOverrides map[string]RateLimitPolicy
+}
+
+// policy returns the rate limit policy of the tenant.
+func (p RateLimitParams) policy(tenantID string) RateLimitPolicy {
+	if override, ok := p.TenantOverrides[tenantID]; ok {
+		return override
+	}
+	return p.RateLimitPolicy
+}
+
+// limitClient wraps a handler so every API client is limited to the client rate of its tenant.
+// Authenticated clients are told apart by their identity, anonymous ones by their remote address.
+func (s *Server) limitClient(next http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		tenantID := strings.TrimSpace(request.Header.Get(TenantHeader))
+		client := "addr:" + remoteHost(request)
+		if identity, ok := auth.IdentityFromContext(request.Context()); ok {
+			tenantID = identity.TenantID
+			client = "sub:" + identity.Subject
+		}
+		if tenantID == "" {
+			tenantID = domain.DefaultTenantID
+		}
+
+		limit, result := s.allowClientCall(tenantID, client)
+		if !limit.Unlimited() {
+			writeRateLimitHeaders(response, clientRateLimitHeaderPrefix, result)
+		}
+		if !result.Allowed {
+			writeTooManyRequests(response, result, "Rate limit of the client exceeded")
+			return
+		}
+
+		next(response, request)
+	}
+}
+
+// allowDevice applies the device rate limit of the tenant to a request for the given number of signatures of the
+// device. Errors resolving the device are written with the given message.
+// If the return value is false, the handler must return because the device was not found or the limit was exceeded.
+func (s *Server) allowDevice(response http.ResponseWriter, request *http.Request, tenantID string, deviceID string,
+	signatures int, message string) bool {
+	limit, result, err := s.allowDeviceCall(request.Context(), tenantID, deviceID, signatures)
+	if err != nil {
+		writeError(response, err, message)
+		return false
+	}
+	if !limit.Unlimited() {
+		writeRateLimitHeaders(response, deviceRateLimitHeaderPrefix, result)
+	}
+	if !result.Allowed {
+		writeTooManyRequests(response, result, "Rate limit of the signature device exceeded")
+		return false
+	}
+	return true
+}
+
+// allowClientCall takes a token from the bucket of the API client, shared by the REST and gRPC APIs.
+func (s *Server) allowClientCall(tenantID string, client string) (ratelimit.Limit, ratelimit.Result) {
+	limit := s.rateLimits.policy(tenantID).Client
+	return limit, s.clientLimiter.Allow(tenantID+"/"+client, limit)
+}
+
+// allowDeviceCall takes a token per signature from the bucket of the signature device, shared by the REST and gRPC APIs.
+// The device is resolved first, so unknown devices are reported as not found instead of taking a bucket.
+// More signatures than the burst of the limit are rejected with errBatchExceedsLimit.
+func (s *Server) allowDeviceCall(ctx context.Context, tenantID string, deviceID string, signatures int) (ratelimit.Limit, ratelimit.Result, error) {
+	limit := s.rateLimits.policy(tenantID).Device
+	if limit.Unlimited() {
+		return limit, ratelimit.Result{Allowed: true}, nil
+	}
+	if _, err := s.deviceStore.Get(ctx, tenantID, deviceID); err != nil {
+		return limit, ratelimit.Result{}, err
+	}
+	if signatures > limit.Burst {
+		// no amount of waiting lets the bucket cover more signatures than its burst
+		return limit, ratelimit.Result{}, fmt.Errorf("%w: %d signatures exceed its burst of %d",
+			errBatchExceedsLimit, signatures, limit.Burst)
+	}
+	return limit, s.deviceLimiter.AllowN(tenantID+"/"+deviceID, limit, signatures), nil
+}
+
+func writeRateLimitHeaders(response http.ResponseWriter, prefix string, result ratelimit.Result) {
+	header := response.Header()
+	header.Set(prefix+"-Limit", strconv.Itoa(result.Limit))
+	header.Set(prefix+"-Remaining", strconv.Itoa(result.Remaining))
+	header.Set(prefix+"-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+func writeTooManyRequests(response http.ResponseWriter, result ratelimit.Result, message string) {
+	response.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+	WriteErrorResponse(response, http.StatusTooManyRequests, []string{
+		fmt.Sprintf("%s, retry in %s", message, result.RetryAfter.Round(time.Millisecond)),
+	})
+}
+
+func ceilSeconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
+
+// remoteHost returns the host part of the remote address of the request.
+func remoteHost(request *http.Request) string {
+	return hostOf(request.RemoteAddr)
+}
+
+// hostOf returns the host part of a network address.
+func hostOf(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/ratelimit"
+)
+
+func TestRateLimit_Client(t *testing.T) {
+	srv := newTenantTestServer(t)
+	srv.rateLimits = RateLimitParams{
+		RateLimitPolicy: RateLimitPolicy{Client: ratelimit.Limit{Rate: 0.001, Burst: 2}},
+		TenantOverrides: map[string]RateLimitPolicy{
+			"globex": {Client: ratelimit.Limit{Rate: 0.001, Burst: 3}},
+		},
+	}
+	acme := map[string]string{TenantHeader: "acme"}
+
+	for i := 0; i < 2; i++ {
+		rr := doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device", acme, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, rr.Code)
+		}
+		if got := rr.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Fatalf("expected limit header 2, got %q", got)
+		}
+	}
+	rr := doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device", acme, nil)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" || rr.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("missing rate limit headers: %v", rr.Header())
+	}
+
+	// the override of globex allows one more request
+	globex := map[string]string{TenantHeader: "globex"}
+	for i := 0; i < 3; i++ {
+		if rr := doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device", globex, nil); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200 for overridden tenant, got %d", i+1, rr.Code)
+		}
+	}
+}
+
+func TestRateLimit_Device(t *testing.T) {
+	srv := newTestServer(t)
+	srv.rateLimits = RateLimitParams{
+		RateLimitPolicy: RateLimitPolicy{Device: ratelimit.Limit{Rate: 0.001, Burst: 1}},
+	}
+	var ids []string
+	for i := 0; i < 2; i++ {
+		dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.ECC, "lbl")
+		if err != nil {
+			t.Fatalf("create device: %v", err)
+		}
+		if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		ids = append(ids, dev.GetIDStr())
+	}
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: ids[0], Data: "a"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("X-Device-RateLimit-Remaining") != "0" {
+		t.Fatalf("expected device rate limit headers, got %v", rr.Header())
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: ids[0], Data: "b"})
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for flooded device, got %d", rr.Code)
+	}
+	// other devices are not starved
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: ids[1], Data: "c"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for other device, got %d", rr.Code)
+	}
+}
+
+func TestRateLimit_DeviceBatch(t *testing.T) {
+	srv := newTestServer(t)
+	srv.rateLimits = RateLimitParams{
+		RateLimitPolicy: RateLimitPolicy{Device: ratelimit.Limit{Rate: 0.001, Burst: 5}},
+	}
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.ECC, "lbl")
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	target := "/api/v0/signature-device/" + dev.GetIDStr() + "/sign-batch"
+
+	// every item of a batch takes a token
+	rr := doHandlerReq(t, srv, http.MethodPost, target, nil, SignBatchRequest{Data: []string{"a", "b", "c"}})
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Device-RateLimit-Remaining") != "2" {
+		t.Fatalf("expected 200 with 2 tokens left, got %d: %v", rr.Code, rr.Header())
+	}
+	// a batch the bucket cannot cover is rejected as a whole and takes no token
+	rr = doHandlerReq(t, srv, http.MethodPost, target, nil, SignBatchRequest{Data: []string{"d", "e", "f"}})
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 for a batch beyond the limit, got %d", rr.Code)
+	}
+	if stored, _ := srv.deviceStore.Get(context.Background(), domain.DefaultTenantID, dev.GetIDStr()); stored.GetSignatureCounter() != 3 {
+		t.Fatalf("expected the rejected batch to sign nothing, got counter %d", stored.GetSignatureCounter())
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, target, nil, SignBatchRequest{Data: []string{"d", "e"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the remaining tokens to cover a smaller batch, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// a batch larger than the burst can never be covered, it is not worth a retry
+	rr = doHandlerReq(t, srv, http.MethodPost, target, nil, SignBatchRequest{Data: []string{"a", "b", "c", "d", "e", "f"}})
+	problem := assertProblem(t, rr, http.StatusUnprocessableEntity, ProblemBatchExceedsLimit)
+	if rr.Header().Get("Retry-After") != "" || !strings.Contains(problem.Detail, "6 signatures exceed its burst of 5") {
+		t.Fatalf("expected the limit in the problem and no Retry-After, got %+v %v", problem, rr.Header())
+	}
+}
+
+func TestRateLimit_DeviceUnknown(t *testing.T) {
+	srv := newTestServer(t)
+	srv.rateLimits = RateLimitParams{
+		RateLimitPolicy: RateLimitPolicy{Device: ratelimit.Limit{Rate: 0.001, Burst: 1}},
+	}
+
+	// unknown devices are reported as not found however often they are requested
+	for i := 0; i < 3; i++ {
+		rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: "missing", Data: "a"})
+		assertProblem(t, rr, http.StatusNotFound, ProblemDeviceNotFound)
+		if rr.Header().Get("X-Device-RateLimit-Remaining") != "" {
+			t.Fatalf("unknown device must not take a token, got %v", rr.Header())
+		}
+	}
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device/missing/sign-batch", nil,
+		SignBatchRequest{Data: []string{"a", "b"}})
+	assertProblem(t, rr, http.StatusNotFound, ProblemDeviceNotFound)
+}
+
+func TestRateLimit_DeviceIdempotencyKey(t *testing.T) {
+	srv := newTestServer(t)
+	srv.rateLimits = RateLimitParams{
+		RateLimitPolicy: RateLimitPolicy{Device: ratelimit.Limit{Rate: 0.001, Burst: 1}},
+	}
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.ECC, "lbl")
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	sign := func(key string) *httptest.ResponseRecorder {
+		return doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", map[string]string{IdempotencyKeyHeader: key},
+			SignTxRequest{DeviceID: dev.GetIDStr(), Data: "payload"})
+	}
+
+	// a malformed key is rejected before taking a token
+	assertProblem(t, sign(" "), http.StatusBadRequest, ProblemValidationFailed)
+	if rr := sign("receipt-1"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// retries of the committed key are replayed although the bucket is empty
+	for i := 0; i < 3; i++ {
+		if rr := sign("receipt-1"); rr.Code != http.StatusOK || rr.Header().Get(IdempotentReplayedHeader) != "true" {
+			t.Fatalf("retry %d: expected a replay, got %d: %s", i+1, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := sign("receipt-2"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for a new key, got %d", rr.Code)
+	}
+}
@@ -1,11 +1,42 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/ksrichard/signing-service-challenge/auth"
 	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/metrics"
 	"github.com/ksrichard/signing-service-challenge/persistence"
+	"github.com/ksrichard/signing-service-challenge/ratelimit"
+	"github.com/ksrichard/signing-service-challenge/stream"
+	"github.com/ksrichard/signing-service-challenge/webhook"
+	"google.golang.org/grpc"
+)
+
+const (
+	// StatusClientClosedRequest is the non-standard status code used when the client
+	// went away before the response was ready.
+	StatusClientClosedRequest = 499
+
+	DefaultReadHeaderTimeout = 5 * time.Second
+	DefaultReadTimeout       = 15 * time.Second
+	DefaultWriteTimeout      = 30 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+	DefaultMaxHeaderBytes    = 64 << 10
+	DefaultMaxBodyBytes      = 1 << 20
+	DefaultShutdownTimeout   = 30 * time.Second
 )
 
 // Response is the generic API response container.
@@ -13,47 +44,363 @@ type Response struct {
 	Data interface{} `json:"data"`
 }
 
-// ErrorResponse is the generic error API response container.
+// ErrorResponse is the former error API response container, its errors are still part of every Problem.
 type ErrorResponse struct {
 	Errors []string `json:"errors"`
 }
 
+// HTTPParams hardens the HTTP server against slow or oversized requests, zero values are replaced by the defaults.
+type HTTPParams struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// MaxBodyBytes limits the size of request bodies, larger requests are rejected with 413.
+	MaxBodyBytes int64
+	// ShutdownTimeout is how long in-flight requests may take to finish once the server shuts down.
+	ShutdownTimeout time.Duration
+}
+
+// withDefaults returns the params with every zero value replaced by its default.
+func (p HTTPParams) withDefaults() HTTPParams {
+	if p.ReadHeaderTimeout == 0 {
+		p.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if p.ReadTimeout == 0 {
+		p.ReadTimeout = DefaultReadTimeout
+	}
+	if p.WriteTimeout == 0 {
+		p.WriteTimeout = DefaultWriteTimeout
+	}
+	if p.IdleTimeout == 0 {
+		p.IdleTimeout = DefaultIdleTimeout
+	}
+	if p.MaxHeaderBytes == 0 {
+		p.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	if p.MaxBodyBytes == 0 {
+		p.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if p.ShutdownTimeout == 0 {
+		p.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	return p
+}
+
 type ServerParams struct {
-	ListenAddress     string
+	ListenAddress string
+	// Listener is served instead of listening on ListenAddress if set, e.g. in tests.
+	Listener net.Listener
+	// GRPCListenAddress serves the gRPC API (see GRPCServer) on its own port if set.
+	GRPCListenAddress string
+	// GRPCListener is served instead of listening on GRPCListenAddress if set, e.g. in tests.
+	GRPCListener      net.Listener
 	SignerStore       crypto.SignerStore
 	KeyGeneratorStore crypto.KeyGeneratorStore
-	DeviceStore       persistence.SignatureDeviceStore
+	// VerifierStore verifies signatures, e.g. in the readiness self-test, if empty the built-in verifiers are used.
+	VerifierStore crypto.VerifierStore
+	DeviceStore   persistence.SignatureDeviceStore
+	// TenantStore provides the known tenants, if nil only the default tenant (without device quota) is known.
+	TenantStore persistence.TenantStore
+	// APIKeyStore keeps the API keys managed through the admin endpoints, if nil an in-memory store is used.
+	APIKeyStore persistence.APIKeyStore
+	// Authenticator authenticates the callers of all endpoints except health, if nil authentication is disabled.
+	Authenticator auth.Authenticator
+	// TLSConfig enables HTTPS (and optionally mutual TLS, see NewTLSConfig), if nil plain HTTP is served.
+	TLSConfig *tls.Config
+	// RateLimits limits the requests per API client and the signatures per device, unlimited if zero.
+	RateLimits RateLimitParams
+	// Logger receives the request logs, if nil slog.Default() is used.
+	Logger *slog.Logger
+	// HTTP configures the timeouts and limits of the HTTP server.
+	HTTP HTTPParams
+	// Config is the effective configuration exposed to admins, secrets must already be redacted.
+	Config any
+	// Metrics records the requests and is exposed at /metrics, if nil a new registry is used.
+	Metrics *metrics.Metrics
+	// WebhookStore keeps the webhook endpoints managed through the admin endpoints, if nil an in-memory store is used.
+	WebhookStore persistence.WebhookStore
+	// DeadLetterStore keeps the webhook deliveries which failed every attempt, if nil an in-memory store is used.
+	DeadLetterStore persistence.DeadLetterStore
+	// Webhooks configures the retries of the webhook deliveries.
+	Webhooks webhook.Config
+	// WebhookClient sends the webhook deliveries, if nil http.DefaultClient is used.
+	WebhookClient *http.Client
+	// Streams configures the event streams of the signature devices.
+	Streams stream.Config
+	// IdempotencyRetention is how long the idempotency keys of signature requests are kept,
+	// domain.DefaultIdempotencyRetention if zero.
+	IdempotencyRetention time.Duration
 }
 
 // Server manages HTTP requests and dispatches them to the appropriate services.
 type Server struct {
-	listenAddress     string
-	signerStore       *crypto.SignerStore
-	keyGeneratorStore *crypto.KeyGeneratorStore
-	deviceStore       persistence.SignatureDeviceStore
+	listenAddress        string
+	listener             net.Listener
+	grpcListenAddress    string
+	grpcListener         net.Listener
+	signerStore          *crypto.SignerStore
+	keyGeneratorStore    *crypto.KeyGeneratorStore
+	verifierStore        *crypto.VerifierStore
+	deviceStore          persistence.SignatureDeviceStore
+	tenantStore          persistence.TenantStore
+	apiKeyStore          persistence.APIKeyStore
+	authenticator        auth.Authenticator
+	tlsConfig            *tls.Config
+	rateLimits           RateLimitParams
+	clientLimiter        *ratelimit.Limiter
+	deviceLimiter        *ratelimit.Limiter
+	logger               *slog.Logger
+	httpParams           HTTPParams
+	config               any
+	metrics              *metrics.Metrics
+	webhookStore         persistence.WebhookStore
+	deadLetterStore      persistence.DeadLetterStore
+	webhooks             *webhook.Dispatcher
+	streams              *stream.Broker
+	idempotencyRetention time.Duration
+	events               domain.EventPublisher
+	startedAt            time.Time
+	selfTestKeys         map[crypto.SignatureAlgorithm]selfTestKey
+	selfTestMutex        sync.Mutex
 }
 
 // NewServer is a factory to instantiate a new Server.
 func NewServer(params ServerParams) *Server {
+	tenantStore := params.TenantStore
+	if tenantStore == nil {
+		tenantStore = persistence.NewInMemoryTenantStore(domain.Tenant{ID: domain.DefaultTenantID})
+	}
+	apiKeyStore := params.APIKeyStore
+	if apiKeyStore == nil {
+		apiKeyStore = persistence.NewInMemoryAPIKeyStore()
+	}
+	logger := params.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	serverMetrics := params.Metrics
+	if serverMetrics == nil {
+		serverMetrics = metrics.New()
+	}
+	verifierStore := params.VerifierStore
+	if len(verifierStore.Algorithms()) == 0 {
+		verifierStore = crypto.NewDefaultVerifierStore()
+	}
+	webhookStore := params.WebhookStore
+	if webhookStore == nil {
+		webhookStore = persistence.NewInMemoryWebhookStore()
+	}
+	deadLetterStore := params.DeadLetterStore
+	if deadLetterStore == nil {
+		deadLetterStore = persistence.NewInMemoryDeadLetterStore()
+	}
+	webhooks := webhook.NewDispatcher(webhook.Params{
+		Endpoints:   webhookStore,
+		DeadLetters: deadLetterStore,
+		Client:      params.WebhookClient,
+		Config:      params.Webhooks,
+		Logger:      logger,
+	})
+	serverMetrics.RegisterWebhookDrops(webhooks.Dropped)
+	streams := stream.NewBroker(params.Streams)
+	idempotencyRetention := params.IdempotencyRetention
+	if idempotencyRetention <= 0 {
+		idempotencyRetention = domain.DefaultIdempotencyRetention
+	}
+
 	return &Server{
-		listenAddress:     params.ListenAddress,
-		signerStore:       &params.SignerStore,
-		keyGeneratorStore: &params.KeyGeneratorStore,
-		deviceStore:       params.DeviceStore,
+		listenAddress:        params.ListenAddress,
+		listener:             params.Listener,
+		grpcListenAddress:    params.GRPCListenAddress,
+		grpcListener:         params.GRPCListener,
+		signerStore:          &params.SignerStore,
+		keyGeneratorStore:    &params.KeyGeneratorStore,
+		verifierStore:        &verifierStore,
+		deviceStore:          params.DeviceStore,
+		tenantStore:          tenantStore,
+		apiKeyStore:          apiKeyStore,
+		authenticator:        params.Authenticator,
+		tlsConfig:            params.TLSConfig,
+		rateLimits:           params.RateLimits,
+		clientLimiter:        ratelimit.NewLimiter(),
+		deviceLimiter:        ratelimit.NewLimiter(),
+		logger:               logger,
+		httpParams:           params.HTTP.withDefaults(),
+		config:               params.Config,
+		metrics:              serverMetrics,
+		webhookStore:         webhookStore,
+		deadLetterStore:      deadLetterStore,
+		webhooks:             webhooks,
+		streams:              streams,
+		idempotencyRetention: idempotencyRetention,
+		events:               domain.EventPublishers{webhooks, streams},
+		startedAt:            time.Now(),
+		selfTestKeys:         make(map[crypto.SignatureAlgorithm]selfTestKey),
+	}
+}
+
+// Run starts the Server and serves requests, and gRPC calls if configured, until ctx is done.
+// It then stops accepting connections, waits for in-flight requests to finish
+// (at most for the shutdown timeout), stops the webhook deliveries and closes the device store if it holds resources.
+func (s *Server) Run(ctx context.Context) error {
+	listener := s.listener
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", s.listenAddress); err != nil {
+			return err
+		}
+	}
+	grpcListener := s.grpcListener
+	if grpcListener == nil && s.grpcListenAddress != "" {
+		var err error
+		if grpcListener, err = net.Listen("tcp", s.grpcListenAddress); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	server := &http.Server{
+		Handler:           s.Handler(),
+		TLSConfig:         s.tlsConfig,
+		ReadHeaderTimeout: s.httpParams.ReadHeaderTimeout,
+		ReadTimeout:       s.httpParams.ReadTimeout,
+		WriteTimeout:      s.httpParams.WriteTimeout,
+		IdleTimeout:       s.httpParams.IdleTimeout,
+		MaxHeaderBytes:    s.httpParams.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelWarn),
+	}
+	// event streams never finish on their own, they end as soon as the shutdown starts
+	server.RegisterOnShutdown(s.streams.Close)
+
+	serveErr := make(chan error, 2)
+	go func() {
+		if s.tlsConfig == nil {
+			serveErr <- server.Serve(listener)
+			return
+		}
+		// the certificates are provided by the TLS configuration
+		serveErr <- server.ServeTLS(listener, "", "")
+	}()
+	var grpcServer *grpc.Server
+	if grpcListener != nil {
+		grpcServer = s.GRPCServer()
+		go func() {
+			serveErr <- grpcServer.Serve(grpcListener)
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		server.Close()
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("shutting down, draining in-flight requests", "timeout", s.httpParams.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.httpParams.ShutdownTimeout)
+	defer cancel()
+	var grpcStopped chan struct{}
+	if grpcServer != nil {
+		grpcStopped = make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(grpcStopped)
+		}()
 	}
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		// requests still running after the timeout are cut off
+		server.Close()
+		err = fmt.Errorf("unable to drain in-flight requests: %w", err)
+	}
+	if grpcServer != nil {
+		select {
+		case <-grpcStopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+			<-grpcStopped
+			err = errors.Join(err, errors.New("unable to drain in-flight gRPC calls"))
+		}
+	}
+
+	// deliveries which are still pending are kept as dead letters
+	s.webhooks.Close()
+	if closer, ok := s.deviceStore.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("unable to close device store: %w", closeErr))
+		}
+	}
+	return err
 }
 
-// Run registers all HandlerFuncs for the existing HTTP routes and starts the Server.
-func (s *Server) Run() error {
+// Handler registers all HandlerFuncs for the existing HTTP routes and returns the resulting handler.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	return s.limitRequestBody(s.observeRequests(mux))
+}
+
+// routeMux is what the routes are registered with, e.g. an http.ServeMux.
+type routeMux interface {
+	Handle(pattern string, handler http.Handler)
+}
 
-	mux.Handle("GET /api/v0/health", http.HandlerFunc(s.Health))
-	mux.Handle("POST /api/v0/signature-device", http.HandlerFunc(s.CreateSignatureDevice))
-	mux.Handle("GET /api/v0/signature-device", http.HandlerFunc(s.ListSignatureDevices))
-	mux.Handle("GET /api/v0/signature-device/{id}", http.HandlerFunc(s.GetSignatureDevice))
-	mux.Handle("POST /api/v0/sign-tx", http.HandlerFunc(s.SignTransaction))
+// registerRoutes registers the handlers of all HTTP routes, every route is described in the OpenAPI document.
+func (s *Server) registerRoutes(mux routeMux) {
+	mux.Handle("GET /api/openapi.json", http.HandlerFunc(ServeOpenAPI))
+	mux.Handle("GET /metrics", s.metrics.Handler())
+	mux.Handle("GET /api/v1/health/live", http.HandlerFunc(s.Liveness))
+	mux.Handle("GET /api/v1/health/ready", http.HandlerFunc(s.Readiness))
+	mux.Handle("POST /api/v1/devices", s.requireScope(auth.ScopeDevicesWrite, s.limitClient(s.CreateSignatureDeviceV1)))
+	mux.Handle("GET /api/v1/devices", s.requireScope(auth.ScopeDevicesRead, s.limitClient(s.ListSignatureDevices)))
+	mux.Handle("GET /api/v1/devices/{id}", s.requireScope(auth.ScopeDevicesRead, s.limitClient(s.GetSignatureDevice)))
+	mux.Handle("PATCH /api/v1/devices/{id}", s.requireScope(auth.ScopeDevicesWrite, s.limitClient(s.UpdateSignatureDevice)))
+	mux.Handle("GET /api/v1/devices/{id}/events", s.requireScope(auth.ScopeDevicesRead, s.limitClient(s.StreamSignatureDeviceEvents)))
+	mux.Handle("POST /api/v1/devices/{id}/keys", s.requireScope(auth.ScopeDevicesWrite, s.limitClient(s.RotateSignatureDeviceKey)))
+	mux.Handle("GET /api/v1/devices/{id}/signatures", s.requireScope(auth.ScopeDevicesRead, s.limitClient(s.ListSignaturesV1)))
+	mux.Handle("POST /api/v1/devices/{id}/signatures", s.requireScope(auth.ScopeSign, s.limitClient(s.CreateSignatureV1)))
+	mux.Handle("POST /api/v1/devices/{id}/signatures/batch", s.requireScope(auth.ScopeSign, s.limitClient(s.CreateSignatureBatchV1)))
+	mux.Handle("POST /api/v1/devices/{id}/verifications", s.requireScope(auth.ScopeDevicesRead, s.limitClient(s.VerifySignatureV1)))
+	mux.Handle("POST /api/v1/api-keys", s.requireScope(auth.ScopeAdmin, s.limitClient(s.CreateAPIKey)))
+	mux.Handle("GET /api/v1/api-keys", s.requireScope(auth.ScopeAdmin, s.limitClient(s.ListAPIKeys)))
+	mux.Handle("DELETE /api/v1/api-keys/{id}", s.requireScope(auth.ScopeAdmin, s.limitClient(s.DeleteAPIKey)))
+	mux.Handle("POST /api/v1/webhooks", s.requireScope(auth.ScopeAdmin, s.limitClient(s.CreateWebhook)))
+	mux.Handle("GET /api/v1/webhooks", s.requireScope(auth.ScopeAdmin, s.limitClient(s.ListWebhooks)))
+	mux.Handle("DELETE /api/v1/webhooks/{id}", s.requireScope(auth.ScopeAdmin, s.limitClient(s.DeleteWebhook)))
+	mux.Handle("GET /api/v1/webhooks/dead-letters", s.requireScope(auth.ScopeAdmin, s.limitClient(s.ListDeadLetters)))
+	mux.Handle("GET /api/v1/webhooks/dead-letters/{id}", s.requireScope(auth.ScopeAdmin, s.limitClient(s.GetDeadLetter)))
+	mux.Handle("POST /api/v1/webhooks/dead-letters/{id}/replay", s.requireScope(auth.ScopeAdmin, s.limitClient(s.ReplayDeadLetter)))
+	mux.Handle("GET /api/v1/admin/config", s.requireScope(auth.ScopeAdmin, s.limitClient(s.GetConfig)))
 
-	return http.ListenAndServe(s.listenAddress, mux)
+	// API v0 keeps working, its responses announce the v1 routes replacing them
+	// the original health endpoint reports liveness for existing probes
+	mux.Handle("GET /api/v0/health", deprecated("/api/v1/health/live", http.HandlerFunc(s.Liveness)))
+	mux.Handle("GET /api/v0/health/live", deprecated("/api/v1/health/live", http.HandlerFunc(s.Liveness)))
+	mux.Handle("GET /api/v0/health/ready", deprecated("/api/v1/health/ready", http.HandlerFunc(s.Readiness)))
+	mux.Handle("POST /api/v0/signature-device", deprecated("/api/v1/devices", s.requireScope(auth.ScopeDevicesWrite, s.limitClient(s.CreateSignatureDevice))))
+	mux.Handle("GET /api/v0/signature-device", deprecated("/api/v1/devices", s.requireScope(auth.ScopeDevicesRead, s.limitClient(s.ListSignatureDevices))))
+	mux.Handle("GET /api/v0/signature-device/{id}", deprecated("/api/v1/devices/{id}", s.requireScope(auth.ScopeDevicesRead, s.limitClient(s.GetSignatureDevice))))
+	mux.Handle("PATCH /api/v0/signature-device/{id}", deprecated("/api/v1/devices/{id}", s.requireScope(auth.ScopeDevicesWrite, s.limitClient(s.UpdateSignatureDevice))))
+	mux.Handle("GET /api/v0/signature-device/{id}/events", deprecated("/api/v1/devices/{id}/events", s.requireScope(auth.ScopeDevicesRead, s.limitClient(s.StreamSignatureDeviceEventsV0))))
+	mux.Handle("POST /api/v0/signature-device/{id}/rotate-key", deprecated("/api/v1/devices/{id}/keys", s.requireScope(auth.ScopeDevicesWrite, s.limitClient(s.RotateSignatureDeviceKey))))
+	mux.Handle("POST /api/v0/signature-device/{id}/sign-batch", deprecated("/api/v1/devices/{id}/signatures/batch", s.requireScope(auth.ScopeSign, s.limitClient(s.SignBatch))))
+	mux.Handle("POST /api/v0/sign-tx", deprecated("/api/v1/devices/{id}/signatures", s.requireScope(auth.ScopeSign, s.limitClient(s.SignTransaction))))
+	mux.Handle("POST /api/v0/verify-tx", deprecated("/api/v1/devices/{id}/verifications", s.requireScope(auth.ScopeDevicesRead, s.limitClient(s.VerifyTransaction))))
+	mux.Handle("POST /api/v0/api-keys", deprecated("/api/v1/api-keys", s.requireScope(auth.ScopeAdmin, s.limitClient(s.CreateAPIKey))))
+	mux.Handle("GET /api/v0/api-keys", deprecated("/api/v1/api-keys", s.requireScope(auth.ScopeAdmin, s.limitClient(s.ListAPIKeys))))
+	mux.Handle("DELETE /api/v0/api-keys/{id}", deprecated("/api/v1/api-keys/{id}", s.requireScope(auth.ScopeAdmin, s.limitClient(s.DeleteAPIKey))))
+	mux.Handle("POST /api/v0/webhooks", deprecated("/api/v1/webhooks", s.requireScope(auth.ScopeAdmin, s.limitClient(s.CreateWebhook))))
+	mux.Handle("GET /api/v0/webhooks", deprecated("/api/v1/webhooks", s.requireScope(auth.ScopeAdmin, s.limitClient(s.ListWebhooks))))
+	mux.Handle("DELETE /api/v0/webhooks/{id}", deprecated("/api/v1/webhooks/{id}", s.requireScope(auth.ScopeAdmin, s.limitClient(s.DeleteWebhook))))
+	mux.Handle("GET /api/v0/webhooks/dead-letters", deprecated("/api/v1/webhooks/dead-letters", s.requireScope(auth.ScopeAdmin, s.limitClient(s.ListDeadLetters))))
+	mux.Handle("GET /api/v0/webhooks/dead-letters/{id}", deprecated("/api/v1/webhooks/dead-letters/{id}", s.requireScope(auth.ScopeAdmin, s.limitClient(s.GetDeadLetter))))
+	mux.Handle("POST /api/v0/webhooks/dead-letters/{id}/replay", deprecated("/api/v1/webhooks/dead-letters/{id}/replay", s.requireScope(auth.ScopeAdmin, s.limitClient(s.ReplayDeadLetter))))
+	mux.Handle("GET /api/v0/admin/config", deprecated("/api/v1/admin/config", s.requireScope(auth.ScopeAdmin, s.limitClient(s.GetConfig))))
 }
 
 // WriteInternalError writes a default internal error message as an HTTP response.
@@ -62,22 +409,36 @@ func WriteInternalError(w http.ResponseWriter) {
 	w.Write([]byte(http.StatusText(http.StatusInternalServerError)))
 }
 
+// writeContextError writes an error response if err was caused by the request context ending:
+// 499 when the client cancelled the request and 504 when its deadline was exceeded.
+// If the return value is false, err is unrelated to the context and the handler has to report it.
+func writeContextError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled):
+		WriteErrorResponse(w, StatusClientClosedRequest, []string{
+			"Request was cancelled",
+		})
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		WriteErrorResponse(w, http.StatusGatewayTimeout, []string{
+			"Request timed out",
+		})
+		return true
+	}
+	return false
+}
+
 // WriteErrorResponse takes an HTTP status code and a slice of errors
-// and writes those as an HTTP error response in a structured format.
+// and writes those as a problem (RFC 7807) with the generic code of the status.
 func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-
-	errorResponse := ErrorResponse{
+	problemCode, title := statusProblem(code)
+	writeProblem(w, Problem{
+		Status: code,
+		Code:   problemCode,
+		Title:  title,
+		Detail: strings.Join(errors, "; "),
 		Errors: errors,
-	}
-
-	bytes, err := json.Marshal(errorResponse)
-	if err != nil {
-		WriteInternalError(w)
-	}
-
-	w.Write(bytes)
+	})
 }
 
 // WriteAPIResponse takes an HTTP status code and a generic data struct
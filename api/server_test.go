@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+// blockingGenerator holds key generation until released, to keep a request in flight.
+type blockingGenerator struct {
+	started  chan struct{}
+	release  chan struct{}
+	delegate crypto.KeyGenerator
+}
+
+func (g *blockingGenerator) GenerateKeyPair(ctx context.Context) ([]byte, []byte, error) {
+	close(g.started)
+	<-g.release
+	return g.delegate.GenerateKeyPair(ctx)
+}
+
+// closingStore records whether it was closed.
+type closingStore struct {
+	*persistence.InMemorySignatureDeviceStore
+	closed atomic.Bool
+}
+
+func (s *closingStore) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func TestServerRun_GracefulShutdown(t *testing.T) {
+	generator := &blockingGenerator{started: make(chan struct{}), release: make(chan struct{}), delegate: &crypto.ECCGenerator{}}
+	store := &closingStore{InMemorySignatureDeviceStore: persistence.NewInMemorySignatureDeviceStore()}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := NewServer(ServerParams{
+		Listener:          listener,
+		KeyGeneratorStore: crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{crypto.ECC: generator}),
+		SignerStore: crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+			crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+		}),
+		DeviceStore: store,
+		HTTP:        HTTPParams{ShutdownTimeout: 5 * time.Second},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx) }()
+
+	url := "http://" + listener.Addr().String() + "/api/v0/signature-device"
+	body, _ := json.Marshal(CreateSignatureDeviceRequest{Algorithm: crypto.ECC, Label: "in flight"})
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	<-generator.started
+	cancel()
+	select {
+	case err := <-runErr:
+		t.Fatalf("Run returned before the in-flight request finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if store.closed.Load() {
+		t.Fatalf("store closed while a request was in flight")
+	}
+
+	close(generator.release)
+	if code := <-status; code != http.StatusOK {
+		t.Fatalf("expected in-flight request to complete with 200, got %d", code)
+	}
+	if err := <-runErr; err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if !store.closed.Load() {
+		t.Fatalf("expected store to be closed after shutdown")
+	}
+	if devices, _ := store.List(context.Background(), domain.DefaultTenantID); len(devices) != 1 {
+		t.Fatalf("expected in-flight device to be saved, got %d devices", len(devices))
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Fatalf("expected new connections to be refused after shutdown")
+	}
+}
+
+func TestServerRun_ShutdownTimeoutWithoutGRPC(t *testing.T) {
+	// the drain timing out without a gRPC server must not stop the missing gRPC server, repeated as the
+	// shutdown used to pick between the two at random
+	for i := 0; i < 10; i++ {
+		generator := &blockingGenerator{started: make(chan struct{}), release: make(chan struct{}), delegate: &crypto.ECCGenerator{}}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		srv := NewServer(ServerParams{
+			Listener:          listener,
+			KeyGeneratorStore: crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{crypto.ECC: generator}),
+			SignerStore: crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+				crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+			}),
+			DeviceStore: persistence.NewInMemorySignatureDeviceStore(),
+			HTTP:        HTTPParams{ShutdownTimeout: 20 * time.Millisecond},
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		runErr := make(chan error, 1)
+		go func() { runErr <- srv.Run(ctx) }()
+
+		body, _ := json.Marshal(CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+		go func() {
+			resp, err := http.Post("http://"+listener.Addr().String()+"/api/v0/signature-device", "application/json", bytes.NewReader(body))
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+
+		<-generator.started
+		cancel()
+		err = <-runErr
+		close(generator.release)
+		if err == nil || !strings.Contains(err.Error(), "unable to drain in-flight requests") || strings.Contains(err.Error(), "gRPC") {
+			t.Fatalf("expected the HTTP drain to time out, got %v", err)
+		}
+	}
+}
+
+func TestHTTPParams_Defaults(t *testing.T) {
+	params := HTTPParams{WriteTimeout: time.Minute}.withDefaults()
+	if params.WriteTimeout != time.Minute {
+		t.Fatalf("expected configured write timeout to be kept, got %v", params.WriteTimeout)
+	}
+	if params.ReadHeaderTimeout != DefaultReadHeaderTimeout || params.MaxHeaderBytes != DefaultMaxHeaderBytes {
+		t.Fatalf("expected defaults for unset params, got %+v", params)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	srv := newTestServer(t)
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", nil, CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodGet, "/metrics", nil, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	expected := `signing_http_requests_total{method="POST",route="POST /api/v0/signature-device",status="200"} 1`
+	if !strings.Contains(rr.Body.String(), expected) {
+		t.Fatalf("expected %q in metrics:\n%s", expected, rr.Body.String())
+	}
+}
@@ -0,0 +1,4 @@
+// Package signingpb contains the protobuf messages and gRPC stubs of the signing service API.
+package signingpb
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative api/signingpb/signing.proto
@@ -0,0 +1,296 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: api/signingpb/signing.proto
+
+// The gRPC API of the signing service, mirroring the REST API under /api/v0.
+
+package signingpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SignatureDeviceService_CreateSignatureDevice_FullMethodName = "/signing.v0.SignatureDeviceService/CreateSignatureDevice"
+	SignatureDeviceService_GetSignatureDevice_FullMethodName    = "/signing.v0.SignatureDeviceService/GetSignatureDevice"
+	SignatureDeviceService_ListSignatureDevices_FullMethodName  = "/signing.v0.SignatureDeviceService/ListSignatureDevices"
+	SignatureDeviceService_SignTransaction_FullMethodName       = "/signing.v0.SignatureDeviceService/SignTransaction"
+	SignatureDeviceService_VerifySignature_FullMethodName       = "/signing.v0.SignatureDeviceService/VerifySignature"
+)
+
+// SignatureDeviceServiceClient is the client API for SignatureDeviceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// SignatureDeviceService creates signature devices and signs data with them.
+// Callers authenticate with the same credentials as on the REST API, sent as metadata
+// (x-api-key or authorization), or with a client certificate. The x-tenant-id metadata
+// selects the tenant of unauthenticated calls.
+type SignatureDeviceServiceClient interface {
+	// CreateSignatureDevice creates a new signature device with a newly generated key pair.
+	CreateSignatureDevice(ctx context.Context, in *CreateSignatureDeviceRequest, opts ...grpc.CallOption) (*CreateSignatureDeviceResponse, error)
+	// GetSignatureDevice returns a single signature device.
+	GetSignatureDevice(ctx context.Context, in *GetSignatureDeviceRequest, opts ...grpc.CallOption) (*SignatureDevice, error)
+	// ListSignatureDevices lists all signature devices of the tenant.
+	ListSignatureDevices(ctx context.Context, in *ListSignatureDevicesRequest, opts ...grpc.CallOption) (*ListSignatureDevicesResponse, error)
+	// SignTransaction signs data with a signature device and advances its signature chain.
+	SignTransaction(ctx context.Context, in *SignTransactionRequest, opts ...grpc.CallOption) (*SignTransactionResponse, error)
+	// VerifySignature checks a signature against the public key of a signature device.
+	VerifySignature(ctx context.Context, in *VerifySignatureRequest, opts ...grpc.CallOption) (*VerifySignatureResponse, error)
+}
+
+type signatureDeviceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSignatureDeviceServiceClient(cc grpc.ClientConnInterface) SignatureDeviceServiceClient {
+	return &signatureDeviceServiceClient{cc}
+}
+
+func (c *signatureDeviceServiceClient) CreateSignatureDevice(ctx context.Context, in *CreateSignatureDeviceRequest, opts ...grpc.CallOption) (*CreateSignatureDeviceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateSignatureDeviceResponse)
+	err := c.cc.Invoke(ctx, SignatureDeviceService_CreateSignatureDevice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signatureDeviceServiceClient) GetSignatureDevice(ctx context.Context, in *GetSignatureDeviceRequest, opts ...grpc.CallOption) (*SignatureDevice, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SignatureDevice)
+	err := c.cc.Invoke(ctx, SignatureDeviceService_GetSignatureDevice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signatureDeviceServiceClient) ListSignatureDevices(ctx context.Context, in *ListSignatureDevicesRequest, opts ...grpc.CallOption) (*ListSignatureDevicesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSignatureDevicesResponse)
+	err := c.cc.Invoke(ctx, SignatureDeviceService_ListSignatureDevices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signatureDeviceServiceClient) SignTransaction(ctx context.Context, in *SignTransactionRequest, opts ...grpc.CallOption) (*SignTransactionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SignTransactionResponse)
+	err := c.cc.Invoke(ctx, SignatureDeviceService_SignTransaction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signatureDeviceServiceClient) VerifySignature(ctx context.Context, in *VerifySignatureRequest, opts ...grpc.CallOption) (*VerifySignatureResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VerifySignatureResponse)
+	err := c.cc.Invoke(ctx, SignatureDeviceService_VerifySignature_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SignatureDeviceServiceServer is the server API for SignatureDeviceService service.
+// All implementations must embed UnimplementedSignatureDeviceServiceServer
+// for forward compatibility.
+//
+// SignatureDeviceService creates signature devices and signs data with them.
+// Callers authenticate with the same credentials as on the REST API, sent as metadata
+// (x-api-key or authorization), or with a client certificate. The x-tenant-id metadata
+// selects the tenant of unauthenticated calls.
+type SignatureDeviceServiceServer interface {
+	// CreateSignatureDevice creates a new signature device with a newly generated key pair.
+	CreateSignatureDevice(context.Context, *CreateSignatureDeviceRequest) (*CreateSignatureDeviceResponse, error)
+	// GetSignatureDevice returns a single signature device.
+	GetSignatureDevice(context.Context, *GetSignatureDeviceRequest) (*SignatureDevice, error)
+	// ListSignatureDevices lists all signature devices of the tenant.
+	ListSignatureDevices(context.Context, *ListSignatureDevicesRequest) (*ListSignatureDevicesResponse, error)
+	// SignTransaction signs data with a signature device and advances its signature chain.
+	SignTransaction(context.Context, *SignTransactionRequest) (*SignTransactionResponse, error)
+	// VerifySignature checks a signature against the public key of a signature device.
+	VerifySignature(context.Context, *VerifySignatureRequest) (*VerifySignatureResponse, error)
+	mustEmbedUnimplementedSignatureDeviceServiceServer()
+}
+
+// UnimplementedSignatureDeviceServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSignatureDeviceServiceServer struct{}
+
+func (UnimplementedSignatureDeviceServiceServer) CreateSignatureDevice(context.Context, *CreateSignatureDeviceRequest) (*CreateSignatureDeviceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSignatureDevice not implemented")
+}
+func (UnimplementedSignatureDeviceServiceServer) GetSignatureDevice(context.Context, *GetSignatureDeviceRequest) (*SignatureDevice, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSignatureDevice not implemented")
+}
+func (UnimplementedSignatureDeviceServiceServer) ListSignatureDevices(context.Context, *ListSignatureDevicesRequest) (*ListSignatureDevicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSignatureDevices not implemented")
+}
+func (UnimplementedSignatureDeviceServiceServer) SignTransaction(context.Context, *SignTransactionRequest) (*SignTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SignTransaction not implemented")
+}
+func (UnimplementedSignatureDeviceServiceServer) VerifySignature(context.Context, *VerifySignatureRequest) (*VerifySignatureResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifySignature not implemented")
+}
+func (UnimplementedSignatureDeviceServiceServer) mustEmbedUnimplementedSignatureDeviceServiceServer() {
+}
+func (UnimplementedSignatureDeviceServiceServer) testEmbeddedByValue() {}
+
+// UnsafeSignatureDeviceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SignatureDeviceServiceServer will
+// result in compilation errors.
+type UnsafeSignatureDeviceServiceServer interface {
+	mustEmbedUnimplementedSignatureDeviceServiceServer()
+}
+
+func RegisterSignatureDeviceServiceServer(s grpc.ServiceRegistrar, srv SignatureDeviceServiceServer) {
+	// If the following call pancis, it indicates UnimplementedSignatureDeviceServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SignatureDeviceService_ServiceDesc, srv)
+}
+
+func _SignatureDeviceService_CreateSignatureDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSignatureDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignatureDeviceServiceServer).CreateSignatureDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignatureDeviceService_CreateSignatureDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignatureDeviceServiceServer).CreateSignatureDevice(ctx, req.(*CreateSignatureDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignatureDeviceService_GetSignatureDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSignatureDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignatureDeviceServiceServer).GetSignatureDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignatureDeviceService_GetSignatureDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignatureDeviceServiceServer).GetSignatureDevice(ctx, req.(*GetSignatureDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignatureDeviceService_ListSignatureDevices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSignatureDevicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignatureDeviceServiceServer).ListSignatureDevices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignatureDeviceService_ListSignatureDevices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignatureDeviceServiceServer).ListSignatureDevices(ctx, req.(*ListSignatureDevicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignatureDeviceService_SignTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignatureDeviceServiceServer).SignTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignatureDeviceService_SignTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignatureDeviceServiceServer).SignTransaction(ctx, req.(*SignTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignatureDeviceService_VerifySignature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifySignatureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignatureDeviceServiceServer).VerifySignature(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignatureDeviceService_VerifySignature_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignatureDeviceServiceServer).VerifySignature(ctx, req.(*VerifySignatureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SignatureDeviceService_ServiceDesc is the grpc.ServiceDesc for SignatureDeviceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SignatureDeviceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "signing.v0.SignatureDeviceService",
+	HandlerType: (*SignatureDeviceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateSignatureDevice",
+			Handler:    _SignatureDeviceService_CreateSignatureDevice_Handler,
+		},
+		{
+			MethodName: "GetSignatureDevice",
+			Handler:    _SignatureDeviceService_GetSignatureDevice_Handler,
+		},
+		{
+			MethodName: "ListSignatureDevices",
+			Handler:    _SignatureDeviceService_ListSignatureDevices_Handler,
+		},
+		{
+			MethodName: "SignTransaction",
+			Handler:    _SignatureDeviceService_SignTransaction_Handler,
+		},
+		{
+			MethodName: "VerifySignature",
+			Handler:    _SignatureDeviceService_VerifySignature_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "api/signingpb/signing.proto",
+}
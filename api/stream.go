@@ -0,0 +1,241 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/stream"
+)
+
+const (
+	// EventStreamContentType is the content type of Server-Sent Events.
+	EventStreamContentType = "text/event-stream"
+	// LastEventIDHeader carries the ID of the last event a reconnecting client received.
+	LastEventIDHeader = "Last-Event-ID"
+
+	// eventDeviceSnapshot is the first event of a stream, the device as it was when the stream started.
+	eventDeviceSnapshot = "device.snapshot"
+	// eventStreamReset tells the client that signatures it did not receive are no longer available.
+	eventStreamReset = "stream.reset"
+
+	// streamReadLimit is how many signatures a stream reads from the store at once.
+	streamReadLimit = 100
+)
+
+// streamReset is the data of a stream.reset event: the signatures from counter missedFrom up to resumedAt
+// (excluded) can not be sent, the stream continues with the signature of counter resumedAt.
+type streamReset struct {
+	MissedFrom uint64 `json:"missedFrom"`
+	ResumedAt  uint64 `json:"resumedAt"`
+}
+
+// StreamSignatureDeviceEvents streams the events of a signature device as Server-Sent Events,
+// starting with a snapshot of the device. Signatures carry their counter as event ID: if the client
+// sends the Last-Event-ID header, the signatures following that counter are sent first.
+// Signatures are sent in the order of their counters without gaps: the ones the broker of this instance did not
+// deliver, e.g. created by another instance, are read from the store. If they are no longer in the signature log
+// of the device, a stream.reset event tells the client which counters it misses.
+func (s *Server) StreamSignatureDeviceEvents(response http.ResponseWriter, request *http.Request) {
+	s.streamSignatureDeviceEvents(response, request, false)
+}
+
+// StreamSignatureDeviceEventsV0 streams the events of a signature device like StreamSignatureDeviceEvents,
+// its signature.created events also carry the signed data under its former name signed_data.
+func (s *Server) StreamSignatureDeviceEventsV0(response http.ResponseWriter, request *http.Request) {
+	s.streamSignatureDeviceEvents(response, request, true)
+}
+
+func (s *Server) streamSignatureDeviceEvents(response http.ResponseWriter, request *http.Request, legacy bool) {
+	id := request.PathValue("id")
+	logDeviceID(request.Context(), id)
+	if strings.TrimSpace(id) == "" {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"id is required",
+		})
+		return
+	}
+
+	var after *uint64
+	if lastEventID := request.Header.Get(LastEventIDHeader); lastEventID != "" {
+		counter, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				fmt.Sprintf("%s must be a signature counter", LastEventIDHeader),
+			})
+			return
+		}
+		after = &counter
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	// subscribe before reading the device, so no event happening in between is missed
+	subscription, replay := s.streams.Subscribe(tenant.ID, id, after)
+	defer s.streams.Unsubscribe(subscription)
+
+	device, err := s.deviceStore.Get(request.Context(), tenant.ID, id)
+	if err != nil {
+		writeError(response, err, "Could not retrieve signature device")
+		return
+	}
+	// an ID beyond the chain would skip the signatures up to it (or wrap around to the start of the chain)
+	if after != nil && *after >= device.GetSignatureCounter() {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			fmt.Sprintf("%s %d is beyond the last signature of the device", LastEventIDHeader, *after),
+		})
+		return
+	}
+
+	response.Header().Set("Content-Type", EventStreamContentType)
+	response.Header().Set("Cache-Control", "no-store")
+	// keeps reverse proxies from buffering the stream
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+
+	// the write timeout of the server applies to every message instead of the whole stream
+	controller := http.NewResponseController(response)
+	send := func(message []byte) bool {
+		controller.SetWriteDeadline(time.Now().Add(s.httpParams.WriteTimeout))
+		if _, err := response.Write(message); err != nil {
+			return false
+		}
+		return controller.Flush() == nil
+	}
+
+	if !send(formatEvent("", eventDeviceSnapshot, newSignatureDevice(device))) {
+		return
+	}
+
+	// next is the counter of the next signature to send
+	next := device.GetSignatureCounter()
+	if after != nil {
+		next = *after + 1
+	}
+	// catchUp sends the signatures from next on as read from the store, committed is the counter up to which
+	// (excluded) signatures are known to exist
+	catchUp := func(committed uint64) bool {
+		for {
+			results, err := s.deviceStore.ListSignatures(request.Context(), tenant.ID, id, next, streamReadLimit)
+			if err != nil {
+				// read again on the next poll
+				s.requestLogger(request.Context()).Warn("unable to read the signatures of the event stream", "error", err)
+				return true
+			}
+			if len(results) > 0 && results[0].Counter > next || len(results) == 0 && next < committed {
+				resumedAt := committed
+				if len(results) > 0 {
+					resumedAt = results[0].Counter
+				}
+				// the ID lets a reconnecting client continue after the gap
+				reset := streamReset{MissedFrom: next, ResumedAt: resumedAt}
+				if !send(formatEvent(strconv.FormatUint(resumedAt-1, 10), eventStreamReset, reset)) {
+					return false
+				}
+				next = resumedAt
+			}
+			for _, result := range results {
+				event := domain.NewEvent(domain.EventSignatureCreated, tenant.ID, id, newSignatureCreatedEvent(result))
+				if !send(formatDomainEvent(event, legacy)) {
+					return false
+				}
+				next = result.Counter + 1
+			}
+			if len(results) < streamReadLimit {
+				return true
+			}
+		}
+	}
+	// deliver sends an event of the broker, signatures are only sent in the order of their counters
+	deliver := func(event domain.Event) bool {
+		sequence, ok := stream.Sequence(event)
+		switch {
+		case !ok:
+			return send(formatDomainEvent(event, legacy))
+		case sequence < next:
+			// already sent
+			return true
+		case sequence == next:
+			next++
+			return send(formatDomainEvent(event, legacy))
+		}
+		// published out of order or signatures of another instance are missing
+		return catchUp(sequence + 1)
+	}
+
+	for _, event := range replay {
+		if !deliver(event) {
+			return
+		}
+	}
+	if !catchUp(device.GetSignatureCounter()) {
+		return
+	}
+
+	heartbeat := time.NewTicker(s.streams.Config().Heartbeat)
+	defer heartbeat.Stop()
+	poll := time.NewTicker(s.streams.Config().Poll)
+	defer poll.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !send([]byte(": heartbeat\n\n")) {
+				return
+			}
+		case <-poll.C:
+			if !catchUp(next) {
+				return
+			}
+		case event, ok := <-subscription.Events():
+			if !ok {
+				if s.streams.Dropped(subscription) {
+					s.requestLogger(request.Context()).Warn("event stream dropped, the client did not keep up")
+				}
+				return
+			}
+			if !deliver(event) {
+				return
+			}
+		}
+	}
+}
+
+// formatDomainEvent formats an event of a device as a Server-Sent Event, identified by its sequence number if any.
+// Legacy events use the data of the v0 event stream.
+func formatDomainEvent(event domain.Event, legacy bool) []byte {
+	var id string
+	if sequence, ok := stream.Sequence(event); ok {
+		id = strconv.FormatUint(sequence, 10)
+	}
+	data := event.Data
+	if created, ok := data.(signatureCreatedEvent); ok && legacy {
+		data = legacySignatureCreatedEvent{signatureCreatedEvent: created, LegacySignedData: created.SignedData}
+	}
+	return formatEvent(id, string(event.Type), data)
+}
+
+// formatEvent formats a Server-Sent Event with JSON data, it has no ID field if id is empty.
+// Clients keep the last ID they received in that case.
+func formatEvent(id string, eventType string, data any) []byte {
+	var builder strings.Builder
+	if id != "" {
+		fmt.Fprintf(&builder, "id: %s\n", id)
+	}
+	fmt.Fprintf(&builder, "event: %s\n", eventType)
+	// JSON without indentation is a single line, as required for a data field
+	payload, err := json.Marshal(data)
+	if err != nil {
+		payload = []byte("null")
+	}
+	fmt.Fprintf(&builder, "data: %s\n\n", payload)
+	return []byte(builder.String())
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+	"github.com/ksrichard/signing-service-challenge/stream"
+)
+
+// sseEvent is an event received from an event stream.
+type sseEvent struct {
+	id        string
+	eventType string
+	data      string
+}
+
+// helper to open the event stream of a device, the events are read in the background
+func openEventStream(t *testing.T, url string, lastEventID string) (*http.Response, chan sseEvent) {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if lastEventID != "" {
+		request.Header.Set(LastEventIDHeader, lastEventID)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(response.Body)
+		var event sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event.eventType != "" {
+					events <- event
+				}
+				event = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.eventType = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return response, events
+}
+
+func receiveEvent(t *testing.T, events chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatalf("event stream ended")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event received")
+		return sseEvent{}
+	}
+}
+
+func TestStreamSignatureDeviceEvents(t *testing.T) {
+	srv := newTestServer(t)
+	httpServer := httptest.NewServer(srv.Handler())
+	t.Cleanup(httpServer.Close)
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", nil, CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+	var device struct {
+		Data CreateSignatureDeviceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &device); err != nil {
+		t.Fatalf("create device: %d %s", rr.Code, rr.Body.String())
+	}
+	sign := func() {
+		t.Helper()
+		rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: device.Data.ID, Data: "data"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("sign: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	url := httpServer.URL + "/api/v0/signature-device/" + device.Data.ID + "/events"
+
+	sign()
+	response, events := openEventStream(t, url, "")
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != EventStreamContentType {
+		t.Fatalf("unexpected response: %d %s", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+	snapshot := receiveEvent(t, events)
+	var current signatureDevice
+	if err := json.Unmarshal([]byte(snapshot.data), &current); err != nil || snapshot.eventType != "device.snapshot" || current.SignatureCounter != 1 {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+
+	// new signatures are identified by their counter
+	sign()
+	event := receiveEvent(t, events)
+	var signature signatureCreatedEvent
+	if err := json.Unmarshal([]byte(event.data), &signature); err != nil || event.eventType != "signature.created" || event.id != "1" ||
+		signature.Counter != 1 || !strings.HasPrefix(signature.SignedData, "1_data_") {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodPatch, "/api/v0/signature-device/"+device.Data.ID, nil, UpdateSignatureDeviceRequest{State: domain.StateSuspended})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("suspend: %d %s", rr.Code, rr.Body.String())
+	}
+	event = receiveEvent(t, events)
+	if event.eventType != "device.state_changed" || event.id != "" || !strings.Contains(event.data, `"state":"suspended"`) {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	// reconnecting clients receive the signatures they missed first
+	_, resumed := openEventStream(t, url, "0")
+	if event := receiveEvent(t, resumed); event.eventType != "device.snapshot" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	if event := receiveEvent(t, resumed); event.eventType != "signature.created" || event.id != "1" ||
+		!strings.Contains(event.data, `"signed_data":"1_data_`) {
+		t.Fatalf("expected the missed signature with the v0 field names, got %+v", event)
+	}
+	// the v1 stream only uses the camelCase names
+	_, resumedV1 := openEventStream(t, httpServer.URL+"/api/v1/devices/"+device.Data.ID+"/events", "0")
+	receiveEvent(t, resumedV1)
+	if event := receiveEvent(t, resumedV1); event.eventType != "signature.created" ||
+		!strings.Contains(event.data, `"signedData":"1_data_`) || strings.Contains(event.data, "signed_data") {
+		t.Fatalf("expected the missed signature with the v1 field names, got %+v", event)
+	}
+
+	srv.streams.Close()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatalf("unexpected event after close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the stream to end once the streams are closed")
+	}
+}
+
+func TestStreamSignatureDeviceEvents_Errors(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device/unknown/events", nil, nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device/unknown/events", map[string]string{LastEventIDHeader: "last"}, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid Last-Event-ID, got %d", rr.Code)
+	}
+
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.ECC, "lbl")
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, err := persistence.SignData(context.Background(), srv.deviceStore, domain.DefaultTenantID, dev.GetIDStr(), "data"); err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+	target := "/api/v0/signature-device/" + dev.GetIDStr() + "/events"
+	// IDs beyond the last signature would drop the signatures up to them, the largest one would wrap around
+	for _, lastEventID := range []string{"1", "5", strconv.FormatUint(math.MaxUint64, 10)} {
+		rr = doHandlerReq(t, srv, http.MethodGet, target, map[string]string{LastEventIDHeader: lastEventID}, nil)
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "beyond the last signature") {
+			t.Fatalf("expected 400 for Last-Event-ID %s, got %d: %s", lastEventID, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// trimmedLogStore is a device store whose signature logs start at counter first, as if older entries were trimmed.
+type trimmedLogStore struct {
+	persistence.SignatureDeviceStore
+	first atomic.Uint64
+}
+
+func (s *trimmedLogStore) ListSignatures(ctx context.Context, tenantID string, id string, from uint64, limit int) ([]domain.SignDataResult, error) {
+	return s.SignatureDeviceStore.ListSignatures(ctx, tenantID, id, max(from, s.first.Load()), limit)
+}
+
+func TestStreamSignatureDeviceEvents_SharedStore(t *testing.T) {
+	// two instances sharing a store, streams only subscribe to the broker of the second one
+	first := newTestServer(t)
+	trimmed := &trimmedLogStore{SignatureDeviceStore: first.deviceStore}
+	second := NewServer(ServerParams{
+		SignerStore:       *first.signerStore,
+		KeyGeneratorStore: *first.keyGeneratorStore,
+		DeviceStore:       trimmed,
+		Streams:           stream.Config{Poll: 10 * time.Millisecond},
+	})
+	t.Cleanup(func() { second.webhooks.Close() })
+	httpServer := httptest.NewServer(second.Handler())
+	t.Cleanup(httpServer.Close)
+
+	rr := doHandlerReq(t, first, http.MethodPost, "/api/v0/signature-device", nil, CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+	var device struct {
+		Data CreateSignatureDeviceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &device); err != nil {
+		t.Fatalf("create device: %d %s", rr.Code, rr.Body.String())
+	}
+	sign := func() {
+		t.Helper()
+		rr := doHandlerReq(t, first, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: device.Data.ID, Data: "data"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("sign: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	url := httpServer.URL + "/api/v0/signature-device/" + device.Data.ID + "/events"
+
+	_, events := openEventStream(t, url, "")
+	if event := receiveEvent(t, events); event.eventType != "device.snapshot" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	// signatures of the other instance are read from the store
+	sign()
+	sign()
+	for _, id := range []string{"0", "1"} {
+		if event := receiveEvent(t, events); event.eventType != "signature.created" || event.id != id {
+			t.Fatalf("expected signature %s, got %+v", id, event)
+		}
+	}
+
+	// resuming from the store, which no longer has the signature of counter 1
+	trimmed.first.Store(2)
+	sign()
+	_, resumed := openEventStream(t, url, "0")
+	if event := receiveEvent(t, resumed); event.eventType != "device.snapshot" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	event := receiveEvent(t, resumed)
+	var reset streamReset
+	if err := json.Unmarshal([]byte(event.data), &reset); err != nil || event.eventType != "stream.reset" || event.id != "1" ||
+		reset != (streamReset{MissedFrom: 1, ResumedAt: 2}) {
+		t.Fatalf("expected a reset, got %+v", event)
+	}
+	if event := receiveEvent(t, resumed); event.eventType != "signature.created" || event.id != "2" {
+		t.Fatalf("expected signature 2 after the reset, got %+v", event)
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+const (
+	// TenantHeader is the request header naming the tenant a request acts for.
+	TenantHeader = "X-Tenant-ID"
+)
+
+var (
+	errForeignTenant = errors.New("not allowed to act for tenant")
+)
+
+// resolveTenant resolves the tenant a call acts for, given the tenant requested by the caller (if any).
+// Authenticated callers always act for their own tenant, otherwise the requested tenant decides, falling back to the default tenant.
+// It returns errForeignTenant if an authenticated caller requested another tenant, and persistence.ErrTenantNotFound
+// (with the ID of the unknown tenant set on the returned tenant) if the tenant does not exist.
+func (s *Server) resolveTenant(ctx context.Context, tenantID string) (domain.Tenant, error) {
+	tenantID = strings.TrimSpace(tenantID)
+	if identity, ok := auth.IdentityFromContext(ctx); ok {
+		if tenantID != "" && tenantID != identity.TenantID {
+			return domain.Tenant{ID: tenantID}, errForeignTenant
+		}
+		tenantID = identity.TenantID
+	}
+	if tenantID == "" {
+		tenantID = domain.DefaultTenantID
+	}
+
+	tenant, err := s.tenantStore.Get(ctx, tenantID)
+	if err != nil {
+		return domain.Tenant{ID: tenantID}, err
+	}
+	return tenant, nil
+}
+
+// requestTenant resolves the tenant the request acts for, requested by the TenantHeader.
+// If the second return value is false, the handler must return because there was an error.
+func (s *Server) requestTenant(response http.ResponseWriter, request *http.Request) (domain.Tenant, bool) {
+	tenant, err := s.resolveTenant(request.Context(), request.Header.Get(TenantHeader))
+	switch {
+	case errors.Is(err, errForeignTenant):
+		writeErrorDetail(response, err, "Not allowed to act for tenant", fmt.Sprintf("Not allowed to act for tenant: %q", tenant.ID))
+		return domain.Tenant{}, false
+	case errors.Is(err, persistence.ErrTenantNotFound):
+		writeErrorDetail(response, err, "Unknown tenant", fmt.Sprintf("Unknown tenant: %q", tenant.ID))
+		return domain.Tenant{}, false
+	case err != nil:
+		writeError(response, err, "Unable to resolve tenant")
+		return domain.Tenant{}, false
+	}
+
+	return tenant, true
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+// helper to perform a JSON request as the given tenant
+func doTenantReq(t *testing.T, handler http.HandlerFunc, tenantID, method, pattern, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal body: %v", err)
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TenantHeader, tenantID)
+	rr := httptest.NewRecorder()
+	mux := http.NewServeMux()
+	mux.Handle(method+" "+pattern, handler)
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func newTenantTestServer(t *testing.T) *Server {
+	t.Helper()
+	srv := newTestServer(t)
+	srv.tenantStore = persistence.NewInMemoryTenantStore(
+		domain.Tenant{ID: "acme", MaxDevices: 1},
+		domain.Tenant{ID: "globex"},
+	)
+	return srv
+}
+
+func TestTenants_Isolation(t *testing.T) {
+	srv := newTenantTestServer(t)
+	create := CreateSignatureDeviceRequest{Algorithm: crypto.ECC, Label: "acme"}
+	rr := doTenantReq(t, srv.CreateSignatureDevice, "acme", http.MethodPost, "/api/v0/signature-device", "/api/v0/signature-device", create)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Data CreateSignatureDeviceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	id := resp.Data.ID
+
+	rr = doTenantReq(t, srv.GetSignatureDevice, "globex", http.MethodGet, "/api/v0/signature-device/{id}", "/api/v0/signature-device/"+id, nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for other tenant, got %d", rr.Code)
+	}
+
+	rr = doTenantReq(t, srv.ListSignatureDevices, "globex", http.MethodGet, "/api/v0/signature-device", "/api/v0/signature-device", nil)
+	var list struct {
+		Data []signatureDevice `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(list.Data) != 0 {
+		t.Fatalf("other tenant must not see any devices, got %d", len(list.Data))
+	}
+
+	sign := SignTxRequest{DeviceID: id, Data: "payload"}
+	rr = doTenantReq(t, srv.SignTransaction, "globex", http.MethodPost, "/api/v0/sign-tx", "/api/v0/sign-tx", sign)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when signing with another tenant's device, got %d", rr.Code)
+	}
+	rr = doTenantReq(t, srv.SignTransaction, "acme", http.MethodPost, "/api/v0/sign-tx", "/api/v0/sign-tx", sign)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for owning tenant, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestTenants_QuotaAndUnknownTenant(t *testing.T) {
+	srv := newTenantTestServer(t)
+	create := CreateSignatureDeviceRequest{Algorithm: crypto.ECC, Label: "acme"}
+	pattern := "/api/v0/signature-device"
+
+	if rr := doTenantReq(t, srv.CreateSignatureDevice, "acme", http.MethodPost, pattern, pattern, create); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doTenantReq(t, srv.CreateSignatureDevice, "acme", http.MethodPost, pattern, pattern, create); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 when quota is exceeded, got %d", rr.Code)
+	}
+	if rr := doTenantReq(t, srv.CreateSignatureDevice, "initech", http.MethodPost, pattern, pattern, create); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for unknown tenant, got %d", rr.Code)
+	}
+}
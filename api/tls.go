@@ -0,0 +1,144 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCertificateReloadInterval is how often the certificate files are checked for changes.
+	DefaultCertificateReloadInterval = 10 * time.Second
+)
+
+// TLSParams configures TLS and optional mutual TLS for the Server.
+type TLSParams struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mutual TLS: client certificates are verified against the CAs in this PEM file.
+	ClientCAFile string
+	// RequireClientCert rejects connections without a valid client certificate,
+	// otherwise clients may still authenticate by other means (e.g. API keys).
+	RequireClientCert bool
+	// ReloadInterval is how often the certificate files are checked for changes, DefaultCertificateReloadInterval if zero.
+	ReloadInterval time.Duration
+}
+
+// NewTLSConfig creates a TLS configuration which picks up renewed certificate files without a restart.
+func NewTLSConfig(params TLSParams) (*tls.Config, error) {
+	if params.CertFile == "" || params.KeyFile == "" {
+		return nil, errors.New("certificate and key file are required")
+	}
+	if params.RequireClientCert && params.ClientCAFile == "" {
+		return nil, errors.New("requiring client certificates needs a client CA file")
+	}
+
+	reloader, err := NewCertificateReloader(params.CertFile, params.KeyFile, params.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if params.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(params.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client CA file: %w", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("client CA file contains no certificates")
+		}
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if params.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return config, nil
+}
+
+// CertificateReloader serves a certificate from files and reloads it when the files change.
+type CertificateReloader struct {
+	certFile  string
+	keyFile   string
+	interval  time.Duration
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewCertificateReloader creates a new CertificateReloader and loads the certificate once.
+func NewCertificateReloader(certFile string, keyFile string, interval time.Duration) (*CertificateReloader, error) {
+	if interval == 0 {
+		interval = DefaultCertificateReloadInterval
+	}
+	reloader := &CertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// GetCertificate returns the current certificate, it can be used as tls.Config.GetCertificate.
+// The files are checked for changes at most once per reload interval; if a changed
+// certificate can not be loaded (e.g. key and certificate are written one after another), the previous one is kept.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Since(r.checkedAt) >= r.interval {
+		r.checkedAt = time.Now()
+		if modTime, err := r.latestModTime(); err == nil && modTime.After(r.modTime) {
+			_ = r.reloadLocked()
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *CertificateReloader) reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.checkedAt = time.Now()
+	return r.reloadLocked()
+}
+
+func (r *CertificateReloader) reloadLocked() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load certificate: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func (r *CertificateReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+)
+
+// testCert is a certificate with its key, signed by parent (or self-signed if parent is nil).
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, commonName string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{"localhost"},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	cert, err := tls.X509KeyPair(c.certPEM(), c.keyPEM(t))
+	if err != nil {
+		t.Fatalf("key pair: %v", err)
+	}
+	return cert
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes %s: %v", path, err)
+	}
+}
+
+func TestCertificateReloader_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first := newTestCert(t, "first", nil, false)
+	past := time.Now().Add(-time.Minute)
+	writeFile(t, certFile, first.certPEM(), past)
+	writeFile(t, keyFile, first.keyPEM(t), past)
+
+	reloader, err := NewCertificateReloader(certFile, keyFile, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("NewCertificateReloader error: %v", err)
+	}
+	cert, _ := reloader.GetCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "first" {
+		t.Fatalf("expected first certificate, got %s", cert.Leaf.Subject.CommonName)
+	}
+
+	// a half written renewal keeps the previous certificate
+	second := newTestCert(t, "second", nil, false)
+	writeFile(t, certFile, second.certPEM(), time.Now())
+	cert, _ = reloader.GetCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "first" {
+		t.Fatalf("expected first certificate while key is outdated, got %s", cert.Leaf.Subject.CommonName)
+	}
+
+	writeFile(t, keyFile, second.keyPEM(t), time.Now().Add(time.Second))
+	cert, _ = reloader.GetCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "second" {
+		t.Fatalf("expected reloaded certificate, got %s", cert.Leaf.Subject.CommonName)
+	}
+}
+
+func TestMutualTLS_MapsClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test ca", nil, true)
+	serverCert := newTestCert(t, "localhost", ca, false)
+	terminal := newTestCert(t, "terminal-1", ca, false)
+	byFingerprint := newTestCert(t, "terminal-2", ca, false)
+	unmapped := newTestCert(t, "terminal-3", ca, false)
+	untrusted := newTestCert(t, "terminal-1", newTestCert(t, "other ca", nil, true), false)
+
+	writeFile(t, filepath.Join(dir, "tls.crt"), serverCert.certPEM(), time.Now())
+	writeFile(t, filepath.Join(dir, "tls.key"), serverCert.keyPEM(t), time.Now())
+	writeFile(t, filepath.Join(dir, "ca.crt"), ca.certPEM(), time.Now())
+
+	tlsConfig, err := NewTLSConfig(TLSParams{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	})
+	if err != nil {
+		t.Fatalf("NewTLSConfig error: %v", err)
+	}
+	authenticator, err := auth.NewCertificateAuthenticator([]auth.CertificateMapping{
+		{Subject: "terminal-1", TenantID: "acme", Scopes: []string{auth.ScopeDevicesWrite}},
+		{Fingerprint: auth.CertificateFingerprint(byFingerprint.cert), Name: "pos-2", TenantID: "acme", Scopes: []string{auth.ScopeDevicesRead}},
+	})
+	if err != nil {
+		t.Fatalf("NewCertificateAuthenticator error: %v", err)
+	}
+
+	srv := newTenantTestServer(t)
+	srv.authenticator = authenticator
+	httpServer := httptest.NewUnstartedServer(srv.Handler())
+	httpServer.TLS = tlsConfig
+	httpServer.StartTLS()
+	defer httpServer.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	request := func(client *testCert, method, path string, body any) int {
+		t.Helper()
+		clientTLS := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+		if client != nil {
+			clientTLS.Certificates = []tls.Certificate{client.tlsCertificate(t)}
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		req, err := http.NewRequestWithContext(context.Background(), method, httpServer.URL+path, bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return 0
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	create := CreateSignatureDeviceRequest{Algorithm: crypto.ECC, Label: "terminal"}
+	if code := request(terminal, http.MethodPost, "/api/v0/signature-device", create); code != http.StatusOK {
+		t.Fatalf("expected 200 for subject mapped certificate, got %d", code)
+	}
+	if code := request(byFingerprint, http.MethodGet, "/api/v0/signature-device", nil); code != http.StatusOK {
+		t.Fatalf("expected 200 for fingerprint mapped certificate, got %d", code)
+	}
+	if code := request(terminal, http.MethodGet, "/api/v0/signature-device", nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for missing scope, got %d", code)
+	}
+	if code := request(unmapped, http.MethodGet, "/api/v0/signature-device", nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unmapped certificate, got %d", code)
+	}
+	if code := request(nil, http.MethodGet, "/api/v0/signature-device", nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without certificate, got %d", code)
+	}
+	// the client does not even offer a certificate of a foreign CA, or the handshake fails
+	if code := request(untrusted, http.MethodGet, "/api/v0/signature-device", nil); code != http.StatusUnauthorized && code != 0 {
+		t.Fatalf("expected untrusted certificate to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ksrichard/signing-service-challenge/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/ksrichard/signing-service-challenge/api")
+
+// startServerSpan starts the span of a request, continuing the trace of the caller given by the W3C traceparent header.
+func startServerSpan(request *http.Request, route string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+	if route == "" {
+		route = metrics.UnmatchedRoute
+	}
+	return tracer.Start(ctx, route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(request.Method),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(request.URL.Path),
+		),
+	)
+}
+
+// endServerSpan records the outcome of a request on its span, server errors mark the span as failed.
+func endServerSpan(span trace.Span, status int, deviceID string) {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if deviceID != "" {
+		span.SetAttributes(attribute.String("device.id", deviceID))
+	}
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
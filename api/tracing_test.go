@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing_ContinuesCallerTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	srv := newTestServer(t)
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device",
+		map[string]string{"traceparent": "00-" + traceID + "-" + parentID + "-01"},
+		CreateSignatureDeviceRequest{Algorithm: crypto.ECC, Label: "traced"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	var server, parse sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "POST /api/v0/signature-device":
+			server = span
+		case "parseRequestJSON":
+			parse = span
+		}
+	}
+	if server == nil || parse == nil {
+		t.Fatalf("expected server and parse spans, got %v", recorder.Ended())
+	}
+	if server.SpanContext().TraceID().String() != traceID || server.Parent().SpanID().String() != parentID {
+		t.Fatalf("server span does not continue the caller trace: %s / %s", server.SpanContext().TraceID(), server.Parent().SpanID())
+	}
+	if parse.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Fatalf("parse span is not a child of the server span")
+	}
+}
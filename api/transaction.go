@@ -5,6 +5,19 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header making a signature request idempotent: retries with the same key
+	// return the signature of the first request instead of signing again. Keys are scoped per device.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set to true on responses which return the signature of an earlier request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// MaxSignBatchSize is the maximum number of data items signed by a single batch request.
+	MaxSignBatchSize = 1000
 )
 
 type SignTxRequest struct {
@@ -13,18 +26,40 @@ type SignTxRequest struct {
 }
 
 func (r *SignTxRequest) Validate() error {
-	if strings.ReplaceAll(r.DeviceID, " ", "") == "" {
-		return errors.New("deviceId is required")
-	}
+	var v validator
+	v.required(r.DeviceID, "deviceId")
+	v.required(r.Data, "data")
+	return v.err()
+}
 
-	if strings.ReplaceAll(r.Data, " ", "") == "" {
-		return errors.New("data is required")
-	}
+type SignTxResponse struct {
+	Signature  string `json:"signature"`
+	SignedData string `json:"signed_data"`
+}
 
-	return nil
+// SignBatchRequest is the request to sign data items as consecutive entries of the signature chain of a device.
+type SignBatchRequest struct {
+	Data []string `json:"data"`
 }
 
-type SignTxResponse struct {
+func (r *SignBatchRequest) Validate() error {
+	var v validator
+	validateBatch(&v, r.Data)
+	return v.err()
+}
+
+// validateBatch checks the data items of a batch request, shared by the API versions.
+func validateBatch(v *validator, data []string) {
+	v.check(len(data) > 0, "data", "must contain at least one item")
+	v.check(len(data) <= MaxSignBatchSize, "data", fmt.Sprintf("must contain at most %d items", MaxSignBatchSize))
+	for i, item := range data {
+		v.required(item, fmt.Sprintf("data[%d]", i))
+	}
+}
+
+// SignBatchItem is the signature of one data item of a batch, in the order of the request.
+type SignBatchItem struct {
+	Counter    uint64 `json:"counter"`
 	Signature  string `json:"signature"`
 	SignedData string `json:"signed_data"`
 }
@@ -35,33 +70,133 @@ func (s *Server) SignTransaction(response http.ResponseWriter, request *http.Req
 	if !ok {
 		return
 	}
-	if err := requestJSON.Validate(); err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			fmt.Sprintf("Request validation failed: %s", err.Error()),
-		})
+
+	result, ok := s.signData(response, request, requestJSON.DeviceID, requestJSON.Data)
+	if !ok {
 		return
 	}
 
-	// find device
-	device, err := s.deviceStore.Get(requestJSON.DeviceID)
+	WriteAPIResponse(response, http.StatusOK, SignTxResponse{
+		Signature:  result.Signature,
+		SignedData: result.SignedData,
+	})
+}
+
+// signData signs data with a device of the request tenant, shared by the API versions.
+// If the second return value is false, the handler must return because there was an error.
+func (s *Server) signData(response http.ResponseWriter, request *http.Request, deviceID string, data string) (domain.SignDataResult, bool) {
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return domain.SignDataResult{}, false
+	}
+	logDeviceID(request.Context(), deviceID)
+
+	idempotencyKey := request.Header.Get(IdempotencyKeyHeader)
+	charge := true
+	if idempotencyKey != "" {
+		var v validator
+		v.check(validIdempotencyKey(idempotencyKey), IdempotencyKeyHeader,
+			"must be at most 255 visible ASCII characters")
+		if err := v.err(); err != nil {
+			writeError(response, err, "Invalid request")
+			return domain.SignDataResult{}, false
+		}
+
+		// retries of a committed key return the first signature, they do not take a token of the device again
+		_, err := s.deviceStore.GetIdempotencyRecord(request.Context(), tenant.ID, deviceID, idempotencyKey)
+		if err != nil && !errors.Is(err, persistence.ErrIdempotencyRecordNotFound) {
+			writeError(response, err, "Failed to sign data")
+			return domain.SignDataResult{}, false
+		}
+		charge = err != nil
+	}
+	if charge && !s.allowDevice(response, request, tenant.ID, deviceID, 1, "Failed to sign data") {
+		return domain.SignDataResult{}, false
+	}
+
+	// sign data with the device and commit the new chain head
+	var result domain.SignDataResult
+	var replayed bool
+	var err error
+	if idempotencyKey == "" {
+		result, err = persistence.SignData(request.Context(), s.deviceStore, tenant.ID, deviceID, data)
+	} else {
+		result, replayed, err = persistence.SignDataIdempotent(request.Context(), s.deviceStore, tenant.ID, deviceID,
+			data, idempotencyKey, s.idempotencyRetention)
+	}
 	if err != nil {
-		WriteErrorResponse(response, http.StatusNotFound, []string{
-			fmt.Sprintf("Unable to find signature device: %s", err.Error()),
-		})
+		writeError(response, err, "Failed to sign data")
+		return domain.SignDataResult{}, false
+	}
+	if replayed {
+		// the signature was already created (and its event published) by the first request with the key
+		response.Header().Set(IdempotentReplayedHeader, "true")
+		return result, true
+	}
+	s.publish(domain.EventSignatureCreated, tenant.ID, deviceID, newSignatureCreatedEvent(result))
+	return result, true
+}
+
+// SignBatch signs the data items of the request in order as consecutive entries of the signature chain of a device.
+// Either every item is signed or, if any fails, none is.
+func (s *Server) SignBatch(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+
+	// parse and validate request JSON
+	requestJSON, ok := parseRequestJSON[SignBatchRequest](response, request)
+	if !ok {
 		return
 	}
 
-	// sign data
-	result, err := device.SignData(requestJSON.Data)
-	if err != nil {
-		WriteErrorResponse(response, http.StatusInternalServerError, []string{
-			fmt.Sprintf("Failed to sign data: %s", err.Error()),
-		})
+	results, ok := s.signBatch(response, request, id, requestJSON.Data)
+	if !ok {
 		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, SignTxResponse{
-		Signature:  result.Signature,
-		SignedData: result.SignedData,
-	})
+	items := make([]SignBatchItem, 0, len(results))
+	for _, result := range results {
+		items = append(items, SignBatchItem{
+			Counter:    result.Counter,
+			Signature:  result.Signature,
+			SignedData: result.SignedData,
+		})
+	}
+	WriteAPIResponse(response, http.StatusOK, items)
+}
+
+// signBatch signs data items with a device of the request tenant in one commit, shared by the API versions.
+// Every item of the batch takes a token from the rate limit of the device, batches larger than its burst are rejected.
+// If the second return value is false, the handler must return because there was an error.
+func (s *Server) signBatch(response http.ResponseWriter, request *http.Request, deviceID string, data []string) ([]domain.SignDataResult, bool) {
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return nil, false
+	}
+	logDeviceID(request.Context(), deviceID)
+	if !s.allowDevice(response, request, tenant.ID, deviceID, len(data), "Failed to sign batch") {
+		return nil, false
+	}
+
+	results, err := persistence.SignBatch(request.Context(), s.deviceStore, tenant.ID, deviceID, data)
+	if err != nil {
+		writeError(response, err, "Failed to sign batch")
+		return nil, false
+	}
+	for _, result := range results {
+		s.publish(domain.EventSignatureCreated, tenant.ID, deviceID, newSignatureCreatedEvent(result))
+	}
+	return results, true
+}
+
+// validIdempotencyKey reports whether key is a valid idempotency key.
+func validIdempotencyKey(key string) bool {
+	if len(key) > domain.MaxIdempotencyKeyLength || strings.TrimSpace(key) == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
 }
@@ -2,12 +2,15 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ksrichard/signing-service-challenge/crypto"
 	"github.com/ksrichard/signing-service-challenge/domain"
@@ -17,7 +20,9 @@ import (
 // failingSigner implements crypto.Signer and always returns an error
 type failingSigner struct{}
 
-func (f failingSigner) Sign(dataToBeSigned []byte) ([]byte, error) { return nil, assertErr("signfail") }
+func (f failingSigner) Sign(ctx context.Context, dataToBeSigned []byte) ([]byte, error) {
+	return nil, assertErr("signfail")
+}
 
 // helper to perform raw JSON/body requests (not auto-marshaled)
 func doRawReq(t *testing.T, handler http.HandlerFunc, method, target string, body []byte) *httptest.ResponseRecorder {
@@ -77,11 +82,11 @@ func TestSignTransaction_SignDataFailure(t *testing.T) {
 	store := persistence.NewInMemorySignatureDeviceStore()
 	srv := NewServer(ServerParams{KeyGeneratorStore: kg, SignerStore: ss, DeviceStore: store})
 
-	dev, err := domain.NewSignatureDevice(srv.keyGeneratorStore, srv.signerStore, crypto.RSA, "lbl")
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.RSA, "lbl")
 	if err != nil {
 		t.Fatalf("create device: %v", err)
 	}
-	if err := srv.deviceStore.Add(dev); err != nil {
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
 		t.Fatalf("add: %v", err)
 	}
 
@@ -100,11 +105,11 @@ func TestSignTransaction_SignDataFailure(t *testing.T) {
 func TestSignTransaction_Success(t *testing.T) {
 	srv := newTestServer(t)
 	// create and add a device
-	dev, err := domain.NewSignatureDevice(srv.keyGeneratorStore, srv.signerStore, crypto.RSA, "lbl")
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.RSA, "lbl")
 	if err != nil {
 		t.Fatalf("create device: %v", err)
 	}
-	if err := srv.deviceStore.Add(dev); err != nil {
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
 		t.Fatalf("add: %v", err)
 	}
 
@@ -127,3 +132,181 @@ func TestSignTransaction_Success(t *testing.T) {
 		t.Fatalf("missing fields in response: %+v", txResp)
 	}
 }
+
+func TestSignTransaction_ContextEnded(t *testing.T) {
+	srv := newTestServer(t)
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.RSA, "lbl")
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	body, _ := json.Marshal(SignTxRequest{DeviceID: dev.GetIDStr(), Data: "payload"})
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	cases := []struct {
+		ctx  context.Context
+		code int
+	}{
+		{cancelled, StatusClientClosedRequest},
+		{expired, http.StatusGatewayTimeout},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/v0/sign-tx", bytes.NewReader(body)).WithContext(c.ctx)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		srv.SignTransaction(rr, req)
+		if rr.Code != c.code {
+			t.Fatalf("expected %d, got %d: %s", c.code, rr.Code, rr.Body.String())
+		}
+	}
+	if dev.GetSignatureCounter() != 0 {
+		t.Fatalf("signature counter must not advance for an ended request, got %d", dev.GetSignatureCounter())
+	}
+}
+
+func TestSignTransaction_IdempotencyKey(t *testing.T) {
+	srv := newTestServer(t)
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.RSA, "lbl")
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	sign := func(key string, data string) (*httptest.ResponseRecorder, SignTxResponse) {
+		t.Helper()
+		rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", map[string]string{IdempotencyKeyHeader: key}, SignTxRequest{DeviceID: dev.GetIDStr(), Data: data})
+		var signed struct {
+			Data SignTxResponse `json:"data"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &signed)
+		return rr, signed.Data
+	}
+
+	rr, first := sign("receipt-42", "payload")
+	if rr.Code != http.StatusOK || rr.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("expected a new signature, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// a retry of the timed out request returns the same signature without advancing the counter
+	rr, retried := sign("receipt-42", "payload")
+	if rr.Code != http.StatusOK || rr.Header().Get(IdempotentReplayedHeader) != "true" || retried != first {
+		t.Fatalf("expected the first signature to be replayed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	stored, err := srv.deviceStore.Get(context.Background(), domain.DefaultTenantID, dev.GetIDStr())
+	if err != nil || stored.GetSignatureCounter() != 1 {
+		t.Fatalf("expected the counter to advance once, got %v", err)
+	}
+
+	rr, _ = sign("receipt-42", "other payload")
+	assertProblem(t, rr, http.StatusConflict, ProblemIdempotencyKeyReused)
+	for _, key := range []string{strings.Repeat("k", domain.MaxIdempotencyKeyLength+1), "keyé", " "} {
+		rr, _ = sign(key, "payload")
+		assertProblem(t, rr, http.StatusBadRequest, ProblemValidationFailed)
+	}
+
+	// the v1 API shares the keys of the device
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v1/devices/"+dev.GetIDStr()+"/signatures", map[string]string{IdempotencyKeyHeader: "receipt-42"}, CreateSignatureRequest{Data: "payload"})
+	if rr.Code != http.StatusCreated || rr.Header().Get(IdempotentReplayedHeader) != "true" || !strings.Contains(rr.Body.String(), first.Signature) {
+		t.Fatalf("expected the first signature to be replayed by the v1 API, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// failingCommitStore fails to commit batches of signatures
+type failingCommitStore struct {
+	*persistence.InMemorySignatureDeviceStore
+}
+
+func (s *failingCommitStore) CommitSignatures(ctx context.Context, device *domain.SignatureDevice, results []domain.SignDataResult) error {
+	return assertErr("connection reset by peer")
+}
+
+func TestSignBatch(t *testing.T) {
+	srv := newTestServer(t)
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.ECC, "lbl")
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	target := "/api/v0/signature-device/" + dev.GetIDStr() + "/sign-batch"
+
+	rr := doHandlerReq(t, srv, http.MethodPost, target, nil, SignBatchRequest{Data: []string{"a", "b", "c"}})
+	var signed struct {
+		Data []SignBatchItem `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &signed); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(signed.Data) != 3 || rr.Header().Get("Deprecation") == "" {
+		t.Fatalf("unexpected response: %s", rr.Body.String())
+	}
+	for i, item := range signed.Data {
+		if item.Counter != uint64(i) || !strings.HasPrefix(item.SignedData, fmt.Sprintf("%d_%s_", i, []string{"a", "b", "c"}[i])) {
+			t.Fatalf("unexpected item %d: %+v", i, item)
+		}
+		if i > 0 && !strings.HasSuffix(item.SignedData, "_"+signed.Data[i-1].Signature) {
+			t.Fatalf("item %d is not linked to the one before", i)
+		}
+	}
+
+	// the chain continues after the batch
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: dev.GetIDStr(), Data: "d"})
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "3_d_"+signed.Data[2].Signature) {
+		t.Fatalf("expected the next signature to follow the batch, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	for _, data := range [][]string{nil, {"a", " "}, make([]string, MaxSignBatchSize+1)} {
+		rr = doHandlerReq(t, srv, http.MethodPost, target, nil, SignBatchRequest{Data: data})
+		assertProblem(t, rr, http.StatusBadRequest, ProblemValidationFailed)
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device/unknown/sign-batch", nil, SignBatchRequest{Data: []string{"a"}})
+	assertProblem(t, rr, http.StatusNotFound, ProblemDeviceNotFound)
+
+	// the v1 API returns the signatures as resources
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v1/devices/"+dev.GetIDStr()+"/signatures/batch", nil, CreateSignatureBatchRequest{Data: []string{"e", "f"}})
+	var created struct {
+		Data []Signature `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(created.Data) != 2 || created.Data[0].Counter != 4 || created.Data[1].DeviceID != dev.GetIDStr() {
+		t.Fatalf("unexpected signatures: %+v", created.Data)
+	}
+}
+
+func TestSignBatch_CommitFailure(t *testing.T) {
+	kg := crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{crypto.ECC: &crypto.ECCGenerator{}})
+	ss := crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+		crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+	})
+	store := &failingCommitStore{InMemorySignatureDeviceStore: persistence.NewInMemorySignatureDeviceStore()}
+	srv := NewServer(ServerParams{KeyGeneratorStore: kg, SignerStore: ss, DeviceStore: store})
+	t.Cleanup(func() { srv.webhooks.Close() })
+
+	dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, crypto.ECC, "lbl")
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device/"+dev.GetIDStr()+"/sign-batch", nil, SignBatchRequest{Data: []string{"a", "b"}})
+	assertProblem(t, rr, http.StatusInternalServerError, ProblemInternal)
+	// no item of the failed batch is part of the chain
+	stored, err := store.Get(context.Background(), domain.DefaultTenantID, dev.GetIDStr())
+	if err != nil || stored.GetSignatureCounter() != 0 {
+		t.Fatalf("expected the counter to stay at 0, got %v", err)
+	}
+	if log, err := store.ListSignatures(context.Background(), domain.DefaultTenantID, dev.GetIDStr(), 0, 10); err != nil || len(log) != 0 {
+		t.Fatalf("expected an empty signature log, got %v %v", log, err)
+	}
+}
@@ -2,31 +2,132 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"reflect"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	errInvalidJSON      = errors.New("request body is not valid JSON")
+	errBodyTooLarge     = errors.New("request body is too large")
+	errUnsupportedMedia = errors.New("request body must be application/json")
 )
 
-// parseRequestJSON parses the request body as JSON and returns it.
+// requestValidator is implemented by requests which validate themselves after being parsed.
+type requestValidator interface {
+	Validate() error
+}
+
+// parseRequestJSON parses the request body as JSON, validates it (if it has a Validate method) and returns it.
+// The body must be declared as JSON, it must not exceed the maximum body size, contain unknown fields or anything
+// after the JSON value.
 // If the second return value is false, the handler must return because there was an error.
 func parseRequestJSON[T any](response http.ResponseWriter, request *http.Request) (*T, bool) {
-	body := request.Body
-	defer body.Close()
-	requestJSONRaw, err := io.ReadAll(body)
-	if err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			"Unable to read request body",
-		})
+	_, span := tracer.Start(request.Context(), "parseRequestJSON")
+	defer span.End()
+	defer request.Body.Close()
+
+	if !isJSONContentType(request.Header.Get("Content-Type")) {
+		span.SetStatus(codes.Error, errUnsupportedMedia.Error())
+		writeError(response, errUnsupportedMedia, "Unable to parse request body")
 		return nil, false
 	}
+
 	var requestJSON T
-	err = json.Unmarshal(requestJSONRaw, &requestJSON)
-	if err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			fmt.Sprintf("Unable to parse request body: %s", err.Error()),
-		})
+	if err := decodeJSON(request.Body, &requestJSON); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		writeError(response, err, "Unable to parse request body")
 		return nil, false
 	}
 
+	if validated, ok := any(&requestJSON).(requestValidator); ok {
+		if err := validated.Validate(); err != nil {
+			writeError(response, err, "Request validation failed")
+			return nil, false
+		}
+	}
+
 	return &requestJSON, true
 }
+
+// isJSONContentType checks if the content type declares JSON (application/json or application/*+json).
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
+// decodeJSON strictly decodes a single JSON value into v. Unknown fields and values of the wrong type
+// are reported as a ValidationError.
+func decodeJSON(body io.Reader, v any) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	// only whitespace may follow the value
+	_, err := decoder.Token()
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil
+	case err != nil:
+		return decodeError(err)
+	}
+	return fmt.Errorf("%w: unexpected data after the JSON value", errInvalidJSON)
+}
+
+// decodeError converts an error of the JSON decoder into the error reported to the client.
+func decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return fmt.Errorf("%w: it exceeds %d bytes", errBodyTooLarge, maxBytesErr.Limit)
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		return &ValidationError{Params: []InvalidParam{{Name: field, Reason: fmt.Sprintf("must be of type %s", jsonType(typeErr.Type.Kind()))}}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// the decoder has no typed error for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &ValidationError{Params: []InvalidParam{{Name: field, Reason: "is not a known field"}}}
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("%w: it is empty", errInvalidJSON)
+	}
+	return fmt.Errorf("%w: %s", errInvalidJSON, err.Error())
+}
+
+// jsonType names the JSON type of a Go kind.
+func jsonType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "number"
+}
+
+// limitRequestBody limits the size of the request bodies, reading beyond it fails.
+func (s *Server) limitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.Body != nil {
+			request.Body = http.MaxBytesReader(response, request.Body, s.httpParams.MaxBodyBytes)
+		}
+		next.ServeHTTP(response, request)
+	})
+}
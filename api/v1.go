@@ -0,0 +1,231 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSignaturePageSize is how many signatures are listed if the request has no limit.
+	DefaultSignaturePageSize = 100
+	// MaxSignaturePageSize is the maximum number of signatures listed by a single request.
+	MaxSignaturePageSize = 1000
+)
+
+// APIv0DeprecatedAt is when API v0 was deprecated in favour of API v1.
+var APIv0DeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// CreateSignatureRequest is the request to sign data with a signature device.
+type CreateSignatureRequest struct {
+	Data string `json:"data"`
+}
+
+// Validate checks if the JSON request is valid.
+func (r *CreateSignatureRequest) Validate() error {
+	var v validator
+	v.required(r.Data, "data")
+	return v.err()
+}
+
+// CreateSignatureBatchRequest is the request to sign data items as consecutive signatures of a signature device.
+type CreateSignatureBatchRequest struct {
+	Data []string `json:"data"`
+}
+
+// Validate checks if the JSON request is valid.
+func (r *CreateSignatureBatchRequest) Validate() error {
+	var v validator
+	validateBatch(&v, r.Data)
+	return v.err()
+}
+
+// Signature is a signature created by a signature device.
+type Signature struct {
+	DeviceID   string `json:"deviceId"`
+	Counter    uint64 `json:"counter"`
+	Signature  string `json:"signature"`
+	SignedData string `json:"signedData"`
+	KeyVersion uint64 `json:"keyVersion"`
+}
+
+// VerifySignatureRequest is the request to verify a signature of a signature device.
+type VerifySignatureRequest struct {
+	SignedData string `json:"signedData"`
+	Signature  string `json:"signature"`
+}
+
+// Validate checks if the JSON request is valid.
+func (r *VerifySignatureRequest) Validate() error {
+	var v validator
+	v.check(r.SignedData != "", "signedData", "is required")
+	v.check(r.Signature != "", "signature", "is required")
+	return v.err()
+}
+
+// CreateSignatureDeviceV1 creates a new signature device and returns it.
+func (s *Server) CreateSignatureDeviceV1(response http.ResponseWriter, request *http.Request) {
+	// parse and validate request JSON
+	requestJSON, ok := parseRequestJSON[CreateSignatureDeviceRequest](response, request)
+	if !ok {
+		return
+	}
+
+	device, ok := s.createSignatureDevice(response, request, requestJSON)
+	if !ok {
+		return
+	}
+
+	response.Header().Set("Location", "/api/v1/devices/"+device.GetIDStr())
+	WriteAPIResponse(response, http.StatusCreated, newSignatureDevice(device))
+}
+
+// CreateSignatureV1 signs data with a signature device, advancing its signature chain.
+func (s *Server) CreateSignatureV1(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+
+	// parse and validate request JSON
+	requestJSON, ok := parseRequestJSON[CreateSignatureRequest](response, request)
+	if !ok {
+		return
+	}
+
+	result, ok := s.signData(response, request, id, requestJSON.Data)
+	if !ok {
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusCreated, Signature{
+		DeviceID:   id,
+		Counter:    result.Counter,
+		Signature:  result.Signature,
+		SignedData: result.SignedData,
+		KeyVersion: result.KeyVersion,
+	})
+}
+
+// CreateSignatureBatchV1 signs the data items in order as consecutive signatures of a signature device, all of them
+// or none.
+func (s *Server) CreateSignatureBatchV1(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+
+	// parse and validate request JSON
+	requestJSON, ok := parseRequestJSON[CreateSignatureBatchRequest](response, request)
+	if !ok {
+		return
+	}
+
+	results, ok := s.signBatch(response, request, id, requestJSON.Data)
+	if !ok {
+		return
+	}
+
+	signatures := make([]Signature, 0, len(results))
+	for _, result := range results {
+		signatures = append(signatures, Signature{
+			DeviceID:   id,
+			Counter:    result.Counter,
+			Signature:  result.Signature,
+			SignedData: result.SignedData,
+			KeyVersion: result.KeyVersion,
+		})
+	}
+	WriteAPIResponse(response, http.StatusCreated, signatures)
+}
+
+// ListSignaturesV1 lists the committed signatures of a signature device, oldest first. The query parameter from is
+// the counter of the first signature (0 by default) and limit the maximum number of signatures.
+func (s *Server) ListSignaturesV1(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	logDeviceID(request.Context(), id)
+
+	from, limit := uint64(0), DefaultSignaturePageSize
+	var v validator
+	query := request.URL.Query()
+	if value := query.Get("from"); value != "" {
+		var err error
+		from, err = strconv.ParseUint(value, 10, 64)
+		v.check(err == nil, "from", "must be a signature counter")
+	}
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		v.check(err == nil && limit > 0 && limit <= MaxSignaturePageSize, "limit", fmt.Sprintf("must be between 1 and %d", MaxSignaturePageSize))
+	}
+	if err := v.err(); err != nil {
+		writeError(response, err, "Request validation failed")
+		return
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	signatures, err := s.deviceStore.ListSignatures(request.Context(), tenant.ID, id, from, limit)
+	if err != nil {
+		writeError(response, err, "Could not retrieve signatures")
+		return
+	}
+
+	result := make([]Signature, len(signatures))
+	for i, signature := range signatures {
+		result[i] = Signature{
+			DeviceID:   id,
+			Counter:    signature.Counter,
+			Signature:  signature.Signature,
+			SignedData: signature.SignedData,
+			KeyVersion: signature.KeyVersion,
+		}
+	}
+	WriteAPIResponse(response, http.StatusOK, result)
+}
+
+// VerifySignatureV1 checks a signature against the public key of a signature device.
+func (s *Server) VerifySignatureV1(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	logDeviceID(request.Context(), id)
+
+	// parse and validate request JSON
+	requestJSON, ok := parseRequestJSON[VerifySignatureRequest](response, request)
+	if !ok {
+		return
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	valid, err := s.verifySignature(request.Context(), tenant.ID, id, requestJSON.SignedData, requestJSON.Signature)
+	if err != nil {
+		writeError(response, err, "Failed to verify signature")
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, VerifyTxResponse{
+		Valid: valid,
+	})
+}
+
+// deprecated marks the responses of an API v0 route as deprecated (RFC 9745) and links the API v1 route
+// replacing it, with {id} replaced by the id of the request path. The successor is not linked if its id is not in the path.
+func deprecated(successor string, next http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", APIv0DeprecatedAt.Unix())
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Set("Deprecation", deprecation)
+		link := successor
+		if strings.Contains(link, "{id}") {
+			link = strings.ReplaceAll(link, "{id}", request.PathValue("id"))
+			if request.PathValue("id") == "" {
+				link = ""
+			}
+		}
+		if link != "" {
+			response.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, link))
+		}
+		next.ServeHTTP(response, request)
+	})
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+)
+
+func TestAPIv1_SignAndVerify(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v1/devices", nil, CreateSignatureDeviceRequest{Algorithm: crypto.ECC, Label: "till"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var device struct {
+		Data signatureDevice `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &device); err != nil || device.Data.Label != "till" || len(device.Data.PublicKey) == 0 {
+		t.Fatalf("unexpected device: %s", rr.Body.String())
+	}
+	if location := rr.Header().Get("Location"); location != "/api/v1/devices/"+device.Data.ID {
+		t.Fatalf("unexpected location: %q", location)
+	}
+	if rr.Header().Get("Deprecation") != "" {
+		t.Fatalf("v1 must not be deprecated")
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v1/devices/"+device.Data.ID+"/signatures", nil, CreateSignatureRequest{Data: "data"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var body map[string]map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	// fields are named consistently in camelCase
+	for _, field := range []string{"deviceId", "counter", "signature", "signedData", "keyVersion"} {
+		if _, ok := body["data"][field]; !ok {
+			t.Fatalf("expected field %s in %s", field, rr.Body.String())
+		}
+	}
+	var signature struct {
+		Data Signature `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &signature)
+	if signature.Data.DeviceID != device.Data.ID || signature.Data.Counter != 0 {
+		t.Fatalf("unexpected signature: %+v", signature.Data)
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v1/devices/"+device.Data.ID+"/verifications", nil,
+		VerifySignatureRequest{SignedData: signature.Data.SignedData, Signature: signature.Data.Signature})
+	var verified struct {
+		Data VerifyTxResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &verified); err != nil || rr.Code != http.StatusOK || !verified.Data.Valid {
+		t.Fatalf("expected a valid signature, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// the v0 fields are unknown to v1
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v1/devices/"+device.Data.ID+"/verifications", nil,
+		map[string]string{"signed_data": signature.Data.SignedData, "signature": signature.Data.Signature})
+	assertProblem(t, rr, http.StatusBadRequest, ProblemValidationFailed)
+
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v1/devices/unknown/signatures", nil, CreateSignatureRequest{Data: "data"})
+	assertProblem(t, rr, http.StatusNotFound, ProblemDeviceNotFound)
+}
+
+func TestAPIv0_Deprecated(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", nil, CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	expected := fmt.Sprintf("@%d", APIv0DeprecatedAt.Unix())
+	if rr.Header().Get("Deprecation") != expected || rr.Header().Get("Link") != `</api/v1/devices>; rel="successor-version"` {
+		t.Fatalf("unexpected deprecation headers: %v", rr.Header())
+	}
+	var device struct {
+		Data CreateSignatureDeviceResponse `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &device)
+
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device/"+device.Data.ID, nil, nil)
+	if rr.Header().Get("Link") != `</api/v1/devices/`+device.Data.ID+`>; rel="successor-version"` {
+		t.Fatalf("unexpected link: %q", rr.Header().Get("Link"))
+	}
+
+	// the successor of sign-tx depends on the body, it is not linked
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: device.Data.ID, Data: "data"})
+	if rr.Code != http.StatusOK || rr.Header().Get("Deprecation") != expected || rr.Header().Get("Link") != "" {
+		t.Fatalf("unexpected response: %d %v", rr.Code, rr.Header())
+	}
+	var signed map[string]map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &signed); err != nil || signed["data"]["signed_data"] == "" {
+		t.Fatalf("expected the v0 response, got %s", rr.Body.String())
+	}
+
+	// errors of v0 routes are deprecated as well
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/signature-device/unknown", nil, nil)
+	if rr.Code != http.StatusNotFound || rr.Header().Get("Deprecation") != expected {
+		t.Fatalf("unexpected response: %d %v", rr.Code, rr.Header())
+	}
+}
+
+func TestAPIv1_ListSignatures(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v1/devices", nil, CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+	var device struct {
+		Data signatureDevice `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &device); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	path := "/api/v1/devices/" + device.Data.ID + "/signatures"
+	for i := 0; i < 3; i++ {
+		if rr := doHandlerReq(t, srv, http.MethodPost, path, nil, CreateSignatureRequest{Data: fmt.Sprint("data", i)}); rr.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodGet, path+"?from=1&limit=5", nil, nil)
+	var signatures struct {
+		Data []Signature `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &signatures); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(signatures.Data) != 2 || signatures.Data[0].Counter != 1 || signatures.Data[1].Counter != 2 || signatures.Data[0].DeviceID != device.Data.ID {
+		t.Fatalf("unexpected signatures: %+v", signatures.Data)
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodGet, path+"?from=-1&limit=0", nil, nil)
+	if problem := assertProblem(t, rr, http.StatusBadRequest, ProblemValidationFailed); len(problem.InvalidParams) != 2 {
+		t.Fatalf("expected both parameters to be invalid, got %+v", problem.InvalidParams)
+	}
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v1/devices/unknown/signatures", nil, nil)
+	assertProblem(t, rr, http.StatusNotFound, ProblemDeviceNotFound)
+}
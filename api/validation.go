@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InvalidParam describes why a field of a request is invalid.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError reports the invalid fields of a request.
+type ValidationError struct {
+	Params []InvalidParam
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Params))
+	for i, param := range e.Params {
+		messages[i] = fmt.Sprintf("%s %s", param.Name, param.Reason)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// validator collects every invalid field of a request, instead of stopping at the first one.
+type validator struct {
+	params []InvalidParam
+}
+
+// check records the field as invalid for the given reason, unless ok.
+func (v *validator) check(ok bool, name string, reason string) {
+	if !ok {
+		v.params = append(v.params, InvalidParam{Name: name, Reason: reason})
+	}
+}
+
+// required records the field as invalid if its value is blank.
+func (v *validator) required(value string, name string) {
+	v.check(strings.TrimSpace(value) != "", name, "is required")
+}
+
+// err returns the ValidationError of the invalid fields, nil if every field is valid.
+func (v *validator) err() error {
+	if len(v.params) == 0 {
+		return nil
+	}
+	return &ValidationError{Params: v.params}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+func TestParseRequestJSON_Strict(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doRawReq(t, srv.Handler().ServeHTTP, http.MethodPost, "/api/v0/sign-tx", []byte(`{"deviceId":"id","data":"data","counter":1}`))
+	problem := assertProblem(t, rr, http.StatusBadRequest, ProblemValidationFailed)
+	if len(problem.InvalidParams) != 1 || problem.InvalidParams[0].Name != "counter" || problem.InvalidParams[0].Reason != "is not a known field" {
+		t.Fatalf("unexpected invalid params: %+v", problem.InvalidParams)
+	}
+
+	rr = doRawReq(t, srv.Handler().ServeHTTP, http.MethodPost, "/api/v0/sign-tx", []byte(`{"deviceId":"id","data":42}`))
+	problem = assertProblem(t, rr, http.StatusBadRequest, ProblemValidationFailed)
+	if len(problem.InvalidParams) != 1 || problem.InvalidParams[0].Name != "data" || problem.InvalidParams[0].Reason != "must be of type string" {
+		t.Fatalf("unexpected invalid params: %+v", problem.InvalidParams)
+	}
+
+	for _, body := range []string{`{"deviceId":"id","data":"data"}{}`, `{"deviceId":"id","data":"data"} x`, `{"deviceId":`, ``} {
+		rr = doRawReq(t, srv.Handler().ServeHTTP, http.MethodPost, "/api/v0/sign-tx", []byte(body))
+		assertProblem(t, rr, http.StatusBadRequest, ProblemInvalidJSON)
+	}
+
+	// trailing whitespace is fine
+	rr = doRawReq(t, srv.Handler().ServeHTTP, http.MethodPost, "/api/v0/signature-device", []byte("{\"algorithm\":\"ECC\"}\n"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestParseRequestJSON_ContentType(t *testing.T) {
+	srv := newTestServer(t)
+
+	for contentType, code := range map[string]int{
+		"":                                  http.StatusUnsupportedMediaType,
+		"text/plain":                        http.StatusUnsupportedMediaType,
+		"application/x-www-form-urlencoded": http.StatusUnsupportedMediaType,
+		"application/json; charset=utf-8":   http.StatusOK,
+		"application/merge-patch+json":      http.StatusOK,
+	} {
+		rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device",
+			map[string]string{"Content-Type": contentType}, CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+		if rr.Code != code {
+			t.Fatalf("expected %d for %q, got %d: %s", code, contentType, rr.Code, rr.Body.String())
+		}
+		if code == http.StatusUnsupportedMediaType {
+			assertProblem(t, rr, code, ProblemUnsupportedMedia)
+		}
+	}
+}
+
+func TestParseRequestJSON_BodyLimit(t *testing.T) {
+	srv := NewServer(ServerParams{
+		KeyGeneratorStore: crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{crypto.ECC: &crypto.ECCGenerator{}}),
+		SignerStore: crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+			crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+		}),
+		DeviceStore: persistence.NewInMemorySignatureDeviceStore(),
+		HTTP:        HTTPParams{MaxBodyBytes: 64},
+	})
+	t.Cleanup(func() { srv.webhooks.Close() })
+
+	body := `{"algorithm":"ECC","label":"` + strings.Repeat("x", 64) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v0/signature-device", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rr, req)
+	assertProblem(t, rr, http.StatusRequestEntityTooLarge, ProblemPayloadTooLarge)
+
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", nil, CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 within the limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestParseRequestJSON_CollectsValidationErrors(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/verify-tx", nil, VerifyTxRequest{DeviceID: " "})
+	problem := assertProblem(t, rr, http.StatusBadRequest, ProblemValidationFailed)
+	var names []string
+	for _, param := range problem.InvalidParams {
+		names = append(names, param.Name)
+	}
+	if strings.Join(names, ",") != "deviceId,signed_data,signature" {
+		t.Fatalf("expected every invalid field, got %+v", problem.InvalidParams)
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+)
+
+var (
+	errSignatureEncoding = errors.New("signature is not valid base64")
+)
+
+type VerifyTxRequest struct {
+	DeviceID   string `json:"deviceId"`
+	SignedData string `json:"signed_data"`
+	Signature  string `json:"signature"`
+}
+
+func (r *VerifyTxRequest) Validate() error {
+	var v validator
+	v.required(r.DeviceID, "deviceId")
+	v.check(r.SignedData != "", "signed_data", "is required")
+	v.check(r.Signature != "", "signature", "is required")
+	return v.err()
+}
+
+type VerifyTxResponse struct {
+	Valid bool `json:"valid"`
+}
+
+// VerifyTransaction checks a signature against the public key of a signature device.
+func (s *Server) VerifyTransaction(response http.ResponseWriter, request *http.Request) {
+	// parse and validate request JSON
+	requestJSON, ok := parseRequestJSON[VerifyTxRequest](response, request)
+	if !ok {
+		return
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+	logDeviceID(request.Context(), requestJSON.DeviceID)
+
+	valid, err := s.verifySignature(request.Context(), tenant.ID, requestJSON.DeviceID, requestJSON.SignedData, requestJSON.Signature)
+	if err != nil {
+		writeError(response, err, "Failed to verify signature")
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, VerifyTxResponse{
+		Valid: valid,
+	})
+}
+
+// verifySignature checks the base64 encoded signature of signedData against the public key of the device
+// which was current at the counter signedData starts with (the current key, if it does not start with a counter).
+// An invalid signature is not an error, the result is false.
+func (s *Server) verifySignature(ctx context.Context, tenantID string, deviceID string, signedData string, signature string) (bool, error) {
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false, errSignatureEncoding
+	}
+
+	device, err := s.deviceStore.Get(ctx, tenantID, deviceID)
+	if err != nil {
+		return false, err
+	}
+	publicKey := device.PublicKey
+	if prefix, _, ok := strings.Cut(signedData, "_"); ok {
+		if counter, err := strconv.ParseUint(prefix, 10, 64); err == nil {
+			publicKey = device.PublicKeyAt(counter)
+		}
+	}
+	verifier, err := s.verifierStore.Get(device.Algorithm, publicKey)
+	if err != nil {
+		return false, err
+	}
+
+	err = verifier.Verify([]byte(signedData), signatureBytes)
+	if errors.Is(err, crypto.ErrInvalidSignature) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+func TestVerifyTransaction(t *testing.T) {
+	srv := newTestServer(t)
+	for _, algorithm := range []crypto.SignatureAlgorithm{crypto.RSA, crypto.ECC} {
+		dev, err := domain.NewSignatureDevice(context.Background(), srv.keyGeneratorStore, srv.signerStore, domain.DefaultTenantID, algorithm, "lbl")
+		if err != nil {
+			t.Fatalf("create device: %v", err)
+		}
+		if err := srv.deviceStore.Add(context.Background(), dev, 0); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+
+		rr := doJSONReq(t, srv.SignTransaction, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: dev.GetIDStr(), Data: "hello"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("sign: expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var signed struct {
+			Data SignTxResponse `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &signed); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+
+		cases := []struct {
+			name       string
+			signedData string
+			valid      bool
+		}{
+			{"original", signed.Data.SignedData, true},
+			{"tampered", signed.Data.SignedData + "x", false},
+		}
+		for _, c := range cases {
+			body := VerifyTxRequest{DeviceID: dev.GetIDStr(), SignedData: c.signedData, Signature: signed.Data.Signature}
+			rr := doJSONReq(t, srv.VerifyTransaction, http.MethodPost, "/api/v0/verify-tx", nil, body)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%s/%s: expected 200, got %d: %s", algorithm, c.name, rr.Code, rr.Body.String())
+			}
+			var verified struct {
+				Data VerifyTxResponse `json:"data"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &verified); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if verified.Data.Valid != c.valid {
+				t.Fatalf("%s/%s: expected valid=%v", algorithm, c.name, c.valid)
+			}
+		}
+	}
+}
+
+func TestVerifyTransaction_Errors(t *testing.T) {
+	srv := newTestServer(t)
+	cases := []struct {
+		name string
+		body VerifyTxRequest
+		code int
+	}{
+		{"missing signature", VerifyTxRequest{DeviceID: "id", SignedData: "0_a_b"}, http.StatusBadRequest},
+		{"invalid base64", VerifyTxRequest{DeviceID: "id", SignedData: "0_a_b", Signature: "%%%"}, http.StatusBadRequest},
+		{"unknown device", VerifyTxRequest{DeviceID: "unknown", SignedData: "0_a_b", Signature: "c2ln"}, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		rr := doJSONReq(t, srv.VerifyTransaction, http.MethodPost, "/api/v0/verify-tx", nil, c.body)
+		if rr.Code != c.code {
+			t.Fatalf("%s: expected %d, got %d: %s", c.name, c.code, rr.Code, rr.Body.String())
+		}
+	}
+}
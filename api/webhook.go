@@ -0,0 +1,242 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+type CreateWebhookRequest struct {
+	URL        string             `json:"url"`
+	EventTypes []domain.EventType `json:"eventTypes"`
+}
+
+// Validate checks if the JSON request is valid.
+func (r *CreateWebhookRequest) Validate() error {
+	var v validator
+	endpoint, err := url.Parse(r.URL)
+	v.check(err == nil && endpoint.Scheme == "https" && endpoint.Host != "", "url", "must be an absolute https URL")
+	v.check(len(r.EventTypes) > 0, "eventTypes", "are required")
+	for _, eventType := range r.EventTypes {
+		v.check(domain.IsValidEventType(eventType), "eventTypes", fmt.Sprintf("contain the invalid event type %q", eventType))
+	}
+	return v.err()
+}
+
+// webhookEndpoint is a representation of a webhook endpoint but as an API response.
+type webhookEndpoint struct {
+	ID         string             `json:"id"`
+	TenantID   string             `json:"tenantId"`
+	URL        string             `json:"url"`
+	EventTypes []domain.EventType `json:"eventTypes"`
+	CreatedAt  time.Time          `json:"createdAt"`
+}
+
+func newWebhookEndpoint(endpoint *domain.WebhookEndpoint) webhookEndpoint {
+	return webhookEndpoint{
+		ID:         endpoint.ID,
+		TenantID:   endpoint.TenantID,
+		URL:        endpoint.URL,
+		EventTypes: endpoint.EventTypes,
+		CreatedAt:  endpoint.CreatedAt,
+	}
+}
+
+// CreateWebhookResponse is the response when creating a webhook endpoint.
+// It is the only time the secret signing the deliveries is revealed.
+type CreateWebhookResponse struct {
+	webhookEndpoint
+	Secret string `json:"secret"`
+}
+
+// deadLetter is a representation of a dead letter but as an API response.
+type deadLetter struct {
+	ID         string           `json:"id"`
+	EndpointID string           `json:"endpointId"`
+	URL        string           `json:"url"`
+	EventID    string           `json:"eventId"`
+	EventType  domain.EventType `json:"eventType"`
+	Payload    json.RawMessage  `json:"payload"`
+	Attempts   int              `json:"attempts"`
+	LastError  string           `json:"lastError"`
+	FailedAt   time.Time        `json:"failedAt"`
+}
+
+func newDeadLetter(letter *domain.DeadLetter) deadLetter {
+	return deadLetter{
+		ID:         letter.ID,
+		EndpointID: letter.EndpointID,
+		URL:        letter.URL,
+		EventID:    letter.EventID,
+		EventType:  letter.EventType,
+		Payload:    letter.Payload,
+		Attempts:   letter.Attempts,
+		LastError:  letter.LastError,
+		FailedAt:   letter.FailedAt,
+	}
+}
+
+// CreateWebhook registers a webhook endpoint for the tenant of the caller.
+func (s *Server) CreateWebhook(response http.ResponseWriter, request *http.Request) {
+	// parse and validate request JSON
+	requestJSON, ok := parseRequestJSON[CreateWebhookRequest](response, request)
+	if !ok {
+		return
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	endpoint, err := domain.NewWebhookEndpoint(tenant.ID, requestJSON.URL, requestJSON.EventTypes)
+	if err != nil {
+		WriteErrorResponse(response, http.StatusInternalServerError, []string{
+			"Unable to create webhook",
+		})
+		return
+	}
+
+	err = s.webhookStore.Add(request.Context(), endpoint)
+	if err != nil {
+		writeError(response, err, "Unable to save webhook")
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, CreateWebhookResponse{
+		webhookEndpoint: newWebhookEndpoint(endpoint),
+		Secret:          endpoint.Secret,
+	})
+}
+
+// ListWebhooks lists all webhook endpoints of the tenant of the caller.
+func (s *Server) ListWebhooks(response http.ResponseWriter, request *http.Request) {
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	endpoints, err := s.webhookStore.List(request.Context(), tenant.ID)
+	if err != nil {
+		writeError(response, err, "Unable to list webhooks")
+		return
+	}
+
+	result := make([]webhookEndpoint, len(endpoints))
+	for i, endpoint := range endpoints {
+		result[i] = newWebhookEndpoint(endpoint)
+	}
+
+	WriteAPIResponse(response, http.StatusOK, result)
+}
+
+// DeleteWebhook removes a webhook endpoint of the tenant of the caller, its pending deliveries are dropped.
+func (s *Server) DeleteWebhook(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if strings.TrimSpace(id) == "" {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"id is required",
+		})
+		return
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	err := s.webhookStore.Delete(request.Context(), tenant.ID, id)
+	if err != nil {
+		writeError(response, err, "Could not delete webhook")
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeadLetters lists the webhook deliveries of the tenant of the caller which failed every attempt.
+func (s *Server) ListDeadLetters(response http.ResponseWriter, request *http.Request) {
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	letters, err := s.deadLetterStore.List(request.Context(), tenant.ID)
+	if err != nil {
+		writeError(response, err, "Unable to list dead letters")
+		return
+	}
+
+	result := make([]deadLetter, len(letters))
+	for i, letter := range letters {
+		result[i] = newDeadLetter(letter)
+	}
+
+	WriteAPIResponse(response, http.StatusOK, result)
+}
+
+// GetDeadLetter returns a single dead letter, including the payload of the failed delivery.
+func (s *Server) GetDeadLetter(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if strings.TrimSpace(id) == "" {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"id is required",
+		})
+		return
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	letter, err := s.deadLetterStore.Get(request.Context(), tenant.ID, id)
+	if err != nil {
+		writeError(response, err, "Could not retrieve dead letter")
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, newDeadLetter(letter))
+}
+
+// ReplayDeadLetter queues a dead letter for delivery again. The delivery happens in the background,
+// if it fails again it shows up as a dead letter again.
+func (s *Server) ReplayDeadLetter(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if strings.TrimSpace(id) == "" {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"id is required",
+		})
+		return
+	}
+
+	tenant, ok := s.requestTenant(response, request)
+	if !ok {
+		return
+	}
+
+	err := s.webhooks.Replay(request.Context(), tenant.ID, id)
+	// the dead letter exists, but the endpoint it was addressed to is gone
+	if errors.Is(err, persistence.ErrWebhookNotFound) {
+		writeProblem(response, Problem{
+			Status: http.StatusConflict,
+			Code:   ProblemWebhookNotFound,
+			Title:  "Webhook not found",
+			Detail: fmt.Sprintf("Could not replay dead letter: %s", err.Error()),
+		})
+		return
+	}
+	if err != nil {
+		writeError(response, err, "Could not replay dead letter")
+		return
+	}
+
+	response.WriteHeader(http.StatusAccepted)
+}
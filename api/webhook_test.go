@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/webhook"
+)
+
+// webhookDelivery is a delivery received by a test webhook endpoint.
+type webhookDelivery struct {
+	header  http.Header
+	payload []byte
+}
+
+// helper to create an authenticated test server delivering its webhooks to an HTTPS test endpoint,
+// which answers with the given status code
+func newWebhookTestServer(t *testing.T, status int) (*Server, string, string, chan webhookDelivery) {
+	t.Helper()
+	deliveries := make(chan webhookDelivery, 16)
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- webhookDelivery{header: r.Header, payload: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(receiver.Close)
+
+	srv, adminKey := newAuthTestServer(t)
+	srv.webhooks.Close()
+	srv.webhooks = webhook.NewDispatcher(webhook.Params{
+		Endpoints:   srv.webhookStore,
+		DeadLetters: srv.deadLetterStore,
+		Client:      receiver.Client(),
+		Config:      webhook.Config{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	})
+	srv.events = srv.webhooks
+	t.Cleanup(func() { srv.webhooks.Close() })
+	return srv, adminKey, receiver.URL, deliveries
+}
+
+func receiveDelivery(t *testing.T, deliveries chan webhookDelivery) webhookDelivery {
+	t.Helper()
+	select {
+	case delivery := <-deliveries:
+		return delivery
+	case <-time.After(5 * time.Second):
+		t.Fatalf("webhook was not delivered")
+		return webhookDelivery{}
+	}
+}
+
+func TestWebhooks_SignatureCreated(t *testing.T) {
+	srv, _, url, deliveries := newWebhookTestServer(t, http.StatusNoContent)
+	srv.authenticator = nil
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/webhooks", nil, CreateWebhookRequest{URL: "http://example.com", EventTypes: []domain.EventType{domain.EventSignatureCreated}})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a plain HTTP URL, got %d", rr.Code)
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/webhooks", nil, CreateWebhookRequest{URL: url, EventTypes: []domain.EventType{"device.deleted"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown event type, got %d", rr.Code)
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/webhooks", nil, CreateWebhookRequest{URL: url, EventTypes: []domain.EventType{domain.EventSignatureCreated}})
+	var created struct {
+		Data CreateWebhookResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || created.Data.Secret == "" {
+		t.Fatalf("create webhook: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/signature-device", nil, CreateSignatureDeviceRequest{Algorithm: crypto.ECC})
+	var device struct {
+		Data CreateSignatureDeviceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &device); err != nil {
+		t.Fatalf("create device: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/sign-tx", nil, SignTxRequest{DeviceID: device.Data.ID, Data: "data"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("sign: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// only the subscribed signature.created event is delivered
+	delivery := receiveDelivery(t, deliveries)
+	if err := webhook.Verify(created.Data.Secret, delivery.header, delivery.payload, time.Minute); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+	var payload struct {
+		Type     string                `json:"type"`
+		DeviceID string                `json:"deviceId"`
+		Data     signatureCreatedEvent `json:"data"`
+	}
+	if err := json.Unmarshal(delivery.payload, &payload); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if payload.Type != "signature.created" || payload.DeviceID != device.Data.ID || payload.Data.Counter != 0 || payload.Data.Signature == "" {
+		t.Fatalf("unexpected payload: %s", delivery.payload)
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/webhooks", nil, nil)
+	if rr.Code != http.StatusOK || !json.Valid(rr.Body.Bytes()) {
+		t.Fatalf("list webhooks: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = doHandlerReq(t, srv, http.MethodDelete, "/api/v0/webhooks/"+created.Data.ID, nil, nil)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	rr = doHandlerReq(t, srv, http.MethodDelete, "/api/v0/webhooks/"+created.Data.ID, nil, nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
+
+func TestWebhooks_DeadLetters(t *testing.T) {
+	srv, adminKey, url, deliveries := newWebhookTestServer(t, http.StatusInternalServerError)
+	admin := map[string]string{auth.APIKeyHeader: adminKey}
+
+	rr := doHandlerReq(t, srv, http.MethodPost, "/api/v0/webhooks", admin, CreateWebhookRequest{URL: url, EventTypes: []domain.EventType{domain.EventDeviceCreated}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create webhook: %d %s", rr.Code, rr.Body.String())
+	}
+	srv.publish(domain.EventDeviceCreated, domain.DefaultTenantID, "device", nil)
+	receiveDelivery(t, deliveries)
+	receiveDelivery(t, deliveries)
+
+	var letters []deadLetter
+	for deadline := time.Now().Add(5 * time.Second); len(letters) == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery did not become a dead letter")
+		}
+		rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/webhooks/dead-letters", admin, nil)
+		var listed struct {
+			Data []deadLetter `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &listed); err != nil {
+			t.Fatalf("list dead letters: %d %s", rr.Code, rr.Body.String())
+		}
+		letters = listed.Data
+	}
+	if letters[0].Attempts != 2 || letters[0].EventType != domain.EventDeviceCreated || letters[0].LastError == "" {
+		t.Fatalf("unexpected dead letter: %+v", letters[0])
+	}
+
+	rr = doHandlerReq(t, srv, http.MethodGet, "/api/v0/webhooks/dead-letters/"+letters[0].ID, admin, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/webhooks/dead-letters/unknown/replay", admin, nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	rr = doHandlerReq(t, srv, http.MethodPost, "/api/v0/webhooks/dead-letters/"+letters[0].ID+"/replay", admin, nil)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if delivery := receiveDelivery(t, deliveries); delivery.header.Get(webhook.HeaderID) != letters[0].ID {
+		t.Fatalf("expected the replay to keep the delivery ID")
+	}
+	if letters, _ := srv.deadLetterStore.List(context.Background(), domain.DefaultTenantID); len(letters) != 0 {
+		t.Fatalf("expected the replayed dead letter to be removed, got %d", len(letters))
+	}
+}
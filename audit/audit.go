@@ -0,0 +1,250 @@
+// Package audit verifies exported signature chains of signature devices offline, without access to the signing
+// service: given the public keys of a device and its signature log it checks that the counters are continuous, that
+// every signature is linked to the previous one (starting with the base64 encoded device ID), and that every
+// signature verifies with the key the device had when it was created.
+package audit
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+)
+
+// Issue codes reported by VerifyChain.
+const (
+	IssueIncompleteChain  = "incomplete_chain"
+	IssueCounterSequence  = "counter_sequence"
+	IssueCounterMismatch  = "counter_mismatch"
+	IssueGenesisMismatch  = "genesis_mismatch"
+	IssueBrokenLink       = "broken_link"
+	IssueDeviceMismatch   = "device_mismatch"
+	IssueUnknownKey       = "unknown_key"
+	IssueKeyOrder         = "key_order"
+	IssueInvalidSignature = "invalid_signature"
+)
+
+// Key is a version of the public key of a device, the JSON encoding matches the public keys of the API.
+type Key struct {
+	Version uint64 `json:"version"`
+	// PublicKey is a PEM encoded public key or certificate of an RSA or ECDSA key.
+	PublicKey []byte `json:"publicKey"`
+	// FirstCounter is the counter of the first signature created with the key, 0 if unknown.
+	FirstCounter uint64 `json:"firstCounter"`
+}
+
+// Signature is an entry of a signature log, the JSON encoding matches the signatures of the API.
+type Signature struct {
+	DeviceID   string `json:"deviceId"`
+	Counter    uint64 `json:"counter"`
+	Signature  string `json:"signature"`
+	SignedData string `json:"signedData"`
+	KeyVersion uint64 `json:"keyVersion"`
+}
+
+// Params configure the verification of a signature chain.
+type Params struct {
+	// DeviceID is the ID of the device, its base64 encoded bytes are the last signature of the first signed data.
+	DeviceID string
+	// Keys are the versions of the public key of the device.
+	Keys []Key
+	// Partial accepts a log which does not start with the first signature of the device, the link of its first
+	// signature to the one before cannot be checked.
+	Partial bool
+}
+
+// Issue is a violation of the chain rules found at a signature.
+type Issue struct {
+	Counter uint64 `json:"counter"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Report is the result of VerifyChain.
+type Report struct {
+	DeviceID     string `json:"deviceId"`
+	Signatures   int    `json:"signatures"`
+	FirstCounter uint64 `json:"firstCounter"`
+	LastCounter  uint64 `json:"lastCounter"`
+	// ValidSignatures is the number of signatures which verify with their key, regardless of the chain rules.
+	ValidSignatures int `json:"validSignatures"`
+	// Valid is true if no issue was found.
+	Valid  bool    `json:"valid"`
+	Issues []Issue `json:"issues"`
+}
+
+// verificationKey is a parsed Key.
+type verificationKey struct {
+	Key
+	verifier crypto.Verifier
+}
+
+// VerifyChain checks a signature log, ordered by counter, against the chain rules and the public keys of the device.
+// Violations are reported as issues of the report, errors are only returned for invalid params.
+func VerifyChain(params Params, signatures []Signature) (*Report, error) {
+	id, err := uuid.Parse(params.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device id %q: %w", params.DeviceID, err)
+	}
+	idBytes, err := id.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseKeys(params.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{DeviceID: params.DeviceID, Signatures: len(signatures), Issues: []Issue{}}
+	if len(signatures) == 0 {
+		report.Valid = true
+		return report, nil
+	}
+	report.FirstCounter = signatures[0].Counter
+	report.LastCounter = signatures[len(signatures)-1].Counter
+	issue := func(counter uint64, code string, format string, args ...any) {
+		report.Issues = append(report.Issues, Issue{Counter: counter, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	lastSignature := base64.StdEncoding.EncodeToString(idBytes)
+	if first := signatures[0].Counter; first != 0 && !params.Partial {
+		issue(first, IssueIncompleteChain, "the log starts at counter %d, not with the first signature of the device", first)
+	}
+	var lastKeyVersion uint64
+	for i, signature := range signatures {
+		counter := signature.Counter
+		if i > 0 && counter != signatures[i-1].Counter+1 {
+			issue(counter, IssueCounterSequence, "follows counter %d", signatures[i-1].Counter)
+		}
+		if signature.DeviceID != "" && !sameDevice(signature.DeviceID, id) {
+			issue(counter, IssueDeviceMismatch, "created by device %s", signature.DeviceID)
+		}
+
+		// <counter>_<data>_<last signature>, the data may contain underscores
+		prefix, _, _ := strings.Cut(signature.SignedData, "_")
+		if signedCounter, err := strconv.ParseUint(prefix, 10, 64); err != nil || signedCounter != counter {
+			issue(counter, IssueCounterMismatch, "the signed data does not start with the counter")
+		}
+		// the link of a log starting after the first signature is unknown
+		if i > 0 || counter == 0 {
+			link := "_" + lastSignature
+			if !strings.HasSuffix(signature.SignedData, link) || len(signature.SignedData) < len(prefix)+1+len(link) {
+				if i == 0 && counter == 0 {
+					issue(counter, IssueGenesisMismatch, "the signed data does not end with the base64 encoded device id")
+				} else {
+					issue(counter, IssueBrokenLink, "the signed data does not end with the previous signature")
+				}
+			}
+		}
+		lastSignature = signature.Signature
+
+		key, ok := keyAt(keys, signature)
+		if !ok {
+			issue(counter, IssueUnknownKey, "no public key of version %d", signature.KeyVersion)
+			continue
+		}
+		if key.Version < lastKeyVersion {
+			issue(counter, IssueKeyOrder, "signed with key version %d after version %d", key.Version, lastKeyVersion)
+		}
+		lastKeyVersion = key.Version
+		if key.FirstCounter > counter {
+			issue(counter, IssueKeyOrder, "signed with key version %d, which signs from counter %d", key.Version, key.FirstCounter)
+		}
+		if next, ok := keyOfVersion(keys, key.Version+1); ok && next.FirstCounter > 0 && counter >= next.FirstCounter {
+			issue(counter, IssueKeyOrder, "signed with key version %d, replaced at counter %d", key.Version, next.FirstCounter)
+		}
+
+		signatureBytes, err := base64.StdEncoding.DecodeString(signature.Signature)
+		if err == nil {
+			err = key.verifier.Verify([]byte(signature.SignedData), signatureBytes)
+		}
+		if err != nil {
+			issue(counter, IssueInvalidSignature, "the signature does not verify with key version %d", key.Version)
+			continue
+		}
+		report.ValidSignatures++
+	}
+	report.Valid = len(report.Issues) == 0
+	return report, nil
+}
+
+// keyAt returns the key a signature was created with: the key of its version, or the only key if the log has no
+// key versions.
+func keyAt(keys []verificationKey, signature Signature) (verificationKey, bool) {
+	if signature.KeyVersion == 0 && len(keys) == 1 {
+		return keys[0], true
+	}
+	return keyOfVersion(keys, signature.KeyVersion)
+}
+
+func keyOfVersion(keys []verificationKey, version uint64) (verificationKey, bool) {
+	for _, key := range keys {
+		if key.Version == version {
+			return key, true
+		}
+	}
+	return verificationKey{}, false
+}
+
+// sameDevice compares device IDs regardless of their format, the API omits the dashes of UUIDs.
+func sameDevice(deviceID string, id uuid.UUID) bool {
+	parsed, err := uuid.Parse(deviceID)
+	return err == nil && parsed == id
+}
+
+func parseKeys(keys []Key) ([]verificationKey, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys")
+	}
+	parsed := make([]verificationKey, len(keys))
+	for i, key := range keys {
+		verifier, err := newVerifier(key.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key version %d: %w", key.Version, err)
+		}
+		parsed[i] = verificationKey{Key: key, verifier: verifier}
+	}
+	return parsed, nil
+}
+
+// newVerifier creates the verifier of a PEM encoded public key or certificate, in the encoding of the service
+// (PKCS #1 for RSA, PKIX for ECDSA) or any other encoding of the key.
+func newVerifier(publicKey []byte) (crypto.Verifier, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return nil, errors.New("not PEM encoded")
+	}
+	var key any
+	var err error
+	if block.Type == "CERTIFICATE" {
+		var certificate *x509.Certificate
+		if certificate, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = certificate.PublicKey
+		}
+	} else if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return crypto.NewRSAVerifier(pem.EncodeToMemory(&pem.Block{Type: "RSA_PUBLIC_KEY", Bytes: x509.MarshalPKCS1PublicKey(key)}))
+	case *ecdsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.NewECCVerifier(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC_KEY", Bytes: der}))
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
+}
@@ -0,0 +1,292 @@
+package audit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+func newStores() (crypto.KeyGeneratorStore, crypto.SignerStore) {
+	kg := crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{
+		crypto.RSA: &crypto.RSAGenerator{},
+		crypto.ECC: &crypto.ECCGenerator{},
+	})
+	ss := crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+		crypto.RSA: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewRSASigner(privateKey) },
+		crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+	})
+	return kg, ss
+}
+
+// helper to sign count entries with a new device, rotating its key before the signature rotateAt if it is not 0
+func newTestChain(t *testing.T, algorithm crypto.SignatureAlgorithm, count int, rotateAt int) (Params, []Signature) {
+	t.Helper()
+	ctx := context.Background()
+	kg, ss := newStores()
+	device, err := domain.NewSignatureDevice(ctx, &kg, &ss, domain.DefaultTenantID, algorithm, "audit")
+	if err != nil {
+		t.Fatalf("new device: %v", err)
+	}
+	var signatures []Signature
+	for i := 0; i < count; i++ {
+		if i > 0 && i == rotateAt {
+			generator, _ := kg.Get(algorithm)
+			public, private, err := generator.GenerateKeyPair(ctx)
+			if err != nil {
+				t.Fatalf("generate key: %v", err)
+			}
+			if device, err = device.WithKey(&ss, public, private); err != nil {
+				t.Fatalf("rotate key: %v", err)
+			}
+		}
+		// data with underscores must not confuse the linkage
+		result, err := device.SignData(ctx, fmt.Sprintf("receipt_%d", i))
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		signatures = append(signatures, Signature{
+			DeviceID:   device.GetIDStr(),
+			Counter:    result.Counter,
+			Signature:  result.Signature,
+			SignedData: result.SignedData,
+			KeyVersion: result.KeyVersion,
+		})
+	}
+	var keys []Key
+	for _, key := range device.PublicKeys() {
+		keys = append(keys, Key{Version: key.Version, PublicKey: key.PublicKey, FirstCounter: key.FirstCounter})
+	}
+	return Params{DeviceID: device.GetIDStr(), Keys: keys}, signatures
+}
+
+func issueCodes(report *Report) []string {
+	codes := []string{}
+	for _, issue := range report.Issues {
+		codes = append(codes, fmt.Sprintf("%d:%s", issue.Counter, issue.Code))
+	}
+	return codes
+}
+
+func TestVerifyChain_Valid(t *testing.T) {
+	for _, algorithm := range []crypto.SignatureAlgorithm{crypto.RSA, crypto.ECC} {
+		params, signatures := newTestChain(t, algorithm, 4, 2)
+		report, err := VerifyChain(params, signatures)
+		if err != nil {
+			t.Fatalf("%s: verify: %v", algorithm, err)
+		}
+		if !report.Valid || report.ValidSignatures != 4 || report.LastCounter != 3 || len(report.Issues) != 0 {
+			t.Fatalf("%s: expected a valid chain, got %+v", algorithm, report)
+		}
+	}
+}
+
+func TestVerifyChain_Issues(t *testing.T) {
+	params, signatures := newTestChain(t, crypto.ECC, 4, 2)
+	other, otherSignatures := newTestChain(t, crypto.ECC, 1, 0)
+
+	for name, tc := range map[string]struct {
+		modify func(params *Params, signatures []Signature) []Signature
+		want   string
+	}{
+		"missing signature": {
+			modify: func(_ *Params, signatures []Signature) []Signature { return append(signatures[:1], signatures[2:]...) },
+			want:   "2:counter_sequence 2:broken_link",
+		},
+		"reordered signatures": {
+			modify: func(_ *Params, signatures []Signature) []Signature {
+				signatures[2], signatures[3] = signatures[3], signatures[2]
+				return signatures
+			},
+			want: "3:counter_sequence 3:broken_link 2:counter_sequence 2:broken_link",
+		},
+		"tampered data": {
+			modify: func(_ *Params, signatures []Signature) []Signature {
+				signatures[1].SignedData = strings.Replace(signatures[1].SignedData, "receipt_1", "receipt_9", 1)
+				return signatures
+			},
+			want: "1:invalid_signature",
+		},
+		"wrong counter in the signed data": {
+			modify: func(_ *Params, signatures []Signature) []Signature {
+				signatures[1].Counter = 5
+				return signatures[:2]
+			},
+			want: "5:counter_sequence 5:counter_mismatch 5:key_order",
+		},
+		"chain of another device": {
+			modify: func(params *Params, _ []Signature) []Signature {
+				params.Keys = other.Keys
+				otherSignatures[0].DeviceID = ""
+				return otherSignatures
+			},
+			want: "0:genesis_mismatch",
+		},
+		"signature of another device": {
+			modify: func(_ *Params, signatures []Signature) []Signature {
+				signatures[0].DeviceID = other.DeviceID
+				return signatures[:1]
+			},
+			want: "0:device_mismatch",
+		},
+		"former key after a rotation": {
+			modify: func(params *Params, signatures []Signature) []Signature {
+				signatures[3].KeyVersion = 1
+				return signatures
+			},
+			want: "3:key_order 3:key_order 3:invalid_signature",
+		},
+		"missing key": {
+			modify: func(params *Params, signatures []Signature) []Signature {
+				params.Keys = params.Keys[:1]
+				return signatures
+			},
+			want: "2:unknown_key 3:unknown_key",
+		},
+		"incomplete log": {
+			modify: func(_ *Params, signatures []Signature) []Signature { return signatures[1:] },
+			want:   "1:incomplete_chain",
+		},
+		"partial log": {
+			modify: func(params *Params, signatures []Signature) []Signature {
+				params.Partial = true
+				return signatures[1:]
+			},
+			want: "",
+		},
+	} {
+		params := params
+		params.Keys = append([]Key(nil), params.Keys...)
+		modified := tc.modify(&params, append([]Signature(nil), signatures...))
+		report, err := VerifyChain(params, modified)
+		if err != nil {
+			t.Fatalf("%s: verify: %v", name, err)
+		}
+		if got := strings.Join(issueCodes(report), " "); got != tc.want || report.Valid != (tc.want == "") {
+			t.Fatalf("%s: expected issues %q, got %q", name, tc.want, got)
+		}
+	}
+}
+
+func TestVerifyChain_InvalidParams(t *testing.T) {
+	params, signatures := newTestChain(t, crypto.ECC, 1, 0)
+	for name, modify := range map[string]func(params *Params){
+		"invalid device id": func(params *Params) { params.DeviceID = "device" },
+		"no keys":           func(params *Params) { params.Keys = nil },
+		"invalid key":       func(params *Params) { params.Keys = []Key{{Version: 1, PublicKey: []byte("key")}} },
+	} {
+		params := params
+		modify(&params)
+		if _, err := VerifyChain(params, signatures); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	params, signatures := newTestChain(t, crypto.ECC, 3, 1)
+
+	// PEM keys in the order of their versions, with text around them
+	var exported strings.Builder
+	for _, key := range params.Keys {
+		fmt.Fprintf(&exported, "# key version %d\n%s", key.Version, key.PublicKey)
+	}
+	asJSON, _ := json.Marshal(params.Keys)
+	device, _ := json.Marshal(map[string]any{"id": params.DeviceID, "publicKeys": params.Keys})
+	for name, data := range map[string]string{"pem": exported.String(), "json": string(asJSON), "device": string(device)} {
+		keys, err := ParseKeys([]byte(data))
+		if err != nil || len(keys) != 2 || keys[1].Version != 2 {
+			t.Fatalf("%s: unexpected keys %+v: %v", name, keys, err)
+		}
+		report, err := VerifyChain(Params{DeviceID: params.DeviceID, Keys: keys}, signatures)
+		if err != nil || !report.Valid {
+			t.Fatalf("%s: expected a valid chain, got %+v: %v", name, report, err)
+		}
+	}
+
+	if _, err := ParseKeys([]byte("no keys")); err == nil {
+		t.Fatalf("expected an error without keys")
+	}
+
+	// the comments of signctl export keys carry the counter each key signs from, so the rotation is checked
+	header := func(firstCounter uint64) string {
+		return fmt.Sprintf("# ECC key version 2 of device %s, signs from counter %d\n", params.DeviceID, firstCounter)
+	}
+	first := fmt.Sprintf("# ECC key version 1 of device %s, signs from counter 0\n%s", params.DeviceID, params.Keys[0].PublicKey)
+	keys, err := ParseKeys([]byte(first + header(1) + string(params.Keys[1].PublicKey)))
+	if err != nil || len(keys) != 2 || keys[1].Version != 2 || keys[1].FirstCounter != 1 {
+		t.Fatalf("expected the first counters of the exported keys, got %+v: %v", keys, err)
+	}
+	keys, _ = ParseKeys([]byte(first + header(2) + string(params.Keys[1].PublicKey)))
+	report, err := VerifyChain(Params{DeviceID: params.DeviceID, Keys: keys}, signatures)
+	if err != nil || report.Valid || report.Issues[0].Code != IssueKeyOrder {
+		t.Fatalf("expected a key order issue for a signature before the key took over, got %+v: %v", report, err)
+	}
+}
+
+func TestVerifyChain_Certificate(t *testing.T) {
+	params, signatures := newTestChain(t, crypto.ECC, 2, 0)
+
+	// a certificate issued for the public key of the device
+	block, _ := pem.Decode(params.Keys[0].PublicKey)
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	issuer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: params.DeviceID},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, publicKey, issuer)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	keys, err := ParseKeys(certificate)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	report, err := VerifyChain(Params{DeviceID: params.DeviceID, Keys: keys}, signatures)
+	if err != nil || !report.Valid {
+		t.Fatalf("expected a valid chain, got %+v: %v", report, err)
+	}
+}
+
+func TestReadSignatures(t *testing.T) {
+	_, signatures := newTestChain(t, crypto.ECC, 2, 0)
+	var lines strings.Builder
+	for _, signature := range signatures {
+		line, _ := json.Marshal(signature)
+		lines.Write(append(line, '\n'))
+	}
+	array, _ := json.MarshalIndent(signatures, "", "  ")
+
+	for name, data := range map[string]string{"json lines": lines.String(), "json array": "\n " + string(array)} {
+		read, err := ReadSignatures(strings.NewReader(data))
+		if err != nil || len(read) != 2 || read[1] != signatures[1] {
+			t.Fatalf("%s: unexpected signatures %+v: %v", name, read, err)
+		}
+	}
+	if read, err := ReadSignatures(strings.NewReader("")); err != nil || len(read) != 0 {
+		t.Fatalf("expected an empty log, got %+v: %v", read, err)
+	}
+	if _, err := ReadSignatures(strings.NewReader(`{"counter": "first"}`)); err == nil {
+		t.Fatalf("expected an error for an invalid log")
+	}
+}
@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// pemKeyVersion and pemFirstCounter read the comment line signctl export keys writes before each key,
+	// e.g. "# ECC key version 2 of device <id>, signs from counter 10".
+	pemKeyVersion   = regexp.MustCompile(`key version (\d+)`)
+	pemFirstCounter = regexp.MustCompile(`signs from counter (\d+)`)
+)
+
+// ReadSignatures reads a signature log, either a JSON array of signatures or one signature per line (JSON lines, as
+// exported by signctl export chain -output json).
+func ReadSignatures(r io.Reader) ([]Signature, error) {
+	reader := bufio.NewReader(r)
+	decoder := json.NewDecoder(reader)
+	if start, err := peekNonSpace(reader); err == nil && start == '[' {
+		var signatures []Signature
+		if err := decoder.Decode(&signatures); err != nil {
+			return nil, fmt.Errorf("invalid signature log: %w", err)
+		}
+		return signatures, nil
+	}
+
+	signatures := []Signature{}
+	for {
+		var signature Signature
+		err := decoder.Decode(&signature)
+		if errors.Is(err, io.EOF) {
+			return signatures, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature %d of the log: %w", len(signatures)+1, err)
+		}
+		signatures = append(signatures, signature)
+	}
+}
+
+// peekNonSpace returns the first byte which is not white space, without consuming it.
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, reader.UnreadByte()
+		}
+	}
+}
+
+// ParseKeys parses the public keys of a device:
+//   - PEM encoded public keys or certificates, one per key version in order (as exported by signctl export keys);
+//     the version and first counter are read from the comment before each key if it has them, other text is ignored
+//   - a JSON array of keys (as exported by signctl export keys -output json)
+//   - a device as JSON (as returned by the API), its public keys or its only key
+func ParseKeys(data []byte) ([]Key, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var keys []Key
+		if err := json.Unmarshal(trimmed, &keys); err != nil {
+			return nil, fmt.Errorf("invalid keys: %w", err)
+		}
+		return keys, nil
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var device struct {
+			PublicKey  []byte `json:"publicKey"`
+			KeyVersion uint64 `json:"keyVersion"`
+			PublicKeys []Key  `json:"publicKeys"`
+		}
+		if err := json.Unmarshal(trimmed, &device); err != nil {
+			return nil, fmt.Errorf("invalid device: %w", err)
+		}
+		if len(device.PublicKeys) > 0 {
+			return device.PublicKeys, nil
+		}
+		return []Key{{Version: max(device.KeyVersion, 1), PublicKey: device.PublicKey}}, nil
+	}
+
+	var keys []Key
+	rest := data
+	for {
+		// the text between the previous key and this one
+		header := rest
+		if begin := bytes.Index(rest, []byte("-----BEGIN")); begin >= 0 {
+			header = rest[:begin]
+		}
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		key := Key{Version: uint64(len(keys) + 1), PublicKey: pem.EncodeToMemory(block)}
+		if version, ok := lastNumber(pemKeyVersion, header); ok {
+			key.Version = version
+		}
+		if counter, ok := lastNumber(pemFirstCounter, header); ok {
+			key.FirstCounter = counter
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM encoded public keys or certificates found")
+	}
+	return keys, nil
+}
+
+// lastNumber returns the number captured by the last match of pattern in text.
+func lastNumber(pattern *regexp.Regexp, text []byte) (uint64, bool) {
+	matches := pattern.FindAllSubmatch(text, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	number, err := strconv.ParseUint(string(matches[len(matches)-1][1]), 10, 64)
+	return number, err == nil
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+const (
+	// APIKeyHeader is the request header carrying an API key.
+	APIKeyHeader = "X-API-Key"
+)
+
+// APIKeyAuthenticator authenticates requests by the API key in the APIKeyHeader.
+type APIKeyAuthenticator struct {
+	store persistence.APIKeyStore
+}
+
+// NewAPIKeyAuthenticator creates a new APIKeyAuthenticator looking up keys in the given store.
+func NewAPIKeyAuthenticator(store persistence.APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		store: store,
+	}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(request *http.Request) (Identity, error) {
+	key := strings.TrimSpace(request.Header.Get(APIKeyHeader))
+	if key == "" {
+		return Identity{}, ErrNoCredentials
+	}
+
+	apiKey, err := a.store.GetByHash(request.Context(), domain.HashAPIKey(key))
+	if errors.Is(err, persistence.ErrAPIKeyNotFound) {
+		return Identity{}, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		Subject:  apiKey.ID,
+		TenantID: apiKey.TenantID,
+		Scopes:   apiKey.Scopes,
+	}, nil
+}
+
+func (a *APIKeyAuthenticator) Challenge() string {
+	return fmt.Sprintf("ApiKey header=%q", APIKeyHeader)
+}
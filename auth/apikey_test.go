@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	store := persistence.NewInMemoryAPIKeyStore()
+	key, plaintext, err := domain.NewAPIKey("acme", "pos", []string{ScopeSign})
+	if err != nil {
+		t.Fatalf("NewAPIKey error: %v", err)
+	}
+	if strings.Contains(key.Hash, plaintext) || key.Hash == plaintext {
+		t.Fatalf("the plaintext key must not be stored")
+	}
+	if err := store.Add(context.Background(), key); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	authenticator := NewAPIKeyAuthenticator(store)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := authenticator.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials, got %v", err)
+	}
+
+	req.Header.Set(APIKeyHeader, "ssk_wrong")
+	if _, err := authenticator.Authenticate(req); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+
+	req.Header.Set(APIKeyHeader, plaintext)
+	identity, err := authenticator.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Authenticate error: %v", err)
+	}
+	if identity.Subject != key.ID || identity.TenantID != "acme" {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+	if !identity.HasScope(ScopeSign) || identity.HasScope(ScopeAdmin) {
+		t.Fatalf("unexpected scopes: %v", identity.Scopes)
+	}
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Scope is a permission carried by an identity.
+type Scope = string
+
+const (
+	ScopeDevicesRead  Scope = "devices:read"
+	ScopeDevicesWrite Scope = "devices:write"
+	ScopeSign         Scope = "sign"
+	ScopeAdmin        Scope = "admin"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator if the request carries no credentials it understands.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned by an Authenticator if the request carries credentials which are not valid.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Scopes lists every known scope.
+var Scopes = []Scope{ScopeDevicesRead, ScopeDevicesWrite, ScopeSign, ScopeAdmin}
+
+// IsValidScope checks if the given scope is known.
+func IsValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	// Subject identifies the caller, e.g. the ID of an API key.
+	Subject  string
+	TenantID string
+	Scopes   []Scope
+}
+
+// HasScope checks if the identity was granted the given scope.
+func (i Identity) HasScope(scope Scope) bool {
+	return slices.Contains(i.Scopes, scope)
+}
+
+// Authenticator resolves the identity of the caller of a request.
+type Authenticator interface {
+	// Authenticate returns ErrNoCredentials if the request carries no credentials for this authenticator
+	// and ErrInvalidCredentials (or an error wrapping it) if they are not valid.
+	Authenticate(request *http.Request) (Identity, error)
+}
+
+// Challenger is implemented by authenticators which know the WWW-Authenticate challenge for their credentials.
+type Challenger interface {
+	Challenge() string
+}
+
+// Chain is an Authenticator trying several authenticators in order.
+// The first authenticator finding credentials in the request decides.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(request *http.Request) (Identity, error) {
+	for _, authenticator := range c {
+		identity, err := authenticator.Authenticate(request)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return identity, err
+	}
+	return Identity{}, ErrNoCredentials
+}
+
+func (c Chain) Challenge() string {
+	var challenges []string
+	for _, authenticator := range c {
+		if challenger, ok := authenticator.(Challenger); ok {
+			challenges = append(challenges, challenger.Challenge())
+		}
+	}
+	return strings.Join(challenges, ", ")
+}
+
+type identityContextKey struct{}
+
+// WithIdentity returns a copy of the context carrying the identity.
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the identity stored in the context, if any.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(Identity)
+	return identity, ok
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// CertificateMapping maps a client certificate, by its fingerprint or its subject, to an identity.
+type CertificateMapping struct {
+	// Fingerprint is the hex encoded SHA-256 hash of the DER encoded certificate.
+	Fingerprint string `json:"fingerprint"`
+	// Subject is the common name of the certificate subject, used if no fingerprint is given.
+	Subject  string   `json:"subject"`
+	Name     string   `json:"name"`
+	TenantID string   `json:"tenantId"`
+	Scopes   []string `json:"scopes"`
+}
+
+// CertificateAuthenticator authenticates requests by the verified TLS client certificate (mutual TLS).
+// The certificate chain itself is verified by the TLS handshake, see api.NewTLSConfig.
+type CertificateAuthenticator struct {
+	byFingerprint map[string]CertificateMapping
+	bySubject     map[string]CertificateMapping
+}
+
+// NewCertificateAuthenticator creates a new CertificateAuthenticator with the given mappings.
+func NewCertificateAuthenticator(mappings []CertificateMapping) (*CertificateAuthenticator, error) {
+	authenticator := &CertificateAuthenticator{
+		byFingerprint: make(map[string]CertificateMapping),
+		bySubject:     make(map[string]CertificateMapping),
+	}
+	for i, mapping := range mappings {
+		if mapping.TenantID == "" {
+			return nil, fmt.Errorf("certificate mapping %d has no tenant", i+1)
+		}
+		switch {
+		case mapping.Fingerprint != "":
+			fingerprint := strings.ToLower(strings.ReplaceAll(mapping.Fingerprint, ":", ""))
+			authenticator.byFingerprint[fingerprint] = mapping
+		case mapping.Subject != "":
+			authenticator.bySubject[mapping.Subject] = mapping
+		default:
+			return nil, fmt.Errorf("certificate mapping %d has neither fingerprint nor subject", i+1)
+		}
+	}
+	return authenticator, nil
+}
+
+// LoadCertificateMappings reads certificate mappings from a JSON file.
+func LoadCertificateMappings(path string) ([]CertificateMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mappings []CertificateMapping
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return nil, fmt.Errorf("invalid certificate mappings: %w", err)
+	}
+	return mappings, nil
+}
+
+// CertificateFingerprint returns the hex encoded SHA-256 hash of the DER encoded certificate.
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *CertificateAuthenticator) Authenticate(request *http.Request) (Identity, error) {
+	// only certificates verified against the client CAs are trusted
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+	cert := request.TLS.VerifiedChains[0][0]
+
+	mapping, ok := a.byFingerprint[CertificateFingerprint(cert)]
+	if !ok {
+		mapping, ok = a.bySubject[cert.Subject.CommonName]
+	}
+	if !ok {
+		return Identity{}, fmt.Errorf("%w: client certificate %q is not mapped to an identity", ErrInvalidCredentials, cert.Subject.CommonName)
+	}
+
+	name := mapping.Name
+	if name == "" {
+		name = cert.Subject.CommonName
+	}
+	return Identity{
+		Subject:  name,
+		TenantID: mapping.TenantID,
+		Scopes:   mapping.Scopes,
+	}, nil
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	DefaultTenantClaim = "tenant_id"
+	DefaultScopeClaim  = "scope"
+)
+
+// jwtSigningMethods are the accepted JWT signature algorithms, symmetric algorithms are never accepted.
+var jwtSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// JWTConfig configures the validation of bearer JWTs and how their claims map to an Identity.
+type JWTConfig struct {
+	// Issuer is the required "iss" claim.
+	Issuer string
+	// Audience is the required "aud" claim.
+	Audience string
+	// TenantClaim names the claim carrying the tenant, DefaultTenantClaim if empty.
+	TenantClaim string
+	// ScopeClaim names the claim carrying the scopes, either space separated or as an array, DefaultScopeClaim if empty.
+	ScopeClaim string
+	// Leeway is the allowed clock skew when checking the expiry.
+	Leeway time.Duration
+}
+
+// JWTAuthenticator authenticates requests by an OIDC access token passed as bearer token.
+type JWTAuthenticator struct {
+	config JWTConfig
+	keys   KeyProvider
+}
+
+// NewJWTAuthenticator creates a new JWTAuthenticator verifying token signatures with the given keys.
+func NewJWTAuthenticator(config JWTConfig, keys KeyProvider) *JWTAuthenticator {
+	if config.TenantClaim == "" {
+		config.TenantClaim = DefaultTenantClaim
+	}
+	if config.ScopeClaim == "" {
+		config.ScopeClaim = DefaultScopeClaim
+	}
+	return &JWTAuthenticator{
+		config: config,
+		keys:   keys,
+	}
+}
+
+func (a *JWTAuthenticator) Authenticate(request *http.Request) (Identity, error) {
+	scheme, token, ok := strings.Cut(request.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return Identity{}, ErrNoCredentials
+	}
+
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.keys.Key(request.Context(), kid)
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimSpace(token), claims, keyFunc,
+		jwt.WithValidMethods(jwtSigningMethods),
+		jwt.WithIssuer(a.config.Issuer),
+		jwt.WithAudience(a.config.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(a.config.Leeway),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %s", ErrInvalidCredentials, err.Error())
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return Identity{}, fmt.Errorf("%w: missing subject", ErrInvalidCredentials)
+	}
+	tenantID, _ := claims[a.config.TenantClaim].(string)
+	if tenantID == "" {
+		return Identity{}, fmt.Errorf("%w: missing %q claim", ErrInvalidCredentials, a.config.TenantClaim)
+	}
+	scopes, err := scopesFromClaim(claims[a.config.ScopeClaim])
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: invalid %q claim: %s", ErrInvalidCredentials, a.config.ScopeClaim, err.Error())
+	}
+
+	return Identity{
+		Subject:  subject,
+		TenantID: tenantID,
+		Scopes:   scopes,
+	}, nil
+}
+
+func (a *JWTAuthenticator) Challenge() string {
+	return `Bearer realm="signing-service"`
+}
+
+// scopesFromClaim reads scopes given either as space separated string (OAuth 2.0 "scope") or as array (e.g. "scp").
+func scopesFromClaim(claim interface{}) ([]Scope, error) {
+	switch value := claim.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.Fields(value), nil
+	case []interface{}:
+		scopes := make([]Scope, 0, len(value))
+		for _, item := range value {
+			scope, ok := item.(string)
+			if !ok {
+				return nil, errors.New("scopes must be strings")
+			}
+			scopes = append(scopes, scope)
+		}
+		return scopes, nil
+	}
+	return nil, errors.New("scopes must be a string or an array")
+}
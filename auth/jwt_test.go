@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "signing-service"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   b64(key.N.Bytes()),
+		"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   b64(key.X.FillBytes(make([]byte, 32))),
+		"y":   b64(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func jwksJSON(t *testing.T, keys ...map[string]string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatalf("marshal jwks: %v", err)
+	}
+	return data
+}
+
+// helper to create a token with the default valid claims, overridden by the given ones
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key any, overrides jwt.MapClaims) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"iss":       testIssuer,
+		"aud":       testAudience,
+		"sub":       "pos-1",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"tenant_id": "acme",
+		"scope":     "devices:read sign",
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestJWTAuthenticator_RemoteJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	var fetches atomic.Int32
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(jwksJSON(t, rsaJWK("rsa-1", &key.PublicKey)))
+	}))
+	defer jwksServer.Close()
+
+	authenticator := NewJWTAuthenticator(JWTConfig{Issuer: testIssuer, Audience: testAudience},
+		NewRemoteKeyProvider(jwksServer.URL, jwksServer.Client()))
+
+	identity, err := authenticator.Authenticate(bearerRequest(signToken(t, jwt.SigningMethodRS256, "rsa-1", key, nil)))
+	if err != nil {
+		t.Fatalf("Authenticate error: %v", err)
+	}
+	if identity.Subject != "pos-1" || identity.TenantID != "acme" {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+	if !identity.HasScope(ScopeDevicesRead) || !identity.HasScope(ScopeSign) || identity.HasScope(ScopeAdmin) {
+		t.Fatalf("unexpected scopes: %v", identity.Scopes)
+	}
+
+	// scopes given as array
+	token := signToken(t, jwt.SigningMethodRS256, "rsa-1", key, jwt.MapClaims{"scope": []string{ScopeAdmin}})
+	if identity, err = authenticator.Authenticate(bearerRequest(token)); err != nil || !identity.HasScope(ScopeAdmin) {
+		t.Fatalf("expected admin scope from array claim, got %v (%v)", identity.Scopes, err)
+	}
+
+	// unknown key IDs do not trigger a fetch on every request
+	token = signToken(t, jwt.SigningMethodRS256, "rsa-2", key, nil)
+	for i := 0; i < 3; i++ {
+		if _, err := authenticator.Authenticate(bearerRequest(token)); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("expected ErrInvalidCredentials for unknown kid, got %v", err)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("expected a single jwks fetch, got %d", fetches.Load())
+	}
+}
+
+func TestJWTAuthenticator_RejectsInvalidTokens(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksJSON(t, ecJWK("ec-1", &key.PublicKey)), 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	keys, err := LoadJWKSFile(path)
+	if err != nil {
+		t.Fatalf("LoadJWKSFile error: %v", err)
+	}
+	authenticator := NewJWTAuthenticator(JWTConfig{Issuer: testIssuer, Audience: testAudience}, keys)
+
+	if _, err := authenticator.Authenticate(bearerRequest(signToken(t, jwt.SigningMethodES256, "ec-1", key, nil))); err != nil {
+		t.Fatalf("expected valid token, got %v", err)
+	}
+
+	cases := map[string]string{
+		"expired":        signToken(t, jwt.SigningMethodES256, "ec-1", key, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}),
+		"no expiry":      signToken(t, jwt.SigningMethodES256, "ec-1", key, jwt.MapClaims{"exp": nil}),
+		"wrong issuer":   signToken(t, jwt.SigningMethodES256, "ec-1", key, jwt.MapClaims{"iss": "https://evil.example.com"}),
+		"wrong audience": signToken(t, jwt.SigningMethodES256, "ec-1", key, jwt.MapClaims{"aud": "other"}),
+		"no tenant":      signToken(t, jwt.SigningMethodES256, "ec-1", key, jwt.MapClaims{"tenant_id": nil}),
+		"wrong key":      signToken(t, jwt.SigningMethodES256, "ec-1", otherKey, nil),
+		"hmac":           signToken(t, jwt.SigningMethodHS256, "ec-1", []byte("secret"), nil),
+		"garbage":        "not-a-jwt",
+	}
+	for name, token := range cases {
+		if _, err := authenticator.Authenticate(bearerRequest(token)); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%s: expected ErrInvalidCredentials, got %v", name, err)
+		}
+	}
+
+	if _, err := authenticator.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil)); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials without header, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// apiKeyHeader carries the API key of a request.
+const apiKeyHeader = "X-API-Key"
+
+// Authenticator adds the credentials to a request of the client.
+type Authenticator interface {
+	Authenticate(request *http.Request) error
+}
+
+// AuthenticatorFunc is a function used as Authenticator.
+type AuthenticatorFunc func(request *http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(request *http.Request) error {
+	return f(request)
+}
+
+// APIKey authenticates with an API key of the service.
+func APIKey(key string) Authenticator {
+	return AuthenticatorFunc(func(request *http.Request) error {
+		request.Header.Set(apiKeyHeader, key)
+		return nil
+	})
+}
+
+// BearerToken authenticates with a fixed bearer token, e.g. an OIDC access token.
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(request *http.Request) error {
+		request.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// TokenSource returns the bearer token of a request, e.g. refreshing it once it expired.
+type TokenSource func(ctx context.Context) (string, error)
+
+// BearerTokenSource authenticates with the bearer token of source, requested for every request.
+func BearerTokenSource(source TokenSource) Authenticator {
+	return AuthenticatorFunc(func(request *http.Request) error {
+		token, err := source(request.Context())
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
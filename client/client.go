@@ -0,0 +1,233 @@
+// Package client is a typed Go client of the signing service API v1.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 2 * time.Second
+
+	// tenantHeader selects the tenant to act for.
+	tenantHeader = "X-Tenant-ID"
+)
+
+// RetryPolicy configures the retries of requests which failed with a safe error (see Client), zero values are
+// replaced by the defaults. MaxAttempts 1 disables the retries.
+type RetryPolicy struct {
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, it doubles with every retry up to MaxBackoff.
+	// A Retry-After header of the service takes precedence.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// withDefaults returns the policy with every zero value replaced by its default.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = DefaultInitialBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	return p
+}
+
+// Config configures a Client.
+type Config struct {
+	// HTTPClient sends the requests, if nil http.DefaultClient is used.
+	// Client certificates for mutual TLS are configured on its transport.
+	HTTPClient *http.Client
+	// Auth adds the credentials to every request, if nil no credentials are sent.
+	Auth Authenticator
+	// Tenant is the tenant to act for, if empty the tenant of the credentials.
+	Tenant string
+	// Retry configures the retries of requests which failed with a safe error.
+	Retry RetryPolicy
+}
+
+// Client calls the signing service API v1, it is safe for concurrent use.
+//
+// Requests which failed with a safe error are retried: requests without side effects (e.g. GetDevice, Verify) after
+// network errors and the 429, 502, 503 and 504 statuses, all requests after 429 (which is returned before the request
+// is processed) and signatures after a chain_conflict (the signature was not committed).
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	auth       Authenticator
+	tenant     string
+	retry      RetryPolicy
+}
+
+// New returns a client of the service at baseURL, e.g. https://signing.example.com.
+func New(baseURL string, config Config) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: must be an absolute http(s) URL", baseURL)
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    parsed,
+		httpClient: httpClient,
+		auth:       config.Auth,
+		tenant:     config.Tenant,
+		retry:      config.Retry.withDefaults(),
+	}, nil
+}
+
+// call describes a request of the API.
+type call struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	// safe calls have no side effects, they can be retried after any transient failure
+	safe bool
+	// retryCodes are the problem codes after which the call is retried, it had no effect
+	retryCodes []string
+}
+
+// do sends the call, retrying it after safe errors, and decodes the data of the response into result (if not nil).
+func (c *Client) do(ctx context.Context, call call, result any) error {
+	var body []byte
+	if call.body != nil {
+		var err error
+		if body, err = json.Marshal(call.body); err != nil {
+			return fmt.Errorf("unable to encode request: %w", err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		response, err := c.send(ctx, call, body)
+		var retryAfter time.Duration
+		if err == nil {
+			err = decodeResponse(response, result)
+			retryAfter = parseRetryAfter(response.Header.Get("Retry-After"))
+		}
+		if err == nil || attempt >= c.retry.MaxAttempts || !retryable(call, err) {
+			return err
+		}
+
+		delay := c.backoff(attempt)
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// send sends a single attempt of the call.
+func (c *Client) send(ctx context.Context, call call, body []byte) (*http.Response, error) {
+	target := c.baseURL.JoinPath(call.path)
+	target.RawQuery = call.query.Encode()
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, call.method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.tenant != "" {
+		request.Header.Set(tenantHeader, c.tenant)
+	}
+	if c.auth != nil {
+		if err := c.auth.Authenticate(request); err != nil {
+			return nil, fmt.Errorf("unable to authenticate request: %w", err)
+		}
+	}
+	return c.httpClient.Do(request)
+}
+
+// decodeResponse decodes the data of a successful response into result, or the problem of an error response.
+func decodeResponse(response *http.Response, result any) error {
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return decodeProblem(response)
+	}
+	if result == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	envelope := struct {
+		Data any `json:"data"`
+	}{Data: result}
+	if err := json.NewDecoder(response.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("unable to decode response: %w", err)
+	}
+	return nil
+}
+
+// retryable checks if the call can be retried after err.
+func retryable(call call, err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		// the request may have been processed if it failed on the way back
+		var netErr net.Error
+		return call.safe && (errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF))
+	}
+	switch apiErr.Status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return call.safe
+	}
+	for _, code := range call.retryCodes {
+		if apiErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the retry following the attempt, with jitter.
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.retry.InitialBackoff << (attempt - 1)
+	if delay > c.retry.MaxBackoff || delay <= 0 {
+		delay = c.retry.MaxBackoff
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// parseRetryAfter parses the seconds of a Retry-After header, zero if there is none.
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
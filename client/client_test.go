@@ -0,0 +1,262 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/api"
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+// helper to run an api.Server, with API key authentication if authenticator is not nil
+func startServer(t *testing.T, authenticator auth.Authenticator, keys persistence.APIKeyStore) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := api.NewServer(api.ServerParams{
+		Listener: listener,
+		SignerStore: crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+			crypto.RSA: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewRSASigner(privateKey) },
+			crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+		}),
+		KeyGeneratorStore: crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{
+			crypto.RSA: &crypto.RSAGenerator{},
+			crypto.ECC: &crypto.ECCGenerator{},
+		}),
+		DeviceStore:   persistence.NewInMemorySignatureDeviceStore(),
+		Authenticator: authenticator,
+		APIKeyStore:   keys,
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		srv.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return "http://" + listener.Addr().String()
+}
+
+func newTestClient(t *testing.T, baseURL string, config Config) *Client {
+	t.Helper()
+	c, err := New(baseURL, config)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return c
+}
+
+func TestClient_Devices(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, startServer(t, nil, nil), Config{})
+
+	device, err := c.CreateDevice(ctx, CreateDeviceRequest{Algorithm: crypto.ECC, Label: "till"})
+	if err != nil || device.ID == "" || device.Label != "till" || device.State != domain.StateActive {
+		t.Fatalf("create device: %+v %v", device, err)
+	}
+	devices, err := c.ListDevices(ctx)
+	if err != nil || len(devices) != 1 || devices[0].ID != device.ID {
+		t.Fatalf("list devices: %+v %v", devices, err)
+	}
+
+	first, err := c.Sign(ctx, device.ID, "first")
+	if err != nil || first.Counter != 0 || first.DeviceID != device.ID {
+		t.Fatalf("sign: %+v %v", first, err)
+	}
+	valid, err := c.Verify(ctx, device.ID, first.SignedData, first.Signature)
+	if err != nil || !valid {
+		t.Fatalf("verify: %v %v", valid, err)
+	}
+	if err := VerifySignature(device, first); err != nil {
+		t.Fatalf("verify locally: %v", err)
+	}
+
+	// signatures keep verifying locally with the key they were created with
+	rotated, err := c.RotateDeviceKey(ctx, device.ID)
+	if err != nil || rotated.KeyVersion != 2 {
+		t.Fatalf("rotate key: %+v %v", rotated, err)
+	}
+	second, err := c.Sign(ctx, device.ID, "second")
+	if err != nil || second.Counter != 1 || second.KeyVersion != 2 {
+		t.Fatalf("sign: %+v %v", second, err)
+	}
+	for _, signature := range []*Signature{first, second} {
+		if err := VerifySignature(rotated, signature); err != nil {
+			t.Fatalf("verify %d locally: %v", signature.Counter, err)
+		}
+	}
+	if err := VerifySignature(device, second); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected the former key to reject the signature, got %v", err)
+	}
+	tampered := *second
+	tampered.SignedData = "1_tampered_" + first.Signature
+	if err := VerifySignature(rotated, &tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+
+	signatures, err := c.ListSignatures(ctx, device.ID, 1, 10)
+	if err != nil || len(signatures) != 1 || signatures[0] != *second {
+		t.Fatalf("list signatures: %+v %v", signatures, err)
+	}
+
+	suspended, err := c.SetDeviceState(ctx, device.ID, domain.StateSuspended)
+	if err != nil || suspended.State != domain.StateSuspended {
+		t.Fatalf("suspend: %+v %v", suspended, err)
+	}
+	_, err = c.Sign(ctx, device.ID, "third")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusConflict || apiErr.Code != CodeDeviceNotActive {
+		t.Fatalf("expected device_not_active, got %v", err)
+	}
+
+	_, err = c.GetDevice(ctx, "unknown")
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeDeviceNotFound {
+		t.Fatalf("expected device_not_found, got %v", err)
+	}
+	_, err = c.CreateDevice(ctx, CreateDeviceRequest{Algorithm: "DSA"})
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeValidationFailed || len(apiErr.InvalidParams) != 1 {
+		t.Fatalf("expected validation_failed, got %v", err)
+	}
+}
+
+func TestClient_Auth(t *testing.T) {
+	ctx := context.Background()
+	keys := persistence.NewInMemoryAPIKeyStore()
+	key, plaintext, err := domain.NewAPIKey(domain.DefaultTenantID, "pos", []string{auth.ScopeDevicesRead})
+	if err != nil {
+		t.Fatalf("new api key: %v", err)
+	}
+	if err := keys.Add(ctx, key); err != nil {
+		t.Fatalf("add api key: %v", err)
+	}
+	baseURL := startServer(t, auth.NewAPIKeyAuthenticator(keys), keys)
+
+	var apiErr *Error
+	_, err = newTestClient(t, baseURL, Config{}).ListDevices(ctx)
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeUnauthenticated {
+		t.Fatalf("expected unauthenticated, got %v", err)
+	}
+
+	authenticated := newTestClient(t, baseURL, Config{Auth: APIKey(plaintext)})
+	if _, err := authenticated.ListDevices(ctx); err != nil {
+		t.Fatalf("list devices: %v", err)
+	}
+	_, err = authenticated.CreateDevice(ctx, CreateDeviceRequest{Algorithm: crypto.ECC})
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusForbidden {
+		t.Fatalf("expected 403 without the devices:write scope, got %v", err)
+	}
+
+	failing := newTestClient(t, baseURL, Config{Auth: BearerTokenSource(func(ctx context.Context) (string, error) {
+		return "", errors.New("token expired")
+	})})
+	if _, err := failing.ListDevices(ctx); err == nil || errors.As(err, &apiErr) {
+		t.Fatalf("expected the error of the token source, got %v", err)
+	}
+}
+
+// helper to serve fixed responses, counting the requests
+func startFakeServer(t *testing.T, handler func(attempt int32, response http.ResponseWriter)) (string, *atomic.Int32) {
+	t.Helper()
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		handler(attempts.Add(1), response)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &attempts
+}
+
+func writeProblem(response http.ResponseWriter, status int, code string) {
+	response.Header().Set("Content-Type", "application/problem+json")
+	response.WriteHeader(status)
+	io.WriteString(response, `{"status":0,"code":"`+code+`","title":"failure","detail":"failure"}`)
+}
+
+func TestClient_Retries(t *testing.T) {
+	ctx := context.Background()
+	retry := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	// safe requests are retried after transient failures
+	baseURL, attempts := startFakeServer(t, func(attempt int32, response http.ResponseWriter) {
+		if attempt < 3 {
+			writeProblem(response, http.StatusServiceUnavailable, "unavailable")
+			return
+		}
+		io.WriteString(response, `{"data":{"id":"device"}}`)
+	})
+	device, err := newTestClient(t, baseURL, Config{Retry: retry}).GetDevice(ctx, "device")
+	if err != nil || device.ID != "device" || attempts.Load() != 3 {
+		t.Fatalf("expected success after 3 attempts, got %v after %d", err, attempts.Load())
+	}
+
+	// signatures are not, they may have been created
+	baseURL, attempts = startFakeServer(t, func(attempt int32, response http.ResponseWriter) {
+		writeProblem(response, http.StatusServiceUnavailable, "unavailable")
+	})
+	if _, err := newTestClient(t, baseURL, Config{Retry: retry}).Sign(ctx, "device", "data"); err == nil || attempts.Load() != 1 {
+		t.Fatalf("expected a single attempt, got %d", attempts.Load())
+	}
+
+	// unless the signature was certainly not created
+	for _, code := range []string{"rate_limited", CodeChainConflict} {
+		baseURL, attempts = startFakeServer(t, func(attempt int32, response http.ResponseWriter) {
+			if attempt == 1 {
+				status := http.StatusConflict
+				if code == "rate_limited" {
+					status = http.StatusTooManyRequests
+					response.Header().Set("Retry-After", "0")
+				}
+				writeProblem(response, status, code)
+				return
+			}
+			io.WriteString(response, `{"data":{"counter":7}}`)
+		})
+		signature, err := newTestClient(t, baseURL, Config{Retry: retry}).Sign(ctx, "device", "data")
+		if err != nil || signature.Counter != 7 || attempts.Load() != 2 {
+			t.Fatalf("expected a retry after %s, got %v after %d", code, err, attempts.Load())
+		}
+	}
+
+	// responses which are not problems keep their status
+	baseURL, attempts = startFakeServer(t, func(attempt int32, response http.ResponseWriter) {
+		response.WriteHeader(http.StatusBadGateway)
+		io.WriteString(response, "bad gateway")
+	})
+	_, err = newTestClient(t, baseURL, Config{Retry: retry}).ListDevices(ctx)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeUnexpected || apiErr.Status != http.StatusBadGateway || attempts.Load() != 3 {
+		t.Fatalf("unexpected error %v after %d attempts", err, attempts.Load())
+	}
+
+	// the context ends the retries
+	cancelled, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	slow := newTestClient(t, baseURL, Config{Retry: RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Minute, MaxBackoff: time.Minute}})
+	if _, err := slow.ListDevices(cancelled); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to end the retries, got %v", err)
+	}
+}
+
+func TestNew_InvalidBaseURL(t *testing.T) {
+	for _, baseURL := range []string{"", "signing.example.com", "ftp://signing.example.com", "http://"} {
+		if _, err := New(baseURL, Config{}); err == nil {
+			t.Fatalf("expected an error for %q", baseURL)
+		}
+	}
+}
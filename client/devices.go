@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+// Device is a signature device.
+type Device struct {
+	ID        string                    `json:"id"`
+	TenantID  string                    `json:"tenantId"`
+	Algorithm crypto.SignatureAlgorithm `json:"algorithm"`
+	// PublicKey is the PEM encoded current public key.
+	PublicKey        []byte             `json:"publicKey"`
+	Label            string             `json:"label"`
+	State            domain.DeviceState `json:"state"`
+	SignatureCounter uint64             `json:"signatureCounter"`
+	KeyVersion       uint64             `json:"keyVersion"`
+	// PublicKeys are all the public keys of the device, oldest first.
+	PublicKeys []domain.PublicKeyVersion `json:"publicKeys"`
+}
+
+// CreateDeviceRequest is the request to create a signature device.
+type CreateDeviceRequest struct {
+	Algorithm crypto.SignatureAlgorithm `json:"algorithm"`
+	Label     string                    `json:"label,omitempty"`
+}
+
+// Signature is a signature created by a signature device.
+type Signature struct {
+	DeviceID  string `json:"deviceId"`
+	Counter   uint64 `json:"counter"`
+	Signature string `json:"signature"`
+	// SignedData is <counter>_<data>_<last signature>, the data which was signed.
+	SignedData string `json:"signedData"`
+	KeyVersion uint64 `json:"keyVersion"`
+}
+
+// CreateDevice creates a new signature device.
+func (c *Client) CreateDevice(ctx context.Context, request CreateDeviceRequest) (*Device, error) {
+	var device Device
+	err := c.do(ctx, call{method: http.MethodPost, path: "/api/v1/devices", body: request}, &device)
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// ListDevices lists all signature devices of the tenant.
+func (c *Client) ListDevices(ctx context.Context) ([]Device, error) {
+	var devices []Device
+	err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/devices", safe: true}, &devices)
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// GetDevice returns a single signature device.
+func (c *Client) GetDevice(ctx context.Context, id string) (*Device, error) {
+	var device Device
+	err := c.do(ctx, call{method: http.MethodGet, path: devicePath(id), safe: true}, &device)
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// SetDeviceState suspends or activates a signature device.
+func (c *Client) SetDeviceState(ctx context.Context, id string, state domain.DeviceState) (*Device, error) {
+	var device Device
+	body := struct {
+		State domain.DeviceState `json:"state"`
+	}{State: state}
+	// setting the same state again has no effect
+	err := c.do(ctx, call{method: http.MethodPatch, path: devicePath(id), body: body, safe: true}, &device)
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// RotateDeviceKey replaces the key pair of a signature device, its signature chain continues with the new key.
+func (c *Client) RotateDeviceKey(ctx context.Context, id string) (*Device, error) {
+	var device Device
+	err := c.do(ctx, call{method: http.MethodPost, path: devicePath(id) + "/keys"}, &device)
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// Sign signs data with a signature device, advancing its signature chain.
+func (c *Client) Sign(ctx context.Context, deviceID string, data string) (*Signature, error) {
+	var signature Signature
+	body := struct {
+		Data string `json:"data"`
+	}{Data: data}
+	err := c.do(ctx, call{
+		method:     http.MethodPost,
+		path:       devicePath(deviceID) + "/signatures",
+		body:       body,
+		retryCodes: []string{CodeChainConflict},
+	}, &signature)
+	if err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+// ListSignatures lists up to limit signatures of a signature device, oldest first, starting with the signature
+// with the counter from. Fewer signatures are returned at the end of the signature chain.
+func (c *Client) ListSignatures(ctx context.Context, deviceID string, from uint64, limit int) ([]Signature, error) {
+	var signatures []Signature
+	query := url.Values{}
+	query.Set("from", strconv.FormatUint(from, 10))
+	query.Set("limit", strconv.Itoa(limit))
+	err := c.do(ctx, call{method: http.MethodGet, path: devicePath(deviceID) + "/signatures", query: query, safe: true}, &signatures)
+	if err != nil {
+		return nil, err
+	}
+	return signatures, nil
+}
+
+// Verify checks a signature of a signature device on the service, see VerifySignature to check it locally.
+// An invalid signature is not an error, the result is false.
+func (c *Client) Verify(ctx context.Context, deviceID string, signedData string, signature string) (bool, error) {
+	var result struct {
+		Valid bool `json:"valid"`
+	}
+	body := struct {
+		SignedData string `json:"signedData"`
+		Signature  string `json:"signature"`
+	}{SignedData: signedData, Signature: signature}
+	err := c.do(ctx, call{method: http.MethodPost, path: devicePath(deviceID) + "/verifications", body: body, safe: true}, &result)
+	if err != nil {
+		return false, err
+	}
+	return result.Valid, nil
+}
+
+func devicePath(id string) string {
+	return "/api/v1/devices/" + url.PathEscape(id)
+}
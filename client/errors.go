@@ -0,0 +1,68 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// problem codes the client acts on, see the Errors section of the README for all of them
+const (
+	CodeDeviceNotFound   = "device_not_found"
+	CodeDeviceNotActive  = "device_not_active"
+	CodeChainConflict    = "chain_conflict"
+	CodeValidationFailed = "validation_failed"
+	CodeRateLimited      = "rate_limited"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeForbidden        = "forbidden"
+	CodeInternal         = "internal_error"
+	CodeUnexpected       = "unexpected_response"
+)
+
+// maxProblemBytes limits how much of an error response is read.
+const maxProblemBytes = 64 << 10
+
+// InvalidParam describes why a field of a request is invalid.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Error is an error response of the service (a problem, RFC 7807).
+type Error struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	// InvalidParams lists the invalid fields of a request which failed validation.
+	InvalidParams []InvalidParam `json:"invalidParams"`
+}
+
+func (e *Error) Error() string {
+	message := e.Detail
+	if message == "" {
+		message = e.Title
+	}
+	return fmt.Sprintf("signing service: %s (%d %s)", message, e.Status, e.Code)
+}
+
+// decodeProblem decodes the problem of an error response. Responses which are not a problem (e.g. of a proxy)
+// are reported with CodeUnexpected.
+func decodeProblem(response *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxProblemBytes))
+	if err != nil {
+		return fmt.Errorf("unable to read error response (%d): %w", response.StatusCode, err)
+	}
+	var problem Error
+	if json.Unmarshal(body, &problem) != nil || problem.Code == "" {
+		problem = Error{
+			Code:   CodeUnexpected,
+			Title:  http.StatusText(response.StatusCode),
+			Detail: strings.TrimSpace(string(body)),
+		}
+	}
+	problem.Status = response.StatusCode
+	return &problem
+}
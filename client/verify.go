@@ -0,0 +1,54 @@
+package client
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+)
+
+// ErrInvalidSignature is returned by VerifySignature if a signature is not valid.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// VerifySignature checks a signature returned by Sign locally, without calling the service: its signed data has to
+// start with its counter and it has to verify with the public key the device had at that counter.
+// It returns ErrInvalidSignature if the signature is not valid.
+func VerifySignature(device *Device, signature *Signature) error {
+	if signature.DeviceID != "" && signature.DeviceID != device.ID {
+		return fmt.Errorf("%w: created by device %s, not %s", ErrInvalidSignature, signature.DeviceID, device.ID)
+	}
+	prefix, _, _ := strings.Cut(signature.SignedData, "_")
+	if counter, err := strconv.ParseUint(prefix, 10, 64); err != nil || counter != signature.Counter {
+		return fmt.Errorf("%w: signed data does not start with the counter %d", ErrInvalidSignature, signature.Counter)
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: not valid base64", ErrInvalidSignature)
+	}
+
+	verifiers := crypto.NewDefaultVerifierStore()
+	verifier, err := verifiers.Get(device.Algorithm, device.PublicKeyAt(signature.Counter))
+	if err != nil {
+		return fmt.Errorf("unable to verify signature: %w", err)
+	}
+	if err := verifier.Verify([]byte(signature.SignedData), signatureBytes); err != nil {
+		if errors.Is(err, crypto.ErrInvalidSignature) {
+			return ErrInvalidSignature
+		}
+		return fmt.Errorf("unable to verify signature: %w", err)
+	}
+	return nil
+}
+
+// PublicKeyAt returns the public key which was current when the device created the signature with the given counter.
+func (d *Device) PublicKeyAt(counter uint64) []byte {
+	for i := len(d.PublicKeys) - 1; i >= 0; i-- {
+		if counter >= d.PublicKeys[i].FirstCounter {
+			return d.PublicKeys[i].PublicKey
+		}
+	}
+	return d.PublicKey
+}
@@ -0,0 +1,143 @@
+// Command chainverify verifies an exported signature chain offline, without access to the signing service.
+//
+// Usage:
+//
+//	chainverify -keys keys.pem [-device id] [-partial] [-output text|json] [signature log]
+//
+// The signature log is read from stdin if no file is given. The exit code is 0 if the chain is valid, 1 if it is not
+// and 2 if the input could not be read.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ksrichard/signing-service-challenge/audit"
+)
+
+// exit codes of chainverify
+const (
+	exitValid   = 0
+	exitInvalid = 1
+	exitError   = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs chainverify with the command line arguments (without the program name) and returns the exit code.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("chainverify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	keysPath := fs.String("keys", "", "file with the public keys or certificate of the device: PEM, or JSON as exported by signctl")
+	deviceID := fs.String("device", "", "ID of the device, by default the device of the signatures")
+	partial := fs.Bool("partial", false, "accept a log which does not start with the first signature of the device")
+	output := fs.String("output", "text", "output format, text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: chainverify -keys keys.pem [-device id] [-partial] [-output text|json] [signature log]")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+	if *keysPath == "" || fs.NArg() > 1 || (*output != "text" && *output != "json") {
+		fs.Usage()
+		return exitError
+	}
+
+	report, err := verify(*keysPath, fs.Arg(0), *deviceID, *partial, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "chainverify:", err)
+		return exitError
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = printReport(stdout, report)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "chainverify:", err)
+		return exitError
+	}
+	if !report.Valid {
+		return exitInvalid
+	}
+	return exitValid
+}
+
+// verify reads the keys and the signature log and verifies the chain.
+func verify(keysPath, logPath, deviceID string, partial bool, stdin io.Reader) (*audit.Report, error) {
+	keyData, err := os.ReadFile(keysPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read keys: %w", err)
+	}
+	keys, err := audit.ParseKeys(keyData)
+	if err != nil {
+		return nil, err
+	}
+
+	log := stdin
+	if logPath != "" && logPath != "-" {
+		file, err := os.Open(logPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read signature log: %w", err)
+		}
+		defer file.Close()
+		log = file
+	}
+	signatures, err := audit.ReadSignatures(log)
+	if err != nil {
+		return nil, err
+	}
+
+	if deviceID == "" {
+		for _, signature := range signatures {
+			if signature.DeviceID != "" {
+				deviceID = signature.DeviceID
+				break
+			}
+		}
+		if deviceID == "" {
+			return nil, errors.New("the signature log does not name the device, use -device")
+		}
+	}
+	return audit.VerifyChain(audit.Params{DeviceID: deviceID, Keys: keys, Partial: partial}, signatures)
+}
+
+func printReport(w io.Writer, report *audit.Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Device\t%s\n", report.DeviceID)
+	if report.Signatures == 0 {
+		fmt.Fprintf(tw, "Signatures\tnone\n")
+	} else {
+		fmt.Fprintf(tw, "Signatures\t%d (counters %d to %d)\n", report.Signatures, report.FirstCounter, report.LastCounter)
+	}
+	fmt.Fprintf(tw, "Valid signatures\t%d of %d\n", report.ValidSignatures, report.Signatures)
+	result := "VALID"
+	if !report.Valid {
+		result = "INVALID"
+	}
+	fmt.Fprintf(tw, "Result\t%s\n", result)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, issue := range report.Issues {
+		if _, err := fmt.Fprintf(w, "  counter %d: %s: %s\n", issue.Counter, issue.Code, issue.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/audit"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+// helper to export the keys and the signature log of a new device with two signatures, returns their paths
+func exportTestChain(t *testing.T) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+	kg := crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{crypto.ECC: &crypto.ECCGenerator{}})
+	ss := crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+		crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+	})
+	device, err := domain.NewSignatureDevice(ctx, &kg, &ss, domain.DefaultTenantID, crypto.ECC, "till")
+	if err != nil {
+		t.Fatalf("new device: %v", err)
+	}
+	var log bytes.Buffer
+	for _, data := range []string{"first", "second"} {
+		result, err := device.SignData(ctx, data)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		json.NewEncoder(&log).Encode(audit.Signature{
+			DeviceID:   device.GetIDStr(),
+			Counter:    result.Counter,
+			Signature:  result.Signature,
+			SignedData: result.SignedData,
+			KeyVersion: result.KeyVersion,
+		})
+	}
+
+	dir := t.TempDir()
+	keysPath, logPath := filepath.Join(dir, "keys.pem"), filepath.Join(dir, "chain.jsonl")
+	os.WriteFile(keysPath, device.PublicKeyAt(0), 0o600)
+	os.WriteFile(logPath, log.Bytes(), 0o600)
+	return keysPath, logPath
+}
+
+func TestRun(t *testing.T) {
+	keysPath, logPath := exportTestChain(t)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-keys", keysPath, logPath}, nil, &stdout, &stderr); code != exitValid || !strings.Contains(stdout.String(), "VALID") {
+		t.Fatalf("expected a valid chain, got %d: %s%s", code, stdout.String(), stderr.String())
+	}
+
+	// the log is read from stdin, the second signature is tampered with
+	log, _ := os.ReadFile(logPath)
+	tampered := strings.Replace(string(log), "1_second_", "1_forged_", 1)
+	stdout.Reset()
+	if code := run([]string{"-keys", keysPath, "-output", "json"}, strings.NewReader(tampered), &stdout, &stderr); code != exitInvalid {
+		t.Fatalf("expected an invalid chain, got %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	var report audit.Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil || report.Valid || len(report.Issues) != 1 || report.Issues[0].Code != audit.IssueInvalidSignature {
+		t.Fatalf("unexpected report: %s", stdout.String())
+	}
+
+	for _, args := range [][]string{
+		{logPath},
+		{"-keys", logPath, logPath},
+		{"-keys", keysPath, filepath.Join(t.TempDir(), "missing.jsonl")},
+		{"-keys", keysPath, "-output", "yaml", logPath},
+	} {
+		stderr.Reset()
+		if code := run(args, nil, &stdout, &stderr); code != exitError || stderr.Len() == 0 {
+			t.Fatalf("expected an error for %q, got %d", args, code)
+		}
+	}
+}
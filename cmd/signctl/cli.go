@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// cli is a single invocation of signctl.
+type cli struct {
+	environment
+	flags globalFlags
+}
+
+// globalFlags are accepted by every command, before or after the command name.
+type globalFlags struct {
+	config  string
+	profile string
+	server  string
+	apiKey  string
+	token   string
+	tenant  string
+	output  string
+}
+
+// command is a command of signctl, either running itself or grouping sub commands.
+type command struct {
+	name    string
+	summary string
+	sub     []*command
+	run     func(ctx context.Context, c *cli, args []string) error
+}
+
+// flagSet creates the flag set of a command, including the global flags.
+func (c *cli) flagSet(name string, arguments string) *flag.FlagSet {
+	if c.flags.output == "" {
+		c.flags.output = outputTable
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.StringVar(&c.flags.config, "config", c.flags.config, "path of the profiles file (env "+envConfig+")")
+	fs.StringVar(&c.flags.profile, "profile", c.flags.profile, "profile to use (env "+envProfile+")")
+	fs.StringVar(&c.flags.server, "server", c.flags.server, "base URL of the signing service (env "+envServer+")")
+	fs.StringVar(&c.flags.apiKey, "api-key", c.flags.apiKey, "API key to authenticate with (env "+envAPIKey+")")
+	fs.StringVar(&c.flags.token, "token", c.flags.token, "bearer token to authenticate with (env "+envToken+")")
+	fs.StringVar(&c.flags.tenant, "tenant", c.flags.tenant, "tenant to act on (env "+envTenant+")")
+	fs.StringVar(&c.flags.output, "output", c.flags.output, "output format, table or json")
+	fs.StringVar(&c.flags.output, "o", c.flags.output, "shorthand for -output")
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: %s %s\n\nFlags:\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the command line of a command, which has to have the given number of arguments.
+func (c *cli) parse(fs *flag.FlagSet, args []string, count int) ([]string, error) {
+	positional, err := parseFlags(fs, args, false)
+	if err != nil {
+		return nil, err
+	}
+	if c.flags.output != outputTable && c.flags.output != outputJSON {
+		fmt.Fprintf(c.stderr, "invalid output format %q, expected table or json\n", c.flags.output)
+		return nil, errUsage
+	}
+	if len(positional) != count {
+		fs.Usage()
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// dispatch runs the command of the group with the given name.
+func (c *cli) dispatch(ctx context.Context, group []*command, name string, args []string) error {
+	for _, cmd := range group {
+		if cmd.name != name {
+			continue
+		}
+		if cmd.run != nil {
+			return cmd.run(ctx, c, args)
+		}
+		if len(args) == 0 {
+			c.printCommands(cmd.sub)
+			return errUsage
+		}
+		return c.dispatch(ctx, cmd.sub, args[0], args[1:])
+	}
+	fmt.Fprintf(c.stderr, "unknown command %q\n", name)
+	c.printCommands(group)
+	return errUsage
+}
+
+// printCommands prints the commands of a group.
+func (c *cli) printCommands(group []*command) {
+	fmt.Fprintln(c.stderr, "Commands:")
+	w := tabwriter.NewWriter(c.stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range group {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	w.Flush()
+}
+
+// print writes value as indented JSON, or as the human-readable table written by table.
+func (c *cli) print(value any, table func(w io.Writer)) error {
+	if c.flags.output == outputJSON {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	w := c.table()
+	table(w)
+	return w.Flush()
+}
+
+// table returns the writer aligning the tab separated columns of table output, they are written on Flush.
+func (c *cli) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ksrichard/signing-service-challenge/client"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+// chainPageSize is how many signatures export chain requests at once, the maximum of the API.
+const chainPageSize = 1000
+
+var commands = []*command{
+	{name: "devices", summary: "manage signature devices", sub: []*command{
+		{name: "create", summary: "create a signature device", run: createDevice},
+		{name: "list", summary: "list the signature devices", run: listDevices},
+		{name: "inspect", summary: "show a signature device and its public keys", run: inspectDevice},
+		{name: "suspend", summary: "suspend a signature device, it no longer signs", run: setDeviceState(domain.StateSuspended)},
+		{name: "activate", summary: "activate a suspended signature device", run: setDeviceState(domain.StateActive)},
+		{name: "rotate", summary: "replace the key pair of a signature device", run: rotateDeviceKey},
+	}},
+	{name: "sign", summary: "sign data read from stdin or a file", run: sign},
+	{name: "verify", summary: "verify a signature, on the service or locally", run: verify},
+	{name: "export", summary: "export the public keys or the signature chain of a device", sub: []*command{
+		{name: "keys", summary: "export the public keys of a device, PEM encoded or as JSON", run: exportKeys},
+		{name: "chain", summary: "export the signatures of a device, as a table or as JSON lines", run: exportChain},
+	}},
+	{name: "profiles", summary: "list the profiles of the profiles file", run: listProfiles},
+}
+
+func createDevice(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("signctl devices create", "-algorithm ECC|RSA [-label label]")
+	algorithm := fs.String("algorithm", "", "signature algorithm of the device, ECC or RSA")
+	label := fs.String("label", "", "label of the device")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *algorithm == "" {
+		fs.Usage()
+		return errUsage
+	}
+	api, err := c.connect()
+	if err != nil {
+		return err
+	}
+	device, err := api.CreateDevice(ctx, client.CreateDeviceRequest{
+		Algorithm: crypto.SignatureAlgorithm(strings.ToUpper(*algorithm)),
+		Label:     *label,
+	})
+	if err != nil {
+		return err
+	}
+	return c.printDevice(device)
+}
+
+func listDevices(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("signctl devices list", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	api, err := c.connect()
+	if err != nil {
+		return err
+	}
+	devices, err := api.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(devices, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tALGORITHM\tLABEL\tSTATE\tSIGNATURES\tKEY VERSION")
+		for _, device := range devices {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\n", device.ID, device.Algorithm, device.Label, device.State, device.SignatureCounter, device.KeyVersion)
+		}
+	})
+}
+
+func inspectDevice(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("signctl devices inspect", "<device id>")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	api, err := c.connect()
+	if err != nil {
+		return err
+	}
+	device, err := api.GetDevice(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return c.printDevice(device)
+}
+
+func setDeviceState(state domain.DeviceState) func(ctx context.Context, c *cli, args []string) error {
+	return func(ctx context.Context, c *cli, args []string) error {
+		verb := "suspend"
+		if state == domain.StateActive {
+			verb = "activate"
+		}
+		fs := c.flagSet("signctl devices "+verb, "<device id>")
+		positional, err := c.parse(fs, args, 1)
+		if err != nil {
+			return err
+		}
+		api, err := c.connect()
+		if err != nil {
+			return err
+		}
+		device, err := api.SetDeviceState(ctx, positional[0], state)
+		if err != nil {
+			return err
+		}
+		return c.printDevice(device)
+	}
+}
+
+func rotateDeviceKey(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("signctl devices rotate", "<device id>")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	api, err := c.connect()
+	if err != nil {
+		return err
+	}
+	device, err := api.RotateDeviceKey(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return c.printDevice(device)
+}
+
+// printDevice prints a single device with the versions of its public key.
+func (c *cli) printDevice(device *client.Device) error {
+	return c.print(device, func(w io.Writer) {
+		fmt.Fprintf(w, "ID\t%s\n", device.ID)
+		fmt.Fprintf(w, "Tenant\t%s\n", device.TenantID)
+		fmt.Fprintf(w, "Algorithm\t%s\n", device.Algorithm)
+		fmt.Fprintf(w, "Label\t%s\n", device.Label)
+		fmt.Fprintf(w, "State\t%s\n", device.State)
+		fmt.Fprintf(w, "Signatures\t%d\n", device.SignatureCounter)
+		fmt.Fprintf(w, "Key version\t%d\n", device.KeyVersion)
+		for _, key := range publicKeys(device) {
+			fmt.Fprintf(w, "Public key %d\tsigns from counter %d\n", key.Version, key.FirstCounter)
+		}
+	})
+}
+
+func sign(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("signctl sign", "<device id> [-file path]")
+	file := fs.String("file", "-", "file with the data to sign, - for stdin")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	data, err := c.readInput(*file)
+	if err != nil {
+		return err
+	}
+	api, err := c.connect()
+	if err != nil {
+		return err
+	}
+	signature, err := api.Sign(ctx, positional[0], string(data))
+	if err != nil {
+		return err
+	}
+	return c.print(signature, func(w io.Writer) {
+		printSignature(w, signature)
+	})
+}
+
+func verify(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("signctl verify", "<device id> (-signed-data data -signature signature | -file path) [-local]")
+	signedData := fs.String("signed-data", "", "the signed data, <counter>_<data>_<last signature>")
+	signatureFlag := fs.String("signature", "", "the base64 encoded signature")
+	file := fs.String("file", "", "file with a signature as printed by sign -output json, - for stdin")
+	local := fs.Bool("local", false, "verify with the public keys of the device instead of on the service")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	deviceID := positional[0]
+
+	signature := client.Signature{DeviceID: deviceID, SignedData: *signedData, Signature: *signatureFlag}
+	if *file != "" {
+		data, err := c.readInput(*file)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &signature); err != nil {
+			return fmt.Errorf("invalid signature file: %w", err)
+		}
+	} else {
+		// the counter of the signature is the prefix of the signed data, a signature without it does not verify
+		prefix, _, _ := strings.Cut(signature.SignedData, "_")
+		signature.Counter, _ = strconv.ParseUint(prefix, 10, 64)
+	}
+	if signature.SignedData == "" || signature.Signature == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	api, err := c.connect()
+	if err != nil {
+		return err
+	}
+	var valid bool
+	if *local {
+		device, err := api.GetDevice(ctx, deviceID)
+		if err != nil {
+			return err
+		}
+		err = client.VerifySignature(device, &signature)
+		if err != nil && !errors.Is(err, client.ErrInvalidSignature) {
+			return err
+		}
+		valid = err == nil
+	} else if valid, err = api.Verify(ctx, deviceID, signature.SignedData, signature.Signature); err != nil {
+		return err
+	}
+
+	result := struct {
+		Valid bool `json:"valid"`
+	}{Valid: valid}
+	err = c.print(result, func(w io.Writer) {
+		if valid {
+			fmt.Fprintln(w, "valid")
+		} else {
+			fmt.Fprintln(w, "invalid")
+		}
+	})
+	if err == nil && !valid {
+		return errSignatureInvalid
+	}
+	return err
+}
+
+func exportKeys(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("signctl export keys", "<device id>")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	api, err := c.connect()
+	if err != nil {
+		return err
+	}
+	device, err := api.GetDevice(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	keys := publicKeys(device)
+	// PEM decoders skip the comment lines before each key
+	return c.print(keys, func(w io.Writer) {
+		for _, key := range keys {
+			fmt.Fprintf(w, "# %s key version %d of device %s, signs from counter %d\n", device.Algorithm, key.Version, device.ID, key.FirstCounter)
+			w.Write(key.PublicKey)
+		}
+	})
+}
+
+func exportChain(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("signctl export chain", "<device id> [-from counter]")
+	from := fs.Uint64("from", 0, "counter of the first signature to export")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	api, err := c.connect()
+	if err != nil {
+		return err
+	}
+
+	// long chains are streamed page by page, as JSON lines rather than a single document,
+	// and tables are aligned per page
+	encoder := json.NewEncoder(c.stdout)
+	var table *tabwriter.Writer
+	if c.flags.output == outputTable {
+		table = c.table()
+		fmt.Fprintln(table, "COUNTER\tKEY VERSION\tSIGNATURE\tSIGNED DATA")
+	}
+	for counter := *from; ; {
+		signatures, err := api.ListSignatures(ctx, positional[0], counter, chainPageSize)
+		if err != nil {
+			return err
+		}
+		for _, signature := range signatures {
+			if table != nil {
+				fmt.Fprintf(table, "%d\t%d\t%s\t%s\n", signature.Counter, signature.KeyVersion, signature.Signature, signature.SignedData)
+			} else if err := encoder.Encode(signature); err != nil {
+				return err
+			}
+		}
+		if table != nil {
+			if err := table.Flush(); err != nil {
+				return err
+			}
+		}
+		if len(signatures) < chainPageSize {
+			return nil
+		}
+		counter = signatures[len(signatures)-1].Counter + 1
+	}
+}
+
+func listProfiles(_ context.Context, c *cli, args []string) error {
+	fs := c.flagSet("signctl profiles", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	path, explicit := first(c.flags.config, c.getenv(envConfig)), true
+	if path == "" {
+		path, explicit = defaultProfilesPath(), false
+	}
+	file, err := loadProfiles(path, explicit)
+	if err != nil {
+		return err
+	}
+
+	// credentials are never printed, only their kind
+	type profile struct {
+		Name    string `json:"name"`
+		Server  string `json:"server"`
+		Tenant  string `json:"tenant,omitempty"`
+		Auth    string `json:"auth"`
+		Default bool   `json:"default"`
+	}
+	profiles := make([]profile, 0, len(file.Profiles))
+	for name, p := range file.Profiles {
+		auth := "none"
+		switch {
+		case p.APIKey != "":
+			auth = "api key"
+		case p.Token != "":
+			auth = "token"
+		}
+		profiles = append(profiles, profile{Name: name, Server: p.Server, Tenant: p.Tenant, Auth: auth, Default: name == file.Default})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return c.print(profiles, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tSERVER\tTENANT\tAUTH\tDEFAULT")
+		for _, p := range profiles {
+			marker := ""
+			if p.Default {
+				marker = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Name, p.Server, p.Tenant, p.Auth, marker)
+		}
+	})
+}
+
+// readInput reads a file, or stdin if path is -.
+func (c *cli) readInput(path string) ([]byte, error) {
+	if path == "-" {
+		data, err := io.ReadAll(c.stdin)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read stdin: %w", err)
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read input: %w", err)
+	}
+	return data, nil
+}
+
+// publicKeys returns the versions of the public key of a device, for devices without a key history the current key.
+func publicKeys(device *client.Device) []domain.PublicKeyVersion {
+	if len(device.PublicKeys) > 0 {
+		return device.PublicKeys
+	}
+	return []domain.PublicKeyVersion{{Version: device.KeyVersion, PublicKey: device.PublicKey}}
+}
+
+func printSignature(w io.Writer, signature *client.Signature) {
+	fmt.Fprintf(w, "Device\t%s\n", signature.DeviceID)
+	fmt.Fprintf(w, "Counter\t%d\n", signature.Counter)
+	fmt.Fprintf(w, "Key version\t%d\n", signature.KeyVersion)
+	fmt.Fprintf(w, "Signature\t%s\n", signature.Signature)
+	fmt.Fprintf(w, "Signed data\t%s\n", signature.SignedData)
+}
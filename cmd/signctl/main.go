@@ -0,0 +1,115 @@
+// Command signctl manages the signature devices of a signing service from the command line: it creates, inspects,
+// suspends and rotates devices, signs and verifies data and exports the public keys and signature chains of devices.
+//
+// Usage:
+//
+//	signctl [flags] <command> [flags] [arguments]
+//
+// Run signctl help for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ksrichard/signing-service-challenge/client"
+)
+
+// exit codes of signctl
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// errSignatureInvalid reports an invalid signature by the exit code only, the result is already printed.
+var errSignatureInvalid = errors.New("signature is not valid")
+
+// errUsage is returned for invalid command lines, after the usage of the command was printed.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], environment{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		getenv: os.Getenv,
+	})
+	stop()
+	os.Exit(code)
+}
+
+// environment is what signctl reads from and writes to, replaced in tests.
+type environment struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+}
+
+// run runs signctl with the command line arguments (without the program name) and returns the exit code.
+func run(ctx context.Context, args []string, env environment) int {
+	c := &cli{environment: env}
+	fs := c.flagSet("signctl", "<command> [flags] [arguments]")
+	usage := fs.Usage
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintln(env.stderr)
+		c.printCommands(commands)
+	}
+	positional, err := parseFlags(fs, args, true)
+	switch {
+	case err != nil:
+	case len(positional) == 0:
+		fs.Usage()
+		err = errUsage
+	case positional[0] == "help":
+		fs.Usage()
+	default:
+		err = c.dispatch(ctx, commands, positional[0], positional[1:])
+	}
+
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, errSignatureInvalid):
+		return exitFailure
+	}
+	fmt.Fprintln(env.stderr, "signctl:", err)
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) {
+		for _, param := range apiErr.InvalidParams {
+			fmt.Fprintf(env.stderr, "  %s %s\n", param.Name, param.Reason)
+		}
+	}
+	return exitFailure
+}
+
+// parseFlags parses the flags of a command, which may follow its arguments, and returns the arguments.
+// If stopAtCommand is true, parsing stops at the first argument (the name of a sub command).
+func parseFlags(fs *flag.FlagSet, args []string, stopAtCommand bool) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 || stopAtCommand {
+			return append(positional, args...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
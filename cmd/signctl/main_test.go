@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/api"
+	"github.com/ksrichard/signing-service-challenge/audit"
+	"github.com/ksrichard/signing-service-challenge/client"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+// helper to run an api.Server without authentication
+func startServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := api.NewServer(api.ServerParams{
+		Listener: listener,
+		SignerStore: crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+			crypto.RSA: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewRSASigner(privateKey) },
+			crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+		}),
+		KeyGeneratorStore: crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{
+			crypto.RSA: &crypto.RSAGenerator{},
+			crypto.ECC: &crypto.ECCGenerator{},
+		}),
+		DeviceStore: persistence.NewInMemorySignatureDeviceStore(),
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		srv.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return "http://" + listener.Addr().String()
+}
+
+// helper to keep the profiles file of the user out of a test
+func isolateProfiles(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+}
+
+type result struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+// helper to run signctl with the given environment variables and stdin
+func runSignctl(t *testing.T, env map[string]string, stdin string, args ...string) result {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, environment{
+		stdin:  strings.NewReader(stdin),
+		stdout: &stdout,
+		stderr: &stderr,
+		getenv: func(key string) string { return env[key] },
+	})
+	return result{code: code, stdout: stdout.String(), stderr: stderr.String()}
+}
+
+func TestSignctl_Devices(t *testing.T) {
+	isolateProfiles(t)
+	env := map[string]string{envServer: startServer(t)}
+
+	r := runSignctl(t, env, "", "devices", "create", "-algorithm", "ecc", "-label", "till", "-o", "json")
+	var device client.Device
+	if err := json.Unmarshal([]byte(r.stdout), &device); r.code != exitOK || err != nil || device.Label != "till" {
+		t.Fatalf("create device: %+v", r)
+	}
+	r = runSignctl(t, env, "", "devices", "list")
+	if r.code != exitOK || !strings.Contains(r.stdout, device.ID) || !strings.HasPrefix(r.stdout, "ID") {
+		t.Fatalf("list devices: %+v", r)
+	}
+
+	// signatures are piped from sign to verify
+	r = runSignctl(t, env, "first", "sign", device.ID, "--output", "json")
+	if r.code != exitOK {
+		t.Fatalf("sign: %+v", r)
+	}
+	first := r.stdout
+	for _, local := range []string{"-local=false", "-local"} {
+		if r := runSignctl(t, env, first, "verify", device.ID, "-file", "-", local); r.code != exitOK || r.stdout != "valid\n" {
+			t.Fatalf("verify %s: %+v", local, r)
+		}
+	}
+
+	// signing continues with the new key after a rotation, the chain exports with both keys
+	if r := runSignctl(t, env, "", "devices", "rotate", device.ID); r.code != exitOK || !strings.Contains(r.stdout, "Public key 2") {
+		t.Fatalf("rotate: %+v", r)
+	}
+	path := filepath.Join(t.TempDir(), "data")
+	os.WriteFile(path, []byte("second"), 0o600)
+	if r := runSignctl(t, env, "", "sign", device.ID, "-file", path); r.code != exitOK || !strings.Contains(r.stdout, "1_second_") {
+		t.Fatalf("sign file: %+v", r)
+	}
+
+	r = runSignctl(t, env, "", "export", "keys", device.ID)
+	exportedKeys := r.stdout
+	rest, keys := []byte(r.stdout), 0
+	for block, next := pem.Decode(rest); block != nil; block, next = pem.Decode(next) {
+		keys++
+	}
+	if r.code != exitOK || keys != 2 {
+		t.Fatalf("expected 2 PEM encoded keys, got %d: %+v", keys, r)
+	}
+
+	r = runSignctl(t, env, "", "export", "chain", device.ID)
+	if r.code != exitOK || strings.Contains(r.stdout, "\t") || !strings.HasPrefix(r.stdout, "COUNTER  KEY VERSION  SIGNATURE") {
+		t.Fatalf("expected an aligned table, got %+v", r)
+	}
+
+	r = runSignctl(t, env, "", "export", "chain", device.ID, "-o", "json")
+	lines := strings.Split(strings.TrimSpace(r.stdout), "\n")
+	if r.code != exitOK || len(lines) != 2 {
+		t.Fatalf("export chain: %+v", r)
+	}
+	var signature client.Signature
+	if err := json.Unmarshal([]byte(lines[1]), &signature); err != nil || signature.Counter != 1 || signature.KeyVersion != 2 {
+		t.Fatalf("unexpected signature %s", lines[1])
+	}
+
+	// the exports verify offline
+	auditKeys, err := audit.ParseKeys([]byte(exportedKeys))
+	if err != nil {
+		t.Fatalf("parse exported keys: %v", err)
+	}
+	chain, err := audit.ReadSignatures(strings.NewReader(r.stdout))
+	if err != nil {
+		t.Fatalf("read exported chain: %v", err)
+	}
+	if report, err := audit.VerifyChain(audit.Params{DeviceID: device.ID, Keys: auditKeys}, chain); err != nil || !report.Valid {
+		t.Fatalf("expected the exported chain to verify, got %+v: %v", report, err)
+	}
+
+	// an invalid signature fails with the result printed
+	tampered := strings.Replace(first, `"0_first_`, `"0_tampered_`, 1)
+	if r := runSignctl(t, env, tampered, "verify", device.ID, "-file", "-", "-o", "json"); r.code != exitFailure || !strings.Contains(r.stdout, `"valid": false`) {
+		t.Fatalf("expected an invalid signature, got %+v", r)
+	}
+
+	if r := runSignctl(t, env, "", "devices", "suspend", device.ID); r.code != exitOK || !strings.Contains(r.stdout, "suspended") {
+		t.Fatalf("suspend: %+v", r)
+	}
+	if r := runSignctl(t, env, "third", "sign", device.ID); r.code != exitFailure || !strings.Contains(r.stderr, "device_not_active") {
+		t.Fatalf("expected the suspended device to fail signing, got %+v", r)
+	}
+	if r := runSignctl(t, env, "", "devices", "create", "-algorithm", "DSA"); r.code != exitFailure || !strings.Contains(r.stderr, "algorithm") {
+		t.Fatalf("expected the invalid parameter to be printed, got %+v", r)
+	}
+}
+
+func TestSignctl_Usage(t *testing.T) {
+	isolateProfiles(t)
+	var env map[string]string
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"devices"},
+		{"devices", "inspect"},
+		{"devices", "list", "-o", "yaml"},
+		{"sign", "-unknown", "device"},
+	} {
+		if r := runSignctl(t, env, "", args...); r.code != exitUsage || r.stderr == "" {
+			t.Fatalf("expected a usage error for %q, got %+v", args, r)
+		}
+	}
+	if r := runSignctl(t, env, "", "help"); r.code != exitOK || !strings.Contains(r.stderr, "export") {
+		t.Fatalf("unexpected help: %+v", r)
+	}
+}
+
+func TestSignctl_Profiles(t *testing.T) {
+	// the fake server echoes the credentials and the tenant of the request
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		json.NewEncoder(response).Encode(map[string]any{"data": []map[string]string{{
+			"id":    request.Header.Get("X-API-Key") + request.Header.Get("Authorization"),
+			"label": request.Header.Get("X-Tenant-ID"),
+		}}})
+	}))
+	t.Cleanup(server.Close)
+
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	os.WriteFile(path, []byte(`
+default: staging
+profiles:
+  staging:
+    server: `+server.URL+`
+    api_key: staging-key
+  production:
+    server: `+server.URL+`
+    token: production-token
+    tenant: acme
+`), 0o600)
+
+	for _, tc := range []struct {
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{env: map[string]string{envConfig: path}, want: "staging-key"},
+		{env: map[string]string{envConfig: path}, args: []string{"-profile", "production"}, want: "Bearer production-token\tacme"},
+		{env: map[string]string{envConfig: path, envProfile: "production"}, want: "Bearer production-token\tacme"},
+		{env: map[string]string{envConfig: path, envProfile: "production", envAPIKey: "env-key"}, want: "env-key\tacme"},
+		{env: map[string]string{envConfig: path}, args: []string{"-profile", "production", "-tenant", "other"}, want: "Bearer production-token\tother"},
+	} {
+		args := append([]string{"devices", "list", "-o", "json"}, tc.args...)
+		r := runSignctl(t, tc.env, "", args...)
+		var devices []client.Device
+		if err := json.Unmarshal([]byte(r.stdout), &devices); r.code != exitOK || err != nil || len(devices) != 1 {
+			t.Fatalf("list devices %v: %+v", tc.env, r)
+		}
+		if got := devices[0].ID + "\t" + devices[0].Label; strings.TrimSuffix(got, "\t") != tc.want {
+			t.Fatalf("expected %q with %v %v, got %q", tc.want, tc.env, tc.args, got)
+		}
+	}
+
+	if r := runSignctl(t, map[string]string{envConfig: path}, "", "devices", "list", "-profile", "unknown"); r.code != exitFailure || !strings.Contains(r.stderr, "unknown profile") {
+		t.Fatalf("expected an unknown profile, got %+v", r)
+	}
+	if r := runSignctl(t, nil, "", "devices", "list", "-config", filepath.Join(t.TempDir(), "missing.yaml")); r.code != exitFailure {
+		t.Fatalf("expected a missing profiles file to fail, got %+v", r)
+	}
+
+	// profiles are listed without their credentials
+	r := runSignctl(t, map[string]string{envConfig: path}, "", "profiles")
+	if r.code != exitOK || strings.Contains(r.stdout, "staging-key") || !strings.Contains(r.stdout, "production") || !strings.Contains(r.stdout, "*") {
+		t.Fatalf("unexpected profiles: %+v", r)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ksrichard/signing-service-challenge/client"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultServer is the server used if neither a flag, the environment nor a profile names one.
+	defaultServer = "http://localhost:8080"
+
+	envConfig  = "SIGNCTL_CONFIG"
+	envProfile = "SIGNCTL_PROFILE"
+	envServer  = "SIGNCTL_SERVER"
+	envAPIKey  = "SIGNCTL_API_KEY"
+	envToken   = "SIGNCTL_TOKEN"
+	envTenant  = "SIGNCTL_TENANT"
+)
+
+// ProfilesFile is the configuration file of signctl, by default signctl/profiles.yaml in the user configuration
+// directory (e.g. ~/.config/signctl/profiles.yaml):
+//
+//	default: staging
+//	profiles:
+//	  staging:
+//	    server: https://signing.staging.example.com
+//	    api_key: ssk_...
+//	  production:
+//	    server: https://signing.example.com
+//	    token: eyJ...
+//	    tenant: acme
+type ProfilesFile struct {
+	// Default is the profile used if none is selected.
+	Default  string             `yaml:"default"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Profile is a signing service signctl connects to.
+type Profile struct {
+	Server string `yaml:"server"`
+	// APIKey or Token authenticate the requests, Token is sent as a bearer token.
+	APIKey string `yaml:"api_key"`
+	Token  string `yaml:"token"`
+	// Tenant is the tenant the requests act on, the tenant of the credentials if empty.
+	Tenant string `yaml:"tenant"`
+}
+
+// defaultProfilesPath returns the path of the profiles file if SIGNCTL_CONFIG and the config flag are not set.
+func defaultProfilesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "signctl", "profiles.yaml")
+}
+
+// loadProfiles reads a profiles file. A missing file has no profiles, unless it was named explicitly.
+func loadProfiles(path string, explicit bool) (*ProfilesFile, error) {
+	var file ProfilesFile
+	if path == "" {
+		return &file, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return &file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read profiles: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid profiles file %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// profile resolves the connection settings: flags take precedence over the environment, which takes precedence
+// over the selected profile.
+func (c *cli) profile() (Profile, error) {
+	path, explicit := first(c.flags.config, c.getenv(envConfig)), true
+	if path == "" {
+		path, explicit = defaultProfilesPath(), false
+	}
+	file, err := loadProfiles(path, explicit)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	var profile Profile
+	if name := first(c.flags.profile, c.getenv(envProfile), file.Default); name != "" {
+		var ok bool
+		if profile, ok = file.Profiles[name]; !ok {
+			return Profile{}, fmt.Errorf("unknown profile %q", name)
+		}
+	}
+	profile.Server = first(c.flags.server, c.getenv(envServer), profile.Server, defaultServer)
+	profile.Tenant = first(c.flags.tenant, c.getenv(envTenant), profile.Tenant)
+	// credentials of a flag or the environment replace those of the profile, whichever kind they are
+	if apiKey, token := first(c.flags.apiKey, c.getenv(envAPIKey)), first(c.flags.token, c.getenv(envToken)); apiKey != "" || token != "" {
+		profile.APIKey, profile.Token = apiKey, token
+	}
+	if profile.APIKey != "" && profile.Token != "" {
+		return Profile{}, errors.New("either an api key or a token can be used, not both")
+	}
+	return profile, nil
+}
+
+// connect creates the client of the resolved profile.
+func (c *cli) connect() (*client.Client, error) {
+	profile, err := c.profile()
+	if err != nil {
+		return nil, err
+	}
+	config := client.Config{Tenant: profile.Tenant}
+	switch {
+	case profile.APIKey != "":
+		config.Auth = client.APIKey(profile.APIKey)
+	case profile.Token != "":
+		config.Auth = client.BearerToken(profile.Token)
+	}
+	return client.New(strings.TrimSpace(profile.Server), config)
+}
+
+// first returns the first non-empty value.
+func first(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,369 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/logging"
+	"github.com/ksrichard/signing-service-challenge/stream"
+	"github.com/ksrichard/signing-service-challenge/tracing"
+	"github.com/ksrichard/signing-service-challenge/webhook"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+
+	AuthAPIKey = "api-key"
+	AuthJWT    = "jwt"
+	AuthNone   = "none"
+)
+
+// Config is the complete configuration of the service.
+// The same keys are used in configuration files and in the effective configuration exposed by the API.
+type Config struct {
+	Server     ServerConfig     `json:"server" yaml:"server"`
+	Store      StoreConfig      `json:"store" yaml:"store"`
+	Algorithms AlgorithmsConfig `json:"algorithms" yaml:"algorithms"`
+	Tenants    []TenantConfig   `json:"tenants" yaml:"tenants"`
+	Auth       AuthConfig       `json:"auth" yaml:"auth"`
+	TLS        TLSConfig        `json:"tls" yaml:"tls"`
+	RateLimits RateLimitsConfig `json:"rate_limits" yaml:"rate_limits"`
+	Logging    LoggingConfig    `json:"logging" yaml:"logging"`
+	Tracing    TracingConfig    `json:"tracing" yaml:"tracing"`
+	Webhooks   WebhooksConfig   `json:"webhooks" yaml:"webhooks"`
+	Streams    StreamsConfig    `json:"streams" yaml:"streams"`
+}
+
+type ServerConfig struct {
+	ListenAddress string `json:"listen_address" yaml:"listen_address"`
+	// GRPCListenAddress is the address of the gRPC API, which is disabled if empty.
+	GRPCListenAddress string   `json:"grpc_listen_address" yaml:"grpc_listen_address"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout" yaml:"read_header_timeout"`
+	ReadTimeout       Duration `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout      Duration `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	MaxHeaderBytes    int      `json:"max_header_bytes" yaml:"max_header_bytes"`
+	MaxBodyBytes      int64    `json:"max_body_bytes" yaml:"max_body_bytes"`
+	ShutdownTimeout   Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+}
+
+type StoreConfig struct {
+	// Backend is StoreMemory or StoreRedis.
+	Backend string `json:"backend" yaml:"backend"`
+	// DSN locates the store, e.g. redis://localhost:6379/0.
+	DSN string `json:"dsn" yaml:"dsn"`
+	// Password authenticates with the store, it takes precedence over a password in the DSN.
+	// It is not accepted as flag, as the arguments of a process are visible to other users.
+	Password string `json:"password" yaml:"password"`
+	// PasswordFile is read into Password on load, e.g. a mounted secret. It excludes Password.
+	PasswordFile string `json:"password_file" yaml:"password_file"`
+	// IdempotencyRetention is how long the idempotency keys of signature requests are kept.
+	IdempotencyRetention Duration `json:"idempotency_retention" yaml:"idempotency_retention"`
+	// SignatureLogRetention is the number of signatures kept in the signature log of a device, 0 keeps all of them.
+	SignatureLogRetention int `json:"signature_log_retention" yaml:"signature_log_retention"`
+}
+
+type AlgorithmsConfig struct {
+	Enabled []crypto.SignatureAlgorithm `json:"enabled" yaml:"enabled"`
+	// RSAKeySize is the modulus size of new RSA keys in bits.
+	RSAKeySize int `json:"rsa_key_size" yaml:"rsa_key_size"`
+	// ECCKeySize selects the curve of new ECC keys: 256 (P-256), 384 (P-384) or 521 (P-521).
+	ECCKeySize int `json:"ecc_key_size" yaml:"ecc_key_size"`
+}
+
+type TenantConfig struct {
+	ID string `json:"id" yaml:"id"`
+	// MaxDevices is the device quota of the tenant, 0 means unlimited.
+	MaxDevices int `json:"max_devices" yaml:"max_devices"`
+}
+
+type AuthConfig struct {
+	// Mode is AuthAPIKey, AuthJWT or AuthNone.
+	Mode string `json:"mode" yaml:"mode"`
+	// AdminAPIKeys are bootstrap admin keys in the form of tenant:key.
+	AdminAPIKeys []string  `json:"admin_api_keys" yaml:"admin_api_keys"`
+	JWT          JWTConfig `json:"jwt" yaml:"jwt"`
+}
+
+type JWTConfig struct {
+	// JWKS is the file path or URL of the keys verifying bearer JWTs.
+	JWKS        string   `json:"jwks" yaml:"jwks"`
+	Issuer      string   `json:"issuer" yaml:"issuer"`
+	Audience    string   `json:"audience" yaml:"audience"`
+	TenantClaim string   `json:"tenant_claim" yaml:"tenant_claim"`
+	ScopeClaim  string   `json:"scope_claim" yaml:"scope_claim"`
+	Leeway      Duration `json:"leeway" yaml:"leeway"`
+}
+
+type TLSConfig struct {
+	CertFile          string `json:"cert_file" yaml:"cert_file"`
+	KeyFile           string `json:"key_file" yaml:"key_file"`
+	ClientCAFile      string `json:"client_ca_file" yaml:"client_ca_file"`
+	RequireClientCert bool   `json:"require_client_cert" yaml:"require_client_cert"`
+	// ClientIdentitiesFile maps client certificates to identities, see auth.LoadCertificateMappings.
+	ClientIdentitiesFile string   `json:"client_identities_file" yaml:"client_identities_file"`
+	ReloadInterval       Duration `json:"reload_interval" yaml:"reload_interval"`
+}
+
+// RateLimitConfig limits the requests per API client and the signatures per device, a rate of 0 is unlimited.
+type RateLimitConfig struct {
+	ClientRate  float64 `json:"client_rate" yaml:"client_rate"`
+	ClientBurst int     `json:"client_burst" yaml:"client_burst"`
+	DeviceRate  float64 `json:"device_rate" yaml:"device_rate"`
+	DeviceBurst int     `json:"device_burst" yaml:"device_burst"`
+}
+
+type RateLimitsConfig struct {
+	RateLimitConfig `yaml:",inline"`
+	TenantOverrides map[string]RateLimitConfig `json:"tenant_overrides" yaml:"tenant_overrides"`
+}
+
+type LoggingConfig struct {
+	Level  string `json:"level" yaml:"level"`
+	Format string `json:"format" yaml:"format"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout, file or otlp.
+	Exporter string `json:"exporter" yaml:"exporter"`
+	// File receives the spans of the file exporter.
+	File string `json:"file" yaml:"file"`
+	// Endpoint is the host:port of the OTLP/HTTP collector.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	Insecure bool   `json:"insecure" yaml:"insecure"`
+	// SampleRatio is the fraction of new traces which are sampled.
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"`
+}
+
+type WebhooksConfig struct {
+	// MaxAttempts is how many times a delivery is attempted before it becomes a dead letter.
+	MaxAttempts int `json:"max_attempts" yaml:"max_attempts"`
+	// InitialBackoff is the pause after the first failed attempt, it doubles with every further attempt up to MaxBackoff.
+	InitialBackoff Duration `json:"initial_backoff" yaml:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff" yaml:"max_backoff"`
+	// Timeout bounds a single delivery attempt.
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+	Workers int      `json:"workers" yaml:"workers"`
+}
+
+type StreamsConfig struct {
+	// Buffer is the number of events a stream may lag behind before it is dropped.
+	Buffer int `json:"buffer" yaml:"buffer"`
+	// History is the number of signatures retained per device to resume streams from.
+	History    int      `json:"history" yaml:"history"`
+	HistoryTTL Duration `json:"history_ttl" yaml:"history_ttl"`
+	// Heartbeat is the interval of the keep-alive messages of idle streams.
+	Heartbeat Duration `json:"heartbeat" yaml:"heartbeat"`
+	// Poll is the interval in which streams read the signatures created by other instances from the store.
+	Poll Duration `json:"poll" yaml:"poll"`
+}
+
+// Default returns the configuration used for everything not configured otherwise.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			ListenAddress:     ":8080",
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(15 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(2 * time.Minute),
+			MaxHeaderBytes:    64 << 10,
+			MaxBodyBytes:      1 << 20,
+			ShutdownTimeout:   Duration(30 * time.Second),
+		},
+		Store: StoreConfig{
+			Backend:              StoreMemory,
+			IdempotencyRetention: Duration(domain.DefaultIdempotencyRetention),
+		},
+		Algorithms: AlgorithmsConfig{
+			Enabled:    []crypto.SignatureAlgorithm{crypto.RSA, crypto.ECC},
+			RSAKeySize: 2048,
+			ECCKeySize: 384,
+		},
+		Tenants: []TenantConfig{{ID: domain.DefaultTenantID}},
+		Auth: AuthConfig{
+			Mode: AuthAPIKey,
+			JWT: JWTConfig{
+				TenantClaim: auth.DefaultTenantClaim,
+				ScopeClaim:  auth.DefaultScopeClaim,
+				Leeway:      Duration(30 * time.Second),
+			},
+		},
+		TLS: TLSConfig{
+			ReloadInterval: Duration(10 * time.Second),
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: logging.FormatJSON,
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracing.ExporterNone,
+			SampleRatio: 1,
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts:    webhook.DefaultMaxAttempts,
+			InitialBackoff: Duration(webhook.DefaultInitialBackoff),
+			MaxBackoff:     Duration(webhook.DefaultMaxBackoff),
+			Timeout:        Duration(webhook.DefaultTimeout),
+			Workers:        webhook.DefaultWorkers,
+		},
+		Streams: StreamsConfig{
+			Buffer:     stream.DefaultBuffer,
+			History:    stream.DefaultHistory,
+			HistoryTTL: Duration(stream.DefaultHistoryTTL),
+			Heartbeat:  Duration(stream.DefaultHeartbeat),
+			Poll:       Duration(stream.DefaultPoll),
+		},
+	}
+}
+
+// Validate checks the configuration and reports all problems at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.ListenAddress != "", "server.listen_address is required")
+	check(c.Server.GRPCListenAddress != c.Server.ListenAddress, "server.grpc_listen_address must differ from server.listen_address")
+	for name, timeout := range map[string]Duration{
+		"read_header_timeout": c.Server.ReadHeaderTimeout,
+		"read_timeout":        c.Server.ReadTimeout,
+		"write_timeout":       c.Server.WriteTimeout,
+		"idle_timeout":        c.Server.IdleTimeout,
+		"shutdown_timeout":    c.Server.ShutdownTimeout,
+	} {
+		check(timeout > 0, "server.%s must be positive", name)
+	}
+	check(c.Server.MaxHeaderBytes > 0, "server.max_header_bytes must be positive")
+	check(c.Server.MaxBodyBytes > 0, "server.max_body_bytes must be positive")
+
+	switch c.Store.Backend {
+	case StoreMemory:
+	case StoreRedis:
+		dsn, err := url.Parse(c.Store.DSN)
+		check(err == nil && (dsn.Scheme == "redis" || dsn.Scheme == "rediss") && dsn.Host != "",
+			"store.dsn must be a redis:// or rediss:// URL for the redis backend")
+	default:
+		check(false, "store.backend must be %q or %q, got %q", StoreMemory, StoreRedis, c.Store.Backend)
+	}
+	check(c.Store.IdempotencyRetention > 0, "store.idempotency_retention must be positive")
+	check(c.Store.SignatureLogRetention >= 0, "store.signature_log_retention must not be negative")
+
+	check(len(c.Algorithms.Enabled) > 0, "algorithms.enabled must name at least one algorithm")
+	for _, algorithm := range c.Algorithms.Enabled {
+		check(algorithm == crypto.RSA || algorithm == crypto.ECC, "algorithms.enabled: unknown algorithm %q", algorithm)
+	}
+	check(c.Algorithms.RSAKeySize >= 2048 && c.Algorithms.RSAKeySize <= 8192 && c.Algorithms.RSAKeySize%8 == 0,
+		"algorithms.rsa_key_size must be a multiple of 8 between 2048 and 8192")
+	_, err := ECCCurve(c.Algorithms.ECCKeySize)
+	check(err == nil, "algorithms.ecc_key_size must be 256, 384 or 521")
+
+	check(len(c.Tenants) > 0, "at least one tenant is required")
+	tenantIDs := make(map[string]bool, len(c.Tenants))
+	for _, tenant := range c.Tenants {
+		check(tenant.ID != "", "tenants: id is required")
+		check(!tenantIDs[tenant.ID], "tenants: duplicate tenant %q", tenant.ID)
+		check(tenant.MaxDevices >= 0, "tenants: max_devices of %q must not be negative", tenant.ID)
+		tenantIDs[tenant.ID] = true
+	}
+
+	switch c.Auth.Mode {
+	case AuthAPIKey, AuthNone:
+	case AuthJWT:
+		check(c.Auth.JWT.JWKS != "" && c.Auth.JWT.Issuer != "" && c.Auth.JWT.Audience != "",
+			"auth.jwt.jwks, auth.jwt.issuer and auth.jwt.audience are required for the jwt mode")
+		check(c.Auth.JWT.Leeway >= 0, "auth.jwt.leeway must not be negative")
+	default:
+		check(false, "auth.mode must be %q, %q or %q, got %q", AuthAPIKey, AuthJWT, AuthNone, c.Auth.Mode)
+	}
+	for _, entry := range c.Auth.AdminAPIKeys {
+		tenantID, key, ok := strings.Cut(entry, ":")
+		check(ok && tenantID != "" && key != "", "auth.admin_api_keys: entries must be in the form of tenant:key")
+		check(!ok || tenantIDs[tenantID], "auth.admin_api_keys: unknown tenant %q", tenantID)
+	}
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	check(c.TLS.ClientCAFile == "" || c.TLS.CertFile != "", "tls.client_ca_file requires tls.cert_file")
+	check(!c.TLS.RequireClientCert || c.TLS.ClientCAFile != "", "tls.require_client_cert requires tls.client_ca_file")
+	check(c.TLS.ClientIdentitiesFile == "" || c.TLS.ClientCAFile != "", "tls.client_identities_file requires tls.client_ca_file")
+	check(c.TLS.ReloadInterval > 0, "tls.reload_interval must be positive")
+
+	errs = append(errs, c.RateLimits.RateLimitConfig.validate("rate_limits"))
+	for tenantID, override := range c.RateLimits.TenantOverrides {
+		check(tenantIDs[tenantID], "rate_limits.tenant_overrides: unknown tenant %q", tenantID)
+		errs = append(errs, override.validate("rate_limits.tenant_overrides."+tenantID))
+	}
+
+	_, err = logging.ParseLevel(c.Logging.Level)
+	check(err == nil, "logging.level must be debug, info, warn or error, got %q", c.Logging.Level)
+	check(c.Logging.Format == logging.FormatJSON || c.Logging.Format == logging.FormatText,
+		"logging.format must be %q or %q, got %q", logging.FormatJSON, logging.FormatText, c.Logging.Format)
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		check(c.Tracing.File != "", "tracing.file is required for the file exporter")
+	case tracing.ExporterOTLP:
+		check(c.Tracing.Endpoint != "", "tracing.endpoint is required for the otlp exporter")
+	default:
+		check(false, "tracing.exporter must be %q, %q, %q or %q, got %q",
+			tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterFile, tracing.ExporterOTLP, c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive")
+	check(c.Webhooks.InitialBackoff > 0 && c.Webhooks.InitialBackoff <= c.Webhooks.MaxBackoff,
+		"webhooks.initial_backoff must be positive and not exceed webhooks.max_backoff")
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+	check(c.Webhooks.Workers > 0, "webhooks.workers must be positive")
+
+	check(c.Streams.Buffer > 0, "streams.buffer must be positive")
+	check(c.Streams.History > 0, "streams.history must be positive")
+	check(c.Streams.HistoryTTL > 0, "streams.history_ttl must be positive")
+	check(c.Streams.Heartbeat > 0, "streams.heartbeat must be positive")
+	check(c.Streams.Poll > 0, "streams.poll must be positive")
+
+	return errors.Join(errs...)
+}
+
+func (c RateLimitConfig) validate(path string) error {
+	var errs []error
+	if c.ClientRate < 0 || c.DeviceRate < 0 {
+		errs = append(errs, fmt.Errorf("%s: rates must not be negative", path))
+	}
+	if c.ClientBurst < 0 || c.DeviceBurst < 0 {
+		errs = append(errs, fmt.Errorf("%s: bursts must not be negative", path))
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration without secrets, safe to log or expose.
+func (c Config) Redacted() Config {
+	redacted := c
+	if dsn, err := url.Parse(c.Store.DSN); err == nil && dsn.User != nil {
+		redacted.Store.DSN = dsn.Redacted()
+	}
+	if c.Store.Password != "" {
+		redacted.Store.Password = logging.Redacted
+	}
+	redacted.Auth.AdminAPIKeys = make([]string, len(c.Auth.AdminAPIKeys))
+	for i, entry := range c.Auth.AdminAPIKeys {
+		tenantID, _, _ := strings.Cut(entry, ":")
+		redacted.Auth.AdminAPIKeys[i] = tenantID + ":" + logging.Redacted
+	}
+	redacted.Algorithms.Enabled = append([]crypto.SignatureAlgorithm(nil), c.Algorithms.Enabled...)
+	redacted.Tenants = append([]TenantConfig(nil), c.Tenants...)
+	redacted.RateLimits.TenantOverrides = maps.Clone(c.RateLimits.TenantOverrides)
+	return redacted
+}
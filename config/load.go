@@ -0,0 +1,359 @@
+package config
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix prefixes the environment variables derived from the flag names, e.g. SIGNING_LISTEN_ADDRESS.
+	EnvPrefix = "SIGNING_"
+	// ConfigFileEnv names the environment variable with the configuration file, overridden by the -config flag.
+	ConfigFileEnv = EnvPrefix + "CONFIG"
+	// AdminAPIKeysEnv names the environment variable with the bootstrap admin API keys in the form of tenant:key[,tenant:key].
+	// They are not accepted as flag, as the arguments of a process are visible to other users.
+	AdminAPIKeysEnv = "ADMIN_API_KEYS"
+	// StorePasswordEnv names the environment variable with the password of the store, not accepted as flag either.
+	StorePasswordEnv = EnvPrefix + "STORE_PASSWORD"
+)
+
+// Load builds the configuration from the defaults, a YAML or JSON configuration file,
+// environment variables and command line flags, each overriding the previous ones, and validates it.
+// The configuration file is given by the -config flag or the SIGNING_CONFIG environment variable.
+func Load(args []string, getenv func(string) string, output io.Writer) (Config, error) {
+	config := Default()
+	flags := flag.NewFlagSet("signing-service", flag.ContinueOnError)
+	flags.SetOutput(output)
+	configFile := flags.String("config", "", "YAML or JSON configuration file (env "+ConfigFileEnv+")")
+	config.bindFlags(flags)
+
+	// the flags are parsed first to find the configuration file, and applied again on top of it
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if flags.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	setFlags := map[string]string{}
+	flags.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = f.Value.String()
+	})
+
+	path := *configFile
+	if path == "" {
+		path = getenv(ConfigFileEnv)
+	}
+	if path != "" {
+		if err := config.loadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var errs []error
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		if value := getenv(EnvName(f.Name)); value != "" {
+			if err := f.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value %q for %s: %w", value, EnvName(f.Name), err))
+			}
+		}
+	})
+	if value := getenv(AdminAPIKeysEnv); value != "" {
+		config.Auth.AdminAPIKeys = splitList(value)
+	}
+	if value := getenv(StorePasswordEnv); value != "" {
+		config.Store.Password = value
+	}
+	for name, value := range setFlags {
+		if err := flags.Set(name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for -%s: %w", value, name, err))
+		}
+	}
+	if dsn, ok := setFlags["store-dsn"]; ok && dsnHasPassword(dsn) {
+		errs = append(errs, fmt.Errorf("-store-dsn must not contain a password, pass it with %s or -store-password-file", StorePasswordEnv))
+	}
+	if _, ok := setFlags["redis-address"]; ok {
+		if _, ok := setFlags["store-dsn"]; ok {
+			errs = append(errs, errors.New("-redis-address and -store-dsn are mutually exclusive"))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, err
+	}
+	if config.Store.PasswordFile != "" {
+		if config.Store.Password != "" {
+			return Config{}, fmt.Errorf("store.password (%s) and store.password_file are mutually exclusive", StorePasswordEnv)
+		}
+		data, err := os.ReadFile(config.Store.PasswordFile)
+		if err != nil {
+			return Config{}, fmt.Errorf("unable to read store password file: %w", err)
+		}
+		config.Store.Password = strings.TrimSpace(string(data))
+	}
+
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return config, nil
+}
+
+// dsnHasPassword reports whether the URL of a store carries a password.
+func dsnHasPassword(dsn string) bool {
+	parsed, err := url.Parse(dsn)
+	if err != nil || parsed.User == nil {
+		return false
+	}
+	_, ok := parsed.User.Password()
+	return ok
+}
+
+// EnvName returns the environment variable of a flag, e.g. SIGNING_TLS_CERT for -tls-cert.
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadFile overrides the configuration with the values of a YAML or JSON file, unknown keys are rejected.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read configuration file: %w", err)
+	}
+	// JSON is a subset of YAML, so both are read by the YAML decoder
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+// bindFlags registers a flag for every setting which is not a secret, bound to the fields of c.
+func (c *Config) bindFlags(flags *flag.FlagSet) {
+	flags.StringVar(&c.Server.ListenAddress, "listen-address", c.Server.ListenAddress, "address the server listens on")
+	flags.StringVar(&c.Server.GRPCListenAddress, "grpc-listen-address", c.Server.GRPCListenAddress, "address the gRPC API listens on, disabled if empty")
+	flags.Var(&c.Server.ReadHeaderTimeout, "read-header-timeout", "maximum duration for reading request headers")
+	flags.Var(&c.Server.ReadTimeout, "read-timeout", "maximum duration for reading an entire request")
+	flags.Var(&c.Server.WriteTimeout, "write-timeout", "maximum duration before timing out writes of a response")
+	flags.Var(&c.Server.IdleTimeout, "idle-timeout", "maximum time to wait for the next request on a keep-alive connection")
+	flags.IntVar(&c.Server.MaxHeaderBytes, "max-header-bytes", c.Server.MaxHeaderBytes, "maximum size of request headers in bytes")
+	flags.Int64Var(&c.Server.MaxBodyBytes, "max-body-bytes", c.Server.MaxBodyBytes, "maximum size of request bodies in bytes")
+	flags.Var(&c.Server.ShutdownTimeout, "shutdown-timeout", "maximum time to drain in-flight requests on shutdown")
+
+	flags.StringVar(&c.Store.Backend, "store", c.Store.Backend, "signature device store: memory or redis")
+	flags.StringVar(&c.Store.DSN, "store-dsn", c.Store.DSN, "URL of the store without password, e.g. redis://localhost:6379/0 (password in env "+StorePasswordEnv+")")
+	flags.StringVar(&c.Store.PasswordFile, "store-password-file", c.Store.PasswordFile, "file containing the password of the store")
+	warned := false
+	flags.Func("redis-address", "deprecated: use -store redis -store-dsn redis://<address>", func(address string) error {
+		if address == "" {
+			return nil
+		}
+		// the flags are applied twice, see Load
+		if !warned {
+			fmt.Fprintln(flags.Output(), "-redis-address is deprecated, use -store redis -store-dsn redis://"+address)
+			warned = true
+		}
+		c.Store.Backend = StoreRedis
+		c.Store.DSN = "redis://" + address
+		return nil
+	})
+	flags.Var(&c.Store.IdempotencyRetention, "idempotency-retention", "how long the idempotency keys of signature requests are kept")
+	flags.IntVar(&c.Store.SignatureLogRetention, "signature-log-retention", c.Store.SignatureLogRetention, "signatures kept in the signature log of a device, 0 keeps all")
+
+	flags.Var((*algorithmsValue)(&c.Algorithms.Enabled), "algorithms", "comma separated enabled signature algorithms")
+	flags.IntVar(&c.Algorithms.RSAKeySize, "rsa-key-size", c.Algorithms.RSAKeySize, "size of new RSA keys in bits")
+	flags.IntVar(&c.Algorithms.ECCKeySize, "ecc-key-size", c.Algorithms.ECCKeySize, "curve size of new ECC keys: 256, 384 or 521")
+
+	flags.Var((*tenantsValue)(&c.Tenants), "tenants", "comma separated tenants in the form of id[:maxDevices]")
+
+	flags.StringVar(&c.Auth.Mode, "auth", c.Auth.Mode, "authentication mode: api-key, jwt or none")
+	flags.StringVar(&c.Auth.JWT.JWKS, "jwks", c.Auth.JWT.JWKS, "file path or URL of the JWKS used to verify bearer JWTs (jwt mode)")
+	flags.StringVar(&c.Auth.JWT.Issuer, "jwt-issuer", c.Auth.JWT.Issuer, "required issuer of bearer JWTs (jwt mode)")
+	flags.StringVar(&c.Auth.JWT.Audience, "jwt-audience", c.Auth.JWT.Audience, "required audience of bearer JWTs (jwt mode)")
+	flags.StringVar(&c.Auth.JWT.TenantClaim, "jwt-tenant-claim", c.Auth.JWT.TenantClaim, "claim of bearer JWTs carrying the tenant (jwt mode)")
+	flags.StringVar(&c.Auth.JWT.ScopeClaim, "jwt-scope-claim", c.Auth.JWT.ScopeClaim, "claim of bearer JWTs carrying the scopes (jwt mode)")
+	flags.Var(&c.Auth.JWT.Leeway, "jwt-leeway", "allowed clock skew when checking the expiry of bearer JWTs (jwt mode)")
+
+	flags.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "PEM certificate file, enables HTTPS (reloaded on change)")
+	flags.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "PEM private key file of the certificate")
+	flags.StringVar(&c.TLS.ClientCAFile, "tls-client-ca", c.TLS.ClientCAFile, "PEM file of the CAs client certificates are verified against, enables mutual TLS")
+	flags.BoolVar(&c.TLS.RequireClientCert, "tls-require-client-cert", c.TLS.RequireClientCert, "reject connections without a valid client certificate")
+	flags.StringVar(&c.TLS.ClientIdentitiesFile, "tls-client-identities", c.TLS.ClientIdentitiesFile, "JSON file mapping client certificate fingerprints or subjects to identities")
+	flags.Var(&c.TLS.ReloadInterval, "tls-reload-interval", "how often the certificate files are checked for changes")
+
+	flags.Float64Var(&c.RateLimits.ClientRate, "client-rate", c.RateLimits.ClientRate, "requests per second per API client (0 is unlimited)")
+	flags.IntVar(&c.RateLimits.ClientBurst, "client-burst", c.RateLimits.ClientBurst, "request burst per API client")
+	flags.Float64Var(&c.RateLimits.DeviceRate, "device-rate", c.RateLimits.DeviceRate, "signature requests per second per device (0 is unlimited)")
+	flags.IntVar(&c.RateLimits.DeviceBurst, "device-burst", c.RateLimits.DeviceBurst, "signature request burst per device")
+	flags.Var((*overridesValue)(&c.RateLimits.TenantOverrides), "rate-limit-overrides", "comma separated per tenant rate limits in the form of tenant:clientRate:clientBurst:deviceRate:deviceBurst")
+
+	flags.StringVar(&c.Logging.Level, "log-level", c.Logging.Level, "minimum log level: debug, info, warn or error")
+	flags.StringVar(&c.Logging.Format, "log-format", c.Logging.Format, "log format: json or text")
+
+	flags.StringVar(&c.Tracing.Exporter, "trace-exporter", c.Tracing.Exporter, "span exporter: none, stdout, file or otlp")
+	flags.StringVar(&c.Tracing.File, "trace-file", c.Tracing.File, "file the spans are appended to (file exporter)")
+	flags.StringVar(&c.Tracing.Endpoint, "trace-endpoint", c.Tracing.Endpoint, "host:port of the OTLP/HTTP collector (otlp exporter)")
+	flags.BoolVar(&c.Tracing.Insecure, "trace-insecure", c.Tracing.Insecure, "send spans to the collector without TLS (otlp exporter)")
+	flags.Float64Var(&c.Tracing.SampleRatio, "trace-sample-ratio", c.Tracing.SampleRatio, "fraction of new traces which are sampled")
+
+	flags.IntVar(&c.Webhooks.MaxAttempts, "webhook-max-attempts", c.Webhooks.MaxAttempts, "attempts of a webhook delivery before it becomes a dead letter")
+	flags.Var(&c.Webhooks.InitialBackoff, "webhook-initial-backoff", "pause after the first failed webhook delivery, doubled with every further attempt")
+	flags.Var(&c.Webhooks.MaxBackoff, "webhook-max-backoff", "maximum pause between two webhook delivery attempts")
+	flags.Var(&c.Webhooks.Timeout, "webhook-timeout", "maximum duration of a webhook delivery attempt")
+	flags.IntVar(&c.Webhooks.Workers, "webhook-workers", c.Webhooks.Workers, "number of concurrent webhook deliveries")
+
+	flags.IntVar(&c.Streams.Buffer, "stream-buffer", c.Streams.Buffer, "events an event stream may lag behind before it is dropped")
+	flags.IntVar(&c.Streams.History, "stream-history", c.Streams.History, "signatures retained per device to resume event streams from")
+	flags.Var(&c.Streams.HistoryTTL, "stream-history-ttl", "how long the signatures of a device are retained after its last signature")
+	flags.Var(&c.Streams.Heartbeat, "stream-heartbeat", "interval of the keep-alive messages of idle event streams")
+	flags.Var(&c.Streams.Poll, "stream-poll", "interval in which event streams read the signatures created by other instances from the store")
+}
+
+// ECCCurve returns the elliptic curve of an ECC key size.
+func ECCCurve(keySize int) (elliptic.Curve, error) {
+	switch keySize {
+	case 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	case 521:
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("unsupported ECC key size %d", keySize)
+}
+
+// Duration is a time.Duration written as string (e.g. "30s") in configuration files and flags.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+// algorithmsValue is a flag.Value of comma separated signature algorithms.
+type algorithmsValue []crypto.SignatureAlgorithm
+
+func (v *algorithmsValue) String() string {
+	names := make([]string, len(*v))
+	for i, algorithm := range *v {
+		names[i] = string(algorithm)
+	}
+	return strings.Join(names, ",")
+}
+
+func (v *algorithmsValue) Set(value string) error {
+	*v = nil
+	for _, name := range splitList(value) {
+		*v = append(*v, crypto.SignatureAlgorithm(strings.ToUpper(name)))
+	}
+	return nil
+}
+
+// tenantsValue is a flag.Value of comma separated tenants in the form of id[:maxDevices].
+type tenantsValue []TenantConfig
+
+func (v *tenantsValue) String() string {
+	entries := make([]string, len(*v))
+	for i, tenant := range *v {
+		entries[i] = tenant.ID
+		if tenant.MaxDevices > 0 {
+			entries[i] += ":" + strconv.Itoa(tenant.MaxDevices)
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+func (v *tenantsValue) Set(value string) error {
+	var tenants []TenantConfig
+	for _, entry := range splitList(value) {
+		id, maxDevicesStr, hasQuota := strings.Cut(entry, ":")
+		tenant := TenantConfig{ID: id}
+		if hasQuota {
+			maxDevices, err := strconv.Atoi(maxDevicesStr)
+			if err != nil || maxDevices < 0 {
+				return fmt.Errorf("invalid device quota for tenant %q: %q", id, maxDevicesStr)
+			}
+			tenant.MaxDevices = maxDevices
+		}
+		tenants = append(tenants, tenant)
+	}
+	*v = tenants
+	return nil
+}
+
+// overridesValue is a flag.Value of comma separated per tenant rate limits
+// in the form of tenant:clientRate:clientBurst:deviceRate:deviceBurst.
+type overridesValue map[string]RateLimitConfig
+
+func (v *overridesValue) String() string {
+	entries := make([]string, 0, len(*v))
+	for tenantID, limits := range *v {
+		entries = append(entries, fmt.Sprintf("%s:%g:%d:%g:%d", tenantID, limits.ClientRate, limits.ClientBurst, limits.DeviceRate, limits.DeviceBurst))
+	}
+	return strings.Join(entries, ",")
+}
+
+func (v *overridesValue) Set(value string) error {
+	overrides := map[string]RateLimitConfig{}
+	for _, entry := range splitList(value) {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 5 || parts[0] == "" {
+			return fmt.Errorf("invalid rate limit override %q", entry)
+		}
+		clientRate, err1 := strconv.ParseFloat(parts[1], 64)
+		clientBurst, err2 := strconv.Atoi(parts[2])
+		deviceRate, err3 := strconv.ParseFloat(parts[3], 64)
+		deviceBurst, err4 := strconv.Atoi(parts[4])
+		if err := errors.Join(err1, err2, err3, err4); err != nil {
+			return fmt.Errorf("invalid rate limit override %q: %w", entry, err)
+		}
+		overrides[parts[0]] = RateLimitConfig{
+			ClientRate:  clientRate,
+			ClientBurst: clientBurst,
+			DeviceRate:  deviceRate,
+			DeviceBurst: deviceBurst,
+		}
+	}
+	*v = overrides
+	return nil
+}
+
+// splitList splits a comma separated list, ignoring empty entries.
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
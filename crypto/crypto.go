@@ -1,8 +1,22 @@
 package crypto
 
+import (
+	"slices"
+)
+
 type SignatureAlgorithm string
 
 const (
 	RSA SignatureAlgorithm = "RSA"
 	ECC SignatureAlgorithm = "ECC"
 )
+
+// sortedAlgorithms returns the algorithms registered in a store map in alphabetical order.
+func sortedAlgorithms[T any](registered map[SignatureAlgorithm]T) []SignatureAlgorithm {
+	algorithms := make([]SignatureAlgorithm, 0, len(registered))
+	for algorithm := range registered {
+		algorithms = append(algorithms, algorithm)
+	}
+	slices.Sort(algorithms)
+	return algorithms
+}
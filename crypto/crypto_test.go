@@ -1,6 +1,10 @@
 package crypto
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"testing"
+)
 
 func TestKeyGeneratorStore_Get(t *testing.T) {
 	store := NewKeyGeneratorStore(map[SignatureAlgorithm]KeyGenerator{
@@ -17,7 +21,7 @@ func TestKeyGeneratorStore_Get(t *testing.T) {
 func TestRSAMarshalUnmarshalAndSign(t *testing.T) {
 	// generate keys
 	gen := &RSAGenerator{}
-	pub, priv, err := gen.GenerateKeyPair()
+	pub, priv, err := gen.GenerateKeyPair(context.Background())
 	if err != nil {
 		t.Fatalf("GenerateKeyPair error: %v", err)
 	}
@@ -43,14 +47,14 @@ func TestRSAMarshalUnmarshalAndSign(t *testing.T) {
 	if err != nil {
 		t.Fatalf("SignerStore.Get error: %v", err)
 	}
-	if _, err := signer.Sign([]byte("hello")); err != nil {
+	if _, err := signer.Sign(context.Background(), []byte("hello")); err != nil {
 		t.Fatalf("RSASigner.Sign error: %v", err)
 	}
 }
 
 func TestECCEncodeDecodeAndSign(t *testing.T) {
 	gen := &ECCGenerator{}
-	pub, priv, err := gen.GenerateKeyPair()
+	pub, priv, err := gen.GenerateKeyPair(context.Background())
 	if err != nil {
 		t.Fatalf("ECC GenerateKeyPair error: %v", err)
 	}
@@ -72,7 +76,31 @@ func TestECCEncodeDecodeAndSign(t *testing.T) {
 	if err != nil {
 		t.Fatalf("SignerStore.Get ECC error: %v", err)
 	}
-	if _, err := signer.Sign([]byte("hello")); err != nil {
+	if _, err := signer.Sign(context.Background(), []byte("hello")); err != nil {
 		t.Fatalf("ECCSigner.Sign error: %v", err)
 	}
 }
+
+func TestSignAndGenerate_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := (&RSAGenerator{}).GenerateKeyPair(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled from RSA generator, got %v", err)
+	}
+	if _, _, err := (&ECCGenerator{}).GenerateKeyPair(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled from ECC generator, got %v", err)
+	}
+
+	_, priv, err := (&ECCGenerator{}).GenerateKeyPair(context.Background())
+	if err != nil {
+		t.Fatalf("ECC GenerateKeyPair error: %v", err)
+	}
+	signer, err := NewECCSigner(priv)
+	if err != nil {
+		t.Fatalf("NewECCSigner error: %v", err)
+	}
+	if _, err := signer.Sign(ctx, []byte("hello")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled from ECC signer, got %v", err)
+	}
+}
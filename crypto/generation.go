@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -31,19 +32,47 @@ func (s *KeyGeneratorStore) Get(algorithm SignatureAlgorithm) (KeyGenerator, err
 	return generator, nil
 }
 
+// Algorithms returns the registered algorithms in alphabetical order.
+func (s *KeyGeneratorStore) Algorithms() []SignatureAlgorithm {
+	return sortedAlgorithms(s.generators)
+}
+
 // KeyGenerator is the interface that must be implemented by all the key generators.
 // It returns the public and private key as a byte slice (in this order).
+// Implementations backed by remote key custody must honour the cancellation and deadline of the context.
 type KeyGenerator interface {
-	GenerateKeyPair() ([]byte, []byte, error)
+	GenerateKeyPair(ctx context.Context) ([]byte, []byte, error)
+}
+
+// CustodyChecker is implemented by key generators backed by remote key custody (e.g. an HSM or a KMS)
+// which can tell whether the custody is reachable.
+type CustodyChecker interface {
+	CheckCustody(ctx context.Context) error
+}
+
+// CheckCustody checks that the key custody of the generator is available.
+// Generators without remote custody keep their keys in process and always pass.
+func CheckCustody(ctx context.Context, generator KeyGenerator) error {
+	if checker, ok := generator.(CustodyChecker); ok {
+		return checker.CheckCustody(ctx)
+	}
+	return ctx.Err()
 }
 
 // RSAGenerator generates an RSA key pair.
-type RSAGenerator struct{}
+type RSAGenerator struct {
+	// Bits is the size of the modulus, 512 if zero.
+	Bits int
+}
 
 // Generate generates a new RSAKeyPair.
 func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := rsa.GenerateKey(rand.Reader, 512)
+	bits := g.Bits
+	if bits == 0 {
+		// Security has been ignored for the sake of simplicity, configure Bits for production use.
+		bits = 512
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +83,10 @@ func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
 	}, nil
 }
 
-func (g *RSAGenerator) GenerateKeyPair() ([]byte, []byte, error) {
+func (g *RSAGenerator) GenerateKeyPair(ctx context.Context) ([]byte, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
 	keyPair, err := g.Generate()
 	if err != nil {
 		return nil, nil, err
@@ -64,12 +96,18 @@ func (g *RSAGenerator) GenerateKeyPair() ([]byte, []byte, error) {
 }
 
 // ECCGenerator generates an ECC key pair.
-type ECCGenerator struct{}
+type ECCGenerator struct {
+	// Curve is the elliptic curve of the keys, P-384 if nil.
+	Curve elliptic.Curve
+}
 
 // Generate generates a new ECCKeyPair.
 func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	curve := g.Curve
+	if curve == nil {
+		curve = elliptic.P384()
+	}
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +118,10 @@ func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
 	}, nil
 }
 
-func (g *ECCGenerator) GenerateKeyPair() ([]byte, []byte, error) {
+func (g *ECCGenerator) GenerateKeyPair(ctx context.Context) ([]byte, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
 	keyPair, err := g.Generate()
 	if err != nil {
 		return nil, nil, err
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"crypto/elliptic"
 	"errors"
 	"testing"
 )
@@ -48,3 +49,21 @@ func TestECCGenerator_Generate_StructIntegrity(t *testing.T) {
 		t.Fatalf("ECC public coordinates do not match private's public key")
 	}
 }
+
+func TestGenerators_ConfiguredKeySizes(t *testing.T) {
+	rsaKeyPair, err := (&RSAGenerator{Bits: 1024}).Generate()
+	if err != nil {
+		t.Fatalf("RSAGenerator.Generate error: %v", err)
+	}
+	if rsaKeyPair.Private.N.BitLen() != 1024 {
+		t.Fatalf("expected 1024 bit modulus, got %d", rsaKeyPair.Private.N.BitLen())
+	}
+
+	eccKeyPair, err := (&ECCGenerator{Curve: elliptic.P256()}).Generate()
+	if err != nil {
+		t.Fatalf("ECCGenerator.Generate error: %v", err)
+	}
+	if eccKeyPair.Private.Curve.Params().Name != "P-256" {
+		t.Fatalf("expected P-256 key, got %s", eccKeyPair.Private.Curve.Params().Name)
+	}
+}
@@ -52,3 +52,12 @@ func (m *RSAMarshaler) Unmarshal(privateKeyBytes []byte) (*RSAKeyPair, error) {
 		Public:  &privateKey.PublicKey,
 	}, nil
 }
+
+// UnmarshalPublic takes an encoded RSA public key and transforms it into a rsa.PublicKey.
+func (m *RSAMarshaler) UnmarshalPublic(publicKeyBytes []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(publicKeyBytes)
+	if block == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
@@ -34,10 +35,16 @@ func (s *SignerStore) Get(algorithm SignatureAlgorithm, privateKey []byte) (Sign
 	return signer(privateKey)
 }
 
+// Algorithms returns the registered algorithms in alphabetical order.
+func (s *SignerStore) Algorithms() []SignatureAlgorithm {
+	return sortedAlgorithms(s.signers)
+}
+
 // Signer defines a contract for different types of signing implementations.
 type Signer interface {
 	// Sign signs the given data.
-	Sign(dataToBeSigned []byte) ([]byte, error)
+	// Implementations backed by remote key custody must honour the cancellation and deadline of the context.
+	Sign(ctx context.Context, dataToBeSigned []byte) ([]byte, error)
 }
 
 // RSASigner implements the Signer interface for RSA keys.
@@ -56,10 +63,13 @@ func NewRSASigner(privateKey []byte) (Signer, error) {
 	}, nil
 }
 
-func (s *RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
+func (s *RSASigner) Sign(ctx context.Context, dataToBeSigned []byte) ([]byte, error) {
 	if s.privateKey == nil {
 		return nil, ErrUninitializedPrivateKey
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	// hash the data before signing
 	dataHash := sha256.New()
@@ -76,10 +86,13 @@ type ECCSigner struct {
 	privateKey *ecdsa.PrivateKey
 }
 
-func (s *ECCSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
+func (s *ECCSigner) Sign(ctx context.Context, dataToBeSigned []byte) ([]byte, error) {
 	if s.privateKey == nil {
 		return nil, ErrUninitializedPrivateKey
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	// hash the data before signing
 	dataHash := sha256.New()
 	_, err := dataHash.Write(dataToBeSigned)
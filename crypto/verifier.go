@@ -0,0 +1,102 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+)
+
+var (
+	ErrInvalidPublicKey = errors.New("invalid public key")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+type VerifierCreateFunc = func(publicKey []byte) (Verifier, error)
+
+// VerifierStore holds a map of supported signature algorithms and their respective VerifierCreateFunc functions.
+type VerifierStore struct {
+	verifiers map[SignatureAlgorithm]VerifierCreateFunc
+}
+
+func NewVerifierStore(verifiers map[SignatureAlgorithm]VerifierCreateFunc) VerifierStore {
+	return VerifierStore{
+		verifiers: verifiers,
+	}
+}
+
+// NewDefaultVerifierStore returns a VerifierStore with the verifiers of all the built-in algorithms.
+func NewDefaultVerifierStore() VerifierStore {
+	return NewVerifierStore(map[SignatureAlgorithm]VerifierCreateFunc{
+		RSA: NewRSAVerifier,
+		ECC: NewECCVerifier,
+	})
+}
+
+func (s *VerifierStore) Get(algorithm SignatureAlgorithm, publicKey []byte) (Verifier, error) {
+	verifier, ok := s.verifiers[algorithm]
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return verifier(publicKey)
+}
+
+// Algorithms returns the registered algorithms in alphabetical order.
+func (s *VerifierStore) Algorithms() []SignatureAlgorithm {
+	return sortedAlgorithms(s.verifiers)
+}
+
+// Verifier checks signatures created by the Signer of the same algorithm.
+type Verifier interface {
+	// Verify returns ErrInvalidSignature if signature is not a valid signature of data.
+	Verify(data []byte, signature []byte) error
+}
+
+// RSAVerifier implements the Verifier interface for RSA keys (RSASSA-PSS with SHA-256).
+type RSAVerifier struct {
+	publicKey *rsa.PublicKey
+}
+
+func NewRSAVerifier(publicKey []byte) (Verifier, error) {
+	marshaler := NewRSAMarshaler()
+	key, err := marshaler.UnmarshalPublic(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &RSAVerifier{
+		publicKey: key,
+	}, nil
+}
+
+func (v *RSAVerifier) Verify(data []byte, signature []byte) error {
+	hash := sha256.Sum256(data)
+	if err := rsa.VerifyPSS(v.publicKey, crypto.SHA256, hash[:], signature, nil); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ECCVerifier implements the Verifier interface for ECC keys (ECDSA with SHA-256).
+type ECCVerifier struct {
+	publicKey *ecdsa.PublicKey
+}
+
+func NewECCVerifier(publicKey []byte) (Verifier, error) {
+	marshaler := NewECCMarshaler()
+	key, err := marshaler.DecodePublic(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ECCVerifier{
+		publicKey: key,
+	}, nil
+}
+
+func (v *ECCVerifier) Verify(data []byte, signature []byte) error {
+	hash := sha256.Sum256(data)
+	if !ecdsa.VerifyASN1(v.publicKey, hash[:], signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVerifiers_VerifySignerSignatures(t *testing.T) {
+	cases := map[SignatureAlgorithm]struct {
+		generator KeyGenerator
+		signer    SignerCreateFunc
+		verifier  VerifierCreateFunc
+	}{
+		RSA: {&RSAGenerator{}, NewRSASigner, NewRSAVerifier},
+		ECC: {&ECCGenerator{}, NewECCSigner, NewECCVerifier},
+	}
+	for algorithm, c := range cases {
+		public, private, err := c.generator.GenerateKeyPair(context.Background())
+		if err != nil {
+			t.Fatalf("%s: GenerateKeyPair error: %v", algorithm, err)
+		}
+		signer, err := c.signer(private)
+		if err != nil {
+			t.Fatalf("%s: signer error: %v", algorithm, err)
+		}
+		signature, err := signer.Sign(context.Background(), []byte("data"))
+		if err != nil {
+			t.Fatalf("%s: Sign error: %v", algorithm, err)
+		}
+
+		store := NewVerifierStore(map[SignatureAlgorithm]VerifierCreateFunc{algorithm: c.verifier})
+		verifier, err := store.Get(algorithm, public)
+		if err != nil {
+			t.Fatalf("%s: verifier error: %v", algorithm, err)
+		}
+		if err := verifier.Verify([]byte("data"), signature); err != nil {
+			t.Fatalf("%s: expected valid signature, got %v", algorithm, err)
+		}
+		if err := verifier.Verify([]byte("other data"), signature); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("%s: expected ErrInvalidSignature for other data, got %v", algorithm, err)
+		}
+	}
+}
+
+func TestVerifiers_InvalidPublicKey(t *testing.T) {
+	if _, err := NewRSAVerifier([]byte("not a key")); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Fatalf("expected ErrInvalidPublicKey, got %v", err)
+	}
+	if _, err := NewECCVerifier([]byte("not a key")); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Fatalf("expected ErrInvalidPublicKey, got %v", err)
+	}
+	store := NewVerifierStore(nil)
+	if _, err := store.Get(RSA, nil); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Fatalf("expected ErrUnsupportedAlgorithm, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// apiKeyPrefix makes API keys recognizable, e.g. for secret scanners.
+	apiKeyPrefix = "ssk_"
+	// apiKeySecretSize is the number of random bytes in an API key.
+	apiKeySecretSize = 32
+)
+
+// APIKey is a credential of a tenant with a set of scopes.
+// Only the hash of the key is kept, the key itself is returned once on creation.
+type APIKey struct {
+	ID        string
+	TenantID  string
+	Name      string
+	Hash      string
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+// NewAPIKey creates a new APIKey and returns it together with the plaintext key.
+func NewAPIKey(tenantID string, name string, scopes []string) (*APIKey, string, error) {
+	secret := make([]byte, apiKeySecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	return &APIKey{
+		ID:        strings.ReplaceAll(uuid.New().String(), "-", ""),
+		TenantID:  tenantID,
+		Name:      name,
+		Hash:      HashAPIKey(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}, key, nil
+}
+
+// HashAPIKey returns the hash under which a plaintext API key is stored.
+// API keys are long random strings, so a plain SHA-256 is sufficient (no salting or stretching needed).
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
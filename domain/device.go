@@ -1,41 +1,107 @@
 package domain
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 	"strings"
 	"sync"
-	"sync/atomic"
 
 	"github.com/google/uuid"
 	"github.com/ksrichard/signing-service-challenge/crypto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/ksrichard/signing-service-challenge/domain")
+
+var (
+	ErrChainConflict   = errors.New("signature chain head was advanced concurrently")
+	ErrDeviceNotActive = errors.New("signature device is not active")
+	ErrInvalidState    = errors.New("invalid signature device state")
+)
+
+// DeviceState is the lifecycle state of a SignatureDevice.
+type DeviceState string
+
+const (
+	// StateActive devices sign data.
+	StateActive DeviceState = "active"
+	// StateSuspended devices are kept with their signature chain, but do not sign data.
+	StateSuspended DeviceState = "suspended"
+)
+
+// Valid checks if the state is a known device state.
+func (s DeviceState) Valid() bool {
+	return s == StateActive || s == StateSuspended
+}
+
+// PublicKeyVersion is a public key of a device, used for the signatures from FirstCounter on
+// until the next key version (if any) takes over.
+type PublicKeyVersion struct {
+	Version      uint64 `json:"version"`
+	PublicKey    []byte `json:"publicKey"`
+	FirstCounter uint64 `json:"firstCounter"`
+}
+
 // SignDataResult is the result of signing any data.
 type SignDataResult struct {
+	Counter    uint64
 	Signature  string
 	SignedData string
+	// KeyVersion is the version of the key the data was signed with.
+	KeyVersion uint64
+}
+
+// ChainHead is the current position of a device in its signature chain.
+type ChainHead struct {
+	Counter       uint64
+	LastSignature string
+}
+
+// SignatureDeviceRecord is the persistable state of a SignatureDevice.
+type SignatureDeviceRecord struct {
+	ID            uuid.UUID
+	TenantID      string
+	Algorithm     crypto.SignatureAlgorithm
+	PrivateKey    []byte
+	PublicKey     []byte
+	Label         string
+	State         DeviceState
+	Counter       uint64
+	LastSignature string
+	// Keys is the public key history of the device, the last version belongs to PrivateKey.
+	Keys []PublicKeyVersion
 }
 
 // SignatureDevice is a device that stores public/private keys and can sign data with them.
 type SignatureDevice struct {
-	ID                 uuid.UUID
-	Algorithm          crypto.SignatureAlgorithm
-	privateKey         []byte
-	PublicKey          []byte
-	Label              string
-	signatureCounter   atomic.Uint64
-	generator          crypto.KeyGenerator
-	signer             crypto.Signer
-	lastSignature      string
-	lastSignatureMutex sync.RWMutex
+	ID         uuid.UUID
+	TenantID   string
+	Algorithm  crypto.SignatureAlgorithm
+	privateKey []byte
+	PublicKey  []byte
+	Label      string
+	State      DeviceState
+	keys       []PublicKeyVersion
+	signer     crypto.Signer
+	head       ChainHead
+	headMutex  sync.RWMutex
+	signMutex  sync.Mutex
 }
 
 // NewSignatureDevice creates a new SignatureDevice.
 // Here we generate a new key pair (based on the given algorithm) and a new signer with the private key.
 func NewSignatureDevice(
+	ctx context.Context,
 	keyGeneratorStore *crypto.KeyGeneratorStore,
 	signerStore *crypto.SignerStore,
+	tenantID string,
 	algorithm crypto.SignatureAlgorithm,
 	label string,
 ) (*SignatureDevice, error) {
@@ -45,7 +111,7 @@ func NewSignatureDevice(
 		return nil, err
 	}
 
-	public, private, err := generator.GenerateKeyPair()
+	public, private, err := generator.GenerateKeyPair(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -57,35 +123,200 @@ func NewSignatureDevice(
 	}
 
 	return &SignatureDevice{
-		ID:                 uuid.New(),
-		Algorithm:          algorithm,
-		privateKey:         private,
-		PublicKey:          public,
-		Label:              label,
-		signatureCounter:   atomic.Uint64{},
-		generator:          generator,
-		signer:             signer,
-		lastSignature:      "",
-		lastSignatureMutex: sync.RWMutex{},
+		ID:         uuid.New(),
+		TenantID:   tenantID,
+		Algorithm:  algorithm,
+		privateKey: private,
+		PublicKey:  public,
+		Label:      label,
+		State:      StateActive,
+		keys:       []PublicKeyVersion{{Version: 1, PublicKey: public}},
+		signer:     signer,
+	}, nil
+}
+
+// RestoreSignatureDevice rebuilds a SignatureDevice from its persisted record.
+func RestoreSignatureDevice(signerStore *crypto.SignerStore, record SignatureDeviceRecord) (*SignatureDevice, error) {
+	signer, err := signerStore.Get(record.Algorithm, record.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	// records persisted before states were introduced belong to active devices
+	state := record.State
+	if state == "" {
+		state = StateActive
+	}
+	// as well as to devices whose key was never rotated
+	keys := record.Keys
+	if len(keys) == 0 {
+		keys = []PublicKeyVersion{{Version: 1, PublicKey: record.PublicKey}}
+	}
+
+	return &SignatureDevice{
+		ID:         record.ID,
+		TenantID:   record.TenantID,
+		Algorithm:  record.Algorithm,
+		privateKey: record.PrivateKey,
+		PublicKey:  record.PublicKey,
+		Label:      record.Label,
+		State:      state,
+		keys:       keys,
+		signer:     signer,
+		head: ChainHead{
+			Counter:       record.Counter,
+			LastSignature: record.LastSignature,
+		},
 	}, nil
 }
 
+// Record returns the persistable state of the device.
+func (d *SignatureDevice) Record() SignatureDeviceRecord {
+	head := d.Head()
+	return SignatureDeviceRecord{
+		ID:            d.ID,
+		TenantID:      d.TenantID,
+		Algorithm:     d.Algorithm,
+		PrivateKey:    d.privateKey,
+		PublicKey:     d.PublicKey,
+		Label:         d.Label,
+		State:         d.State,
+		Counter:       head.Counter,
+		LastSignature: head.LastSignature,
+		Keys:          d.PublicKeys(),
+	}
+}
+
+// PublicKeys returns the public key history of the device, oldest first.
+func (d *SignatureDevice) PublicKeys() []PublicKeyVersion {
+	return slices.Clone(d.keys)
+}
+
+// KeyVersion returns the version of the current key of the device.
+func (d *SignatureDevice) KeyVersion() uint64 {
+	return d.keys[len(d.keys)-1].Version
+}
+
+// PublicKeyAt returns the public key the signature with the given counter was created with.
+func (d *SignatureDevice) PublicKeyAt(counter uint64) []byte {
+	for i := len(d.keys) - 1; i > 0; i-- {
+		if counter >= d.keys[i].FirstCounter {
+			return d.keys[i].PublicKey
+		}
+	}
+	return d.keys[0].PublicKey
+}
+
+// WithState returns a copy of the device in the given state, the device itself is left unchanged.
+func (d *SignatureDevice) WithState(state DeviceState) (*SignatureDevice, error) {
+	if !state.Valid() {
+		return nil, ErrInvalidState
+	}
+	record := d.Record()
+	record.State = state
+	return d.restore(record), nil
+}
+
+// WithKey returns a copy of the device which signs with the given new key pair from its current chain head on.
+// The device itself is left unchanged, the copy has to be committed to replace it (see RotateKey of the stores).
+func (d *SignatureDevice) WithKey(signerStore *crypto.SignerStore, public []byte, private []byte) (*SignatureDevice, error) {
+	signer, err := signerStore.Get(d.Algorithm, private)
+	if err != nil {
+		return nil, err
+	}
+	record := d.Record()
+	record.PrivateKey = private
+	record.PublicKey = public
+	record.Keys = append(record.Keys, PublicKeyVersion{
+		Version:      d.KeyVersion() + 1,
+		PublicKey:    public,
+		FirstCounter: record.Counter,
+	})
+	rotated := d.restore(record)
+	rotated.signer = signer
+	return rotated, nil
+}
+
+// restore creates a device from a record derived from d, keeping the signer of d.
+func (d *SignatureDevice) restore(record SignatureDeviceRecord) *SignatureDevice {
+	return &SignatureDevice{
+		ID:         record.ID,
+		TenantID:   record.TenantID,
+		Algorithm:  record.Algorithm,
+		privateKey: record.PrivateKey,
+		PublicKey:  record.PublicKey,
+		Label:      record.Label,
+		State:      record.State,
+		keys:       record.Keys,
+		signer:     d.signer,
+		head: ChainHead{
+			Counter:       record.Counter,
+			LastSignature: record.LastSignature,
+		},
+	}
+}
+
 func (d *SignatureDevice) GetIDStr() string {
 	return strings.ReplaceAll(d.ID.String(), "-", "")
 }
 
+// LogValue implements slog.LogValuer, so logging a device never includes its key material.
+func (d *SignatureDevice) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", d.GetIDStr()),
+		slog.String("tenant_id", d.TenantID),
+		slog.String("algorithm", string(d.Algorithm)),
+		slog.String("label", d.Label),
+		slog.String("state", string(d.State)),
+		slog.Uint64("counter", d.GetSignatureCounter()),
+	)
+}
+
 func (d *SignatureDevice) GetSignatureCounter() uint64 {
-	return d.signatureCounter.Load()
+	return d.Head().Counter
+}
+
+// Head returns the current chain head of the device.
+func (d *SignatureDevice) Head() ChainHead {
+	d.headMutex.RLock()
+	defer d.headMutex.RUnlock()
+	return d.head
+}
+
+// Advance moves the chain head past the given result.
+// It fails with ErrDeviceNotActive if the device is not active and with ErrChainConflict
+// if the head is no longer at the counter or the key the result was signed with.
+func (d *SignatureDevice) Advance(result SignDataResult) error {
+	return d.AdvanceBatch([]SignDataResult{result})
+}
+
+// AdvanceBatch moves the chain head past the given consecutive results (see SignBatchAt), all or none of them.
+// It fails like Advance, and with ErrChainConflict if the results are not consecutive.
+func (d *SignatureDevice) AdvanceBatch(results []SignDataResult) error {
+	if d.State != StateActive {
+		return ErrDeviceNotActive
+	}
+	d.headMutex.Lock()
+	defer d.headMutex.Unlock()
+	head := d.head
+	for _, result := range results {
+		if head.Counter != result.Counter || d.KeyVersion() != result.KeyVersion {
+			return ErrChainConflict
+		}
+		head = ChainHead{
+			Counter:       result.Counter + 1,
+			LastSignature: result.Signature,
+		}
+	}
+	d.head = head
+	return nil
 }
 
 func (d *SignatureDevice) base64Encode(data []byte) string {
 	return base64.StdEncoding.EncodeToString(data)
 }
 
-func (d *SignatureDevice) signedData(data string) (string, error) {
-	d.lastSignatureMutex.RLock()
-	lastSig := d.lastSignature
-	d.lastSignatureMutex.RUnlock()
+func (d *SignatureDevice) signedData(head ChainHead, data string) (string, error) {
+	lastSig := head.LastSignature
 	if lastSig == "" {
 		idBytes, err := d.ID.MarshalBinary()
 		if err != nil {
@@ -93,30 +324,88 @@ func (d *SignatureDevice) signedData(data string) (string, error) {
 		}
 		lastSig = d.base64Encode(idBytes)
 	}
-	return fmt.Sprintf("%d_%s_%s", d.signatureCounter.Load(), data, lastSig), nil
+	return fmt.Sprintf("%d_%s_%s", head.Counter, data, lastSig), nil
 }
 
-func (d *SignatureDevice) SignData(data string) (SignDataResult, error) {
-	signedData, err := d.signedData(data)
+// SignDataAt signs data as the chain entry following the given head, without advancing the device.
+// The result has to be committed (see Advance) to become part of the chain.
+// Only active devices sign data, others fail with ErrDeviceNotActive.
+func (d *SignatureDevice) SignDataAt(ctx context.Context, head ChainHead, data string) (SignDataResult, error) {
+	ctx, span := tracer.Start(ctx, "SignatureDevice.SignDataAt", trace.WithAttributes(
+		attribute.String("device.id", d.GetIDStr()),
+		attribute.String("signature.algorithm", string(d.Algorithm)),
+		attribute.Int64("signature.counter", int64(head.Counter)),
+	))
+	defer span.End()
+
+	if d.State != StateActive {
+		span.SetStatus(codes.Error, ErrDeviceNotActive.Error())
+		return SignDataResult{}, ErrDeviceNotActive
+	}
+
+	signedData, err := d.signedData(head, data)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		return SignDataResult{}, err
 	}
 
-	signature, err := d.signer.Sign([]byte(signedData))
+	signature, err := d.signer.Sign(ctx, []byte(signedData))
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		return SignDataResult{}, err
 	}
-	signatureB64 := d.base64Encode(signature)
-
-	// setting last signature and increase signature counter
-	d.lastSignatureMutex.Lock()
-	d.lastSignature = signatureB64
-	d.lastSignatureMutex.Unlock()
-
-	d.signatureCounter.Add(1)
 
 	return SignDataResult{
-		Signature:  signatureB64,
+		Counter:    head.Counter,
+		Signature:  d.base64Encode(signature),
 		SignedData: signedData,
+		KeyVersion: d.KeyVersion(),
 	}, nil
 }
+
+// SignBatchAt signs the data items in order as consecutive chain entries following the given head, each linked to
+// the signature of the one before, without advancing the device. The results have to be committed together
+// (see AdvanceBatch) to become part of the chain.
+func (d *SignatureDevice) SignBatchAt(ctx context.Context, head ChainHead, data []string) ([]SignDataResult, error) {
+	ctx, span := tracer.Start(ctx, "SignatureDevice.SignBatchAt", trace.WithAttributes(
+		attribute.String("device.id", d.GetIDStr()),
+		attribute.Int64("signature.counter", int64(head.Counter)),
+		attribute.Int("batch.size", len(data)),
+	))
+	defer span.End()
+
+	results := make([]SignDataResult, 0, len(data))
+	for _, item := range data {
+		result, err := d.SignDataAt(ctx, head, item)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		results = append(results, result)
+		head = ChainHead{Counter: result.Counter + 1, LastSignature: result.Signature}
+	}
+	return results, nil
+}
+
+// SignData signs data at the current chain head and advances the device.
+func (d *SignatureDevice) SignData(ctx context.Context, data string) (SignDataResult, error) {
+	ctx, span := tracer.Start(ctx, "SignatureDevice.SignData", trace.WithAttributes(
+		attribute.String("device.id", d.GetIDStr()),
+	))
+	defer span.End()
+
+	d.signMutex.Lock()
+	defer d.signMutex.Unlock()
+
+	result, err := d.SignDataAt(ctx, d.Head(), data)
+	if err != nil {
+		return SignDataResult{}, err
+	}
+
+	// setting last signature and increase signature counter
+	if err := d.Advance(result); err != nil {
+		return SignDataResult{}, err
+	}
+
+	return result, nil
+}
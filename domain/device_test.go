@@ -1,7 +1,10 @@
 package domain
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -22,7 +25,7 @@ func newStores() (crypto.KeyGeneratorStore, crypto.SignerStore) {
 
 func TestNewSignatureDeviceAndSignDataFlow_RSA(t *testing.T) {
 	kg, ss := newStores()
-	dev, err := NewSignatureDevice(&kg, &ss, crypto.RSA, "label")
+	dev, err := NewSignatureDevice(context.Background(), &kg, &ss, DefaultTenantID, crypto.RSA, "label")
 	if err != nil {
 		t.Fatalf("NewSignatureDevice RSA error: %v", err)
 	}
@@ -35,7 +38,7 @@ func TestNewSignatureDeviceAndSignDataFlow_RSA(t *testing.T) {
 	}
 
 	// First signature: last signature should be base64 of UUID bytes
-	res1, err := dev.SignData("hello")
+	res1, err := dev.SignData(context.Background(), "hello")
 	if err != nil {
 		t.Fatalf("SignData 1 error: %v", err)
 	}
@@ -62,7 +65,7 @@ func TestNewSignatureDeviceAndSignDataFlow_RSA(t *testing.T) {
 	}
 
 	// Second signature: last signature should equal previous signature (base64)
-	res2, err := dev.SignData("world")
+	res2, err := dev.SignData(context.Background(), "world")
 	if err != nil {
 		t.Fatalf("SignData 2 error: %v", err)
 	}
@@ -83,12 +86,122 @@ func TestNewSignatureDeviceAndSignDataFlow_RSA(t *testing.T) {
 
 func TestNewSignatureDevice_ECC(t *testing.T) {
 	kg, ss := newStores()
-	dev, err := NewSignatureDevice(&kg, &ss, crypto.ECC, "ecc")
+	dev, err := NewSignatureDevice(context.Background(), &kg, &ss, DefaultTenantID, crypto.ECC, "ecc")
 	if err != nil {
 		t.Fatalf("NewSignatureDevice ECC error: %v", err)
 	}
 	// quick sign to ensure signer works
-	if _, err := dev.SignData("x"); err != nil {
+	if _, err := dev.SignData(context.Background(), "x"); err != nil {
 		t.Fatalf("ECC SignData error: %v", err)
 	}
 }
+
+func TestSignatureDevice_SuspendedDoesNotSign(t *testing.T) {
+	kg, ss := newStores()
+	dev, err := NewSignatureDevice(context.Background(), &kg, &ss, DefaultTenantID, crypto.ECC, "label")
+	if err != nil {
+		t.Fatalf("NewSignatureDevice error: %v", err)
+	}
+	if _, err := dev.WithState("broken"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected ErrInvalidState, got %v", err)
+	}
+	suspended, err := dev.WithState(StateSuspended)
+	if err != nil {
+		t.Fatalf("WithState error: %v", err)
+	}
+	if dev.State != StateActive {
+		t.Fatalf("WithState must not change the original device")
+	}
+	if _, err := suspended.SignData(context.Background(), "data"); !errors.Is(err, ErrDeviceNotActive) {
+		t.Fatalf("expected ErrDeviceNotActive, got %v", err)
+	}
+}
+
+func TestSignatureDevice_WithKey(t *testing.T) {
+	kg, ss := newStores()
+	dev, err := NewSignatureDevice(context.Background(), &kg, &ss, DefaultTenantID, crypto.ECC, "label")
+	if err != nil {
+		t.Fatalf("NewSignatureDevice error: %v", err)
+	}
+	first, err := dev.SignData(context.Background(), "first")
+	if err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+
+	generator, _ := kg.Get(crypto.ECC)
+	public, private, err := generator.GenerateKeyPair(context.Background())
+	if err != nil {
+		t.Fatalf("GenerateKeyPair error: %v", err)
+	}
+	rotated, err := dev.WithKey(&ss, public, private)
+	if err != nil {
+		t.Fatalf("WithKey error: %v", err)
+	}
+	if dev.KeyVersion() != 1 || rotated.KeyVersion() != 2 || len(rotated.PublicKeys()) != 2 {
+		t.Fatalf("unexpected key versions: %d, %d", dev.KeyVersion(), rotated.KeyVersion())
+	}
+
+	// a result signed with the previous key is not committed to the rotated device
+	stale, err := dev.SignDataAt(context.Background(), dev.Head(), "stale")
+	if err != nil {
+		t.Fatalf("SignDataAt error: %v", err)
+	}
+	if err := rotated.Advance(stale); !errors.Is(err, ErrChainConflict) {
+		t.Fatalf("expected ErrChainConflict, got %v", err)
+	}
+
+	second, err := rotated.SignData(context.Background(), "second")
+	if err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+	if second.KeyVersion != 2 || !strings.HasSuffix(second.SignedData, "_"+first.Signature) {
+		t.Fatalf("the chain must continue with the new key, got %+v", second)
+	}
+	if string(rotated.PublicKeyAt(first.Counter)) != string(dev.PublicKey) || string(rotated.PublicKeyAt(second.Counter)) != string(public) {
+		t.Fatalf("PublicKeyAt returned the wrong key version")
+	}
+
+	restored, err := RestoreSignatureDevice(&ss, rotated.Record())
+	if err != nil {
+		t.Fatalf("RestoreSignatureDevice error: %v", err)
+	}
+	if restored.KeyVersion() != 2 || string(restored.PublicKeyAt(0)) != string(dev.PublicKey) {
+		t.Fatalf("key history was not restored")
+	}
+}
+
+func TestSignatureDevice_SignBatchAt(t *testing.T) {
+	kg, ss := newStores()
+	dev, err := NewSignatureDevice(context.Background(), &kg, &ss, DefaultTenantID, crypto.ECC, "batch")
+	if err != nil {
+		t.Fatalf("NewSignatureDevice error: %v", err)
+	}
+	if _, err := dev.SignData(context.Background(), "first"); err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+
+	results, err := dev.SignBatchAt(context.Background(), dev.Head(), []string{"a", "b", "c"})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("SignBatchAt error: %v", err)
+	}
+	if dev.GetSignatureCounter() != 1 {
+		t.Fatalf("SignBatchAt must not advance the device, got counter %d", dev.GetSignatureCounter())
+	}
+	for i, result := range results {
+		if result.Counter != uint64(i+1) || !strings.HasPrefix(result.SignedData, fmt.Sprintf("%d_%s_", i+1, []string{"a", "b", "c"}[i])) {
+			t.Fatalf("unexpected result %d: %+v", i, result)
+		}
+		if i > 0 && !strings.HasSuffix(result.SignedData, "_"+results[i-1].Signature) {
+			t.Fatalf("result %d is not linked to the one before", i)
+		}
+	}
+
+	// the results advance the head together, or not at all
+	reordered := []SignDataResult{results[0], results[2], results[1]}
+	if err := dev.AdvanceBatch(reordered); !errors.Is(err, ErrChainConflict) || dev.GetSignatureCounter() != 1 {
+		t.Fatalf("expected ErrChainConflict without advancing, got %v", err)
+	}
+	if err := dev.AdvanceBatch(results); err != nil || dev.Head() != (ChainHead{Counter: 4, LastSignature: results[2].Signature}) {
+		t.Fatalf("expected the head past the batch, got %+v: %v", dev.Head(), err)
+	}
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType names something that happened to a signature device.
+type EventType string
+
+const (
+	EventDeviceCreated      EventType = "device.created"
+	EventDeviceStateChanged EventType = "device.state_changed"
+	EventDeviceKeyRotated   EventType = "device.key_rotated"
+	EventSignatureCreated   EventType = "signature.created"
+)
+
+// EventTypes lists every known event type.
+var EventTypes = []EventType{EventDeviceCreated, EventDeviceStateChanged, EventDeviceKeyRotated, EventSignatureCreated}
+
+// IsValidEventType checks if the given event type is known.
+func IsValidEventType(eventType EventType) bool {
+	return slices.Contains(EventTypes, eventType)
+}
+
+// Event is something that happened to a signature device of a tenant.
+type Event struct {
+	ID       string
+	Type     EventType
+	TenantID string
+	DeviceID string
+	Time     time.Time
+	// Data is the JSON serializable payload of the event, depending on its type.
+	Data any
+}
+
+// NewEvent creates a new Event which happened now.
+func NewEvent(eventType EventType, tenantID string, deviceID string, data any) Event {
+	return Event{
+		ID:       strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Type:     eventType,
+		TenantID: tenantID,
+		DeviceID: deviceID,
+		Time:     time.Now().UTC(),
+		Data:     data,
+	}
+}
+
+// EventPublisher receives the events of signature devices.
+// Publish must not block the operation the event originates from.
+type EventPublisher interface {
+	Publish(event Event)
+}
+
+// EventPublishers publishes every event to each of its publishers in turn.
+type EventPublishers []EventPublisher
+
+func (p EventPublishers) Publish(event Event) {
+	for _, publisher := range p {
+		publisher.Publish(event)
+	}
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultIdempotencyRetention is how long idempotency keys are kept by default.
+	DefaultIdempotencyRetention = 24 * time.Hour
+	// MaxIdempotencyKeyLength is the maximum length of an idempotency key in bytes.
+	MaxIdempotencyKeyLength = 255
+)
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
+// IdempotencyRecord remembers the signature created for a request with an idempotency key, so retries of the
+// request return it instead of signing again. Idempotency keys are scoped per device.
+type IdempotencyRecord struct {
+	Key string
+	// RequestHash identifies the payload of the request the key was first used with, see IdempotencyRequestHash.
+	RequestHash string
+	Result      SignDataResult
+	ExpiresAt   time.Time
+}
+
+// IdempotencyRequestHash returns the hash identifying the payload of a signature request.
+func IdempotencyRequestHash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// Expired reports whether the record is past its retention at the given time.
+func (r IdempotencyRecord) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "errors"
+
+const (
+	// DefaultTenantID is the tenant used when a request does not name one.
+	DefaultTenantID = "default"
+)
+
+var (
+	ErrTenantQuotaExceeded = errors.New("tenant signature device quota exceeded")
+)
+
+// Tenant is an organization (e.g. a merchant) that owns signature devices.
+// Devices of one tenant are never visible to another tenant.
+type Tenant struct {
+	ID string
+	// MaxDevices is the maximum number of signature devices the tenant may own, 0 means unlimited.
+	MaxDevices int
+}
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// webhookSecretPrefix makes webhook secrets recognizable, following the Standard Webhooks convention.
+	webhookSecretPrefix = "whsec_"
+	// webhookSecretSize is the number of random bytes in a webhook secret.
+	webhookSecretSize = 32
+)
+
+// WebhookEndpoint is an HTTPS endpoint of a tenant which is notified of the subscribed event types.
+// The secret signs the deliveries, it is returned once on creation.
+type WebhookEndpoint struct {
+	ID         string
+	TenantID   string
+	URL        string
+	EventTypes []EventType
+	Secret     string
+	CreatedAt  time.Time
+}
+
+// NewWebhookEndpoint creates a new WebhookEndpoint with a random secret.
+func NewWebhookEndpoint(tenantID string, url string, eventTypes []EventType) (*WebhookEndpoint, error) {
+	secret := make([]byte, webhookSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &WebhookEndpoint{
+		ID:         strings.ReplaceAll(uuid.New().String(), "-", ""),
+		TenantID:   tenantID,
+		URL:        url,
+		EventTypes: eventTypes,
+		Secret:     webhookSecretPrefix + base64.StdEncoding.EncodeToString(secret),
+		CreatedAt:  time.Now().UTC(),
+	}, nil
+}
+
+// Subscribes checks if the endpoint is notified of the given event type.
+func (e *WebhookEndpoint) Subscribes(eventType EventType) bool {
+	return slices.Contains(e.EventTypes, eventType)
+}
+
+// DeadLetter is a webhook delivery which failed every attempt. It keeps the payload, so it can be replayed.
+type DeadLetter struct {
+	ID         string
+	TenantID   string
+	EndpointID string
+	URL        string
+	EventID    string
+	EventType  EventType
+	Payload    json.RawMessage
+	Attempts   int
+	LastError  string
+	FailedAt   time.Time
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+
+	// Redacted replaces the values of sensitive attributes.
+	Redacted = "[REDACTED]"
+)
+
+// sensitiveKeys are attribute keys whose values must never reach the logs,
+// such as signed payloads, signatures, key material and credentials.
+var sensitiveKeys = map[string]bool{
+	"data":          true,
+	"signed_data":   true,
+	"signature":     true,
+	"private_key":   true,
+	"public_key":    true,
+	"key":           true,
+	"api_key":       true,
+	"authorization": true,
+	"token":         true,
+	"password":      true,
+	"secret":        true,
+}
+
+// Config configures the logger.
+type Config struct {
+	// Level is one of debug, info, warn or error.
+	Level string
+	// Format is FormatJSON or FormatText.
+	Format string
+}
+
+// New creates a structured logger writing to w, sensitive attributes are redacted.
+func New(w io.Writer, config Config) (*slog.Logger, error) {
+	level, err := ParseLevel(config.Level)
+	if err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}
+
+	switch strings.ToLower(config.Format) {
+	case FormatJSON, "":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", config.Format)
+}
+
+// ParseLevel parses a log level name, an empty name is info.
+func ParseLevel(name string) (slog.Level, error) {
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// redact replaces the values of sensitive attributes, it is used as slog.HandlerOptions.ReplaceAttr.
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
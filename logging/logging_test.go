@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew_RedactsSensitiveAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Config{Level: "debug", Format: FormatJSON})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	logger.Debug("signed", "device_id", "abc", "data", "secret payload", slog.Group("device", "private_key", "-----BEGIN"))
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("unmarshal log entry: %v", err)
+	}
+	if entry["device_id"] != "abc" {
+		t.Fatalf("expected device_id to be logged, got %v", entry)
+	}
+	if entry["data"] != Redacted {
+		t.Fatalf("expected data to be redacted, got %v", entry["data"])
+	}
+	if strings.Contains(buf.String(), "secret payload") || strings.Contains(buf.String(), "BEGIN") {
+		t.Fatalf("sensitive values reached the log: %s", buf.String())
+	}
+}
+
+func TestNew_LevelAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Config{Level: "warn", Format: FormatText})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown", "device_id", "abc")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "msg=shown device_id=abc") {
+		t.Fatalf("unexpected text output: %s", buf.String())
+	}
+
+	if _, err := New(&buf, Config{Level: "loud"}); err == nil {
+		t.Fatalf("expected error for unknown level")
+	}
+	if _, err := New(&buf, Config{Format: "xml"}); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
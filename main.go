@@ -1,45 +1,296 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ksrichard/signing-service-challenge/api"
+	"github.com/ksrichard/signing-service-challenge/auth"
+	"github.com/ksrichard/signing-service-challenge/config"
 	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/logging"
+	"github.com/ksrichard/signing-service-challenge/metrics"
 	"github.com/ksrichard/signing-service-challenge/persistence"
-)
-
-const (
-	ListenAddress = ":8080"
+	"github.com/ksrichard/signing-service-challenge/ratelimit"
+	"github.com/ksrichard/signing-service-challenge/stream"
+	"github.com/ksrichard/signing-service-challenge/tracing"
+	"github.com/ksrichard/signing-service-challenge/webhook"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
-	// init stores
-	signerStore := crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
-		crypto.RSA: func(privateKey []byte) (crypto.Signer, error) {
-			return crypto.NewRSASigner(privateKey)
-		},
-		crypto.ECC: func(privateKey []byte) (crypto.Signer, error) {
-			return crypto.NewECCSigner(privateKey)
-		},
-	})
-	keyGeneratorStore := crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{
-		crypto.RSA: &crypto.RSAGenerator{},
-		crypto.ECC: &crypto.ECCGenerator{},
-	})
-	deviceStore := persistence.NewInMemorySignatureDeviceStore()
+	cfg, err := config.Load(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	logger, err := logging.New(os.Stderr, logging.Config{Level: cfg.Logging.Level, Format: cfg.Logging.Format})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid logging configuration:", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	// init tracing
+	tracingConfig := tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		File:        cfg.Tracing.File,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	}
+	exporter, err := tracing.NewExporter(context.Background(), tracingConfig)
+	if err != nil {
+		fatal("Could not create trace exporter", "error", err)
+	}
+	shutdownTracing := tracing.Setup(exporter, tracingConfig)
+
+	// init stores, instrumented for the metrics and traces
+	serviceMetrics := metrics.New()
+	signerStore, keyGeneratorStore := newCryptoStores(cfg.Algorithms, serviceMetrics)
+	memoryStore := persistence.NewInMemorySignatureDeviceStore()
+	memoryStore.SetSignatureLogRetention(cfg.Store.SignatureLogRetention)
+	var deviceStore persistence.SignatureDeviceStore = memoryStore
+	var webhookStore persistence.WebhookStore = persistence.NewInMemoryWebhookStore()
+	var deadLetterStore persistence.DeadLetterStore = persistence.NewInMemoryDeadLetterStore()
+	var apiKeyStore persistence.APIKeyStore = persistence.NewInMemoryAPIKeyStore()
+	if cfg.Store.Backend == config.StoreRedis {
+		options, err := redis.ParseURL(cfg.Store.DSN)
+		if err != nil {
+			fatal("Invalid store DSN", "error", err)
+		}
+		if cfg.Store.Password != "" {
+			options.Password = cfg.Store.Password
+		}
+		redisClient := redis.NewClient(options)
+		redisStore := persistence.NewRedisSignatureDeviceStore(redisClient, &signerStore)
+		redisStore.SetSignatureLogRetention(cfg.Store.SignatureLogRetention)
+		deviceStore = redisStore
+		webhookStore = persistence.NewRedisWebhookStore(redisClient)
+		deadLetterStore = persistence.NewRedisDeadLetterStore(redisClient)
+		apiKeyStore = persistence.NewRedisAPIKeyStore(redisClient)
+	}
+	tenants := make([]domain.Tenant, len(cfg.Tenants))
+	for i, tenant := range cfg.Tenants {
+		tenants[i] = domain.Tenant{ID: tenant.ID, MaxDevices: tenant.MaxDevices}
+	}
+	tenantStore := persistence.NewInMemoryTenantStore(tenants...)
+	// counting the devices on scrapes is not recorded as store operations
+	serviceMetrics.RegisterDeviceCollector(tenantStore, deviceStore)
+	deviceStore = tracing.InstrumentStore(serviceMetrics.InstrumentStore(deviceStore))
+
+	// init authentication
+	if err := addAdminAPIKeys(apiKeyStore, cfg.Auth.AdminAPIKeys); err != nil {
+		fatal("Invalid admin api keys", "error", err)
+	}
+	var authenticator auth.Authenticator
+	switch cfg.Auth.Mode {
+	case config.AuthAPIKey:
+		authenticator = auth.NewAPIKeyAuthenticator(apiKeyStore)
+	case config.AuthJWT:
+		jwks := cfg.Auth.JWT.JWKS
+		var keys auth.KeyProvider
+		if strings.HasPrefix(jwks, "https://") || strings.HasPrefix(jwks, "http://") {
+			keys = auth.NewRemoteKeyProvider(jwks, &http.Client{Timeout: 10 * time.Second})
+		} else if keys, err = auth.LoadJWKSFile(jwks); err != nil {
+			fatal("Could not load JWKS", "error", err)
+		}
+		authenticator = auth.NewJWTAuthenticator(auth.JWTConfig{
+			Issuer:      cfg.Auth.JWT.Issuer,
+			Audience:    cfg.Auth.JWT.Audience,
+			TenantClaim: cfg.Auth.JWT.TenantClaim,
+			ScopeClaim:  cfg.Auth.JWT.ScopeClaim,
+			Leeway:      time.Duration(cfg.Auth.JWT.Leeway),
+		}, keys)
+	case config.AuthNone:
+		slog.Warn("Authentication is disabled, every endpoint is open to anyone who can reach the server")
+	}
+
+	// init TLS
+	var tlsConfig *tls.Config
+	if cfg.TLS.CertFile != "" {
+		tlsConfig, err = api.NewTLSConfig(api.TLSParams{
+			CertFile:          cfg.TLS.CertFile,
+			KeyFile:           cfg.TLS.KeyFile,
+			ClientCAFile:      cfg.TLS.ClientCAFile,
+			RequireClientCert: cfg.TLS.RequireClientCert,
+			ReloadInterval:    time.Duration(cfg.TLS.ReloadInterval),
+		})
+		if err != nil {
+			fatal("Invalid TLS configuration", "error", err)
+		}
+	}
+	if cfg.TLS.ClientIdentitiesFile != "" {
+		mappings, err := auth.LoadCertificateMappings(cfg.TLS.ClientIdentitiesFile)
+		if err != nil {
+			fatal("Could not load client certificate identities", "error", err)
+		}
+		certificateAuthenticator, err := auth.NewCertificateAuthenticator(mappings)
+		if err != nil {
+			fatal("Invalid client certificate identities", "error", err)
+		}
+		// client certificates take precedence, other credentials remain usable
+		if authenticator != nil {
+			authenticator = auth.Chain{certificateAuthenticator, authenticator}
+		} else {
+			authenticator = certificateAuthenticator
+		}
+	}
 
 	// init server
 	params := api.ServerParams{
-		ListenAddress:     ListenAddress,
+		ListenAddress:     cfg.Server.ListenAddress,
+		GRPCListenAddress: cfg.Server.GRPCListenAddress,
 		SignerStore:       signerStore,
 		KeyGeneratorStore: keyGeneratorStore,
+		VerifierStore:     crypto.NewDefaultVerifierStore(),
 		DeviceStore:       deviceStore,
+		TenantStore:       tenantStore,
+		APIKeyStore:       apiKeyStore,
+		WebhookStore:      webhookStore,
+		DeadLetterStore:   deadLetterStore,
+		Authenticator:     authenticator,
+		TLSConfig:         tlsConfig,
+		RateLimits:        rateLimitParams(cfg.RateLimits),
+		Logger:            logger,
+		HTTP: api.HTTPParams{
+			ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+			ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+			WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+			IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+			MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+			MaxBodyBytes:      cfg.Server.MaxBodyBytes,
+			ShutdownTimeout:   time.Duration(cfg.Server.ShutdownTimeout),
+		},
+		Config:  cfg.Redacted(),
+		Metrics: serviceMetrics,
+		Webhooks: webhook.Config{
+			MaxAttempts:    cfg.Webhooks.MaxAttempts,
+			InitialBackoff: time.Duration(cfg.Webhooks.InitialBackoff),
+			MaxBackoff:     time.Duration(cfg.Webhooks.MaxBackoff),
+			Timeout:        time.Duration(cfg.Webhooks.Timeout),
+			Workers:        cfg.Webhooks.Workers,
+		},
+		IdempotencyRetention: time.Duration(cfg.Store.IdempotencyRetention),
+		Streams: stream.Config{
+			Buffer:     cfg.Streams.Buffer,
+			History:    cfg.Streams.History,
+			HistoryTTL: time.Duration(cfg.Streams.HistoryTTL),
+			Heartbeat:  time.Duration(cfg.Streams.Heartbeat),
+			Poll:       time.Duration(cfg.Streams.Poll),
+		},
 	}
 	server := api.NewServer(params)
 
-	log.Printf("Starting server on %s...\n", ListenAddress)
+	slog.Info("Starting server", "address", cfg.Server.ListenAddress, "grpc_address", cfg.Server.GRPCListenAddress, "tls", tlsConfig != nil,
+		"store", cfg.Store.Backend, "auth", cfg.Auth.Mode)
+
+	// SIGINT and SIGTERM (e.g. during deploys) drain in-flight requests before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runErr := server.Run(ctx)
+
+	// flush the spans of the drained requests
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("Could not flush spans", "error", err)
+	}
+	if runErr != nil {
+		fatal("Server stopped with error", "address", cfg.Server.ListenAddress, "error", runErr)
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// newCryptoStores registers the signers and key generators of the enabled algorithms.
+func newCryptoStores(algorithms config.AlgorithmsConfig, serviceMetrics *metrics.Metrics) (crypto.SignerStore, crypto.KeyGeneratorStore) {
+	signers := make(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc)
+	generators := make(map[crypto.SignatureAlgorithm]crypto.KeyGenerator)
+	for _, algorithm := range algorithms.Enabled {
+		switch algorithm {
+		case crypto.RSA:
+			signers[crypto.RSA] = func(privateKey []byte) (crypto.Signer, error) {
+				return crypto.NewRSASigner(privateKey)
+			}
+			generators[crypto.RSA] = &crypto.RSAGenerator{Bits: algorithms.RSAKeySize}
+		case crypto.ECC:
+			// the key size has been validated with the configuration
+			curve, _ := config.ECCCurve(algorithms.ECCKeySize)
+			signers[crypto.ECC] = func(privateKey []byte) (crypto.Signer, error) {
+				return crypto.NewECCSigner(privateKey)
+			}
+			generators[crypto.ECC] = &crypto.ECCGenerator{Curve: curve}
+		}
+	}
+	return crypto.NewSignerStore(tracing.InstrumentSigners(serviceMetrics.InstrumentSigners(signers))),
+		crypto.NewKeyGeneratorStore(tracing.InstrumentKeyGenerators(serviceMetrics.InstrumentKeyGenerators(generators)))
+}
+
+// rateLimitParams converts the configured rate limits.
+func rateLimitParams(limits config.RateLimitsConfig) api.RateLimitParams {
+	policy := func(limits config.RateLimitConfig) api.RateLimitPolicy {
+		return api.RateLimitPolicy{
+			Client: ratelimit.Limit{Rate: limits.ClientRate, Burst: limits.ClientBurst},
+			Device: ratelimit.Limit{Rate: limits.DeviceRate, Burst: limits.DeviceBurst},
+		}
+	}
+	params := api.RateLimitParams{
+		RateLimitPolicy: policy(limits.RateLimitConfig),
+		TenantOverrides: make(map[string]api.RateLimitPolicy, len(limits.TenantOverrides)),
+	}
+	for tenantID, override := range limits.TenantOverrides {
+		params.TenantOverrides[tenantID] = policy(override)
+	}
+	return params
+}
 
-	if err := server.Run(); err != nil {
-		log.Fatal("Could not start server on ", ListenAddress)
+// addAdminAPIKeys adds the bootstrap admin API keys, given in the form of tenant:key, to the store.
+// The IDs are derived from the key hashes, so a tenant can have several bootstrap keys and restarting with a
+// persistent store replaces the keys instead of adding them again.
+func addAdminAPIKeys(store persistence.APIKeyStore, entries []string) error {
+	seen := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		tenantID, key, ok := strings.Cut(entry, ":")
+		if !ok || tenantID == "" || key == "" {
+			return fmt.Errorf("entry %d is not in the form of tenant:key", i+1)
+		}
+		hash := domain.HashAPIKey(key)
+		if seen[hash] {
+			return fmt.Errorf("entry %d repeats the key of an earlier entry", i+1)
+		}
+		seen[hash] = true
+		err := store.Add(context.Background(), &domain.APIKey{
+			ID:        fmt.Sprintf("bootstrap-%s", hash[:16]),
+			TenantID:  tenantID,
+			Name:      "bootstrap admin",
+			Hash:      hash,
+			Scopes:    []string{auth.ScopeAdmin},
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentSigners decorates the signers created by the given functions to record their latency and failures per
+// algorithm. A chain conflict makes the signer sign again, so the created signatures are counted by the store
+// decorator (see InstrumentStore) once they are committed.
+func (m *Metrics) InstrumentSigners(signers map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc) map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc {
+	instrumented := make(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc, len(signers))
+	for algorithm, create := range signers {
+		instrumented[algorithm] = func(privateKey []byte) (crypto.Signer, error) {
+			signer, err := create(privateKey)
+			if err != nil {
+				return nil, err
+			}
+			return &instrumentedSigner{
+				signer:   signer,
+				duration: m.signDuration.WithLabelValues(string(algorithm)),
+				failed:   m.signatureErrors.WithLabelValues(string(algorithm)),
+			}, nil
+		}
+	}
+	return instrumented
+}
+
+type instrumentedSigner struct {
+	signer   crypto.Signer
+	duration prometheus.Observer
+	failed   prometheus.Counter
+}
+
+func (s *instrumentedSigner) Sign(ctx context.Context, dataToBeSigned []byte) ([]byte, error) {
+	start := time.Now()
+	signature, err := s.signer.Sign(ctx, dataToBeSigned)
+	if err != nil {
+		s.failed.Inc()
+		return nil, err
+	}
+	s.duration.Observe(time.Since(start).Seconds())
+	return signature, nil
+}
+
+// InstrumentKeyGenerators decorates the given key generators to record their durations per algorithm.
+func (m *Metrics) InstrumentKeyGenerators(generators map[crypto.SignatureAlgorithm]crypto.KeyGenerator) map[crypto.SignatureAlgorithm]crypto.KeyGenerator {
+	instrumented := make(map[crypto.SignatureAlgorithm]crypto.KeyGenerator, len(generators))
+	for algorithm, generator := range generators {
+		instrumented[algorithm] = &instrumentedKeyGenerator{
+			generator: generator,
+			duration:  m.keyGeneration.WithLabelValues(string(algorithm)),
+		}
+	}
+	return instrumented
+}
+
+type instrumentedKeyGenerator struct {
+	generator crypto.KeyGenerator
+	duration  prometheus.Observer
+}
+
+func (g *instrumentedKeyGenerator) GenerateKeyPair(ctx context.Context) ([]byte, []byte, error) {
+	start := time.Now()
+	public, private, err := g.generator.GenerateKeyPair(ctx)
+	if err == nil {
+		g.duration.Observe(time.Since(start).Seconds())
+	}
+	return public, private, err
+}
+
+// CheckCustody checks the key custody of the decorated generator.
+func (g *instrumentedKeyGenerator) CheckCustody(ctx context.Context) error {
+	return crypto.CheckCustody(ctx, g.generator)
+}
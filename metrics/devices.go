@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// deviceCountTimeout bounds how long counting the devices may delay a scrape.
+	deviceCountTimeout = 5 * time.Second
+	// deviceCountTTL is how long the device counts are reported before they are counted again. Counting lists every
+	// device of every tenant, so scrapes must not be able to trigger it at their own rate.
+	deviceCountTTL = 30 * time.Second
+)
+
+var devicesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "devices"),
+	"Number of signature devices by state.",
+	[]string{"state"}, nil,
+)
+
+// RegisterDeviceCollector counts the devices of all tenants by state in the store, so the counts stay correct when
+// several instances share a store. The counts are cached for deviceCountTTL across scrapes.
+func (m *Metrics) RegisterDeviceCollector(tenants persistence.TenantStore, devices persistence.SignatureDeviceStore) {
+	m.registry.MustRegister(&deviceCollector{
+		tenants:   tenants,
+		devices:   devices,
+		ttl:       deviceCountTTL,
+		timeNowFn: time.Now,
+	})
+}
+
+type deviceCollector struct {
+	tenants   persistence.TenantStore
+	devices   persistence.SignatureDeviceStore
+	ttl       time.Duration
+	timeNowFn func() time.Time
+
+	// mutex also makes concurrent scrapes wait for a single count
+	mutex   sync.Mutex
+	counts  map[domain.DeviceState]int
+	counted time.Time
+}
+
+func (c *deviceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- devicesDesc
+}
+
+func (c *deviceCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.cachedCounts()
+	if err != nil {
+		slog.Warn("unable to count signature devices", "error", err)
+		ch <- prometheus.NewInvalidMetric(devicesDesc, err)
+		return
+	}
+	for state, count := range counts {
+		ch <- prometheus.MustNewConstMetric(devicesDesc, prometheus.GaugeValue, float64(count), string(state))
+	}
+}
+
+// cachedCounts returns the cached counts, counting the devices again once they are older than the TTL.
+// Failed counts are not cached, the next scrape tries again.
+func (c *deviceCollector) cachedCounts() (map[domain.DeviceState]int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.timeNowFn()
+	if c.counts == nil || now.Sub(c.counted) >= c.ttl {
+		ctx, cancel := context.WithTimeout(context.Background(), deviceCountTimeout)
+		defer cancel()
+		counts, err := c.count(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.counts, c.counted = counts, now
+	}
+	return maps.Clone(c.counts), nil
+}
+
+func (c *deviceCollector) count(ctx context.Context) (map[domain.DeviceState]int, error) {
+	// every state is reported, also without devices
+	counts := map[domain.DeviceState]int{
+		domain.StateActive:    0,
+		domain.StateSuspended: 0,
+	}
+	tenants, err := c.tenants.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, tenant := range tenants {
+		devices, err := c.devices.List(ctx, tenant.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			counts[device.State]++
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "signing"
+
+	// UnmatchedRoute labels requests which matched no route, so unknown paths do not create new series.
+	UnmatchedRoute = "unmatched"
+)
+
+// Metrics holds the collectors of the service and the registry they are exposed from.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	calls           *prometheus.CounterVec
+	callDuration    *prometheus.HistogramVec
+	signatures      *prometheus.CounterVec
+	signatureErrors *prometheus.CounterVec
+	signDuration    *prometheus.HistogramVec
+	keyGeneration   *prometheus.HistogramVec
+	storeOperations *prometheus.HistogramVec
+}
+
+// New creates the collectors of the service in a new registry, together with the Go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_total",
+			Help:      "Number of gRPC calls by method and status code.",
+		}, []string{"method", "code"}),
+		callDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Latency of gRPC calls by method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+		signatures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signatures_total",
+			Help:      "Number of signatures committed to the chains of the devices by algorithm.",
+		}, []string{"algorithm"}),
+		signatureErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signature_errors_total",
+			Help:      "Number of failed signature attempts by algorithm.",
+		}, []string{"algorithm"}),
+		signDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sign_duration_seconds",
+			Help:      "Latency of the signer calls by algorithm, including the ones of signatures signed again after a chain conflict.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 3, 10),
+		}, []string{"algorithm"}),
+		keyGeneration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "key_generation_duration_seconds",
+			Help:      "Duration of key pair generations by algorithm.",
+			// RSA key generation takes from milliseconds to seconds depending on the key size
+			Buckets: prometheus.ExponentialBuckets(0.001, 2.5, 12),
+		}, []string{"algorithm"}),
+		storeOperations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_operation_duration_seconds",
+			Help:      "Latency of signature device store operations by operation and result.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 3, 10),
+		}, []string{"operation", "result"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.calls,
+		m.callDuration,
+		m.signatures,
+		m.signatureErrors,
+		m.signDuration,
+		m.keyGeneration,
+		m.storeOperations,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		// a failing collector (e.g. an unreachable store) must not hide the other metrics
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// RegisterWebhookDrops exposes the number of webhook events which were neither delivered nor kept as dead letters,
+// dropped reports the current count.
+func (m *Metrics) RegisterWebhookDrops(dropped func() uint64) {
+	m.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_dropped_total",
+		Help:      "Number of webhook events dropped because the delivery queue and its overflow were full or the dispatcher was closed.",
+	}, func() float64 {
+		return float64(dropped())
+	}))
+}
+
+// ObserveRequest records a completed HTTP request, route is the matched route pattern or empty if none matched.
+func (m *Metrics) ObserveRequest(method string, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	statusLabel := strconv.Itoa(status)
+	m.requests.WithLabelValues(method, route, statusLabel).Inc()
+	m.requestDuration.WithLabelValues(method, route, statusLabel).Observe(duration.Seconds())
+}
+
+// ObserveCall records a completed gRPC call, method is the full method name and code the name of the status code.
+func (m *Metrics) ObserveCall(method string, code string, duration time.Duration) {
+	m.calls.WithLabelValues(method, code).Inc()
+	m.callDuration.WithLabelValues(method, code).Observe(duration.Seconds())
+}
+
+// result is the result label of an operation.
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
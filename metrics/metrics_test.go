@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	return rr.Body.String()
+}
+
+func expectMetrics(t *testing.T, body string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(body, line) {
+			t.Fatalf("expected %q in metrics:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetrics_InstrumentedSigning(t *testing.T) {
+	m := New()
+	signerStore := crypto.NewSignerStore(m.InstrumentSigners(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+		crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+	}))
+	generatorStore := crypto.NewKeyGeneratorStore(m.InstrumentKeyGenerators(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{
+		crypto.ECC: &crypto.ECCGenerator{},
+	}))
+	tenants := persistence.NewInMemoryTenantStore(domain.Tenant{ID: domain.DefaultTenantID})
+	rawStore := persistence.NewInMemorySignatureDeviceStore()
+	m.RegisterDeviceCollector(tenants, rawStore)
+	store := m.InstrumentStore(rawStore)
+
+	ctx := context.Background()
+	device, err := domain.NewSignatureDevice(ctx, &generatorStore, &signerStore, domain.DefaultTenantID, crypto.ECC, "metrics")
+	if err != nil {
+		t.Fatalf("NewSignatureDevice error: %v", err)
+	}
+	if err := store.Add(ctx, device, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := persistence.SignData(ctx, store, domain.DefaultTenantID, device.GetIDStr(), "data"); err != nil {
+			t.Fatalf("SignData error: %v", err)
+		}
+	}
+	if _, err := store.Get(ctx, domain.DefaultTenantID, "missing"); err == nil {
+		t.Fatalf("expected error for missing device")
+	}
+
+	expectMetrics(t, scrape(t, m),
+		`signing_signatures_total{algorithm="ECC"} 2`,
+		`signing_key_generation_duration_seconds_count{algorithm="ECC"} 1`,
+		`signing_store_operation_duration_seconds_count{operation="add",result="ok"} 1`,
+		`signing_store_operation_duration_seconds_count{operation="commit_signature",result="ok"} 2`,
+		`signing_store_operation_duration_seconds_count{operation="get",result="error"} 1`,
+		`signing_devices{state="active"} 1`,
+		`signing_devices{state="suspended"} 0`,
+	)
+}
+
+// conflictOnceStore fails the first commit with a chain conflict, as if another writer advanced the chain.
+type conflictOnceStore struct {
+	persistence.SignatureDeviceStore
+	conflicted bool
+}
+
+func (s *conflictOnceStore) CommitSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult) error {
+	if !s.conflicted {
+		s.conflicted = true
+		return domain.ErrChainConflict
+	}
+	return s.SignatureDeviceStore.CommitSignature(ctx, device, result)
+}
+
+func TestMetrics_CountsCommittedSignatures(t *testing.T) {
+	m := New()
+	signerStore := crypto.NewSignerStore(m.InstrumentSigners(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+		crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+	}))
+	generatorStore := crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{
+		crypto.ECC: &crypto.ECCGenerator{},
+	})
+	store := m.InstrumentStore(&conflictOnceStore{SignatureDeviceStore: persistence.NewInMemorySignatureDeviceStore()})
+
+	ctx := context.Background()
+	device, err := domain.NewSignatureDevice(ctx, &generatorStore, &signerStore, domain.DefaultTenantID, crypto.ECC, "metrics")
+	if err != nil {
+		t.Fatalf("NewSignatureDevice error: %v", err)
+	}
+	if err := store.Add(ctx, device, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	// the conflicting first attempt signs once more than is committed
+	if _, err := persistence.SignData(ctx, store, domain.DefaultTenantID, device.GetIDStr(), "data"); err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+	if _, err := persistence.SignBatch(ctx, store, domain.DefaultTenantID, device.GetIDStr(), []string{"a", "b", "c"}); err != nil {
+		t.Fatalf("SignBatch error: %v", err)
+	}
+	if _, _, err := persistence.SignDataIdempotent(ctx, store, domain.DefaultTenantID, device.GetIDStr(), "data", "key", time.Hour); err != nil {
+		t.Fatalf("SignDataIdempotent error: %v", err)
+	}
+
+	expectMetrics(t, scrape(t, m),
+		`signing_signatures_total{algorithm="ECC"} 5`,
+		// a new idempotency key is not a failed lookup
+		`signing_store_operation_duration_seconds_count{operation="get_idempotency_record",result="ok"} 1`,
+		`signing_sign_duration_seconds_count{algorithm="ECC"} 6`,
+		`signing_store_operation_duration_seconds_count{operation="commit_signature",result="error"} 1`,
+	)
+}
+
+func TestMetrics_ObserveRequest(t *testing.T) {
+	m := New()
+	m.ObserveRequest(http.MethodPost, "POST /api/v0/sign-tx", http.StatusOK, 20*time.Millisecond)
+	m.ObserveRequest(http.MethodGet, "", http.StatusNotFound, time.Millisecond)
+
+	expectMetrics(t, scrape(t, m),
+		`signing_http_requests_total{method="POST",route="POST /api/v0/sign-tx",status="200"} 1`,
+		`signing_http_request_duration_seconds_bucket{method="POST",route="POST /api/v0/sign-tx",status="200",le="0.025"} 1`,
+		`signing_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+	)
+}
+
+func TestMetrics_RegisterWebhookDrops(t *testing.T) {
+	m := New()
+	m.RegisterWebhookDrops(func() uint64 { return 3 })
+
+	expectMetrics(t, scrape(t, m), `signing_webhook_events_dropped_total 3`)
+}
+
+func TestMetrics_ObserveCall(t *testing.T) {
+	m := New()
+	m.ObserveCall("/signing.v0.SignatureDeviceService/SignTransaction", "OK", 20*time.Millisecond)
+	m.ObserveCall("/signing.v0.SignatureDeviceService/SignTransaction", "NotFound", time.Millisecond)
+
+	expectMetrics(t, scrape(t, m),
+		`signing_grpc_requests_total{code="OK",method="/signing.v0.SignatureDeviceService/SignTransaction"} 1`,
+		`signing_grpc_requests_total{code="NotFound",method="/signing.v0.SignatureDeviceService/SignTransaction"} 1`,
+		`signing_grpc_request_duration_seconds_bucket{code="OK",method="/signing.v0.SignatureDeviceService/SignTransaction",le="0.025"} 1`,
+	)
+}
+
+// countingTenantStore counts how often the tenants are listed.
+type countingTenantStore struct {
+	persistence.TenantStore
+	lists int
+}
+
+func (s *countingTenantStore) List(ctx context.Context) ([]domain.Tenant, error) {
+	s.lists++
+	return s.TenantStore.List(ctx)
+}
+
+func TestMetrics_DeviceCountsCached(t *testing.T) {
+	m := New()
+	generatorStore := crypto.NewKeyGeneratorStore(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{crypto.ECC: &crypto.ECCGenerator{}})
+	signerStore := crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+		crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+	})
+	tenants := &countingTenantStore{TenantStore: persistence.NewInMemoryTenantStore(domain.Tenant{ID: domain.DefaultTenantID})}
+	store := persistence.NewInMemorySignatureDeviceStore()
+	now := time.Now()
+	m.registry.MustRegister(&deviceCollector{
+		tenants:   tenants,
+		devices:   store,
+		ttl:       time.Minute,
+		timeNowFn: func() time.Time { return now },
+	})
+	addDevice := func() {
+		t.Helper()
+		device, err := domain.NewSignatureDevice(context.Background(), &generatorStore, &signerStore, domain.DefaultTenantID, crypto.ECC, "cached")
+		if err != nil {
+			t.Fatalf("NewSignatureDevice error: %v", err)
+		}
+		if err := store.Add(context.Background(), device, 0); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+
+	addDevice()
+	expectMetrics(t, scrape(t, m), `signing_devices{state="active"} 1`)
+	// scrapes within the TTL report the cached counts without listing the devices again
+	addDevice()
+	for i := 0; i < 3; i++ {
+		expectMetrics(t, scrape(t, m), `signing_devices{state="active"} 1`)
+	}
+	if tenants.lists != 1 {
+		t.Fatalf("expected the devices to be counted once, got %d", tenants.lists)
+	}
+	now = now.Add(time.Minute)
+	expectMetrics(t, scrape(t, m), `signing_devices{state="active"} 2`)
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+// InstrumentStore decorates a signature device store to record the latency of its operations
+// and to count the signatures it commits.
+func (m *Metrics) InstrumentStore(store persistence.SignatureDeviceStore) persistence.SignatureDeviceStore {
+	return &instrumentedStore{
+		store:   store,
+		metrics: m,
+	}
+}
+
+type instrumentedStore struct {
+	store   persistence.SignatureDeviceStore
+	metrics *Metrics
+}
+
+func (s *instrumentedStore) observe(operation string, start time.Time, err error) {
+	s.metrics.storeOperations.WithLabelValues(operation, result(err)).Observe(time.Since(start).Seconds())
+}
+
+// committed counts the signatures committed to the chain of the device.
+func (s *instrumentedStore) committed(device *domain.SignatureDevice, signatures int, err error) {
+	if err == nil {
+		s.metrics.signatures.WithLabelValues(string(device.Algorithm)).Add(float64(signatures))
+	}
+}
+
+func (s *instrumentedStore) Add(ctx context.Context, device *domain.SignatureDevice, maxDevices int) error {
+	start := time.Now()
+	err := s.store.Add(ctx, device, maxDevices)
+	s.observe("add", start, err)
+	return err
+}
+
+func (s *instrumentedStore) Get(ctx context.Context, tenantID string, id string) (*domain.SignatureDevice, error) {
+	start := time.Now()
+	device, err := s.store.Get(ctx, tenantID, id)
+	s.observe("get", start, err)
+	return device, err
+}
+
+func (s *instrumentedStore) List(ctx context.Context, tenantID string) ([]*domain.SignatureDevice, error) {
+	start := time.Now()
+	devices, err := s.store.List(ctx, tenantID)
+	s.observe("list", start, err)
+	return devices, err
+}
+
+func (s *instrumentedStore) CommitSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult) error {
+	start := time.Now()
+	err := s.store.CommitSignature(ctx, device, result)
+	s.observe("commit_signature", start, err)
+	s.committed(device, 1, err)
+	return err
+}
+
+func (s *instrumentedStore) CommitSignatures(ctx context.Context, device *domain.SignatureDevice, results []domain.SignDataResult) error {
+	start := time.Now()
+	err := s.store.CommitSignatures(ctx, device, results)
+	s.observe("commit_signatures", start, err)
+	s.committed(device, len(results), err)
+	return err
+}
+
+func (s *instrumentedStore) CommitIdempotentSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult, record domain.IdempotencyRecord) error {
+	start := time.Now()
+	err := s.store.CommitIdempotentSignature(ctx, device, result, record)
+	s.observe("commit_idempotent_signature", start, err)
+	s.committed(device, 1, err)
+	return err
+}
+
+func (s *instrumentedStore) GetIdempotencyRecord(ctx context.Context, tenantID string, id string, key string) (*domain.IdempotencyRecord, error) {
+	start := time.Now()
+	record, err := s.store.GetIdempotencyRecord(ctx, tenantID, id, key)
+	observed := err
+	if errors.Is(err, persistence.ErrIdempotencyRecordNotFound) {
+		// most requests carry a new key, not finding a record is the expected outcome
+		observed = nil
+	}
+	s.observe("get_idempotency_record", start, observed)
+	return record, err
+}
+
+func (s *instrumentedStore) ListSignatures(ctx context.Context, tenantID string, id string, from uint64, limit int) ([]domain.SignDataResult, error) {
+	start := time.Now()
+	signatures, err := s.store.ListSignatures(ctx, tenantID, id, from, limit)
+	s.observe("list_signatures", start, err)
+	return signatures, err
+}
+
+func (s *instrumentedStore) SetState(ctx context.Context, tenantID string, id string, state domain.DeviceState) (*domain.SignatureDevice, error) {
+	start := time.Now()
+	device, err := s.store.SetState(ctx, tenantID, id, state)
+	s.observe("set_state", start, err)
+	return device, err
+}
+
+func (s *instrumentedStore) RotateKey(ctx context.Context, rotated *domain.SignatureDevice) error {
+	start := time.Now()
+	err := s.store.RotateKey(ctx, rotated)
+	s.observe("rotate_key", start, err)
+	return err
+}
+
+func (s *instrumentedStore) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := s.store.Ping(ctx)
+	s.observe("ping", start, err)
+	return err
+}
+
+// Close closes the decorated store if it holds resources.
+func (s *instrumentedStore) Close() error {
+	if closer, ok := s.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
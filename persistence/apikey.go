@@ -0,0 +1,86 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+)
+
+// APIKeyStore persists API keys by their hash, the plaintext keys are never stored.
+type APIKeyStore interface {
+	Add(ctx context.Context, key *domain.APIKey) error
+	GetByHash(ctx context.Context, hash string) (*domain.APIKey, error)
+	List(ctx context.Context, tenantID string) ([]*domain.APIKey, error)
+	Delete(ctx context.Context, tenantID string, id string) error
+}
+
+type InMemoryAPIKeyStore struct {
+	sync.RWMutex
+	// keys maps key hashes to keys
+	keys map[string]*domain.APIKey
+}
+
+func NewInMemoryAPIKeyStore() *InMemoryAPIKeyStore {
+	return &InMemoryAPIKeyStore{
+		keys: make(map[string]*domain.APIKey),
+	}
+}
+
+func (s *InMemoryAPIKeyStore) Add(ctx context.Context, key *domain.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.keys[key.Hash] = key
+	return nil
+}
+
+func (s *InMemoryAPIKeyStore) GetByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	key, ok := s.keys[hash]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *InMemoryAPIKeyStore) List(ctx context.Context, tenantID string) ([]*domain.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	var result []*domain.APIKey
+	for _, key := range s.keys {
+		if key.TenantID == tenantID {
+			result = append(result, key)
+		}
+	}
+	return result, nil
+}
+
+func (s *InMemoryAPIKeyStore) Delete(ctx context.Context, tenantID string, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	for hash, key := range s.keys {
+		if key.TenantID == tenantID && key.ID == id {
+			delete(s.keys, hash)
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
@@ -0,0 +1,56 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+func TestInMemoryAPIKeyStore(t *testing.T) {
+	testAPIKeyStore(t, NewInMemoryAPIKeyStore())
+}
+
+func TestRedisAPIKeyStore(t *testing.T) {
+	testAPIKeyStore(t, NewRedisAPIKeyStore(newTestRedisClient(t)))
+}
+
+func testAPIKeyStore(t *testing.T, store APIKeyStore) {
+	key, plaintext, err := domain.NewAPIKey("acme", "pos", []string{"sign"})
+	if err != nil {
+		t.Fatalf("NewAPIKey error: %v", err)
+	}
+	if err := store.Add(context.Background(), key); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	got, err := store.GetByHash(context.Background(), domain.HashAPIKey(plaintext))
+	if err != nil {
+		t.Fatalf("GetByHash error: %v", err)
+	}
+	if got.ID != key.ID || got.TenantID != "acme" || len(got.Scopes) != 1 || got.Scopes[0] != "sign" {
+		t.Fatalf("GetByHash returned unexpected key: %+v", got)
+	}
+	if list, err := store.List(context.Background(), "acme"); err != nil || len(list) != 1 || list[0].Hash != key.Hash {
+		t.Fatalf("expected the key in the list of its tenant, got %v, %v", list, err)
+	}
+
+	list, err := store.List(context.Background(), "globex")
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("other tenant must not see any keys, got %d", len(list))
+	}
+
+	if err := store.Delete(context.Background(), "globex", key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("other tenant must not delete the key, got %v", err)
+	}
+	if err := store.Delete(context.Background(), "acme", key.ID); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if _, err := store.GetByHash(context.Background(), key.Hash); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("expected ErrAPIKeyNotFound after delete, got %v", err)
+	}
+}
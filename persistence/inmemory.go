@@ -1,49 +1,274 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/ksrichard/signing-service-challenge/domain"
 )
 
 var (
-	ErrDeviceNotFound = errors.New("signature device not found")
+	ErrDeviceNotFound            = errors.New("signature device not found")
+	ErrIdempotencyRecordNotFound = errors.New("idempotency record not found")
+	ErrIdempotencyKeyExists      = errors.New("idempotency key already exists")
 )
 
+// idempotencySweepInterval is how often a commit also drops the expired idempotency records of every device.
+const idempotencySweepInterval = time.Minute
+
 type InMemorySignatureDeviceStore struct {
 	sync.RWMutex
-	devices map[string]*domain.SignatureDevice
+	// devices maps tenant IDs to the devices of the tenant
+	devices map[string]map[string]*domain.SignatureDevice
+	// signatures maps tenant IDs to the signature logs of the devices of the tenant
+	signatures map[string]map[string][]domain.SignDataResult
+	// idempotency maps tenant IDs to the idempotency records of the devices of the tenant by key
+	idempotency map[string]map[string]map[string]domain.IdempotencyRecord
+	lastSweep   time.Time
+	// logRetention is the number of signatures kept in the log of a device, 0 means all
+	logRetention int
 }
 
 func NewInMemorySignatureDeviceStore() *InMemorySignatureDeviceStore {
 	return &InMemorySignatureDeviceStore{
-		devices: make(map[string]*domain.SignatureDevice),
+		devices:     make(map[string]map[string]*domain.SignatureDevice),
+		signatures:  make(map[string]map[string][]domain.SignDataResult),
+		idempotency: make(map[string]map[string]map[string]domain.IdempotencyRecord),
+		lastSweep:   time.Now(),
 	}
 }
 
-func (s *InMemorySignatureDeviceStore) Add(device *domain.SignatureDevice) error {
+// SetSignatureLogRetention limits the signature log of every device to its last entries signatures when signatures
+// are committed, 0 (the default) keeps all of them. It must be called before the store is used.
+func (s *InMemorySignatureDeviceStore) SetSignatureLogRetention(entries int) {
+	s.logRetention = entries
+}
+
+func (s *InMemorySignatureDeviceStore) Add(ctx context.Context, device *domain.SignatureDevice, maxDevices int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	s.Lock()
 	defer s.Unlock()
-	s.devices[device.GetIDStr()] = device
+	tenantDevices, ok := s.devices[device.TenantID]
+	if !ok {
+		tenantDevices = make(map[string]*domain.SignatureDevice)
+		s.devices[device.TenantID] = tenantDevices
+	}
+	if maxDevices > 0 && len(tenantDevices) >= maxDevices {
+		return domain.ErrTenantQuotaExceeded
+	}
+	tenantDevices[device.GetIDStr()] = device
 	return nil
 }
 
-func (s *InMemorySignatureDeviceStore) Get(id string) (*domain.SignatureDevice, error) {
+func (s *InMemorySignatureDeviceStore) Get(ctx context.Context, tenantID string, id string) (*domain.SignatureDevice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	s.RLock()
 	defer s.RUnlock()
-	if ok := s.devices[id] != nil; !ok {
+	device, ok := s.devices[tenantID][id]
+	if !ok {
 		return nil, ErrDeviceNotFound
 	}
-	return s.devices[id], nil
+	return device, nil
 }
 
-func (s *InMemorySignatureDeviceStore) List() ([]*domain.SignatureDevice, error) {
+func (s *InMemorySignatureDeviceStore) List(ctx context.Context, tenantID string) ([]*domain.SignatureDevice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	s.RLock()
 	defer s.RUnlock()
 	var result []*domain.SignatureDevice
-	for _, device := range s.devices {
+	for _, device := range s.devices[tenantID] {
 		result = append(result, device)
 	}
 	return result, nil
 }
+
+func (s *InMemorySignatureDeviceStore) CommitSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult) error {
+	return s.commit(ctx, device, []domain.SignDataResult{result}, nil)
+}
+
+func (s *InMemorySignatureDeviceStore) CommitSignatures(ctx context.Context, device *domain.SignatureDevice, results []domain.SignDataResult) error {
+	return s.commit(ctx, device, results, nil)
+}
+
+func (s *InMemorySignatureDeviceStore) CommitIdempotentSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult, record domain.IdempotencyRecord) error {
+	return s.commit(ctx, device, []domain.SignDataResult{result}, &record)
+}
+
+// commit advances the chain head and appends the signatures to the log, storing the idempotency record if not nil.
+func (s *InMemorySignatureDeviceStore) commit(ctx context.Context, device *domain.SignatureDevice, results []domain.SignDataResult, record *domain.IdempotencyRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	stored, ok := s.devices[device.TenantID][device.GetIDStr()]
+	if !ok {
+		return ErrDeviceNotFound
+	}
+	now := time.Now()
+	records := s.idempotency[device.TenantID][device.GetIDStr()]
+	if record != nil {
+		if existing, ok := records[record.Key]; ok && !existing.Expired(now) {
+			return ErrIdempotencyKeyExists
+		}
+	}
+	if err := stored.AdvanceBatch(results); err != nil {
+		return err
+	}
+	tenantSignatures, ok := s.signatures[device.TenantID]
+	if !ok {
+		tenantSignatures = make(map[string][]domain.SignDataResult)
+		s.signatures[device.TenantID] = tenantSignatures
+	}
+	signatures := append(tenantSignatures[device.GetIDStr()], results...)
+	if s.logRetention > 0 && len(signatures) > s.logRetention {
+		// the dropped entries are released once append moves the log to a new array
+		signatures = signatures[len(signatures)-s.logRetention:]
+	}
+	tenantSignatures[device.GetIDStr()] = signatures
+	if now.Sub(s.lastSweep) >= idempotencySweepInterval {
+		s.sweepIdempotency(now)
+		// the records of the device are gone if all of them expired
+		records = s.idempotency[device.TenantID][device.GetIDStr()]
+	}
+	if record == nil {
+		return nil
+	}
+
+	if records == nil {
+		tenantRecords, ok := s.idempotency[device.TenantID]
+		if !ok {
+			tenantRecords = make(map[string]map[string]domain.IdempotencyRecord)
+			s.idempotency[device.TenantID] = tenantRecords
+		}
+		records = make(map[string]domain.IdempotencyRecord)
+		tenantRecords[device.GetIDStr()] = records
+	}
+	// expired records of the device are dropped whenever a new one is added
+	for key, existing := range records {
+		if existing.Expired(now) {
+			delete(records, key)
+		}
+	}
+	records[record.Key] = *record
+	return nil
+}
+
+// GetIdempotencyRecord returns the record of the key, an expired record is dropped.
+func (s *InMemorySignatureDeviceStore) GetIdempotencyRecord(ctx context.Context, tenantID string, id string, key string) (*domain.IdempotencyRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	record, ok := s.idempotency[tenantID][id][key]
+	s.RUnlock()
+	if !ok {
+		return nil, ErrIdempotencyRecordNotFound
+	}
+	if now := time.Now(); record.Expired(now) {
+		s.Lock()
+		// the key may have been committed again in the meantime
+		if current, ok := s.idempotency[tenantID][id][key]; ok && current.Expired(now) {
+			delete(s.idempotency[tenantID][id], key)
+		}
+		s.Unlock()
+		return nil, ErrIdempotencyRecordNotFound
+	}
+	return &record, nil
+}
+
+// sweepIdempotency drops the expired idempotency records of every device, s must be locked.
+func (s *InMemorySignatureDeviceStore) sweepIdempotency(now time.Time) {
+	for tenantID, tenantRecords := range s.idempotency {
+		for id, records := range tenantRecords {
+			for key, record := range records {
+				if record.Expired(now) {
+					delete(records, key)
+				}
+			}
+			if len(records) == 0 {
+				delete(tenantRecords, id)
+			}
+		}
+		if len(tenantRecords) == 0 {
+			delete(s.idempotency, tenantID)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (s *InMemorySignatureDeviceStore) ListSignatures(ctx context.Context, tenantID string, id string, from uint64, limit int) ([]domain.SignDataResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if _, ok := s.devices[tenantID][id]; !ok {
+		return nil, ErrDeviceNotFound
+	}
+	// the counters of the log are consecutive, the index of a counter is its distance to the first one
+	signatures := s.signatures[tenantID][id]
+	if len(signatures) == 0 {
+		return []domain.SignDataResult{}, nil
+	}
+	start := uint64(0)
+	if first := signatures[0].Counter; from > first {
+		start = from - first
+	}
+	if start >= uint64(len(signatures)) {
+		return []domain.SignDataResult{}, nil
+	}
+	end := min(uint64(len(signatures)), start+uint64(limit))
+	return append([]domain.SignDataResult(nil), signatures[start:end]...), nil
+}
+
+// SetState replaces the stored device with a copy in the new state, callers holding the old device keep an unchanged copy.
+func (s *InMemorySignatureDeviceStore) SetState(ctx context.Context, tenantID string, id string, state domain.DeviceState) (*domain.SignatureDevice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	stored, ok := s.devices[tenantID][id]
+	if !ok {
+		return nil, ErrDeviceNotFound
+	}
+	updated, err := stored.WithState(state)
+	if err != nil {
+		return nil, err
+	}
+	s.devices[tenantID][id] = updated
+	return updated, nil
+}
+
+func (s *InMemorySignatureDeviceStore) RotateKey(ctx context.Context, rotated *domain.SignatureDevice) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	stored, ok := s.devices[rotated.TenantID][rotated.GetIDStr()]
+	if !ok {
+		return ErrDeviceNotFound
+	}
+	keys := rotated.PublicKeys()
+	if stored.GetSignatureCounter() != keys[len(keys)-1].FirstCounter || stored.KeyVersion()+1 != rotated.KeyVersion() ||
+		stored.State != rotated.State {
+		return domain.ErrChainConflict
+	}
+	s.devices[rotated.TenantID][rotated.GetIDStr()] = rotated
+	return nil
+}
+
+// Ping always succeeds while the context is alive, the devices are kept in process.
+func (s *InMemorySignatureDeviceStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
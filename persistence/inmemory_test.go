@@ -1,8 +1,14 @@
 package persistence
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ksrichard/signing-service-challenge/crypto"
 	"github.com/ksrichard/signing-service-challenge/domain"
@@ -18,7 +24,7 @@ func newTestDevice(t *testing.T, label string) *domain.SignatureDevice {
 	ss := crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
 		crypto.RSA: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewRSASigner(privateKey) },
 	})
-	dev, err := domain.NewSignatureDevice(&kg, &ss, crypto.RSA, label)
+	dev, err := domain.NewSignatureDevice(context.Background(), &kg, &ss, domain.DefaultTenantID, crypto.RSA, label)
 	if err != nil {
 		T.Fatalf("failed to create signature device: %v", err)
 	}
@@ -31,15 +37,15 @@ func TestInMemorySignatureDeviceStore_AddGetList(t *testing.T) {
 	dev1 := newTestDevice(t, "one")
 	dev2 := newTestDevice(t, "two")
 
-	if err := store.Add(dev1); err != nil {
+	if err := store.Add(context.Background(), dev1, 0); err != nil {
 		t.Fatalf("Add(dev1) error: %v", err)
 	}
-	if err := store.Add(dev2); err != nil {
+	if err := store.Add(context.Background(), dev2, 0); err != nil {
 		t.Fatalf("Add(dev2) error: %v", err)
 	}
 
 	// Get
-	got1, err := store.Get(dev1.GetIDStr())
+	got1, err := store.Get(context.Background(), domain.DefaultTenantID, dev1.GetIDStr())
 	if err != nil {
 		t.Fatalf("Get(dev1) error: %v", err)
 	}
@@ -48,7 +54,7 @@ func TestInMemorySignatureDeviceStore_AddGetList(t *testing.T) {
 	}
 
 	// List (order not guaranteed)
-	list, err := store.List()
+	list, err := store.List(context.Background(), domain.DefaultTenantID)
 	if err != nil {
 		t.Fatalf("List() error: %v", err)
 	}
@@ -73,7 +79,7 @@ func TestInMemorySignatureDeviceStore_AddGetList(t *testing.T) {
 
 func TestInMemorySignatureDeviceStore_Get_NotFound(t *testing.T) {
 	store := NewInMemorySignatureDeviceStore()
-	_, err := store.Get("doesnotexist")
+	_, err := store.Get(context.Background(), domain.DefaultTenantID, "doesnotexist")
 	if err == nil {
 		t.Fatalf("expected error for missing device, got nil")
 	}
@@ -81,3 +87,536 @@ func TestInMemorySignatureDeviceStore_Get_NotFound(t *testing.T) {
 		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
 	}
 }
+
+func TestInMemorySignatureDeviceStore_TenantIsolation(t *testing.T) {
+	store := NewInMemorySignatureDeviceStore()
+	dev := newTestDevice(t, "acme device")
+	dev.TenantID = "acme"
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	if _, err := store.Get(context.Background(), "globex", dev.GetIDStr()); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound for other tenant, got %v", err)
+	}
+	list, err := store.List(context.Background(), "globex")
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("other tenant must not see any devices, got %d", len(list))
+	}
+	if _, err := SignData(context.Background(), store, "globex", dev.GetIDStr(), "data"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("other tenant must not sign with the device, got %v", err)
+	}
+}
+
+func TestInMemorySignatureDeviceStore_Quota(t *testing.T) {
+	store := NewInMemorySignatureDeviceStore()
+	if err := store.Add(context.Background(), newTestDevice(t, "one"), 1); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	err := store.Add(context.Background(), newTestDevice(t, "two"), 1)
+	if !errors.Is(err, domain.ErrTenantQuotaExceeded) {
+		t.Fatalf("expected ErrTenantQuotaExceeded, got %v", err)
+	}
+
+	// the quota applies per tenant
+	other := newTestDevice(t, "other")
+	other.TenantID = "acme"
+	if err := store.Add(context.Background(), other, 1); err != nil {
+		t.Fatalf("Add for other tenant error: %v", err)
+	}
+}
+
+func TestInMemorySignatureDeviceStore_SetStateAndRotateKey(t *testing.T) {
+	store := NewInMemorySignatureDeviceStore()
+	dev := newTestDevice(t, "lifecycle")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testSetStateAndRotateKey(t, store, dev)
+}
+
+// testSetStateAndRotateKey checks the state changes and key rotations of a store holding dev.
+func testSetStateAndRotateKey(t *testing.T, store SignatureDeviceStore, dev *domain.SignatureDevice) {
+	t.Helper()
+	ctx := context.Background()
+	id := dev.GetIDStr()
+	ss := crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+		crypto.RSA: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewRSASigner(privateKey) },
+	})
+
+	if _, err := store.SetState(ctx, domain.DefaultTenantID, "unknown", domain.StateSuspended); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
+	}
+	suspended, err := store.SetState(ctx, domain.DefaultTenantID, id, domain.StateSuspended)
+	if err != nil || suspended.State != domain.StateSuspended {
+		t.Fatalf("SetState error: %v", err)
+	}
+	if _, err := SignData(ctx, store, domain.DefaultTenantID, id, "data"); !errors.Is(err, domain.ErrDeviceNotActive) {
+		t.Fatalf("expected ErrDeviceNotActive, got %v", err)
+	}
+	if _, err := store.SetState(ctx, domain.DefaultTenantID, id, domain.StateActive); err != nil {
+		t.Fatalf("SetState error: %v", err)
+	}
+	first, err := SignData(ctx, store, domain.DefaultTenantID, id, "first")
+	if err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+
+	public, private, err := (&crypto.RSAGenerator{}).GenerateKeyPair(ctx)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair error: %v", err)
+	}
+	stale, err := store.Get(ctx, domain.DefaultTenantID, id)
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	rotated, err := RotateKey(ctx, store, &ss, domain.DefaultTenantID, id, public, private)
+	if err != nil {
+		t.Fatalf("RotateKey error: %v", err)
+	}
+	if rotated.KeyVersion() != 2 {
+		t.Fatalf("expected key version 2, got %d", rotated.KeyVersion())
+	}
+	// a rotation derived from an outdated device is rejected
+	outdated, err := stale.WithKey(&ss, public, private)
+	if err != nil {
+		t.Fatalf("WithKey error: %v", err)
+	}
+	if err := store.RotateKey(ctx, outdated); !errors.Is(err, domain.ErrChainConflict) {
+		t.Fatalf("expected ErrChainConflict, got %v", err)
+	}
+
+	second, err := SignData(ctx, store, domain.DefaultTenantID, id, "second")
+	if err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+	if second.Counter != 1 || second.KeyVersion != 2 || second.SignedData != "1_second_"+first.Signature {
+		t.Fatalf("the chain must continue with the new key, got %+v", second)
+	}
+	got, err := store.Get(ctx, domain.DefaultTenantID, id)
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	if got.KeyVersion() != 2 || string(got.PublicKey) != string(public) || string(got.PublicKeyAt(0)) != string(dev.PublicKey) {
+		t.Fatalf("the key history was not stored")
+	}
+}
+
+func TestInMemorySignatureDeviceStore_ListSignatures(t *testing.T) {
+	store := NewInMemorySignatureDeviceStore()
+	dev := newTestDevice(t, "log")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testListSignatures(t, store, dev)
+}
+
+func TestInMemorySignatureDeviceStore_SignatureLogRetention(t *testing.T) {
+	store := NewInMemorySignatureDeviceStore()
+	store.SetSignatureLogRetention(3)
+	dev := newTestDevice(t, "retention")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testSignatureLogRetention(t, store, dev)
+}
+
+// testSignatureLogRetention checks the signature log of a store holding dev which retains 3 signatures per device.
+func testSignatureLogRetention(t *testing.T, store SignatureDeviceStore, dev *domain.SignatureDevice) {
+	t.Helper()
+	ctx := context.Background()
+	id := dev.GetIDStr()
+	for i := 0; i < 3; i++ {
+		if _, err := SignData(ctx, store, domain.DefaultTenantID, id, "single"); err != nil {
+			t.Fatalf("SignData error: %v", err)
+		}
+	}
+	if _, err := SignBatch(ctx, store, domain.DefaultTenantID, id, []string{"a", "b"}); err != nil {
+		t.Fatalf("SignBatch error: %v", err)
+	}
+
+	counters := func(from uint64, limit int) []uint64 {
+		t.Helper()
+		signatures, err := store.ListSignatures(ctx, domain.DefaultTenantID, id, from, limit)
+		if err != nil {
+			t.Fatalf("ListSignatures error: %v", err)
+		}
+		result := []uint64{}
+		for _, signature := range signatures {
+			result = append(result, signature.Counter)
+		}
+		return result
+	}
+	if got := counters(0, 10); !slices.Equal(got, []uint64{2, 3, 4}) {
+		t.Fatalf("expected the last 3 signatures, got %v", got)
+	}
+	if got := counters(3, 1); !slices.Equal(got, []uint64{3}) {
+		t.Fatalf("expected the signature of counter 3, got %v", got)
+	}
+	if got := counters(5, 10); len(got) != 0 {
+		t.Fatalf("expected no signatures after the head, got %v", got)
+	}
+}
+
+// testListSignatures checks the signature log of a store holding dev.
+func testListSignatures(t *testing.T, store SignatureDeviceStore, dev *domain.SignatureDevice) {
+	t.Helper()
+	ctx := context.Background()
+	id := dev.GetIDStr()
+
+	if _, err := store.ListSignatures(ctx, domain.DefaultTenantID, "unknown", 0, 10); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
+	}
+	empty, err := store.ListSignatures(ctx, domain.DefaultTenantID, id, 0, 10)
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Fatalf("expected an empty log, got %v %v", empty, err)
+	}
+
+	var signed []domain.SignDataResult
+	for _, data := range []string{"a", "b", "c"} {
+		result, err := SignData(ctx, store, domain.DefaultTenantID, id, data)
+		if err != nil {
+			t.Fatalf("SignData error: %v", err)
+		}
+		signed = append(signed, result)
+	}
+
+	all, err := store.ListSignatures(ctx, domain.DefaultTenantID, id, 0, 10)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("expected 3 signatures, got %v %v", all, err)
+	}
+	for i, signature := range all {
+		if signature != signed[i] {
+			t.Fatalf("unexpected signature %d: %+v", i, signature)
+		}
+	}
+	page, err := store.ListSignatures(ctx, domain.DefaultTenantID, id, 1, 1)
+	if err != nil || len(page) != 1 || page[0].Counter != 1 {
+		t.Fatalf("expected the signature with counter 1, got %v %v", page, err)
+	}
+	if rest, err := store.ListSignatures(ctx, domain.DefaultTenantID, id, 3, 10); err != nil || len(rest) != 0 {
+		t.Fatalf("expected no signature after the head, got %v %v", rest, err)
+	}
+	// other tenants do not see the log
+	if _, err := store.ListSignatures(ctx, "acme", id, 0, 10); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound for another tenant, got %v", err)
+	}
+}
+
+func TestInMemorySignatureDeviceStore_Idempotency(t *testing.T) {
+	store := NewInMemorySignatureDeviceStore()
+	dev := newTestDevice(t, "idempotency")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testIdempotency(t, store, dev, func() { time.Sleep(10 * time.Millisecond) })
+}
+
+func TestInMemorySignatureDeviceStore_IdempotencyConcurrently(t *testing.T) {
+	store := NewInMemorySignatureDeviceStore()
+	dev := newTestDevice(t, "idempotency")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testIdempotencyConcurrently(t, store, dev)
+}
+
+func TestInMemorySignatureDeviceStore_IdempotencyPruning(t *testing.T) {
+	store := NewInMemorySignatureDeviceStore()
+	ctx := context.Background()
+	idle, busy := newTestDevice(t, "idle"), newTestDevice(t, "busy")
+	for _, dev := range []*domain.SignatureDevice{idle, busy} {
+		if err := store.Add(ctx, dev, 0); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+	for _, key := range []string{"key-1", "key-2"} {
+		if _, _, err := SignDataIdempotent(ctx, store, domain.DefaultTenantID, idle.GetIDStr(), "receipt", key, time.Millisecond); err != nil {
+			t.Fatalf("SignDataIdempotent error: %v", err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// reading an expired record drops it
+	if _, err := store.GetIdempotencyRecord(ctx, domain.DefaultTenantID, idle.GetIDStr(), "key-1"); !errors.Is(err, ErrIdempotencyRecordNotFound) {
+		t.Fatalf("expected the record to expire, got %v", err)
+	}
+	if records := store.idempotency[domain.DefaultTenantID][idle.GetIDStr()]; len(records) != 1 {
+		t.Fatalf("expected the expired record to be dropped on read, got %d records", len(records))
+	}
+
+	// the sweep of a commit to another device drops the remaining expired records
+	store.lastSweep = time.Now().Add(-idempotencySweepInterval)
+	if _, err := SignData(ctx, store, domain.DefaultTenantID, busy.GetIDStr(), "data"); err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+	if len(store.idempotency) != 0 {
+		t.Fatalf("expected every expired record to be swept, got %v", store.idempotency)
+	}
+	if _, replayed, err := SignDataIdempotent(ctx, store, domain.DefaultTenantID, idle.GetIDStr(), "receipt", "key-2", time.Hour); err != nil || replayed {
+		t.Fatalf("expected the swept key to sign again, got %v %v", replayed, err)
+	}
+}
+
+// testIdempotencyConcurrently checks that concurrent requests with the same idempotency key sign only once.
+func testIdempotencyConcurrently(t *testing.T, store SignatureDeviceStore, dev *domain.SignatureDevice) {
+	t.Helper()
+	ctx := context.Background()
+	id := dev.GetIDStr()
+	const requests = 10
+
+	type response struct {
+		result   domain.SignDataResult
+		replayed bool
+		err      error
+	}
+	responses := make(chan response, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, replayed, err := SignDataIdempotent(ctx, store, domain.DefaultTenantID, id, "receipt", "shared-key", time.Hour)
+			responses <- response{result, replayed, err}
+		}()
+	}
+	wg.Wait()
+	close(responses)
+
+	signed := 0
+	for r := range responses {
+		if r.err != nil {
+			t.Fatalf("SignDataIdempotent error: %v", r.err)
+		}
+		if r.result.Counter != 0 {
+			t.Fatalf("expected every request to get the signature of counter 0, got %d", r.result.Counter)
+		}
+		if !r.replayed {
+			signed++
+		}
+	}
+	if signed != 1 {
+		t.Fatalf("expected exactly one request to sign, got %d", signed)
+	}
+	device, err := store.Get(ctx, domain.DefaultTenantID, id)
+	if err != nil || device.Head().Counter != 1 {
+		t.Fatalf("expected a single counter to be used, got %v %v", device, err)
+	}
+}
+
+// testIdempotency checks the idempotency keys of a store holding dev, expire must let records with a retention of a
+// millisecond expire.
+func testIdempotency(t *testing.T, store SignatureDeviceStore, dev *domain.SignatureDevice, expire func()) {
+	t.Helper()
+	ctx := context.Background()
+	id := dev.GetIDStr()
+
+	first, replayed, err := SignDataIdempotent(ctx, store, domain.DefaultTenantID, id, "receipt", "key-1", time.Hour)
+	if err != nil || replayed || first.Counter != 0 {
+		t.Fatalf("expected a new signature, got %+v %v %v", first, replayed, err)
+	}
+	retried, replayed, err := SignDataIdempotent(ctx, store, domain.DefaultTenantID, id, "receipt", "key-1", time.Hour)
+	if err != nil || !replayed || retried != first {
+		t.Fatalf("expected the first signature to be replayed, got %+v %v %v", retried, replayed, err)
+	}
+	if _, _, err := SignDataIdempotent(ctx, store, domain.DefaultTenantID, id, "other receipt", "key-1", time.Hour); !errors.Is(err, domain.ErrIdempotencyKeyReused) {
+		t.Fatalf("expected ErrIdempotencyKeyReused, got %v", err)
+	}
+	record, err := store.GetIdempotencyRecord(ctx, domain.DefaultTenantID, id, "key-1")
+	if err != nil || record.Key != "key-1" || record.RequestHash != domain.IdempotencyRequestHash("receipt") || record.Result != first {
+		t.Fatalf("unexpected record %+v %v", record, err)
+	}
+
+	// the key of a committed record cannot be committed again
+	device, err := store.Get(ctx, domain.DefaultTenantID, id)
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	result, err := device.SignDataAt(ctx, device.Head(), "receipt")
+	if err != nil {
+		t.Fatalf("SignDataAt error: %v", err)
+	}
+	err = store.CommitIdempotentSignature(ctx, device, result, domain.IdempotencyRecord{Key: "key-1", Result: result, ExpiresAt: time.Now().Add(time.Hour)})
+	if !errors.Is(err, ErrIdempotencyKeyExists) {
+		t.Fatalf("expected ErrIdempotencyKeyExists, got %v", err)
+	}
+	if head, _ := store.Get(ctx, domain.DefaultTenantID, id); head.Head().Counter != 1 {
+		t.Fatalf("expected the rejected commit to leave the chain head, got %d", head.Head().Counter)
+	}
+
+	// keys are scoped per device and tenant
+	if _, err := store.GetIdempotencyRecord(ctx, domain.DefaultTenantID, "other", "key-1"); !errors.Is(err, ErrIdempotencyRecordNotFound) {
+		t.Fatalf("expected ErrIdempotencyRecordNotFound for another device, got %v", err)
+	}
+	if _, err := store.GetIdempotencyRecord(ctx, "acme", id, "key-1"); !errors.Is(err, ErrIdempotencyRecordNotFound) {
+		t.Fatalf("expected ErrIdempotencyRecordNotFound for another tenant, got %v", err)
+	}
+
+	// an expired key signs again
+	if _, _, err := SignDataIdempotent(ctx, store, domain.DefaultTenantID, id, "receipt", "key-2", time.Millisecond); err != nil {
+		t.Fatalf("SignDataIdempotent error: %v", err)
+	}
+	expire()
+	if _, err := store.GetIdempotencyRecord(ctx, domain.DefaultTenantID, id, "key-2"); !errors.Is(err, ErrIdempotencyRecordNotFound) {
+		t.Fatalf("expected the record to expire, got %v", err)
+	}
+	again, replayed, err := SignDataIdempotent(ctx, store, domain.DefaultTenantID, id, "receipt", "key-2", time.Hour)
+	if err != nil || replayed || again.Counter != 2 {
+		t.Fatalf("expected a new signature after the retention, got %+v %v %v", again, replayed, err)
+	}
+}
+
+func TestInMemorySignatureDeviceStore_SignBatch(t *testing.T) {
+	store := NewInMemorySignatureDeviceStore()
+	dev := newTestDevice(t, "batch")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testSignBatch(t, store, dev)
+}
+
+func TestInMemorySignatureDeviceStore_SignBatchConcurrently(t *testing.T) {
+	store := NewInMemorySignatureDeviceStore()
+	dev := newTestDevice(t, "busy")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testSignBatchConcurrently(t, store, dev)
+}
+
+// testSignBatchConcurrently checks that a batch is committed while single signatures of the device are committed
+// concurrently, and that the chain stays consecutive.
+func testSignBatchConcurrently(t *testing.T, store SignatureDeviceStore, dev *domain.SignatureDevice) {
+	t.Helper()
+	ctx := context.Background()
+	id := dev.GetIDStr()
+	const signers, signatures, batchSize = 4, 20, 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, signers*signatures+1)
+	for i := 0; i < signers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < signatures; j++ {
+				if _, err := SignData(ctx, store, domain.DefaultTenantID, id, "single"); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	batch := make([]string, batchSize)
+	for i := range batch {
+		batch[i] = fmt.Sprint("batch-", i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := SignBatch(ctx, store, domain.DefaultTenantID, id, batch); err != nil {
+			errs <- err
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("signing error: %v", err)
+	}
+
+	const total = signers*signatures + batchSize
+	log, err := store.ListSignatures(ctx, domain.DefaultTenantID, id, 0, total+1)
+	if err != nil || len(log) != total {
+		t.Fatalf("expected %d signatures, got %d: %v", total, len(log), err)
+	}
+	for i, signature := range log {
+		if signature.Counter != uint64(i) || (i > 0 && !strings.HasSuffix(signature.SignedData, "_"+log[i-1].Signature)) {
+			t.Fatalf("signature %d does not continue the chain: %+v", i, signature)
+		}
+	}
+}
+
+// conflictingStore reports a chain conflict for every batch
+type conflictingStore struct {
+	*InMemorySignatureDeviceStore
+	commits int
+}
+
+func (s *conflictingStore) CommitSignatures(ctx context.Context, device *domain.SignatureDevice, results []domain.SignDataResult) error {
+	s.commits++
+	return domain.ErrChainConflict
+}
+
+func TestSignBatch_RetryBudget(t *testing.T) {
+	store := &conflictingStore{InMemorySignatureDeviceStore: NewInMemorySignatureDeviceStore()}
+	dev := newTestDevice(t, "conflicts")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	_, err := SignBatch(context.Background(), store, domain.DefaultTenantID, dev.GetIDStr(), []string{"a", "b"})
+	if !errors.Is(err, domain.ErrChainConflict) || store.commits != maxBatchCommitAttempts {
+		t.Fatalf("expected ErrChainConflict after %d attempts, got %v after %d", maxBatchCommitAttempts, err, store.commits)
+	}
+}
+
+// testSignBatch checks batches of signatures with a store holding dev.
+func testSignBatch(t *testing.T, store SignatureDeviceStore, dev *domain.SignatureDevice) {
+	t.Helper()
+	ctx := context.Background()
+	id := dev.GetIDStr()
+
+	first, err := SignData(ctx, store, domain.DefaultTenantID, id, "first")
+	if err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+	batch, err := SignBatch(ctx, store, domain.DefaultTenantID, id, []string{"a", "b", "c"})
+	if err != nil || len(batch) != 3 {
+		t.Fatalf("SignBatch error: %v", err)
+	}
+	if batch[0].SignedData != "1_a_"+first.Signature || batch[2].SignedData != "3_c_"+batch[1].Signature {
+		t.Fatalf("expected the batch to continue the chain, got %+v", batch)
+	}
+	log, err := store.ListSignatures(ctx, domain.DefaultTenantID, id, 0, 10)
+	if err != nil || len(log) != 4 || log[3] != batch[2] {
+		t.Fatalf("expected the batch in the log, got %v %v", log, err)
+	}
+
+	// a batch which no longer follows the head is rejected as a whole
+	stale, err := store.Get(ctx, domain.DefaultTenantID, id)
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	results, err := stale.SignBatchAt(ctx, stale.Head(), []string{"d", "e"})
+	if err != nil {
+		t.Fatalf("SignBatchAt error: %v", err)
+	}
+	if _, err := SignData(ctx, store, domain.DefaultTenantID, id, "concurrent"); err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+	if err := store.CommitSignatures(ctx, stale, results); !errors.Is(err, domain.ErrChainConflict) {
+		t.Fatalf("expected ErrChainConflict, got %v", err)
+	}
+	fresh, _ := store.Get(ctx, domain.DefaultTenantID, id)
+	results, err = fresh.SignBatchAt(ctx, fresh.Head(), []string{"d", "e", "f"})
+	if err != nil {
+		t.Fatalf("SignBatchAt error: %v", err)
+	}
+	if err := store.CommitSignatures(ctx, fresh, []domain.SignDataResult{results[0], results[2]}); !errors.Is(err, domain.ErrChainConflict) {
+		t.Fatalf("expected ErrChainConflict for a batch skipping counters, got %v", err)
+	}
+	if log, _ := store.ListSignatures(ctx, domain.DefaultTenantID, id, 0, 10); len(log) != 5 {
+		t.Fatalf("expected rejected batches to leave the log, got %d signatures", len(log))
+	}
+
+	// suspended devices sign no item of a batch
+	if _, err := store.SetState(ctx, domain.DefaultTenantID, id, domain.StateSuspended); err != nil {
+		t.Fatalf("SetState error: %v", err)
+	}
+	if _, err := SignBatch(ctx, store, domain.DefaultTenantID, id, []string{"g"}); !errors.Is(err, domain.ErrDeviceNotActive) {
+		t.Fatalf("expected ErrDeviceNotActive, got %v", err)
+	}
+	if _, err := SignBatch(ctx, store, domain.DefaultTenantID, "unknown", []string{"g"}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+)
+
+// signingLocks serialises signing and committing per device within the process, so concurrent requests for a device
+// wait for each other instead of signing at the same chain head and retrying on the conflict. Writers in other
+// processes sharing the store still conflict and are retried.
+var signingLocks = newKeyedLock()
+
+// keyedLock is a mutex per key, which can be waited for with a context.
+type keyedLock struct {
+	mutex sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	held chan struct{}
+	// refs counts the holder and the waiters, the lock is dropped when the last one is done
+	refs int
+}
+
+func newKeyedLock() *keyedLock {
+	return &keyedLock{locks: make(map[string]*keyLock)}
+}
+
+// lock waits until the lock of the key is held or ctx is done, the returned function releases it.
+func (l *keyedLock) lock(ctx context.Context, key string) (func(), error) {
+	l.mutex.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &keyLock{held: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mutex.Unlock()
+
+	select {
+	case lock.held <- struct{}{}:
+		return func() {
+			<-lock.held
+			l.release(key, lock)
+		}, nil
+	case <-ctx.Done():
+		l.release(key, lock)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *keyedLock) release(key string, lock *keyLock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
+
+// withSigningLock runs fn while holding the signing lock of the device.
+func withSigningLock(ctx context.Context, tenantID string, id string, fn func() error) error {
+	unlock, err := signingLocks.lock(ctx, tenantID+"/"+id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
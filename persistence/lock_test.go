@@ -0,0 +1,39 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeyedLock(t *testing.T) {
+	locks := newKeyedLock()
+	unlock, err := locks.lock(context.Background(), "device")
+	if err != nil {
+		t.Fatalf("lock error: %v", err)
+	}
+	// other keys are not blocked
+	unlockOther, err := locks.lock(context.Background(), "other")
+	if err != nil {
+		t.Fatalf("lock error: %v", err)
+	}
+	unlockOther()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := locks.lock(ctx, "device"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the held lock to be waited for until the deadline, got %v", err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		unlock, _ := locks.lock(context.Background(), "device")
+		acquired <- unlock
+	}()
+	unlock()
+	(<-acquired)()
+	if len(locks.locks) != 0 {
+		t.Fatalf("expected released locks to be dropped, got %d", len(locks.locks))
+	}
+}
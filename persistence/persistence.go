@@ -1,11 +1,291 @@
 package persistence
 
 import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
 	"github.com/ksrichard/signing-service-challenge/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/ksrichard/signing-service-challenge/persistence")
+
+const (
+	// maxCommitAttempts is how many times SignData re-signs when the chain head moved underneath it.
+	maxCommitAttempts = 20
+	// maxBatchCommitAttempts is how many times SignBatch re-signs a whole batch when the chain head moved underneath
+	// it, kept small as every attempt signs every item again.
+	maxBatchCommitAttempts = 3
+	// commitBackoff is the upper bound of the random pause between two commit attempts.
+	commitBackoff = 5 * time.Millisecond
+)
+
+// SignatureDeviceStore persists signature devices and their chain heads, partitioned by tenant.
+// Implementations must honour the cancellation and deadline of the given contexts.
 type SignatureDeviceStore interface {
-	Add(device *domain.SignatureDevice) error
-	Get(id string) (*domain.SignatureDevice, error)
-	List() ([]*domain.SignatureDevice, error)
+	// Add stores a new device in the partition of its tenant.
+	// It returns domain.ErrTenantQuotaExceeded if the tenant already owns maxDevices devices (0 means unlimited).
+	Add(ctx context.Context, device *domain.SignatureDevice, maxDevices int) error
+	Get(ctx context.Context, tenantID string, id string) (*domain.SignatureDevice, error)
+	List(ctx context.Context, tenantID string) ([]*domain.SignatureDevice, error)
+	// CommitSignature atomically advances the chain head of the device past the given result and appends it to the
+	// signature log of the device. It returns domain.ErrChainConflict if the stored head is no longer at result.Counter.
+	CommitSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult) error
+	// CommitSignatures is CommitSignature for the consecutive results of a batch (see domain.SignatureDevice.SignBatchAt),
+	// it commits all of them in one atomic step or none of them.
+	CommitSignatures(ctx context.Context, device *domain.SignatureDevice, results []domain.SignDataResult) error
+	// CommitIdempotentSignature is CommitSignature for a request with an idempotency key, it stores the record of the
+	// key in the same atomic step. It returns ErrIdempotencyKeyExists if an unexpired record of the key exists.
+	CommitIdempotentSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult, record domain.IdempotencyRecord) error
+	// GetIdempotencyRecord returns the unexpired record of an idempotency key of the device.
+	// It returns ErrIdempotencyRecordNotFound if there is none.
+	GetIdempotencyRecord(ctx context.Context, tenantID string, id string, key string) (*domain.IdempotencyRecord, error)
+	// ListSignatures returns up to limit committed signatures of the device from the given counter on, oldest first.
+	// Signatures no longer retained in the signature log are skipped, the first one returned then has a later counter.
+	ListSignatures(ctx context.Context, tenantID string, id string, from uint64, limit int) ([]domain.SignDataResult, error)
+	// SetState changes the lifecycle state of the device and returns the updated device.
+	SetState(ctx context.Context, tenantID string, id string, state domain.DeviceState) (*domain.SignatureDevice, error)
+	// RotateKey atomically replaces the key of the device with the current key of the rotated device (see domain.SignatureDevice.WithKey).
+	// It returns domain.ErrChainConflict if the stored chain head or key moved since the rotated device was derived.
+	RotateKey(ctx context.Context, rotated *domain.SignatureDevice) error
+	// Ping checks that the store is reachable.
+	Ping(ctx context.Context) error
+}
+
+// SignData signs data with the device stored under id in the partition of the tenant and commits the new chain head.
+// Signing is serialised per device within the process (see signingLocks). If another writer advanced the chain in
+// the meantime, the device is reloaded and the data is signed again.
+func SignData(ctx context.Context, store SignatureDeviceStore, tenantID string, id string, data string) (result domain.SignDataResult, err error) {
+	ctx, span := tracer.Start(ctx, "persistence.SignData", trace.WithAttributes(
+		attribute.String("tenant.id", tenantID),
+		attribute.String("device.id", id),
+	))
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	for attempt := 0; attempt < maxCommitAttempts; attempt++ {
+		span.SetAttributes(attribute.Int("commit.attempts", attempt+1))
+		var result domain.SignDataResult
+		err := withSigningLock(ctx, tenantID, id, func() error {
+			device, err := store.Get(ctx, tenantID, id)
+			if err != nil {
+				return err
+			}
+			if result, err = device.SignDataAt(ctx, device.Head(), data); err != nil {
+				return err
+			}
+			return store.CommitSignature(ctx, device, result)
+		})
+		if errors.Is(err, domain.ErrChainConflict) {
+			span.AddEvent("chain conflict, signing again")
+			if err := sleep(ctx, rand.N(commitBackoff)); err != nil {
+				return domain.SignDataResult{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return domain.SignDataResult{}, err
+		}
+		return result, nil
+	}
+	return domain.SignDataResult{}, domain.ErrChainConflict
+}
+
+// SignBatch signs the data items in order as consecutive chain entries of the device stored under id in the partition
+// of the tenant and commits them in one step: either every item becomes part of the chain or none does.
+// Signing is serialised per device within the process like SignData, so batches do not conflict with the signatures
+// of the same process. If another writer advanced the chain in the meantime, the device is reloaded and the whole
+// batch is signed again, at most maxBatchCommitAttempts times.
+func SignBatch(ctx context.Context, store SignatureDeviceStore, tenantID string, id string, data []string) (results []domain.SignDataResult, err error) {
+	ctx, span := tracer.Start(ctx, "persistence.SignBatch", trace.WithAttributes(
+		attribute.String("tenant.id", tenantID),
+		attribute.String("device.id", id),
+		attribute.Int("batch.size", len(data)),
+	))
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	for attempt := 0; attempt < maxBatchCommitAttempts; attempt++ {
+		span.SetAttributes(attribute.Int("commit.attempts", attempt+1))
+		var results []domain.SignDataResult
+		err := withSigningLock(ctx, tenantID, id, func() error {
+			device, err := store.Get(ctx, tenantID, id)
+			if err != nil {
+				return err
+			}
+			if results, err = device.SignBatchAt(ctx, device.Head(), data); err != nil {
+				return err
+			}
+			return store.CommitSignatures(ctx, device, results)
+		})
+		if errors.Is(err, domain.ErrChainConflict) {
+			span.AddEvent("chain conflict, signing the batch again")
+			if err := sleep(ctx, rand.N(commitBackoff)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+	return nil, domain.ErrChainConflict
+}
+
+// SignDataIdempotent is SignData for a request with an idempotency key: if the key was already used for the device
+// within the retention, the signature of the first request is returned with replayed set instead of signing again.
+// It fails with domain.ErrIdempotencyKeyReused if the key was used to sign different data.
+func SignDataIdempotent(
+	ctx context.Context,
+	store SignatureDeviceStore,
+	tenantID string,
+	id string,
+	data string,
+	key string,
+	retention time.Duration,
+) (result domain.SignDataResult, replayed bool, err error) {
+	ctx, span := tracer.Start(ctx, "persistence.SignDataIdempotent", trace.WithAttributes(
+		attribute.String("tenant.id", tenantID),
+		attribute.String("device.id", id),
+	))
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.SetAttributes(attribute.Bool("idempotency.replayed", replayed))
+		span.End()
+	}()
+
+	if retention <= 0 {
+		retention = domain.DefaultIdempotencyRetention
+	}
+	requestHash := domain.IdempotencyRequestHash(data)
+	for attempt := 0; attempt < maxCommitAttempts; attempt++ {
+		span.SetAttributes(attribute.Int("commit.attempts", attempt+1))
+		var result domain.SignDataResult
+		var replayed bool
+		// the record is looked up under the lock, so retries in the same process wait for the first request
+		err := withSigningLock(ctx, tenantID, id, func() error {
+			record, err := store.GetIdempotencyRecord(ctx, tenantID, id, key)
+			if err == nil {
+				if record.RequestHash != requestHash {
+					return domain.ErrIdempotencyKeyReused
+				}
+				result, replayed = record.Result, true
+				return nil
+			}
+			if !errors.Is(err, ErrIdempotencyRecordNotFound) {
+				return err
+			}
+
+			device, err := store.Get(ctx, tenantID, id)
+			if err != nil {
+				return err
+			}
+			if result, err = device.SignDataAt(ctx, device.Head(), data); err != nil {
+				return err
+			}
+			return store.CommitIdempotentSignature(ctx, device, result, domain.IdempotencyRecord{
+				Key:         key,
+				RequestHash: requestHash,
+				Result:      result,
+				ExpiresAt:   time.Now().Add(retention),
+			})
+		})
+		if errors.Is(err, ErrIdempotencyKeyExists) {
+			// a concurrent request with the same key won, its record is read on the next attempt
+			span.AddEvent("idempotency key committed concurrently")
+			continue
+		}
+		if errors.Is(err, domain.ErrChainConflict) {
+			span.AddEvent("chain conflict, signing again")
+			if err := sleep(ctx, rand.N(commitBackoff)); err != nil {
+				return domain.SignDataResult{}, false, err
+			}
+			continue
+		}
+		if err != nil {
+			return domain.SignDataResult{}, false, err
+		}
+		return result, replayed, nil
+	}
+	return domain.SignDataResult{}, false, domain.ErrChainConflict
+}
+
+// RotateKey rotates the key of the device stored under id in the partition of the tenant to the given key pair.
+// Signatures committed in the meantime are retried the same way as in SignData, so the new key
+// takes over exactly at the chain head it is committed at.
+func RotateKey(
+	ctx context.Context,
+	store SignatureDeviceStore,
+	signerStore *crypto.SignerStore,
+	tenantID string,
+	id string,
+	public []byte,
+	private []byte,
+) (rotated *domain.SignatureDevice, err error) {
+	ctx, span := tracer.Start(ctx, "persistence.RotateKey", trace.WithAttributes(
+		attribute.String("tenant.id", tenantID),
+		attribute.String("device.id", id),
+	))
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	for attempt := 0; attempt < maxCommitAttempts; attempt++ {
+		span.SetAttributes(attribute.Int("commit.attempts", attempt+1))
+		var rotated *domain.SignatureDevice
+		err := withSigningLock(ctx, tenantID, id, func() error {
+			device, err := store.Get(ctx, tenantID, id)
+			if err != nil {
+				return err
+			}
+			if rotated, err = device.WithKey(signerStore, public, private); err != nil {
+				return err
+			}
+			return store.RotateKey(ctx, rotated)
+		})
+		if errors.Is(err, domain.ErrChainConflict) {
+			span.AddEvent("chain conflict, rotating again")
+			if err := sleep(ctx, rand.N(commitBackoff)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return rotated, nil
+	}
+	return nil, domain.ErrChainConflict
+}
+
+// sleep pauses for the given duration or until the context ends.
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
@@ -0,0 +1,458 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisFieldTenantID      = "tenant_id"
+	redisFieldAlgorithm     = "algorithm"
+	redisFieldPrivateKey    = "private_key"
+	redisFieldPublicKey     = "public_key"
+	redisFieldLabel         = "label"
+	redisFieldState         = "state"
+	redisFieldCounter       = "counter"
+	redisFieldLastSignature = "last_signature"
+	redisFieldKeyVersion    = "key_version"
+	redisFieldKeys          = "keys"
+)
+
+// addDeviceScript stores a new device unless its tenant already reached the device quota.
+// KEYS[1] is the device hash, KEYS[2] the device index of the tenant, ARGV[1] the quota (0 means unlimited),
+// ARGV[2] the device ID and the remaining arguments the field/value pairs of the device hash.
+// It returns 0 if the quota is exceeded and 1 on success.
+var addDeviceScript = redis.NewScript(`
+local max = tonumber(ARGV[1])
+if max > 0 and redis.call('SCARD', KEYS[2]) >= max then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 3))
+redis.call('SADD', KEYS[2], ARGV[2])
+return 1
+`)
+
+// commitSignatureScript reserves the next counters, swaps the last signature and appends the signatures to the log
+// of the device in one server-side step, storing the record of an idempotency key if given.
+// KEYS[1] is the device hash, KEYS[2] the signature log, the optional KEYS[3] the idempotency record,
+// ARGV[1] the expected counter, ARGV[2] the next counter, ARGV[3] the new last signature, ARGV[4] the key version the
+// signatures were created with (devices stored without one are at version 1), ARGV[5] the idempotency record and
+// ARGV[6] its retention in milliseconds (both empty without a record), ARGV[7] the number of log entries to retain
+// (0 means all) and the remaining arguments the log entries.
+// It returns -1 if the device does not exist, -2 if it is not active, -3 if the idempotency record exists,
+// 0 on a chain conflict and 1 on success.
+var commitSignatureScript = redis.NewScript(`
+local fields = redis.call('HMGET', KEYS[1], 'counter', 'state', 'key_version')
+if not fields[1] then
+	return -1
+end
+if fields[2] and fields[2] ~= '' and fields[2] ~= 'active' then
+	return -2
+end
+if KEYS[3] and redis.call('EXISTS', KEYS[3]) == 1 then
+	return -3
+end
+if fields[1] ~= ARGV[1] or (fields[3] or '1') ~= ARGV[4] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'counter', ARGV[2], 'last_signature', ARGV[3])
+redis.call('RPUSH', KEYS[2], unpack(ARGV, 8))
+local retention = tonumber(ARGV[7])
+if retention > 0 then
+	redis.call('LTRIM', KEYS[2], -retention, -1)
+end
+if KEYS[3] then
+	redis.call('SET', KEYS[3], ARGV[5], 'PX', ARGV[6])
+end
+return 1
+`)
+
+// listSignaturesScript reads a page of the signature log of a device in one server-side step, so a retention trim of
+// a concurrent commit can not shift the page. The log ends with the signature before the counter of the device, so
+// its first entry has the counter minus the length of the log.
+// KEYS[1] is the device hash, KEYS[2] the signature log, ARGV[1] the first counter to read and ARGV[2] the maximum
+// number of entries. It returns nil if the device does not exist and the log entries otherwise.
+var listSignaturesScript = redis.NewScript(`
+local counter = redis.call('HGET', KEYS[1], 'counter')
+if not counter then
+	return false
+end
+local first = tonumber(counter) - redis.call('LLEN', KEYS[2])
+local start = 0
+if tonumber(ARGV[1]) > first then
+	start = tonumber(ARGV[1]) - first
+end
+return redis.call('LRANGE', KEYS[2], start, start + tonumber(ARGV[2]) - 1)
+`)
+
+// setStateScript changes the state of an existing device.
+// KEYS[1] is the device hash and ARGV[1] the new state. It returns -1 if the device does not exist and 1 on success.
+var setStateScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+redis.call('HSET', KEYS[1], 'state', ARGV[1])
+return 1
+`)
+
+// rotateKeyScript swaps the key of a device unless its chain head or key moved.
+// KEYS[1] is the device hash, ARGV[1] the expected counter, ARGV[2] the expected key version
+// and the remaining arguments the field/value pairs of the new key.
+// It returns -1 if the device does not exist, 0 on a chain conflict and 1 on success.
+var rotateKeyScript = redis.NewScript(`
+local fields = redis.call('HMGET', KEYS[1], 'counter', 'key_version')
+if not fields[1] then
+	return -1
+end
+if fields[1] ~= ARGV[1] or (fields[2] or '1') ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 3))
+return 1
+`)
+
+// RedisSignatureDeviceStore keeps signature devices and their chain heads in a Redis compatible server,
+// so several service instances can share them.
+// All keys of a tenant share a hash tag, so they live in the same slot of a Redis cluster.
+type RedisSignatureDeviceStore struct {
+	client      redis.UniversalClient
+	signerStore *crypto.SignerStore
+	// logRetention is the number of signatures kept in the log of a device, 0 means all
+	logRetention int
+}
+
+// NewRedisSignatureDeviceStore creates a new RedisSignatureDeviceStore.
+// The signer store is used to rebuild the signers of devices loaded from Redis.
+func NewRedisSignatureDeviceStore(client redis.UniversalClient, signerStore *crypto.SignerStore) *RedisSignatureDeviceStore {
+	return &RedisSignatureDeviceStore{
+		client:      client,
+		signerStore: signerStore,
+	}
+}
+
+// SetSignatureLogRetention limits the signature log of every device to its last entries signatures when signatures
+// are committed, 0 (the default) keeps all of them. It must be called before the store is used.
+func (s *RedisSignatureDeviceStore) SetSignatureLogRetention(entries int) {
+	s.logRetention = entries
+}
+
+func redisDeviceKey(tenantID string, id string) string {
+	return fmt.Sprintf("tenant:{%s}:signature-device:%s", tenantID, id)
+}
+
+func redisDeviceIndexKey(tenantID string) string {
+	return fmt.Sprintf("tenant:{%s}:signature-devices", tenantID)
+}
+
+func redisSignatureLogKey(tenantID string, id string) string {
+	return fmt.Sprintf("tenant:{%s}:signature-device:%s:signatures", tenantID, id)
+}
+
+func redisIdempotencyKey(tenantID string, id string, key string) string {
+	return fmt.Sprintf("tenant:{%s}:signature-device:%s:idempotency:%s", tenantID, id, key)
+}
+
+// redisIdempotencyRecord is the record of an idempotency key, it expires with the key holding it.
+type redisIdempotencyRecord struct {
+	RequestHash string         `json:"request_hash"`
+	Result      redisSignature `json:"result"`
+	ExpiresAt   time.Time      `json:"expires_at"`
+}
+
+// redisSignature is an entry of the signature log of a device.
+type redisSignature struct {
+	Counter    uint64 `json:"counter"`
+	Signature  string `json:"signature"`
+	SignedData string `json:"signed_data"`
+	KeyVersion uint64 `json:"key_version"`
+}
+
+func (s *RedisSignatureDeviceStore) Add(ctx context.Context, device *domain.SignatureDevice, maxDevices int) error {
+	record := device.Record()
+	id := device.GetIDStr()
+	keys, err := json.Marshal(record.Keys)
+	if err != nil {
+		return err
+	}
+	status, err := addDeviceScript.Run(
+		ctx,
+		s.client,
+		[]string{redisDeviceKey(record.TenantID, id), redisDeviceIndexKey(record.TenantID)},
+		maxDevices,
+		id,
+		redisFieldTenantID, record.TenantID,
+		redisFieldAlgorithm, string(record.Algorithm),
+		redisFieldPrivateKey, record.PrivateKey,
+		redisFieldPublicKey, record.PublicKey,
+		redisFieldLabel, record.Label,
+		redisFieldState, string(record.State),
+		redisFieldCounter, strconv.FormatUint(record.Counter, 10),
+		redisFieldLastSignature, record.LastSignature,
+		redisFieldKeyVersion, strconv.FormatUint(device.KeyVersion(), 10),
+		redisFieldKeys, keys,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if status == 0 {
+		return domain.ErrTenantQuotaExceeded
+	}
+	return nil
+}
+
+func (s *RedisSignatureDeviceStore) Get(ctx context.Context, tenantID string, id string) (*domain.SignatureDevice, error) {
+	fields, err := s.client.HGetAll(ctx, redisDeviceKey(tenantID, id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrDeviceNotFound
+	}
+	return s.restore(id, fields)
+}
+
+func (s *RedisSignatureDeviceStore) List(ctx context.Context, tenantID string) ([]*domain.SignatureDevice, error) {
+	ids, err := s.client.SMembers(ctx, redisDeviceIndexKey(tenantID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, redisDeviceKey(tenantID, id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*domain.SignatureDevice
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		device, err := s.restore(ids[i], fields)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, device)
+	}
+	return result, nil
+}
+
+func (s *RedisSignatureDeviceStore) CommitSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult) error {
+	return s.commit(ctx, device, []domain.SignDataResult{result}, nil)
+}
+
+func (s *RedisSignatureDeviceStore) CommitSignatures(ctx context.Context, device *domain.SignatureDevice, results []domain.SignDataResult) error {
+	return s.commit(ctx, device, results, nil)
+}
+
+func (s *RedisSignatureDeviceStore) CommitIdempotentSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult, record domain.IdempotencyRecord) error {
+	return s.commit(ctx, device, []domain.SignDataResult{result}, &record)
+}
+
+// commit runs commitSignatureScript for consecutive results, storing the idempotency record if not nil.
+func (s *RedisSignatureDeviceStore) commit(ctx context.Context, device *domain.SignatureDevice, results []domain.SignDataResult, record *domain.IdempotencyRecord) error {
+	if len(results) == 0 {
+		return nil
+	}
+	first, last := results[0], results[len(results)-1]
+	// the script only checks the first counter and the key version, the rest of the batch must follow on
+	for i, result := range results {
+		if result.Counter != first.Counter+uint64(i) || result.KeyVersion != first.KeyVersion {
+			return domain.ErrChainConflict
+		}
+	}
+
+	keys := []string{redisDeviceKey(device.TenantID, device.GetIDStr()), redisSignatureLogKey(device.TenantID, device.GetIDStr())}
+	args := []any{
+		strconv.FormatUint(first.Counter, 10),
+		strconv.FormatUint(last.Counter+1, 10),
+		last.Signature,
+		strconv.FormatUint(first.KeyVersion, 10),
+		"",
+		"",
+		s.logRetention,
+	}
+	if record != nil {
+		value, err := json.Marshal(redisIdempotencyRecord{
+			RequestHash: record.RequestHash,
+			Result:      redisSignature(record.Result),
+			ExpiresAt:   record.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		// the record expires with its key, at least a millisecond after the commit
+		retention := max(time.Until(record.ExpiresAt).Milliseconds(), 1)
+		keys = append(keys, redisIdempotencyKey(device.TenantID, device.GetIDStr(), record.Key))
+		args[4], args[5] = value, retention
+	}
+	for _, result := range results {
+		entry, err := json.Marshal(redisSignature(result))
+		if err != nil {
+			return err
+		}
+		args = append(args, entry)
+	}
+	status, err := commitSignatureScript.Run(ctx, s.client, keys, args...).Int()
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case -1:
+		return ErrDeviceNotFound
+	case -2:
+		return domain.ErrDeviceNotActive
+	case -3:
+		return ErrIdempotencyKeyExists
+	case 0:
+		return domain.ErrChainConflict
+	}
+
+	// keep the caller's copy in line with the stored head
+	return device.AdvanceBatch(results)
+}
+
+func (s *RedisSignatureDeviceStore) GetIdempotencyRecord(ctx context.Context, tenantID string, id string, key string) (*domain.IdempotencyRecord, error) {
+	value, err := s.client.Get(ctx, redisIdempotencyKey(tenantID, id, key)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrIdempotencyRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored redisIdempotencyRecord
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, fmt.Errorf("invalid stored idempotency record: %w", err)
+	}
+	return &domain.IdempotencyRecord{
+		Key:         key,
+		RequestHash: stored.RequestHash,
+		Result:      domain.SignDataResult(stored.Result),
+		ExpiresAt:   stored.ExpiresAt,
+	}, nil
+}
+
+// ListSignatures reads the signature log of the device. Devices stored before signatures were logged have a log
+// starting at the first signature created afterwards and logs limited by SetSignatureLogRetention start at the oldest
+// retained signature, earlier counters are not returned.
+func (s *RedisSignatureDeviceStore) ListSignatures(ctx context.Context, tenantID string, id string, from uint64, limit int) ([]domain.SignDataResult, error) {
+	keys := []string{redisDeviceKey(tenantID, id), redisSignatureLogKey(tenantID, id)}
+	entries, err := listSignaturesScript.Run(ctx, s.client, keys, from, limit).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	signatures := []domain.SignDataResult{}
+	for _, entry := range entries {
+		var signature redisSignature
+		if err := json.Unmarshal([]byte(entry), &signature); err != nil {
+			return nil, fmt.Errorf("invalid stored signature: %w", err)
+		}
+		signatures = append(signatures, domain.SignDataResult(signature))
+	}
+	return signatures, nil
+}
+
+func (s *RedisSignatureDeviceStore) SetState(ctx context.Context, tenantID string, id string, state domain.DeviceState) (*domain.SignatureDevice, error) {
+	if !state.Valid() {
+		return nil, domain.ErrInvalidState
+	}
+	status, err := setStateScript.Run(ctx, s.client, []string{redisDeviceKey(tenantID, id)}, string(state)).Int()
+	if err != nil {
+		return nil, err
+	}
+	if status == -1 {
+		return nil, ErrDeviceNotFound
+	}
+	return s.Get(ctx, tenantID, id)
+}
+
+func (s *RedisSignatureDeviceStore) RotateKey(ctx context.Context, rotated *domain.SignatureDevice) error {
+	record := rotated.Record()
+	keys, err := json.Marshal(record.Keys)
+	if err != nil {
+		return err
+	}
+	current := record.Keys[len(record.Keys)-1]
+	status, err := rotateKeyScript.Run(
+		ctx,
+		s.client,
+		[]string{redisDeviceKey(record.TenantID, rotated.GetIDStr())},
+		strconv.FormatUint(current.FirstCounter, 10),
+		strconv.FormatUint(current.Version-1, 10),
+		redisFieldPrivateKey, record.PrivateKey,
+		redisFieldPublicKey, record.PublicKey,
+		redisFieldKeyVersion, strconv.FormatUint(current.Version, 10),
+		redisFieldKeys, keys,
+	).Int()
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case -1:
+		return ErrDeviceNotFound
+	case 0:
+		return domain.ErrChainConflict
+	}
+	return nil
+}
+
+// Ping checks that Redis is reachable.
+func (s *RedisSignatureDeviceStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close closes the Redis client once no more commits are pending, e.g. after the server drained its requests.
+func (s *RedisSignatureDeviceStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisSignatureDeviceStore) restore(id string, fields map[string]string) (*domain.SignatureDevice, error) {
+	deviceID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	counter, err := strconv.ParseUint(fields[redisFieldCounter], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored signature counter: %w", err)
+	}
+	// devices stored before keys could be rotated have no key history
+	var keys []domain.PublicKeyVersion
+	if stored := fields[redisFieldKeys]; stored != "" {
+		if err := json.Unmarshal([]byte(stored), &keys); err != nil {
+			return nil, fmt.Errorf("invalid stored key history: %w", err)
+		}
+	}
+
+	return domain.RestoreSignatureDevice(s.signerStore, domain.SignatureDeviceRecord{
+		ID:            deviceID,
+		TenantID:      fields[redisFieldTenantID],
+		Algorithm:     crypto.SignatureAlgorithm(fields[redisFieldAlgorithm]),
+		PrivateKey:    []byte(fields[redisFieldPrivateKey]),
+		PublicKey:     []byte(fields[redisFieldPublicKey]),
+		Label:         fields[redisFieldLabel],
+		State:         domain.DeviceState(fields[redisFieldState]),
+		Counter:       counter,
+		LastSignature: fields[redisFieldLastSignature],
+		Keys:          keys,
+	})
+}
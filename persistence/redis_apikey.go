@@ -0,0 +1,140 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisAPIKeyKey is the key of an API key, looked up by its hash when authenticating requests of any tenant.
+func redisAPIKeyKey(hash string) string {
+	return fmt.Sprintf("api-key:%s", hash)
+}
+
+// redisAPIKeyIndexKey is the hash mapping the IDs of the API keys of a tenant to their hashes.
+func redisAPIKeyIndexKey(tenantID string) string {
+	return fmt.Sprintf("tenant:{%s}:api-keys", tenantID)
+}
+
+// redisAPIKey is the JSON form of an API key.
+type redisAPIKey struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenant_id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RedisAPIKeyStore keeps the API keys in a Redis compatible server, so every service instance accepts the keys created
+// on any of them. A key is stored under its hash and indexed in a hash of its tenant, which live in different slots of
+// a Redis cluster: Add writes the key before the index and Delete removes the key before the index, so an interrupted
+// call leaves at most an index entry of a key which no longer authenticates.
+type RedisAPIKeyStore struct {
+	client redis.UniversalClient
+}
+
+func NewRedisAPIKeyStore(client redis.UniversalClient) *RedisAPIKeyStore {
+	return &RedisAPIKeyStore{client: client}
+}
+
+func (s *RedisAPIKeyStore) Add(ctx context.Context, key *domain.APIKey) error {
+	value, err := json.Marshal(redisAPIKey{
+		ID:        key.ID,
+		TenantID:  key.TenantID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.client.Set(ctx, redisAPIKeyKey(key.Hash), value, 0).Err(); err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, redisAPIKeyIndexKey(key.TenantID), key.ID, key.Hash).Err()
+}
+
+func (s *RedisAPIKeyStore) GetByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	value, err := s.client.Get(ctx, redisAPIKeyKey(hash)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return restoreAPIKey(hash, value)
+}
+
+func (s *RedisAPIKeyStore) List(ctx context.Context, tenantID string) ([]*domain.APIKey, error) {
+	index, err := s.client.HGetAll(ctx, redisAPIKeyIndexKey(tenantID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(index))
+	cmds := make([]*redis.StringCmd, 0, len(index))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, hash := range index {
+			hashes = append(hashes, hash)
+			cmds = append(cmds, pipe.Get(ctx, redisAPIKeyKey(hash)))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	var result []*domain.APIKey
+	for i, cmd := range cmds {
+		value, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			// left behind by an interrupted Delete
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		key, err := restoreAPIKey(hashes[i], value)
+		if err != nil {
+			return nil, err
+		}
+		if key.TenantID == tenantID {
+			result = append(result, key)
+		}
+	}
+	return result, nil
+}
+
+func (s *RedisAPIKeyStore) Delete(ctx context.Context, tenantID string, id string) error {
+	hash, err := s.client.HGet(ctx, redisAPIKeyIndexKey(tenantID), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.client.Del(ctx, redisAPIKeyKey(hash)).Err(); err != nil {
+		return err
+	}
+	return s.client.HDel(ctx, redisAPIKeyIndexKey(tenantID), id).Err()
+}
+
+func restoreAPIKey(hash string, value string) (*domain.APIKey, error) {
+	var stored redisAPIKey
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, fmt.Errorf("invalid stored api key: %w", err)
+	}
+	return &domain.APIKey{
+		ID:        stored.ID,
+		TenantID:  stored.TenantID,
+		Name:      stored.Name,
+		Hash:      hash,
+		Scopes:    stored.Scopes,
+		CreatedAt: stored.CreatedAt,
+	}, nil
+}
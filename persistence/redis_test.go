@@ -0,0 +1,309 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// helper to create a RedisSignatureDeviceStore backed by an in-process Redis stand-in
+func newTestRedisStore(t *testing.T) (*RedisSignatureDeviceStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	ss := crypto.NewSignerStore(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+		crypto.RSA: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewRSASigner(privateKey) },
+	})
+	return NewRedisSignatureDeviceStore(client, &ss), server
+}
+
+// helper to create a client of a fresh in-memory Redis server
+func newTestRedisClient(t *testing.T) redis.UniversalClient {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestRedisSignatureDeviceStore_AddGetList(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+
+	dev1 := newTestDevice(t, "one")
+	dev2 := newTestDevice(t, "two")
+	if err := store.Add(context.Background(), dev1, 0); err != nil {
+		t.Fatalf("Add(dev1) error: %v", err)
+	}
+	if err := store.Add(context.Background(), dev2, 0); err != nil {
+		t.Fatalf("Add(dev2) error: %v", err)
+	}
+
+	got1, err := store.Get(context.Background(), domain.DefaultTenantID, dev1.GetIDStr())
+	if err != nil {
+		t.Fatalf("Get(dev1) error: %v", err)
+	}
+	if got1.GetIDStr() != dev1.GetIDStr() || got1.Label != "one" || got1.Algorithm != crypto.RSA || got1.State != domain.StateActive {
+		t.Fatalf("Get returned unexpected device: %+v", got1.Record())
+	}
+	if string(got1.PublicKey) != string(dev1.PublicKey) {
+		t.Fatalf("public key was not preserved")
+	}
+
+	list, err := store.List(context.Background(), domain.DefaultTenantID)
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected list length 2, got %d", len(list))
+	}
+}
+
+func TestRedisSignatureDeviceStore_Get_NotFound(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	_, err := store.Get(context.Background(), domain.DefaultTenantID, "doesnotexist")
+	if !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
+	}
+}
+
+func TestRedisSignatureDeviceStore_CommitSignature(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	dev := newTestDevice(t, "chain")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	res1, err := SignData(context.Background(), store, domain.DefaultTenantID, dev.GetIDStr(), "first")
+	if err != nil {
+		t.Fatalf("SignData 1 error: %v", err)
+	}
+	res2, err := SignData(context.Background(), store, domain.DefaultTenantID, dev.GetIDStr(), "second")
+	if err != nil {
+		t.Fatalf("SignData 2 error: %v", err)
+	}
+	if res1.Counter != 0 || res2.Counter != 1 {
+		t.Fatalf("unexpected counters: %d, %d", res1.Counter, res2.Counter)
+	}
+	if want := "1_second_" + res1.Signature; res2.SignedData != want {
+		t.Fatalf("second signed data should link to first signature, got %s", res2.SignedData)
+	}
+
+	if got := server.HGet(redisDeviceKey(domain.DefaultTenantID, dev.GetIDStr()), redisFieldCounter); got != "2" {
+		t.Fatalf("expected stored counter 2, got %s", got)
+	}
+	if got := server.HGet(redisDeviceKey(domain.DefaultTenantID, dev.GetIDStr()), redisFieldLastSignature); got != res2.Signature {
+		t.Fatalf("stored last signature mismatch")
+	}
+
+	// committing a result for an outdated head must be rejected
+	stale, err := store.Get(context.Background(), domain.DefaultTenantID, dev.GetIDStr())
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	err = store.CommitSignature(context.Background(), stale, domain.SignDataResult{Counter: 1, Signature: "stale"})
+	if !errors.Is(err, domain.ErrChainConflict) {
+		t.Fatalf("expected ErrChainConflict, got %v", err)
+	}
+}
+
+func TestRedisSignatureDeviceStore_ConcurrentInstances(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	dev := newTestDevice(t, "shared")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	// a second store instance on the same server behaves like another service replica
+	other := NewRedisSignatureDeviceStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), store.signerStore)
+	stores := []SignatureDeviceStore{store, other}
+
+	const signatures = 20
+	var wg sync.WaitGroup
+	counters := make(chan uint64, signatures)
+	for i := 0; i < signatures; i++ {
+		wg.Add(1)
+		go func(s SignatureDeviceStore) {
+			defer wg.Done()
+			res, err := SignData(context.Background(), s, domain.DefaultTenantID, dev.GetIDStr(), "data")
+			if err != nil {
+				t.Errorf("SignData error: %v", err)
+				return
+			}
+			counters <- res.Counter
+		}(stores[i%len(stores)])
+	}
+	wg.Wait()
+	close(counters)
+
+	seen := make(map[uint64]bool)
+	for c := range counters {
+		if seen[c] {
+			t.Fatalf("counter %d was produced twice", c)
+		}
+		seen[c] = true
+	}
+	if len(seen) != signatures {
+		t.Fatalf("expected %d distinct counters, got %d", signatures, len(seen))
+	}
+}
+
+func TestRedisSignatureDeviceStore_TenantsAndQuota(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	dev := newTestDevice(t, "acme device")
+	dev.TenantID = "acme"
+	if err := store.Add(context.Background(), dev, 1); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	second := newTestDevice(t, "second")
+	second.TenantID = "acme"
+	if err := store.Add(context.Background(), second, 1); !errors.Is(err, domain.ErrTenantQuotaExceeded) {
+		t.Fatalf("expected ErrTenantQuotaExceeded, got %v", err)
+	}
+
+	got, err := store.Get(context.Background(), "acme", dev.GetIDStr())
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	if got.TenantID != "acme" {
+		t.Fatalf("tenant was not preserved, got %q", got.TenantID)
+	}
+	if _, err := store.Get(context.Background(), domain.DefaultTenantID, dev.GetIDStr()); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound for other tenant, got %v", err)
+	}
+	list, err := store.List(context.Background(), domain.DefaultTenantID)
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("other tenant must not see any devices, got %d", len(list))
+	}
+}
+
+func TestRedisSignatureDeviceStore_Ping(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	if err := store.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping error: %v", err)
+	}
+	server.Close()
+	if err := store.Ping(context.Background()); err == nil {
+		t.Fatalf("expected Ping to fail once Redis is unreachable")
+	}
+}
+
+func TestRedisSignatureDeviceStore_SetStateAndRotateKey(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	dev := newTestDevice(t, "lifecycle")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testSetStateAndRotateKey(t, store, dev)
+}
+
+func TestRedisSignatureDeviceStore_DevicesWithoutKeyHistory(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	dev := newTestDevice(t, "legacy")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	// devices stored before keys could be rotated
+	key := redisDeviceKey(domain.DefaultTenantID, dev.GetIDStr())
+	server.HDel(key, redisFieldKeys)
+	server.HDel(key, redisFieldKeyVersion)
+
+	res, err := SignData(context.Background(), store, domain.DefaultTenantID, dev.GetIDStr(), "data")
+	if err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+	if res.KeyVersion != 1 {
+		t.Fatalf("expected key version 1, got %d", res.KeyVersion)
+	}
+}
+
+func TestRedisSignatureDeviceStore_ListSignatures(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	dev := newTestDevice(t, "log")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testListSignatures(t, store, dev)
+}
+
+func TestRedisSignatureDeviceStore_SignatureLogRetention(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	store.SetSignatureLogRetention(3)
+	dev := newTestDevice(t, "retention")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testSignatureLogRetention(t, store, dev)
+}
+
+func TestRedisSignatureDeviceStore_ListSignatures_DevicesWithoutLog(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	ctx := context.Background()
+	dev := newTestDevice(t, "legacy")
+	if err := store.Add(ctx, dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	for _, data := range []string{"a", "b"} {
+		if _, err := SignData(ctx, store, domain.DefaultTenantID, dev.GetIDStr(), data); err != nil {
+			t.Fatalf("SignData error: %v", err)
+		}
+	}
+	// signatures created before signatures were logged
+	server.Del(redisSignatureLogKey(domain.DefaultTenantID, dev.GetIDStr()))
+	if _, err := SignData(ctx, store, domain.DefaultTenantID, dev.GetIDStr(), "c"); err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+
+	signatures, err := store.ListSignatures(ctx, domain.DefaultTenantID, dev.GetIDStr(), 0, 10)
+	if err != nil || len(signatures) != 1 || signatures[0].Counter != 2 {
+		t.Fatalf("expected the logged signature with counter 2, got %v %v", signatures, err)
+	}
+	if signatures, err := store.ListSignatures(ctx, domain.DefaultTenantID, dev.GetIDStr(), 3, 10); err != nil || len(signatures) != 0 {
+		t.Fatalf("expected no signature after the head, got %v %v", signatures, err)
+	}
+}
+
+func TestRedisSignatureDeviceStore_Idempotency(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	dev := newTestDevice(t, "idempotency")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testIdempotency(t, store, dev, func() { server.FastForward(time.Second) })
+}
+
+func TestRedisSignatureDeviceStore_IdempotencyConcurrently(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	dev := newTestDevice(t, "idempotency")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testIdempotencyConcurrently(t, store, dev)
+}
+
+func TestRedisSignatureDeviceStore_SignBatch(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	dev := newTestDevice(t, "batch")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testSignBatch(t, store, dev)
+}
+
+func TestRedisSignatureDeviceStore_SignBatchConcurrently(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	dev := newTestDevice(t, "busy")
+	if err := store.Add(context.Background(), dev, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	testSignBatchConcurrently(t, store, dev)
+}
@@ -0,0 +1,209 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+func redisWebhookKey(tenantID string) string {
+	return fmt.Sprintf("tenant:{%s}:webhooks", tenantID)
+}
+
+func redisDeadLetterKey(tenantID string) string {
+	return fmt.Sprintf("tenant:{%s}:webhook-dead-letters", tenantID)
+}
+
+// redisWebhookEndpoint is the JSON form of a webhook endpoint in the webhook hash of its tenant.
+type redisWebhookEndpoint struct {
+	URL        string             `json:"url"`
+	EventTypes []domain.EventType `json:"event_types"`
+	Secret     string             `json:"secret"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+// redisDeadLetter is the JSON form of a dead letter in the dead letter hash of its tenant.
+type redisDeadLetter struct {
+	EndpointID string           `json:"endpoint_id"`
+	URL        string           `json:"url"`
+	EventID    string           `json:"event_id"`
+	EventType  domain.EventType `json:"event_type"`
+	Payload    json.RawMessage  `json:"payload"`
+	Attempts   int              `json:"attempts"`
+	LastError  string           `json:"last_error"`
+	FailedAt   time.Time        `json:"failed_at"`
+}
+
+// RedisWebhookStore keeps the webhook endpoints in a Redis compatible server, so several service instances share them.
+// The endpoints of a tenant are the fields of one hash, keyed by endpoint ID.
+type RedisWebhookStore struct {
+	client redis.UniversalClient
+}
+
+func NewRedisWebhookStore(client redis.UniversalClient) *RedisWebhookStore {
+	return &RedisWebhookStore{client: client}
+}
+
+func (s *RedisWebhookStore) Add(ctx context.Context, endpoint *domain.WebhookEndpoint) error {
+	value, err := json.Marshal(redisWebhookEndpoint{
+		URL:        endpoint.URL,
+		EventTypes: endpoint.EventTypes,
+		Secret:     endpoint.Secret,
+		CreatedAt:  endpoint.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, redisWebhookKey(endpoint.TenantID), endpoint.ID, value).Err()
+}
+
+func (s *RedisWebhookStore) Get(ctx context.Context, tenantID string, id string) (*domain.WebhookEndpoint, error) {
+	value, err := s.client.HGet(ctx, redisWebhookKey(tenantID), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return restoreWebhookEndpoint(tenantID, id, value)
+}
+
+// List returns the endpoints of the tenant, oldest first.
+func (s *RedisWebhookStore) List(ctx context.Context, tenantID string) ([]*domain.WebhookEndpoint, error) {
+	values, err := s.client.HGetAll(ctx, redisWebhookKey(tenantID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var result []*domain.WebhookEndpoint
+	for id, value := range values {
+		endpoint, err := restoreWebhookEndpoint(tenantID, id, value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, endpoint)
+	}
+	slices.SortFunc(result, func(a, b *domain.WebhookEndpoint) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return result, nil
+}
+
+func (s *RedisWebhookStore) Delete(ctx context.Context, tenantID string, id string) error {
+	deleted, err := s.client.HDel(ctx, redisWebhookKey(tenantID), id).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func restoreWebhookEndpoint(tenantID string, id string, value string) (*domain.WebhookEndpoint, error) {
+	var stored redisWebhookEndpoint
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, fmt.Errorf("invalid stored webhook endpoint %s: %w", id, err)
+	}
+	return &domain.WebhookEndpoint{
+		ID:         id,
+		TenantID:   tenantID,
+		URL:        stored.URL,
+		EventTypes: stored.EventTypes,
+		Secret:     stored.Secret,
+		CreatedAt:  stored.CreatedAt,
+	}, nil
+}
+
+// RedisDeadLetterStore keeps the dead letters in a Redis compatible server, so they survive restarts and can be
+// redelivered by any service instance. The dead letters of a tenant are the fields of one hash, keyed by ID.
+type RedisDeadLetterStore struct {
+	client redis.UniversalClient
+}
+
+func NewRedisDeadLetterStore(client redis.UniversalClient) *RedisDeadLetterStore {
+	return &RedisDeadLetterStore{client: client}
+}
+
+func (s *RedisDeadLetterStore) Add(ctx context.Context, letter *domain.DeadLetter) error {
+	value, err := json.Marshal(redisDeadLetter{
+		EndpointID: letter.EndpointID,
+		URL:        letter.URL,
+		EventID:    letter.EventID,
+		EventType:  letter.EventType,
+		Payload:    letter.Payload,
+		Attempts:   letter.Attempts,
+		LastError:  letter.LastError,
+		FailedAt:   letter.FailedAt,
+	})
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, redisDeadLetterKey(letter.TenantID), letter.ID, value).Err()
+}
+
+func (s *RedisDeadLetterStore) Get(ctx context.Context, tenantID string, id string) (*domain.DeadLetter, error) {
+	value, err := s.client.HGet(ctx, redisDeadLetterKey(tenantID), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return restoreDeadLetter(tenantID, id, value)
+}
+
+// List returns the dead letters of the tenant, oldest first.
+func (s *RedisDeadLetterStore) List(ctx context.Context, tenantID string) ([]*domain.DeadLetter, error) {
+	values, err := s.client.HGetAll(ctx, redisDeadLetterKey(tenantID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var result []*domain.DeadLetter
+	for id, value := range values {
+		letter, err := restoreDeadLetter(tenantID, id, value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, letter)
+	}
+	slices.SortFunc(result, func(a, b *domain.DeadLetter) int {
+		return a.FailedAt.Compare(b.FailedAt)
+	})
+	return result, nil
+}
+
+func (s *RedisDeadLetterStore) Delete(ctx context.Context, tenantID string, id string) error {
+	deleted, err := s.client.HDel(ctx, redisDeadLetterKey(tenantID), id).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+func restoreDeadLetter(tenantID string, id string, value string) (*domain.DeadLetter, error) {
+	var stored redisDeadLetter
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, fmt.Errorf("invalid stored dead letter %s: %w", id, err)
+	}
+	return &domain.DeadLetter{
+		ID:         id,
+		TenantID:   tenantID,
+		EndpointID: stored.EndpointID,
+		URL:        stored.URL,
+		EventID:    stored.EventID,
+		EventType:  stored.EventType,
+		Payload:    stored.Payload,
+		Attempts:   stored.Attempts,
+		LastError:  stored.LastError,
+		FailedAt:   stored.FailedAt,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+)
+
+// TenantStore provides the tenants known to the service.
+type TenantStore interface {
+	Get(ctx context.Context, id string) (domain.Tenant, error)
+	List(ctx context.Context) ([]domain.Tenant, error)
+}
+
+type InMemoryTenantStore struct {
+	sync.RWMutex
+	tenants map[string]domain.Tenant
+}
+
+func NewInMemoryTenantStore(tenants ...domain.Tenant) *InMemoryTenantStore {
+	store := &InMemoryTenantStore{
+		tenants: make(map[string]domain.Tenant),
+	}
+	for _, tenant := range tenants {
+		store.tenants[tenant.ID] = tenant
+	}
+	return store
+}
+
+func (s *InMemoryTenantStore) Get(ctx context.Context, id string) (domain.Tenant, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Tenant{}, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	tenant, ok := s.tenants[id]
+	if !ok {
+		return domain.Tenant{}, ErrTenantNotFound
+	}
+	return tenant, nil
+}
+
+func (s *InMemoryTenantStore) List(ctx context.Context) ([]domain.Tenant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	tenants := make([]domain.Tenant, 0, len(s.tenants))
+	for _, tenant := range s.tenants {
+		tenants = append(tenants, tenant)
+	}
+	slices.SortFunc(tenants, func(a, b domain.Tenant) int { return strings.Compare(a.ID, b.ID) })
+	return tenants, nil
+}
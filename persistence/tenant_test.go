@@ -0,0 +1,36 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+func TestInMemoryTenantStore_Get(t *testing.T) {
+	store := NewInMemoryTenantStore(domain.Tenant{ID: "acme", MaxDevices: 5})
+
+	tenant, err := store.Get(context.Background(), "acme")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	if tenant.MaxDevices != 5 {
+		t.Fatalf("expected quota 5, got %d", tenant.MaxDevices)
+	}
+	if _, err := store.Get(context.Background(), "globex"); !errors.Is(err, ErrTenantNotFound) {
+		t.Fatalf("expected ErrTenantNotFound, got %v", err)
+	}
+}
+
+func TestInMemoryTenantStore_List(t *testing.T) {
+	store := NewInMemoryTenantStore(domain.Tenant{ID: "globex"}, domain.Tenant{ID: "acme", MaxDevices: 5})
+
+	tenants, err := store.List(context.Background())
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(tenants) != 2 || tenants[0].ID != "acme" || tenants[1].ID != "globex" {
+		t.Fatalf("expected tenants sorted by id, got %+v", tenants)
+	}
+}
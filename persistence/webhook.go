@@ -0,0 +1,171 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook endpoint not found")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+// WebhookStore persists the webhook endpoints of the tenants.
+type WebhookStore interface {
+	Add(ctx context.Context, endpoint *domain.WebhookEndpoint) error
+	Get(ctx context.Context, tenantID string, id string) (*domain.WebhookEndpoint, error)
+	List(ctx context.Context, tenantID string) ([]*domain.WebhookEndpoint, error)
+	Delete(ctx context.Context, tenantID string, id string) error
+}
+
+// DeadLetterStore persists the webhook deliveries which failed every attempt.
+type DeadLetterStore interface {
+	Add(ctx context.Context, letter *domain.DeadLetter) error
+	Get(ctx context.Context, tenantID string, id string) (*domain.DeadLetter, error)
+	List(ctx context.Context, tenantID string) ([]*domain.DeadLetter, error)
+	Delete(ctx context.Context, tenantID string, id string) error
+}
+
+type InMemoryWebhookStore struct {
+	sync.RWMutex
+	// endpoints maps tenant IDs to the endpoints of the tenant
+	endpoints map[string]map[string]*domain.WebhookEndpoint
+}
+
+func NewInMemoryWebhookStore() *InMemoryWebhookStore {
+	return &InMemoryWebhookStore{
+		endpoints: make(map[string]map[string]*domain.WebhookEndpoint),
+	}
+}
+
+func (s *InMemoryWebhookStore) Add(ctx context.Context, endpoint *domain.WebhookEndpoint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	tenantEndpoints, ok := s.endpoints[endpoint.TenantID]
+	if !ok {
+		tenantEndpoints = make(map[string]*domain.WebhookEndpoint)
+		s.endpoints[endpoint.TenantID] = tenantEndpoints
+	}
+	tenantEndpoints[endpoint.ID] = endpoint
+	return nil
+}
+
+func (s *InMemoryWebhookStore) Get(ctx context.Context, tenantID string, id string) (*domain.WebhookEndpoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	endpoint, ok := s.endpoints[tenantID][id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	return endpoint, nil
+}
+
+// List returns the endpoints of the tenant, oldest first.
+func (s *InMemoryWebhookStore) List(ctx context.Context, tenantID string) ([]*domain.WebhookEndpoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	var result []*domain.WebhookEndpoint
+	for _, endpoint := range s.endpoints[tenantID] {
+		result = append(result, endpoint)
+	}
+	slices.SortFunc(result, func(a, b *domain.WebhookEndpoint) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return result, nil
+}
+
+func (s *InMemoryWebhookStore) Delete(ctx context.Context, tenantID string, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.endpoints[tenantID][id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.endpoints[tenantID], id)
+	return nil
+}
+
+type InMemoryDeadLetterStore struct {
+	sync.RWMutex
+	// letters maps tenant IDs to the dead letters of the tenant
+	letters map[string]map[string]*domain.DeadLetter
+}
+
+func NewInMemoryDeadLetterStore() *InMemoryDeadLetterStore {
+	return &InMemoryDeadLetterStore{
+		letters: make(map[string]map[string]*domain.DeadLetter),
+	}
+}
+
+func (s *InMemoryDeadLetterStore) Add(ctx context.Context, letter *domain.DeadLetter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	tenantLetters, ok := s.letters[letter.TenantID]
+	if !ok {
+		tenantLetters = make(map[string]*domain.DeadLetter)
+		s.letters[letter.TenantID] = tenantLetters
+	}
+	tenantLetters[letter.ID] = letter
+	return nil
+}
+
+func (s *InMemoryDeadLetterStore) Get(ctx context.Context, tenantID string, id string) (*domain.DeadLetter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	letter, ok := s.letters[tenantID][id]
+	if !ok {
+		return nil, ErrDeadLetterNotFound
+	}
+	return letter, nil
+}
+
+// List returns the dead letters of the tenant, oldest first.
+func (s *InMemoryDeadLetterStore) List(ctx context.Context, tenantID string) ([]*domain.DeadLetter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	var result []*domain.DeadLetter
+	for _, letter := range s.letters[tenantID] {
+		result = append(result, letter)
+	}
+	slices.SortFunc(result, func(a, b *domain.DeadLetter) int {
+		return a.FailedAt.Compare(b.FailedAt)
+	})
+	return result, nil
+}
+
+func (s *InMemoryDeadLetterStore) Delete(ctx context.Context, tenantID string, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.letters[tenantID][id]; !ok {
+		return ErrDeadLetterNotFound
+	}
+	delete(s.letters[tenantID], id)
+	return nil
+}
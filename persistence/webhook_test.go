@@ -0,0 +1,101 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+func TestInMemoryWebhookStore(t *testing.T) {
+	testWebhookStore(t, NewInMemoryWebhookStore())
+}
+
+func TestRedisWebhookStore(t *testing.T) {
+	testWebhookStore(t, NewRedisWebhookStore(newTestRedisClient(t)))
+}
+
+func testWebhookStore(t *testing.T, store WebhookStore) {
+	endpoint, err := domain.NewWebhookEndpoint("acme", "https://example.com/hook", []domain.EventType{domain.EventSignatureCreated})
+	if err != nil {
+		t.Fatalf("NewWebhookEndpoint error: %v", err)
+	}
+	if err := store.Add(context.Background(), endpoint); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	if _, err := store.Get(context.Background(), "globex", endpoint.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Fatalf("other tenant must not see the endpoint, got %v", err)
+	}
+	got, err := store.Get(context.Background(), "acme", endpoint.ID)
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	if got.URL != endpoint.URL || got.Secret != endpoint.Secret || !got.CreatedAt.Equal(endpoint.CreatedAt) ||
+		len(got.EventTypes) != 1 || got.EventTypes[0] != domain.EventSignatureCreated {
+		t.Fatalf("Get returned unexpected endpoint: %+v", got)
+	}
+	list, err := store.List(context.Background(), "acme")
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected one endpoint, got %d, %v", len(list), err)
+	}
+	if err := store.Delete(context.Background(), "acme", endpoint.ID); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if err := store.Delete(context.Background(), "acme", endpoint.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Fatalf("expected ErrWebhookNotFound after delete, got %v", err)
+	}
+}
+
+func TestInMemoryDeadLetterStore(t *testing.T) {
+	testDeadLetterStore(t, NewInMemoryDeadLetterStore())
+}
+
+func TestRedisDeadLetterStore(t *testing.T) {
+	testDeadLetterStore(t, NewRedisDeadLetterStore(newTestRedisClient(t)))
+}
+
+func testDeadLetterStore(t *testing.T, store DeadLetterStore) {
+	now := time.Now()
+	older := &domain.DeadLetter{ID: "older", TenantID: "acme", EventType: domain.EventSignatureCreated, FailedAt: now.Add(-time.Minute)}
+	letter := &domain.DeadLetter{
+		ID:        "letter",
+		TenantID:  "acme",
+		EventType: domain.EventSignatureCreated,
+		Payload:   json.RawMessage(`{"counter":1}`),
+		Attempts:  3,
+		LastError: "connection refused",
+		FailedAt:  now,
+	}
+	for _, l := range []*domain.DeadLetter{letter, older} {
+		if err := store.Add(context.Background(), l); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+
+	if _, err := store.Get(context.Background(), "globex", letter.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("other tenant must not see the dead letter, got %v", err)
+	}
+	got, err := store.Get(context.Background(), "acme", letter.ID)
+	if err != nil || got.Attempts != 3 || got.LastError != letter.LastError || string(got.Payload) != string(letter.Payload) {
+		t.Fatalf("Get returned unexpected dead letter: %+v, %v", got, err)
+	}
+	list, err := store.List(context.Background(), "acme")
+	if err != nil || len(list) != 2 || list[0].ID != "older" {
+		t.Fatalf("expected the dead letters oldest first, got %v, %v", list, err)
+	}
+	for _, id := range []string{"letter", "older"} {
+		if err := store.Delete(context.Background(), "acme", id); err != nil {
+			t.Fatalf("Delete error: %v", err)
+		}
+	}
+	if list, _ := store.List(context.Background(), "acme"); len(list) != 0 {
+		t.Fatalf("expected no dead letters after delete, got %d", len(list))
+	}
+	if err := store.Delete(context.Background(), "acme", letter.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("expected ErrDeadLetterNotFound after delete, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// sweepInterval is how often buckets which refilled completely are dropped.
+	sweepInterval = time.Minute
+)
+
+// Limit is a token bucket configuration.
+type Limit struct {
+	// Rate is the number of tokens added per second, zero means unlimited.
+	Rate float64
+	// Burst is the capacity of the bucket.
+	Burst int
+}
+
+// Unlimited checks if the limit never rejects.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// Result is the outcome of taking tokens from a bucket.
+type Result struct {
+	Allowed bool
+	// Limit is the capacity of the bucket.
+	Limit int
+	// Remaining is the number of tokens left after this request.
+	Remaining int
+	// RetryAfter is how long to wait until the requested tokens are available, zero if allowed.
+	// Requests for more tokens than the burst are never allowed, they wait until the bucket is full.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// limit is the limit the bucket was last used with
+	limit Limit
+}
+
+// full checks if the bucket would be refilled completely by now.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+// Limiter keeps a token bucket per key, e.g. per client or per device.
+type Limiter struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	sweptAt   time.Time
+	timeNowFn func() time.Time
+}
+
+// NewLimiter creates a new Limiter.
+func NewLimiter() *Limiter {
+	return &Limiter{
+		buckets:   make(map[string]*bucket),
+		timeNowFn: time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of the key, which is created full on first use.
+// The limit is passed on every call so it can differ per key (e.g. per tenant overrides).
+func (l *Limiter) Allow(key string, limit Limit) Result {
+	return l.AllowN(key, limit, 1)
+}
+
+// AllowN takes n tokens from the bucket of the key, e.g. for a batch of n signatures. It takes all of them or,
+// if the bucket cannot cover them, none.
+func (l *Limiter) AllowN(key string, limit Limit, n int) Result {
+	if limit.Unlimited() {
+		return Result{Allowed: true}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.timeNowFn()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	b.limit = limit
+
+	result := Result{Limit: limit.Burst}
+	switch {
+	case b.tokens >= float64(n):
+		b.tokens -= float64(n)
+		result.Allowed = true
+	case n > limit.Burst:
+		result.RetryAfter = secondsToDuration((float64(limit.Burst) - b.tokens) / limit.Rate)
+	default:
+		result.RetryAfter = secondsToDuration((float64(n) - b.tokens) / limit.Rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsToDuration((float64(limit.Burst) - b.tokens) / limit.Rate)
+	return result
+}
+
+// sweep drops the buckets which would be full by now, they are recreated full on demand.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < sweepInterval {
+		return
+	}
+	l.sweptAt = now
+	for key, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
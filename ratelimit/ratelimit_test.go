@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter()
+	limiter.timeNowFn = func() time.Time { return now }
+	limit := Limit{Rate: 2, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		result := limiter.Allow("client", limit)
+		if !result.Allowed {
+			t.Fatalf("request %d should be allowed", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Fatalf("expected %d remaining, got %d", 2-i, result.Remaining)
+		}
+	}
+
+	result := limiter.Allow("client", limit)
+	if result.Allowed {
+		t.Fatalf("request beyond burst should be rejected")
+	}
+	if result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected retry after 500ms, got %s", result.RetryAfter)
+	}
+	if result.Reset != 1500*time.Millisecond {
+		t.Fatalf("expected reset after 1.5s, got %s", result.Reset)
+	}
+
+	// other keys have their own bucket
+	if !limiter.Allow("other", limit).Allowed {
+		t.Fatalf("other key should be allowed")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !limiter.Allow("client", limit).Allowed {
+		t.Fatalf("request after refill should be allowed")
+	}
+}
+
+func TestLimiter_AllowN(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter()
+	limiter.timeNowFn = func() time.Time { return now }
+	limit := Limit{Rate: 2, Burst: 5}
+
+	if result := limiter.AllowN("device", limit, 4); !result.Allowed || result.Remaining != 1 {
+		t.Fatalf("expected 4 tokens to be taken, got %+v", result)
+	}
+	// a batch the bucket cannot cover takes no token
+	result := limiter.AllowN("device", limit, 3)
+	if result.Allowed || result.Remaining != 1 || result.RetryAfter != time.Second {
+		t.Fatalf("expected the batch to be rejected with a retry after 1s, got %+v", result)
+	}
+	if !limiter.Allow("device", limit).Allowed {
+		t.Fatalf("the rejected batch must leave its tokens")
+	}
+	// more tokens than the burst are never available
+	now = now.Add(time.Minute)
+	if result := limiter.AllowN("device", limit, 6); result.Allowed || result.Remaining != 5 {
+		t.Fatalf("expected a batch beyond the burst to be rejected, got %+v", result)
+	}
+}
+
+func TestLimiter_UnlimitedAndSweep(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter()
+	limiter.timeNowFn = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		if !limiter.Allow("client", Limit{}).Allowed {
+			t.Fatalf("unlimited requests must be allowed")
+		}
+	}
+
+	limiter.Allow("client", Limit{Rate: 1, Burst: 1})
+	now = now.Add(2 * sweepInterval)
+	limiter.Allow("other", Limit{Rate: 1, Burst: 1})
+	if _, ok := limiter.buckets["client"]; ok {
+		t.Fatalf("refilled bucket should have been swept")
+	}
+}
@@ -0,0 +1,262 @@
+package stream
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+const (
+	DefaultBuffer     = 64
+	DefaultHistory    = 100
+	DefaultHistoryTTL = 5 * time.Minute
+	DefaultHeartbeat  = 15 * time.Second
+	DefaultPoll       = time.Second
+)
+
+// Config configures the subscriptions of a Broker, zero values are replaced by the defaults.
+type Config struct {
+	// Buffer is the number of events a subscriber may lag behind before it is dropped.
+	Buffer int
+	// History is the number of signatures retained per device to resume subscriptions from.
+	History int
+	// HistoryTTL is how long the history of a device is retained after its last signature.
+	HistoryTTL time.Duration
+	// Heartbeat is the interval of the keep-alive messages of idle streams.
+	Heartbeat time.Duration
+	// Poll is the interval in which streams read the signatures committed by other instances from the store.
+	Poll time.Duration
+}
+
+// withDefaults returns the config with every zero value replaced by its default.
+func (c Config) withDefaults() Config {
+	if c.Buffer == 0 {
+		c.Buffer = DefaultBuffer
+	}
+	if c.History == 0 {
+		c.History = DefaultHistory
+	}
+	if c.HistoryTTL == 0 {
+		c.HistoryTTL = DefaultHistoryTTL
+	}
+	if c.Heartbeat == 0 {
+		c.Heartbeat = DefaultHeartbeat
+	}
+	if c.Poll == 0 {
+		c.Poll = DefaultPoll
+	}
+	return c
+}
+
+// Sequenced is implemented by the data of events which are numbered per device, e.g. by the signature counter.
+// Only those events are retained to resume subscriptions from.
+type Sequenced interface {
+	Sequence() uint64
+}
+
+// Sequence returns the sequence number of an event and whether it has one.
+func Sequence(event domain.Event) (uint64, bool) {
+	sequenced, ok := event.Data.(Sequenced)
+	if !ok {
+		return 0, false
+	}
+	return sequenced.Sequence(), true
+}
+
+type deviceKey struct {
+	tenantID string
+	deviceID string
+}
+
+// device holds the subscribers and the recent sequenced events of a signature device.
+type device struct {
+	subscribers map[*Subscription]struct{}
+	// history is ordered by sequence number.
+	history   []domain.Event
+	updatedAt time.Time
+}
+
+// Subscription receives the events of a single signature device.
+type Subscription struct {
+	key     deviceKey
+	events  chan domain.Event
+	dropped bool
+}
+
+// Events returns the events of the device, the channel is closed once the subscription ends.
+func (s *Subscription) Events() <-chan domain.Event {
+	return s.events
+}
+
+// Broker fans the events of signature devices out to their subscribers in-process.
+// Publishing never blocks: a subscriber which can not keep up is dropped and may resume from the history.
+// The broker only sees the events of its own process, subscribers needing the events of every instance read the
+// sequenced events they did not receive from the store.
+type Broker struct {
+	config    Config
+	mutex     sync.Mutex
+	closed    bool
+	devices   map[deviceKey]*device
+	lastSweep time.Time
+}
+
+// NewBroker creates a new Broker.
+func NewBroker(config Config) *Broker {
+	return &Broker{
+		config:    config.withDefaults(),
+		devices:   make(map[deviceKey]*device),
+		lastSweep: time.Now(),
+	}
+}
+
+// Config returns the effective configuration of the broker.
+func (b *Broker) Config() Config {
+	return b.config
+}
+
+// Subscribe subscribes to the events of a device. If after is set, the retained sequenced events
+// following it are returned to be sent before the events of the subscription.
+func (b *Broker) Subscribe(tenantID string, deviceID string, after *uint64) (*Subscription, []domain.Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	subscription := &Subscription{
+		key:    deviceKey{tenantID: tenantID, deviceID: deviceID},
+		events: make(chan domain.Event, b.config.Buffer),
+	}
+	if b.closed {
+		close(subscription.events)
+		return subscription, nil
+	}
+
+	entry := b.device(subscription.key)
+	entry.subscribers[subscription] = struct{}{}
+
+	var replay []domain.Event
+	if after != nil {
+		for _, event := range entry.history {
+			if sequence, _ := Sequence(event); sequence > *after {
+				replay = append(replay, event)
+			}
+		}
+	}
+	return subscription, replay
+}
+
+// Unsubscribe ends a subscription, it is safe to call more than once.
+func (b *Broker) Unsubscribe(subscription *Subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	entry, ok := b.devices[subscription.key]
+	if !ok {
+		return
+	}
+	if _, ok := entry.subscribers[subscription]; !ok {
+		return
+	}
+	b.remove(entry, subscription)
+}
+
+// Dropped reports whether the subscription was ended because it did not keep up with the events.
+func (b *Broker) Dropped(subscription *Subscription) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return subscription.dropped
+}
+
+// Publish sends an event to the subscribers of its device and retains it if it is sequenced.
+func (b *Broker) Publish(event domain.Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(b.lastSweep) >= b.config.HistoryTTL {
+		b.sweep(now)
+	}
+
+	key := deviceKey{tenantID: event.TenantID, deviceID: event.DeviceID}
+	entry, ok := b.devices[key]
+	if sequence, sequenced := Sequence(event); sequenced {
+		if !ok {
+			entry = b.device(key)
+		}
+		// concurrent signatures may be published out of order
+		index, _ := slices.BinarySearchFunc(entry.history, sequence, func(retained domain.Event, sequence uint64) int {
+			retainedSequence, _ := Sequence(retained)
+			switch {
+			case retainedSequence < sequence:
+				return -1
+			case retainedSequence > sequence:
+				return 1
+			}
+			return 0
+		})
+		entry.history = slices.Insert(entry.history, index, event)
+		if len(entry.history) > b.config.History {
+			entry.history = slices.Delete(entry.history, 0, len(entry.history)-b.config.History)
+		}
+		entry.updatedAt = now
+	} else if !ok {
+		return
+	}
+
+	for subscription := range entry.subscribers {
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.dropped = true
+			b.remove(entry, subscription)
+		}
+	}
+}
+
+// Close ends all subscriptions, events published afterwards are discarded.
+func (b *Broker) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, entry := range b.devices {
+		for subscription := range entry.subscribers {
+			close(subscription.events)
+		}
+	}
+	b.devices = nil
+}
+
+// device returns the entry of a device, creating it if needed.
+func (b *Broker) device(key deviceKey) *device {
+	entry, ok := b.devices[key]
+	if !ok {
+		entry = &device{subscribers: make(map[*Subscription]struct{}), updatedAt: time.Now()}
+		b.devices[key] = entry
+	}
+	return entry
+}
+
+// remove ends a subscription and forgets its device once nothing is left of it.
+func (b *Broker) remove(entry *device, subscription *Subscription) {
+	delete(entry.subscribers, subscription)
+	close(subscription.events)
+	if len(entry.subscribers) == 0 && len(entry.history) == 0 {
+		delete(b.devices, subscription.key)
+	}
+}
+
+// sweep forgets the history of devices without subscribers and recent signatures.
+func (b *Broker) sweep(now time.Time) {
+	for key, entry := range b.devices {
+		if len(entry.subscribers) == 0 && now.Sub(entry.updatedAt) >= b.config.HistoryTTL {
+			delete(b.devices, key)
+		}
+	}
+	b.lastSweep = now
+}
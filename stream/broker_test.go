@@ -0,0 +1,145 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+// counted is the data of a sequenced test event.
+type counted uint64
+
+func (c counted) Sequence() uint64 {
+	return uint64(c)
+}
+
+func signatureEvent(deviceID string, counter uint64) domain.Event {
+	return domain.NewEvent(domain.EventSignatureCreated, "acme", deviceID, counted(counter))
+}
+
+func sequences(t *testing.T, events []domain.Event) []uint64 {
+	t.Helper()
+	result := make([]uint64, len(events))
+	for i, event := range events {
+		sequence, ok := Sequence(event)
+		if !ok {
+			t.Fatalf("expected a sequenced event, got %v", event)
+		}
+		result[i] = sequence
+	}
+	return result
+}
+
+func TestBroker_PublishesToSubscribersOfTheDevice(t *testing.T) {
+	broker := NewBroker(Config{})
+	subscription, replay := broker.Subscribe("acme", "device", nil)
+	other, _ := broker.Subscribe("acme", "other", nil)
+	if len(replay) != 0 {
+		t.Fatalf("expected nothing to replay without a last sequence, got %v", replay)
+	}
+
+	broker.Publish(signatureEvent("device", 0))
+	broker.Publish(domain.NewEvent(domain.EventDeviceStateChanged, "acme", "device", nil))
+	broker.Publish(domain.NewEvent(domain.EventSignatureCreated, "globex", "device", counted(0)))
+
+	if event := <-subscription.Events(); event.Type != domain.EventSignatureCreated {
+		t.Fatalf("unexpected event %v", event)
+	}
+	if event := <-subscription.Events(); event.Type != domain.EventDeviceStateChanged {
+		t.Fatalf("unexpected event %v", event)
+	}
+	if len(subscription.Events()) != 0 || len(other.Events()) != 0 {
+		t.Fatalf("expected only the events of the subscribed device")
+	}
+
+	broker.Unsubscribe(subscription)
+	broker.Unsubscribe(subscription)
+	if _, ok := <-subscription.Events(); ok {
+		t.Fatalf("expected the events to be closed")
+	}
+}
+
+func TestBroker_ResumesFromHistory(t *testing.T) {
+	broker := NewBroker(Config{History: 3})
+	// concurrent signatures may be published out of order
+	for _, counter := range []uint64{0, 1, 3, 2, 4} {
+		broker.Publish(signatureEvent("device", counter))
+	}
+
+	after := uint64(2)
+	_, replay := broker.Subscribe("acme", "device", &after)
+	if got := sequences(t, replay); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Fatalf("expected signatures 3 and 4, got %v", got)
+	}
+	after = 0
+	_, replay = broker.Subscribe("acme", "device", &after)
+	if got := sequences(t, replay); len(got) != 3 || got[0] != 2 {
+		t.Fatalf("expected the 3 retained signatures, got %v", got)
+	}
+}
+
+func TestBroker_DropsSlowSubscribers(t *testing.T) {
+	broker := NewBroker(Config{Buffer: 2})
+	slow, _ := broker.Subscribe("acme", "device", nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for counter := uint64(0); counter < 10; counter++ {
+			broker.Publish(signatureEvent("device", counter))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected publishing not to block on a slow subscriber")
+	}
+
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	if received != 2 || !broker.Dropped(slow) {
+		t.Fatalf("expected the subscriber to be dropped after 2 events, got %d", received)
+	}
+
+	// the dropped subscriber resumes from the history
+	after := uint64(1)
+	_, replay := broker.Subscribe("acme", "device", &after)
+	if len(replay) != 8 {
+		t.Fatalf("expected 8 signatures to replay, got %d", len(replay))
+	}
+}
+
+func TestBroker_ForgetsExpiredHistory(t *testing.T) {
+	broker := NewBroker(Config{HistoryTTL: time.Millisecond})
+	broker.Publish(signatureEvent("device", 0))
+	broker.Publish(signatureEvent("device", 1))
+	time.Sleep(5 * time.Millisecond)
+	// publishing sweeps the expired history
+	broker.Publish(signatureEvent("other", 0))
+
+	var after uint64
+	_, replay := broker.Subscribe("acme", "device", &after)
+	if len(replay) != 0 {
+		t.Fatalf("expected the history to be expired, got %v", replay)
+	}
+}
+
+func TestBroker_Close(t *testing.T) {
+	broker := NewBroker(Config{})
+	subscription, _ := broker.Subscribe("acme", "device", nil)
+	broker.Close()
+	broker.Close()
+	broker.Publish(signatureEvent("device", 0))
+
+	if _, ok := <-subscription.Events(); ok {
+		t.Fatalf("expected the subscription to end")
+	}
+	late, _ := broker.Subscribe("acme", "device", nil)
+	if _, ok := <-late.Events(); ok {
+		t.Fatalf("expected subscriptions of a closed broker to end immediately")
+	}
+	broker.Unsubscribe(subscription)
+}
@@ -0,0 +1,200 @@
+package tracing
+
+import (
+	"context"
+	"io"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/ksrichard/signing-service-challenge/tracing"
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// End ends a span and records err on it, if any.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// InstrumentSigners decorates the signers created by the given functions with a span per signature.
+func InstrumentSigners(signers map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc) map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc {
+	instrumented := make(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc, len(signers))
+	for algorithm, create := range signers {
+		instrumented[algorithm] = func(privateKey []byte) (crypto.Signer, error) {
+			signer, err := create(privateKey)
+			if err != nil {
+				return nil, err
+			}
+			return &tracedSigner{signer: signer, algorithm: algorithm}, nil
+		}
+	}
+	return instrumented
+}
+
+type tracedSigner struct {
+	signer    crypto.Signer
+	algorithm crypto.SignatureAlgorithm
+}
+
+func (s *tracedSigner) Sign(ctx context.Context, dataToBeSigned []byte) ([]byte, error) {
+	ctx, span := tracer().Start(ctx, "Signer.Sign", trace.WithAttributes(
+		attribute.String("signature.algorithm", string(s.algorithm)),
+	))
+	signature, err := s.signer.Sign(ctx, dataToBeSigned)
+	End(span, err)
+	return signature, err
+}
+
+// InstrumentKeyGenerators decorates the given key generators with a span per key generation.
+func InstrumentKeyGenerators(generators map[crypto.SignatureAlgorithm]crypto.KeyGenerator) map[crypto.SignatureAlgorithm]crypto.KeyGenerator {
+	instrumented := make(map[crypto.SignatureAlgorithm]crypto.KeyGenerator, len(generators))
+	for algorithm, generator := range generators {
+		instrumented[algorithm] = &tracedKeyGenerator{generator: generator, algorithm: algorithm}
+	}
+	return instrumented
+}
+
+type tracedKeyGenerator struct {
+	generator crypto.KeyGenerator
+	algorithm crypto.SignatureAlgorithm
+}
+
+func (g *tracedKeyGenerator) GenerateKeyPair(ctx context.Context) ([]byte, []byte, error) {
+	ctx, span := tracer().Start(ctx, "KeyGenerator.GenerateKeyPair", trace.WithAttributes(
+		attribute.String("signature.algorithm", string(g.algorithm)),
+	))
+	public, private, err := g.generator.GenerateKeyPair(ctx)
+	End(span, err)
+	return public, private, err
+}
+
+// CheckCustody checks the key custody of the decorated generator.
+func (g *tracedKeyGenerator) CheckCustody(ctx context.Context) error {
+	return crypto.CheckCustody(ctx, g.generator)
+}
+
+// InstrumentStore decorates a signature device store with a span per operation.
+func InstrumentStore(store persistence.SignatureDeviceStore) persistence.SignatureDeviceStore {
+	return &tracedStore{store: store}
+}
+
+type tracedStore struct {
+	store persistence.SignatureDeviceStore
+}
+
+func (s *tracedStore) start(ctx context.Context, operation string, tenantID string, deviceID string) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{attribute.String("tenant.id", tenantID)}
+	if deviceID != "" {
+		attributes = append(attributes, attribute.String("device.id", deviceID))
+	}
+	return tracer().Start(ctx, "SignatureDeviceStore."+operation,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+}
+
+func (s *tracedStore) Add(ctx context.Context, device *domain.SignatureDevice, maxDevices int) error {
+	ctx, span := s.start(ctx, "Add", device.TenantID, device.GetIDStr())
+	err := s.store.Add(ctx, device, maxDevices)
+	End(span, err)
+	return err
+}
+
+func (s *tracedStore) Get(ctx context.Context, tenantID string, id string) (*domain.SignatureDevice, error) {
+	ctx, span := s.start(ctx, "Get", tenantID, id)
+	device, err := s.store.Get(ctx, tenantID, id)
+	End(span, err)
+	return device, err
+}
+
+func (s *tracedStore) List(ctx context.Context, tenantID string) ([]*domain.SignatureDevice, error) {
+	ctx, span := s.start(ctx, "List", tenantID, "")
+	devices, err := s.store.List(ctx, tenantID)
+	span.SetAttributes(attribute.Int("devices.count", len(devices)))
+	End(span, err)
+	return devices, err
+}
+
+func (s *tracedStore) CommitSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult) error {
+	ctx, span := s.start(ctx, "CommitSignature", device.TenantID, device.GetIDStr())
+	span.SetAttributes(attribute.Int64("signature.counter", int64(result.Counter)))
+	err := s.store.CommitSignature(ctx, device, result)
+	End(span, err)
+	return err
+}
+
+func (s *tracedStore) CommitSignatures(ctx context.Context, device *domain.SignatureDevice, results []domain.SignDataResult) error {
+	ctx, span := s.start(ctx, "CommitSignatures", device.TenantID, device.GetIDStr())
+	span.SetAttributes(attribute.Int("batch.size", len(results)))
+	if len(results) > 0 {
+		span.SetAttributes(attribute.Int64("signature.counter", int64(results[0].Counter)))
+	}
+	err := s.store.CommitSignatures(ctx, device, results)
+	End(span, err)
+	return err
+}
+
+func (s *tracedStore) CommitIdempotentSignature(ctx context.Context, device *domain.SignatureDevice, result domain.SignDataResult, record domain.IdempotencyRecord) error {
+	ctx, span := s.start(ctx, "CommitIdempotentSignature", device.TenantID, device.GetIDStr())
+	span.SetAttributes(attribute.Int64("signature.counter", int64(result.Counter)))
+	err := s.store.CommitIdempotentSignature(ctx, device, result, record)
+	End(span, err)
+	return err
+}
+
+func (s *tracedStore) GetIdempotencyRecord(ctx context.Context, tenantID string, id string, key string) (*domain.IdempotencyRecord, error) {
+	ctx, span := s.start(ctx, "GetIdempotencyRecord", tenantID, id)
+	record, err := s.store.GetIdempotencyRecord(ctx, tenantID, id, key)
+	span.SetAttributes(attribute.Bool("idempotency.found", record != nil))
+	End(span, err)
+	return record, err
+}
+
+func (s *tracedStore) ListSignatures(ctx context.Context, tenantID string, id string, from uint64, limit int) ([]domain.SignDataResult, error) {
+	ctx, span := s.start(ctx, "ListSignatures", tenantID, id)
+	signatures, err := s.store.ListSignatures(ctx, tenantID, id, from, limit)
+	span.SetAttributes(attribute.Int("signatures.count", len(signatures)))
+	End(span, err)
+	return signatures, err
+}
+
+func (s *tracedStore) SetState(ctx context.Context, tenantID string, id string, state domain.DeviceState) (*domain.SignatureDevice, error) {
+	ctx, span := s.start(ctx, "SetState", tenantID, id)
+	span.SetAttributes(attribute.String("device.state", string(state)))
+	device, err := s.store.SetState(ctx, tenantID, id, state)
+	End(span, err)
+	return device, err
+}
+
+func (s *tracedStore) RotateKey(ctx context.Context, rotated *domain.SignatureDevice) error {
+	ctx, span := s.start(ctx, "RotateKey", rotated.TenantID, rotated.GetIDStr())
+	span.SetAttributes(attribute.Int64("device.key_version", int64(rotated.KeyVersion())))
+	err := s.store.RotateKey(ctx, rotated)
+	End(span, err)
+	return err
+}
+
+func (s *tracedStore) Ping(ctx context.Context) error {
+	ctx, span := tracer().Start(ctx, "SignatureDeviceStore.Ping", trace.WithSpanKind(trace.SpanKindClient))
+	err := s.store.Ping(ctx)
+	End(span, err)
+	return err
+}
+
+// Close closes the decorated store if it holds resources.
+func (s *tracedStore) Close() error {
+	if closer, ok := s.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	// ExporterNone records no spans, but trace contexts are still propagated.
+	ExporterNone = "none"
+	// ExporterStdout writes spans as JSON to stdout.
+	ExporterStdout = "stdout"
+	// ExporterFile appends spans as JSON to a file, e.g. to inspect traces offline.
+	ExporterFile = "file"
+	// ExporterOTLP sends spans to an OpenTelemetry collector over OTLP/HTTP.
+	ExporterOTLP = "otlp"
+
+	// DefaultServiceName is the service name of the exported spans.
+	DefaultServiceName = "signing-service"
+)
+
+// Config configures how spans are exported.
+type Config struct {
+	// Exporter is ExporterNone, ExporterStdout, ExporterFile or ExporterOTLP.
+	Exporter string
+	// File is the file spans are appended to by ExporterFile.
+	File string
+	// Endpoint is the host:port of the collector for ExporterOTLP.
+	Endpoint string
+	// Insecure sends spans to the collector without TLS.
+	Insecure bool
+	// SampleRatio is the fraction of new traces which are sampled, traces continued from callers follow their decision.
+	SampleRatio float64
+	// ServiceName is the service name of the spans, DefaultServiceName if empty.
+	ServiceName string
+}
+
+// NewExporter creates the span exporter of the configuration, nil for ExporterNone.
+func NewExporter(ctx context.Context, config Config) (sdktrace.SpanExporter, error) {
+	switch config.Exporter {
+	case ExporterNone, "":
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &fileExporter{SpanExporter: exporter, file: file}, nil
+	case ExporterOTLP:
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.Endpoint)}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, options...)
+	}
+	return nil, fmt.Errorf("unknown trace exporter %q", config.Exporter)
+}
+
+// fileExporter closes its file once the exporter is shut down.
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.file.Close())
+}
+
+// Setup installs the global tracer provider exporting to the given exporter (nil records no spans)
+// and the W3C trace context and baggage propagators.
+// The returned function flushes the pending spans and has to be called on shutdown.
+func Setup(exporter sdktrace.SpanExporter, config Config) func(ctx context.Context) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if exporter == nil {
+		return func(ctx context.Context) error { return nil }
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown
+}
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ksrichard/signing-service-challenge/crypto"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// helper to record all spans of the global tracer provider during a test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestInstrumentedSigning(t *testing.T) {
+	recorder := recordSpans(t)
+	signerStore := crypto.NewSignerStore(InstrumentSigners(map[crypto.SignatureAlgorithm]crypto.SignerCreateFunc{
+		crypto.ECC: func(privateKey []byte) (crypto.Signer, error) { return crypto.NewECCSigner(privateKey) },
+	}))
+	generatorStore := crypto.NewKeyGeneratorStore(InstrumentKeyGenerators(map[crypto.SignatureAlgorithm]crypto.KeyGenerator{
+		crypto.ECC: &crypto.ECCGenerator{},
+	}))
+	store := InstrumentStore(persistence.NewInMemorySignatureDeviceStore())
+
+	ctx, root := otel.Tracer("test").Start(context.Background(), "root")
+	device, err := domain.NewSignatureDevice(ctx, &generatorStore, &signerStore, domain.DefaultTenantID, crypto.ECC, "traced")
+	if err != nil {
+		t.Fatalf("NewSignatureDevice error: %v", err)
+	}
+	if err := store.Add(ctx, device, 0); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	if _, err := persistence.SignData(ctx, store, domain.DefaultTenantID, device.GetIDStr(), "data"); err != nil {
+		t.Fatalf("SignData error: %v", err)
+	}
+	root.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		if span.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Fatalf("span %s is not part of the trace", span.Name())
+		}
+	}
+	for _, name := range []string{"KeyGenerator.GenerateKeyPair", "SignatureDeviceStore.Add", "persistence.SignData",
+		"SignatureDeviceStore.Get", "SignatureDevice.SignDataAt", "Signer.Sign", "SignatureDeviceStore.CommitSignature"} {
+		if _, ok := spans[name]; !ok {
+			t.Fatalf("expected span %s, got %v", name, recorder.Ended())
+		}
+	}
+	// the signature is a child of the device signing, which is a child of the transaction
+	if spans["Signer.Sign"].Parent().SpanID() != spans["SignatureDevice.SignDataAt"].SpanContext().SpanID() {
+		t.Fatalf("Signer.Sign is not a child of SignatureDevice.SignDataAt")
+	}
+	if spans["SignatureDevice.SignDataAt"].Parent().SpanID() != spans["persistence.SignData"].SpanContext().SpanID() {
+		t.Fatalf("SignatureDevice.SignDataAt is not a child of persistence.SignData")
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	config := Config{Exporter: ExporterFile, File: path, SampleRatio: 1}
+	exporter, err := NewExporter(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewExporter error: %v", err)
+	}
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	shutdown := Setup(exporter, config)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "offline span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read spans: %v", err)
+	}
+	if !strings.Contains(string(data), `"Name":"offline span"`) || !strings.Contains(string(data), DefaultServiceName) {
+		t.Fatalf("expected exported span in file, got %s", data)
+	}
+
+	if _, err := NewExporter(context.Background(), Config{Exporter: "zipkin"}); err == nil {
+		t.Fatalf("expected error for unknown exporter")
+	}
+}
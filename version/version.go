@@ -0,0 +1,41 @@
+// Package version provides the build information of the service.
+package version
+
+import (
+	"runtime/debug"
+)
+
+// Version and Commit are set at build time, e.g.
+// go build -ldflags "-X github.com/ksrichard/signing-service-challenge/version.Version=1.2.0 -X github.com/ksrichard/signing-service-challenge/version.Commit=$(git rev-parse HEAD)"
+var (
+	Version = ""
+	Commit  = ""
+)
+
+// Info describes the running build.
+type Info struct {
+	// Version is the release version, "dev" for builds without one.
+	Version string
+	// Commit is the VCS revision the service was built from, empty if unknown.
+	Commit string
+}
+
+// Get returns the build information, falling back to the information embedded by the Go toolchain
+// for the values which were not set at build time.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" && info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
@@ -0,0 +1,16 @@
+package version
+
+import "testing"
+
+func TestGet(t *testing.T) {
+	if info := Get(); info.Version == "" {
+		t.Fatalf("expected a version without build time values, got %+v", info)
+	}
+
+	Version, Commit = "1.2.0", "abc123"
+	t.Cleanup(func() { Version, Commit = "", "" })
+	info := Get()
+	if info.Version != "1.2.0" || info.Commit != "abc123" {
+		t.Fatalf("expected the build time values, got %+v", info)
+	}
+}
@@ -0,0 +1,473 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+const (
+	DefaultMaxAttempts    = 8
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 10 * time.Minute
+	DefaultTimeout        = 10 * time.Second
+	DefaultWorkers        = 4
+	DefaultQueueSize      = 1024
+
+	// maxResponseBytes is how much of a response body is read, e.g. to report it in a dead letter.
+	maxResponseBytes = 1 << 10
+	userAgent        = "signing-service-webhooks"
+)
+
+var (
+	ErrDispatcherClosed = errors.New("webhook dispatcher is closed")
+	ErrQueueFull        = errors.New("webhook delivery queue is full")
+)
+
+// Config configures the deliveries of a Dispatcher, zero values are replaced by the defaults.
+type Config struct {
+	// MaxAttempts is how many times a delivery is attempted before it becomes a dead letter.
+	MaxAttempts int
+	// InitialBackoff is the pause after the first failed attempt, it doubles with every further attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the pause between two attempts.
+	MaxBackoff time.Duration
+	// Timeout bounds a single attempt.
+	Timeout time.Duration
+	// Workers is the number of concurrent deliveries.
+	Workers int
+	// QueueSize is the number of events and deliveries waiting for a worker, as well as the number of events which
+	// did not fit into the queue waiting to be kept as dead letters.
+	QueueSize int
+}
+
+// withDefaults returns the config with every zero value replaced by its default.
+func (c Config) withDefaults() Config {
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = DefaultMaxAttempts
+	}
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = DefaultInitialBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = DefaultMaxBackoff
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Workers == 0 {
+		c.Workers = DefaultWorkers
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+	return c
+}
+
+// backoff returns the pause after the given number of failed attempts.
+func (c Config) backoff(attempts int) time.Duration {
+	backoff := c.InitialBackoff
+	for i := 1; i < attempts && backoff < c.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, c.MaxBackoff)
+}
+
+type Params struct {
+	Endpoints persistence.WebhookStore
+	// DeadLetters keeps the deliveries which failed every attempt, if nil an in-memory store is used.
+	DeadLetters persistence.DeadLetterStore
+	// Client sends the deliveries, if nil http.DefaultClient is used. Attempts are bounded by Config.Timeout.
+	Client *http.Client
+	Config Config
+	// Logger receives the failed deliveries, if nil slog.Default() is used.
+	Logger *slog.Logger
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	ID        string           `json:"id"`
+	Type      domain.EventType `json:"type"`
+	Timestamp time.Time        `json:"timestamp"`
+	TenantID  string           `json:"tenantId"`
+	DeviceID  string           `json:"deviceId"`
+	Data      any              `json:"data"`
+}
+
+// delivery is the notification of one endpoint about one event.
+type delivery struct {
+	// id identifies the delivery towards the endpoint, it is kept across attempts and replays,
+	// so endpoints can drop duplicates.
+	id         string
+	tenantID   string
+	endpointID string
+	eventID    string
+	eventType  domain.EventType
+	payload    []byte
+	attempts   int
+	lastError  string
+}
+
+// Dispatcher notifies the webhook endpoints of the tenants of their events.
+// Events are delivered in the background, failed deliveries are retried with an exponential backoff
+// and kept as dead letters after the last attempt, from where they can be replayed.
+type Dispatcher struct {
+	endpoints   persistence.WebhookStore
+	deadLetters persistence.DeadLetterStore
+	client      *http.Client
+	config      Config
+	logger      *slog.Logger
+	events      chan domain.Event
+	deliveries  chan *delivery
+	// overflow holds the events which did not fit into events until they are kept as dead letters in the background
+	overflow   chan domain.Event
+	overflowed sync.WaitGroup
+	// dropped counts the events which were neither queued nor kept as dead letters
+	dropped atomic.Uint64
+	done    chan struct{}
+	workers sync.WaitGroup
+	// mutex guards closed, it is held for reading while enqueueing so nothing is queued once Close drained the queues
+	mutex      sync.RWMutex
+	closed     bool
+	retryMutex sync.Mutex
+	retries    map[*delivery]*time.Timer
+}
+
+// NewDispatcher creates a new Dispatcher and starts its workers.
+func NewDispatcher(params Params) *Dispatcher {
+	deadLetters := params.DeadLetters
+	if deadLetters == nil {
+		deadLetters = persistence.NewInMemoryDeadLetterStore()
+	}
+	client := params.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	logger := params.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	config := params.Config.withDefaults()
+
+	d := &Dispatcher{
+		endpoints:   params.Endpoints,
+		deadLetters: deadLetters,
+		client:      client,
+		config:      config,
+		logger:      logger,
+		events:      make(chan domain.Event, config.QueueSize),
+		deliveries:  make(chan *delivery, config.QueueSize),
+		overflow:    make(chan domain.Event, config.QueueSize),
+		done:        make(chan struct{}),
+		retries:     make(map[*delivery]*time.Timer),
+	}
+	for i := 0; i < config.Workers; i++ {
+		d.workers.Add(1)
+		go d.work()
+	}
+	d.overflowed.Add(1)
+	go d.deadLetterOverflow()
+	return d
+}
+
+// Publish queues the event for the endpoints of its tenant without blocking.
+// If the queue is full, the deliveries of the event become dead letters in the background. Events which can not be
+// handed over to the background either, or which are published after Close, are dropped and counted (see Dropped).
+func (d *Dispatcher) Publish(event domain.Event) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	reason := ErrDispatcherClosed
+	if !d.closed {
+		select {
+		case d.events <- event:
+			return
+		default:
+		}
+		select {
+		case d.overflow <- event:
+			return
+		default:
+			reason = ErrQueueFull
+		}
+	}
+	d.dropped.Add(1)
+	d.logger.Warn("webhook event dropped", "tenant_id", event.TenantID, "event_id", event.ID, "reason", reason)
+}
+
+// Dropped returns the number of events which were neither delivered nor kept as dead letters.
+func (d *Dispatcher) Dropped() uint64 {
+	return d.dropped.Load()
+}
+
+// Replay delivers a dead letter again, with a new set of attempts. The dead letter is removed once it is queued,
+// it fails with ErrQueueFull or ErrDispatcherClosed if it could not be queued.
+func (d *Dispatcher) Replay(ctx context.Context, tenantID string, id string) error {
+	letter, err := d.deadLetters.Get(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := d.endpoints.Get(ctx, tenantID, letter.EndpointID); err != nil {
+		return err
+	}
+	if err := d.deadLetters.Delete(ctx, tenantID, id); err != nil {
+		return err
+	}
+
+	entry := &delivery{
+		id:         letter.ID,
+		tenantID:   letter.TenantID,
+		endpointID: letter.EndpointID,
+		eventID:    letter.EventID,
+		eventType:  letter.EventType,
+		payload:    letter.Payload,
+	}
+	// a replay which could not be queued is kept as dead letter again
+	return d.enqueue(entry)
+}
+
+// Close stops the workers once their current attempts are finished. Queued events and deliveries
+// as well as the pending retries become dead letters, nothing is dropped silently.
+func (d *Dispatcher) Close() error {
+	d.mutex.Lock()
+	if d.closed {
+		d.mutex.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.done)
+	close(d.overflow)
+	d.mutex.Unlock()
+	d.overflowed.Wait()
+
+	// retries which already fired become dead letters when they try to enqueue
+	d.retryMutex.Lock()
+	for entry, timer := range d.retries {
+		if timer.Stop() {
+			entry.lastError = "dispatcher closed before the next attempt: " + entry.lastError
+			d.deadLetter(entry)
+		}
+	}
+	d.retries = nil
+	d.retryMutex.Unlock()
+
+	d.workers.Wait()
+	for {
+		select {
+		case event := <-d.events:
+			d.deadLetterEvent(event, ErrDispatcherClosed.Error())
+		case entry := <-d.deliveries:
+			entry.lastError = "dispatcher closed before the next attempt: " + entry.lastError
+			d.deadLetter(entry)
+		default:
+			return nil
+		}
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case event := <-d.events:
+			for _, entry := range d.fanOut(event) {
+				d.attempt(entry)
+			}
+		case entry := <-d.deliveries:
+			d.attempt(entry)
+		}
+	}
+}
+
+// fanOut creates the deliveries of the event to the endpoints of its tenant which subscribed to its type.
+func (d *Dispatcher) fanOut(event domain.Event) []*delivery {
+	endpoints, err := d.endpoints.List(context.Background(), event.TenantID)
+	if err != nil {
+		d.logger.Error("unable to list webhook endpoints", "tenant_id", event.TenantID, "event_id", event.ID, "error", err)
+		return nil
+	}
+
+	var deliveries []*delivery
+	var payload []byte
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribes(event.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(newPayload(event)); err != nil {
+				d.logger.Error("unable to encode webhook payload", "event_id", event.ID, "error", err)
+				return nil
+			}
+		}
+		deliveries = append(deliveries, &delivery{
+			id:         strings.ReplaceAll(uuid.New().String(), "-", ""),
+			tenantID:   event.TenantID,
+			endpointID: endpoint.ID,
+			eventID:    event.ID,
+			eventType:  event.Type,
+			payload:    payload,
+		})
+	}
+	return deliveries
+}
+
+// attempt sends the delivery once and schedules the next attempt if it failed.
+func (d *Dispatcher) attempt(entry *delivery) {
+	endpoint, err := d.endpoints.Get(context.Background(), entry.tenantID, entry.endpointID)
+	if errors.Is(err, persistence.ErrWebhookNotFound) {
+		// the endpoint was deleted in the meantime, nobody is waiting for the delivery anymore
+		return
+	}
+	if err == nil {
+		err = d.send(endpoint, entry)
+	}
+	entry.attempts++
+	if err == nil {
+		return
+	}
+	entry.lastError = err.Error()
+
+	if entry.attempts >= d.config.MaxAttempts {
+		d.logger.Warn("webhook delivery failed, keeping it as dead letter", "tenant_id", entry.tenantID,
+			"endpoint_id", entry.endpointID, "event_id", entry.eventID, "attempts", entry.attempts, "error", err)
+		d.deadLetter(entry)
+		return
+	}
+	d.retry(entry)
+}
+
+// send posts the signed payload of the delivery to the endpoint, any status other than 2xx is a failure.
+func (d *Dispatcher) send(endpoint *domain.WebhookEndpoint, entry *delivery) error {
+	now := time.Now()
+	signature, err := Sign(endpoint.Secret, entry.id, now, entry.payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.Timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, strings.NewReader(string(entry.payload)))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set(HeaderID, entry.id)
+	request.Header.Set(HeaderTimestamp, fmt.Sprint(now.Unix()))
+	request.Header.Set(HeaderSignature, signature)
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxResponseBytes))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("endpoint responded with %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// retry queues the delivery again once its backoff passed.
+func (d *Dispatcher) retry(entry *delivery) {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	if d.retries == nil {
+		entry.lastError = "dispatcher closed before the next attempt: " + entry.lastError
+		d.deadLetter(entry)
+		return
+	}
+	d.retries[entry] = time.AfterFunc(d.config.backoff(entry.attempts), func() {
+		d.retryMutex.Lock()
+		delete(d.retries, entry)
+		d.retryMutex.Unlock()
+		d.enqueue(entry)
+	})
+}
+
+// enqueue queues the delivery without blocking, if it can not be queued it becomes a dead letter.
+func (d *Dispatcher) enqueue(entry *delivery) error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	err := ErrDispatcherClosed
+	if !d.closed {
+		select {
+		case d.deliveries <- entry:
+			return nil
+		default:
+			err = ErrQueueFull
+		}
+	}
+	if entry.lastError != "" {
+		entry.lastError = err.Error() + ": " + entry.lastError
+	} else {
+		entry.lastError = err.Error()
+	}
+	d.deadLetter(entry)
+	return err
+}
+
+// deadLetterOverflow keeps the deliveries of the events which did not fit into the queue as dead letters,
+// until Close closes the overflow.
+func (d *Dispatcher) deadLetterOverflow() {
+	defer d.overflowed.Done()
+	for event := range d.overflow {
+		d.deadLetterEvent(event, ErrQueueFull.Error())
+	}
+}
+
+// deadLetterEvent keeps the deliveries of an event which could not be queued as dead letters.
+func (d *Dispatcher) deadLetterEvent(event domain.Event, reason string) {
+	d.logger.Warn("webhook event not queued", "tenant_id", event.TenantID, "event_id", event.ID, "reason", reason)
+	for _, entry := range d.fanOut(event) {
+		entry.lastError = reason
+		d.deadLetter(entry)
+	}
+}
+
+func (d *Dispatcher) deadLetter(entry *delivery) {
+	endpointURL := ""
+	if endpoint, err := d.endpoints.Get(context.Background(), entry.tenantID, entry.endpointID); err == nil {
+		endpointURL = endpoint.URL
+	}
+	err := d.deadLetters.Add(context.Background(), &domain.DeadLetter{
+		ID:         entry.id,
+		TenantID:   entry.tenantID,
+		EndpointID: entry.endpointID,
+		URL:        endpointURL,
+		EventID:    entry.eventID,
+		EventType:  entry.eventType,
+		Payload:    entry.payload,
+		Attempts:   entry.attempts,
+		LastError:  entry.lastError,
+		FailedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		d.logger.Error("unable to keep webhook dead letter", "tenant_id", entry.tenantID,
+			"endpoint_id", entry.endpointID, "event_id", entry.eventID, "error", err)
+	}
+}
+
+func newPayload(event domain.Event) Payload {
+	return Payload{
+		ID:        event.ID,
+		Type:      event.Type,
+		Timestamp: event.Time,
+		TenantID:  event.TenantID,
+		DeviceID:  event.DeviceID,
+		Data:      event.Data,
+	}
+}
@@ -0,0 +1,257 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+	"github.com/ksrichard/signing-service-challenge/persistence"
+)
+
+// receiver is a webhook endpoint which fails the first failures deliveries and records the others.
+type receiver struct {
+	sync.Mutex
+	failures  int
+	attempts  int
+	delivered []*http.Request
+	payloads  [][]byte
+	received  chan struct{}
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.Lock()
+	defer r.Unlock()
+	r.attempts++
+	if r.attempts <= r.failures {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	r.delivered = append(r.delivered, req)
+	r.payloads = append(r.payloads, body)
+	r.received <- struct{}{}
+}
+
+// helper to create a dispatcher delivering to an HTTPS test server with the given number of initial failures
+func newTestDispatcher(t *testing.T, failures int, config Config) (*Dispatcher, *domain.WebhookEndpoint, *receiver, persistence.DeadLetterStore) {
+	t.Helper()
+	rec := &receiver{failures: failures, received: make(chan struct{}, 16)}
+	server := httptest.NewTLSServer(rec)
+	t.Cleanup(server.Close)
+
+	endpoints := persistence.NewInMemoryWebhookStore()
+	endpoint, err := domain.NewWebhookEndpoint("acme", server.URL, []domain.EventType{domain.EventSignatureCreated})
+	if err != nil {
+		t.Fatalf("NewWebhookEndpoint error: %v", err)
+	}
+	if err := endpoints.Add(context.Background(), endpoint); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	deadLetters := persistence.NewInMemoryDeadLetterStore()
+	dispatcher := NewDispatcher(Params{
+		Endpoints:   endpoints,
+		DeadLetters: deadLetters,
+		Client:      server.Client(),
+		Config:      config,
+	})
+	t.Cleanup(func() { dispatcher.Close() })
+	return dispatcher, endpoint, rec, deadLetters
+}
+
+func waitReceived(t *testing.T, rec *receiver) {
+	t.Helper()
+	select {
+	case <-rec.received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("delivery was not received")
+	}
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	dispatcher, endpoint, rec, _ := newTestDispatcher(t, 2, Config{InitialBackoff: time.Millisecond})
+
+	// the endpoint did not subscribe to device.created
+	dispatcher.Publish(domain.NewEvent(domain.EventDeviceCreated, "acme", "device", nil))
+	event := domain.NewEvent(domain.EventSignatureCreated, "acme", "device", map[string]any{"counter": 7})
+	dispatcher.Publish(event)
+	waitReceived(t, rec)
+
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.attempts != 3 || len(rec.delivered) != 1 {
+		t.Fatalf("expected one delivery after two failed attempts, got %d attempts and %d deliveries", rec.attempts, len(rec.delivered))
+	}
+	if err := Verify(endpoint.Secret, rec.delivered[0].Header, rec.payloads[0], time.Minute); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+	var payload struct {
+		ID   string           `json:"id"`
+		Type domain.EventType `json:"type"`
+		Data struct {
+			Counter int `json:"counter"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.payloads[0], &payload); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if payload.ID != event.ID || payload.Type != domain.EventSignatureCreated || payload.Data.Counter != 7 {
+		t.Fatalf("unexpected payload: %s", rec.payloads[0])
+	}
+}
+
+func TestDispatcher_DeadLetterAndReplay(t *testing.T) {
+	dispatcher, _, rec, deadLetters := newTestDispatcher(t, 3, Config{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	dispatcher.Publish(domain.NewEvent(domain.EventSignatureCreated, "acme", "device", nil))
+	var letters []*domain.DeadLetter
+	for deadline := time.Now().Add(5 * time.Second); len(letters) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery did not become a dead letter")
+		}
+		time.Sleep(5 * time.Millisecond)
+		letters, _ = deadLetters.List(context.Background(), "acme")
+	}
+	letter := letters[0]
+	if letter.Attempts != 3 || letter.EventType != domain.EventSignatureCreated || letter.LastError == "" {
+		t.Fatalf("unexpected dead letter: %+v", letter)
+	}
+
+	if err := dispatcher.Replay(context.Background(), "globex", letter.ID); !errors.Is(err, persistence.ErrDeadLetterNotFound) {
+		t.Fatalf("other tenant must not replay the dead letter, got %v", err)
+	}
+	if err := dispatcher.Replay(context.Background(), "acme", letter.ID); err != nil {
+		t.Fatalf("Replay error: %v", err)
+	}
+	waitReceived(t, rec)
+	rec.Lock()
+	defer rec.Unlock()
+	if got := rec.delivered[0].Header.Get(HeaderID); got != letter.ID {
+		t.Fatalf("expected the replay to keep the delivery ID %q, got %q", letter.ID, got)
+	}
+	if letters, _ := deadLetters.List(context.Background(), "acme"); len(letters) != 0 {
+		t.Fatalf("expected the replayed dead letter to be removed, got %d", len(letters))
+	}
+}
+
+func TestDispatcher_CloseKeepsPendingRetries(t *testing.T) {
+	dispatcher, _, rec, deadLetters := newTestDispatcher(t, 1, Config{InitialBackoff: time.Hour})
+
+	dispatcher.Publish(domain.NewEvent(domain.EventSignatureCreated, "acme", "device", nil))
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		rec.Lock()
+		attempts := rec.attempts
+		rec.Unlock()
+		if attempts == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery was not attempted")
+		}
+	}
+	// wait for the retry to be scheduled
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		dispatcher.retryMutex.Lock()
+		pending := len(dispatcher.retries)
+		dispatcher.retryMutex.Unlock()
+		if pending == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("retry was not scheduled")
+		}
+	}
+
+	if err := dispatcher.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	letters, _ := deadLetters.List(context.Background(), "acme")
+	if len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Fatalf("expected the pending retry as dead letter, got %+v", letters)
+	}
+
+	// events published after closing are counted as dropped
+	dispatcher.Publish(domain.NewEvent(domain.EventSignatureCreated, "acme", "device", nil))
+	if letters, _ := deadLetters.List(context.Background(), "acme"); len(letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(letters))
+	}
+	if dropped := dispatcher.Dropped(); dropped != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", dropped)
+	}
+}
+
+// gatedEndpoints is a webhook store whose List blocks until gate is closed.
+type gatedEndpoints struct {
+	persistence.WebhookStore
+	gate chan struct{}
+}
+
+func (s *gatedEndpoints) List(ctx context.Context, tenantID string) ([]*domain.WebhookEndpoint, error) {
+	<-s.gate
+	return s.WebhookStore.List(ctx, tenantID)
+}
+
+func TestDispatcher_PublishDoesNotBlockOnOverflow(t *testing.T) {
+	endpoints := &gatedEndpoints{WebhookStore: persistence.NewInMemoryWebhookStore(), gate: make(chan struct{})}
+	endpoint, err := domain.NewWebhookEndpoint("acme", "https://127.0.0.1:1/hook", []domain.EventType{domain.EventSignatureCreated})
+	if err != nil {
+		t.Fatalf("NewWebhookEndpoint error: %v", err)
+	}
+	if err := endpoints.Add(context.Background(), endpoint); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	deadLetters := persistence.NewInMemoryDeadLetterStore()
+	dispatcher := NewDispatcher(Params{
+		Endpoints:   endpoints,
+		DeadLetters: deadLetters,
+		Config:      Config{Workers: 1, QueueSize: 1, MaxAttempts: 1},
+	})
+
+	// the worker and the overflow are stuck listing the endpoints, publishing must return anyway
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			dispatcher.Publish(domain.NewEvent(domain.EventSignatureCreated, "acme", "device", nil))
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Publish blocked on a full queue")
+	}
+	// at most one event each is listed by the worker and the overflow, queued and waiting in the overflow
+	if dropped := dispatcher.Dropped(); dropped < 6 {
+		t.Fatalf("expected at least 6 dropped events, got %d", dropped)
+	}
+
+	close(endpoints.gate)
+	if err := dispatcher.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	letters, _ := deadLetters.List(context.Background(), "acme")
+	overflowed := 0
+	for _, letter := range letters {
+		if letter.LastError == ErrQueueFull.Error() {
+			overflowed++
+		}
+	}
+	if overflowed == 0 {
+		t.Fatalf("expected the overflowing events as dead letters, got %+v", letters)
+	}
+}
+
+func TestConfig_Backoff(t *testing.T) {
+	config := Config{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 40: 5 * time.Second} {
+		if got := config.backoff(attempts); got != want {
+			t.Fatalf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The headers of a delivery, following the Standard Webhooks specification (https://www.standardwebhooks.com).
+const (
+	HeaderID        = "webhook-id"
+	HeaderTimestamp = "webhook-timestamp"
+	HeaderSignature = "webhook-signature"
+
+	// signatureVersion prefixes the HMAC-SHA256 signatures in the signature header.
+	signatureVersion = "v1"
+	// secretPrefix prefixes the base64 encoded key of a secret.
+	secretPrefix = "whsec_"
+)
+
+var (
+	ErrInvalidSecret    = errors.New("invalid webhook secret")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidTimestamp = errors.New("webhook timestamp is outside of the tolerance")
+)
+
+// Sign returns the value of the signature header of a delivery: the HMAC-SHA256 of
+// "<id>.<unix timestamp>.<payload>" keyed with the secret, in the form of "v1,<base64 signature>".
+func Sign(secret string, id string, timestamp time.Time, payload []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, secretPrefix))
+	if err != nil || len(key) == 0 {
+		return "", ErrInvalidSecret
+	}
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s.%d.", id, timestamp.Unix())
+	mac.Write(payload)
+	return signatureVersion + "," + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Verify checks the signature headers of a delivery against its payload, as receivers of deliveries do.
+// Deliveries signed more than tolerance away from now are rejected to prevent replays.
+func Verify(secret string, header http.Header, payload []byte, tolerance time.Duration) error {
+	seconds, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	timestamp := time.Unix(seconds, 0)
+	if age := time.Since(timestamp); age > tolerance || age < -tolerance {
+		return ErrInvalidTimestamp
+	}
+
+	expected, err := Sign(secret, header.Get(HeaderID), timestamp, payload)
+	if err != nil {
+		return err
+	}
+	// the header may carry several space separated signatures, e.g. while secrets are rotated
+	for _, signature := range strings.Fields(header.Get(HeaderSignature)) {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
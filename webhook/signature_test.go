@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ksrichard/signing-service-challenge/domain"
+)
+
+func TestSignVerify(t *testing.T) {
+	endpoint, err := domain.NewWebhookEndpoint("acme", "https://example.com/hook", nil)
+	if err != nil {
+		t.Fatalf("NewWebhookEndpoint error: %v", err)
+	}
+	payload := []byte(`{"type":"signature.created"}`)
+	now := time.Now()
+	signature, err := Sign(endpoint.Secret, "msg_1", now, payload)
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set(HeaderID, "msg_1")
+	header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	header.Set(HeaderSignature, "v1,bm9wZQ== "+signature)
+	if err := Verify(endpoint.Secret, header, payload, time.Minute); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	if err := Verify(endpoint.Secret, header, []byte(`{"type":"device.created"}`), time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature for a tampered payload, got %v", err)
+	}
+	other, _ := domain.NewWebhookEndpoint("acme", "https://example.com/hook", nil)
+	if err := Verify(other.Secret, header, payload, time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature for another secret, got %v", err)
+	}
+	header.Set(HeaderTimestamp, strconv.FormatInt(now.Add(-time.Hour).Unix(), 10))
+	if err := Verify(endpoint.Secret, header, payload, time.Minute); !errors.Is(err, ErrInvalidTimestamp) {
+		t.Fatalf("expected ErrInvalidTimestamp for an old delivery, got %v", err)
+	}
+	if _, err := Sign("whsec_%%%", "msg_1", now, payload); !errors.Is(err, ErrInvalidSecret) {
+		t.Fatalf("expected ErrInvalidSecret, got %v", err)
+	}
+}